@@ -0,0 +1,66 @@
+package witnesscalc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrABINotSupported is the error, tested with errors.Is, of the calculators
+// given a WitnessCalc WASM module of the circom version they don't support,
+// see ABIError.
+var ErrABINotSupported = errors.New("WitnessCalc module ABI not supported")
+
+// ABIError is the error of the calculators given a WitnessCalc WASM module of
+// the circom version they don't support, e.g. a circom 2 module loaded with
+// LoadWitnessCalculator, naming the constructor that supports it.
+type ABIError struct {
+	// Circom is the major version of the circom that produced the module,
+	// detected from its exports.
+	Circom int
+	// Constructor is the constructor of the calculator of the module.
+	Constructor string
+}
+
+// Error returns the detected circom version and the constructor to use.
+func (e *ABIError) Error() string {
+	return fmt.Sprintf("%v: the module was produced by circom %d, load it with %s or NewAutoWitnessCalculator",
+		ErrABINotSupported, e.Circom, e.Constructor)
+}
+
+// Is reports whether target is ErrABINotSupported.
+func (e *ABIError) Is(target error) bool {
+	return target == ErrABINotSupported
+}
+
+// newABIError returns the ABIError of a module produced by circom 2 if
+// circom2 is true, by circom 1 otherwise.
+func newABIError(circom2 bool) *ABIError {
+	if circom2 {
+		return &ABIError{Circom: 2, Constructor: "NewCircom2WitnessCalculator"}
+	}
+	return &ABIError{Circom: 1, Constructor: "LoadWitnessCalculator"}
+}
+
+// checkModuleABI returns an ABIError if the module wasmBytes was produced by
+// circom 1 when circom2 is true, or by circom 2 otherwise.  The modules of
+// neither, which don't export getFrLen nor getVersion, are left to fail
+// loading with their own errors.
+func checkModuleABI(wasmBytes []byte, circom2 bool) error {
+	exports, err := parseWASMExports(wasmBytes)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isCircom2Module(exports):
+		if !circom2 {
+			return newABIError(true)
+		}
+	case circom2:
+		for _, exp := range exports {
+			if exp.Name == "getFrLen" {
+				return newABIError(false)
+			}
+		}
+	}
+	return nil
+}
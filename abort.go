@@ -0,0 +1,151 @@
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxStrLen is the maximum length of the strings read from the runtime
+// memory; longer strings are truncated.
+const maxStrLen = 1024
+
+// AbortError is the error of the calculations aborted by a module built with
+// an alternative toolchain through the env.abort import: abort(msg, file,
+// line, column) of AssemblyScript, with its UTF-16 strings, or abort(msg) and
+// abort() of emscripten, with a NUL terminated string.
+type AbortError struct {
+	Msg  string
+	File string
+	// Line and Column locate the abort in File, zero if unknown.
+	Line   uint32
+	Column uint32
+}
+
+// Error returns the message and the location of the abort.
+func (e *AbortError) Error() string {
+	msg := "WASM abort"
+	if e.Msg != "" {
+		msg += ": " + e.Msg
+	}
+	if e.File != "" {
+		msg += fmt.Sprintf(" (%s:%d:%d)", e.File, e.Line, e.Column)
+	}
+	return msg
+}
+
+// isAbortImport returns whether imp is an env.abort import with one of the
+// signatures handled by decodeAbort.
+func isAbortImport(imp wasmImport) bool {
+	if imp.Module != "env" || imp.Name != "abort" || imp.Kind != wasmExternFunction || len(imp.Results) > 0 {
+		return false
+	}
+	for _, p := range imp.Params {
+		if p != wasmValueI32 {
+			return false
+		}
+	}
+	return len(imp.Params) == 0 || len(imp.Params) == 1 || len(imp.Params) == 4
+}
+
+// abortImport returns the env.abort import of the module wasmBytes handled
+// by decodeAbort, if any.
+func abortImport(wasmBytes []byte) (wasmImport, bool, error) {
+	imports, err := parseWASMImports(wasmBytes)
+	if err != nil {
+		return wasmImport{}, false, err
+	}
+	for _, imp := range imports {
+		if isAbortImport(imp) {
+			return imp, true, nil
+		}
+	}
+	return wasmImport{}, false, nil
+}
+
+// memReader returns the n bytes at offset p of the memory of a module.
+type memReader func(p, n uint32) ([]byte, error)
+
+// sliceMemReader returns the memReader of the memory mem.
+func sliceMemReader(mem []byte) memReader {
+	return func(p, n uint32) ([]byte, error) {
+		return memRange(mem, int64(p), int64(n))
+	}
+}
+
+// decodeAbort decodes the arguments of the env.abort import.  The arguments
+// come from the module: invalid pointers are reported in the message instead
+// of failing.
+func decodeAbort(read memReader, args []uint32) *AbortError {
+	str := func(s string, err error) string {
+		if err != nil {
+			return fmt.Sprintf("<%v>", err)
+		}
+		return s
+	}
+	e := &AbortError{}
+	switch len(args) {
+	case 1:
+		if args[0] != 0 {
+			e.Msg = str(readCString(read, args[0]))
+		}
+	case 4:
+		if args[0] != 0 {
+			e.Msg = str(readUTF16String(read, args[0]))
+		}
+		if args[1] != 0 {
+			e.File = str(readUTF16String(read, args[1]))
+		}
+		e.Line, e.Column = args[2], args[3]
+	}
+	return e
+}
+
+// readCString returns the NUL terminated string at p, truncated to maxStrLen
+// bytes and with invalid UTF-8 sequences replaced.
+func readCString(read memReader, p uint32) (string, error) {
+	var b []byte
+	for len(b) < maxStrLen {
+		c, err := read(p+uint32(len(b)), 1)
+		if err != nil {
+			return "", fmt.Errorf("string at %d: %w", p, err)
+		}
+		if c[0] == 0 {
+			return strings.ToValidUTF8(string(b), "\uFFFD"), nil
+		}
+		b = append(b, c[0])
+	}
+	return strings.ToValidUTF8(string(b), "\uFFFD") + "...", nil
+}
+
+// readUTF16String returns the AssemblyScript string at p: UTF-16LE code
+// units whose size in bytes is stored in the 32 bits before p.  It is
+// truncated to maxStrLen code units.
+func readUTF16String(read memReader, p uint32) (string, error) {
+	if p < 4 {
+		return "", fmt.Errorf("string at %d out of bounds", p)
+	}
+	size, err := read(p-4, 4)
+	if err != nil {
+		return "", fmt.Errorf("string at %d: %w", p, err)
+	}
+	n := binary.LittleEndian.Uint32(size) / 2
+	truncated := n > maxStrLen
+	if truncated {
+		n = maxStrLen
+	}
+	b, err := read(p, 2*n)
+	if err != nil {
+		return "", fmt.Errorf("string at %d: %w", p, err)
+	}
+	units := make([]uint16, n)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	s := string(utf16.Decode(units))
+	if truncated {
+		s += "..."
+	}
+	return s, nil
+}
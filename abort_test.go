@@ -0,0 +1,84 @@
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// abortMemory is a memory holding the AssemblyScript strings "abc" at 12 and
+// "f.ts" at 40, and the C string "boom" at 64.
+func abortMemory() []byte {
+	mem := make([]byte, 128)
+	binary.LittleEndian.PutUint32(mem[8:], 6)
+	copy(mem[12:], "a\x00b\x00c\x00")
+	binary.LittleEndian.PutUint32(mem[36:], 8)
+	copy(mem[40:], "f\x00.\x00t\x00s\x00")
+	copy(mem[64:], "boom\x00")
+	return mem
+}
+
+func TestDecodeAbort(t *testing.T) {
+	read := sliceMemReader(abortMemory())
+	e := decodeAbort(read, []uint32{12, 40, 7, 3})
+	assert.Equal(t, &AbortError{Msg: "abc", File: "f.ts", Line: 7, Column: 3}, e)
+	assert.Equal(t, "WASM abort: abc (f.ts:7:3)", e.Error())
+
+	e = decodeAbort(read, []uint32{64})
+	assert.Equal(t, &AbortError{Msg: "boom"}, e)
+	assert.Equal(t, "WASM abort: boom", e.Error())
+	assert.Equal(t, "WASM abort", decodeAbort(read, nil).Error())
+
+	e = decodeAbort(read, []uint32{1000, 0, 1, 1})
+	assert.Contains(t, e.Msg, "out of bounds")
+	e = decodeAbort(read, []uint32{200})
+	assert.Contains(t, e.Msg, "out of bounds")
+}
+
+func TestAbortImport(t *testing.T) {
+	assert.True(t, isAbortImport(wasmImport{Module: "env", Name: "abort", Kind: wasmExternFunction,
+		Params: []byte{wasmValueI32, wasmValueI32, wasmValueI32, wasmValueI32}}))
+	assert.True(t, isAbortImport(wasmImport{Module: "env", Name: "abort", Kind: wasmExternFunction}))
+	assert.False(t, isAbortImport(wasmImport{Module: "env", Name: "abort", Kind: wasmExternFunction,
+		Params: []byte{wasmValueI64}}))
+	assert.False(t, isAbortImport(wasmImport{Module: "env", Name: "abort", Kind: wasmExternFunction,
+		Params: []byte{wasmValueI32, wasmValueI32}}))
+
+	module := newAbortModule()
+	imp, ok, err := abortImport(module)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "env.abort", imp.String())
+	stubs, err := stubImports(module, map[string]bool{}, ImportsStrict)
+	require.NoError(t, err)
+	assert.Empty(t, stubs)
+}
+
+// newAbortModule returns a WASM module importing the AssemblyScript env.abort
+// function and exporting f(), which aborts with the message "abc" of the file
+// "f.ts" at line 7, column 3.
+func newAbortModule() []byte {
+	imports := []byte{1}
+	imports = append(imports, wasmName("env")...)
+	imports = append(imports, wasmName("abort")...)
+	imports = append(imports, wasmExternFunction, 0)
+	data := []byte{1, 0, 0x41, 8, 0x0b, 40}
+	data = append(data, abortMemory()[8:48]...)
+
+	m := []byte(wasmMagic + "\x01\x00\x00\x00")
+	// (i32, i32, i32, i32) -> () and () -> ()
+	m = append(m, wasmSection(wasmSectionType, 2,
+		wasmFuncType, 4, wasmValueI32, wasmValueI32, wasmValueI32, wasmValueI32, 0,
+		wasmFuncType, 0, 0)...)
+	m = append(m, wasmSection(wasmSectionImport, imports...)...)
+	m = append(m, wasmSection(3, 1, 1)...)
+	// one page of memory
+	m = append(m, wasmSection(5, 1, 0, 1)...)
+	m = append(m, wasmSection(7, 1, 1, 'f', wasmExternFunction, 1)...)
+	// abort(12, 40, 7, 3), unreachable
+	m = append(m, wasmSection(10, 1, 13, 0, 0x41, 12, 0x41, 40, 0x41, 7, 0x41, 3, 0x10, 0, 0x00, 0x0b)...)
+	m = append(m, wasmSection(11, data...)...)
+	return m
+}
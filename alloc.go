@@ -0,0 +1,71 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// allocConvention is how the WitnessCalculator reserves runtime memory for
+// the arguments of the calls to the module.
+type allocConvention int
+
+const (
+	// allocFreePos is the circom 1 convention: the next free memory
+	// position is stored at memory[0:4].
+	allocFreePos allocConvention = iota
+	// allocScratch is used for modules with their own allocator, like the
+	// ones built with an exported stack pointer or __heap_base, where
+	// memory[0:4] is not a free pointer.  The WitnessCalculator grows the
+	// memory by scratchPages and allocates from them.
+	allocScratch
+)
+
+// scratchPages is the number of WASM pages reserved for allocScratch.
+const scratchPages = 1
+
+// allocExports are the exported globals of the modules that manage their own
+// memory.
+var allocExports = map[string]bool{
+	"__heap_base":     true,
+	"__stack_pointer": true,
+}
+
+// detectAllocConvention returns the allocConvention of the module loaded in
+// the runtime, from its exports when wasmBytes is not nil and otherwise from
+// the free position at memory[0:4], which must point inside the memory.
+func detectAllocConvention(runtime Runtime, wasmBytes []byte) (allocConvention, error) {
+	if wasmBytes != nil {
+		exports, err := parseWASMExports(wasmBytes)
+		if err != nil {
+			return 0, err
+		}
+		for _, exp := range exports {
+			if exp.Kind == wasmExternGlobal && allocExports[exp.Name] {
+				return allocScratch, nil
+			}
+		}
+	}
+	mem := runtime.Memory()
+	freePos := binary.LittleEndian.Uint32(mem[:4])
+	if freePos < 8 || uint64(freePos) >= uint64(len(mem)) {
+		return allocScratch, nil
+	}
+	return allocFreePos, nil
+}
+
+// reserveScratch grows the runtime memory by scratchPages for allocScratch
+// and returns the position of the first of them.
+func reserveScratch(runtime Runtime) (int32, error) {
+	resizer, ok := runtime.(memoryResizer)
+	if !ok {
+		return 0, fmt.Errorf("the module has no free memory position and the runtime memory can't be grown")
+	}
+	pages := (len(runtime.Memory()) + wasmPageSize - 1) / wasmPageSize
+	if err := resizer.ResizeMemory(int32(pages + scratchPages)); err != nil {
+		return 0, fmt.Errorf("reserving scratch memory: %w", err)
+	}
+	return int32(pages * wasmPageSize), nil
+}
@@ -0,0 +1,101 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resizableFakeRuntime is a fakeRuntime whose memory can be grown.
+type resizableFakeRuntime struct {
+	*fakeRuntime
+}
+
+func (r resizableFakeRuntime) ResizeMemory(numPages int32) error {
+	mem := make([]byte, int(numPages)*wasmPageSize)
+	copy(mem, r.mem)
+	r.mem = mem
+	return nil
+}
+
+// newHeapBaseModule returns a WASM module exporting the __heap_base global.
+func newHeapBaseModule() []byte {
+	m := []byte(wasmMagic + "\x01\x00\x00\x00")
+	// i32, immutable, i32.const 1024
+	m = append(m, wasmSection(6, 1, wasmValueI32, 0, 0x41, 0x80, 0x08, 0x0b)...)
+	exports := append([]byte{1}, wasmName("__heap_base")...)
+	m = append(m, wasmSection(wasmSectionExport, append(exports, wasmExternGlobal, 0)...)...)
+	return m
+}
+
+func TestDetectAllocConvention(t *testing.T) {
+	r := newFakeRuntime()
+	c, err := detectAllocConvention(r, nil)
+	require.NoError(t, err)
+	assert.Equal(t, allocFreePos, c)
+
+	c, err = detectAllocConvention(r, newHeapBaseModule())
+	require.NoError(t, err)
+	assert.Equal(t, allocScratch, c)
+
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.NoError(t, err)
+	c, err = detectAllocConvention(r, wasmBytes)
+	require.NoError(t, err)
+	assert.Equal(t, allocFreePos, c)
+
+	_, err = detectAllocConvention(r, []byte("invalid"))
+	require.Error(t, err)
+
+	for _, freePos := range []uint32{0, 4, 1024, 0xffffffff} {
+		binary.LittleEndian.PutUint32(r.mem[:4], freePos)
+		c, err = detectAllocConvention(r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, allocScratch, c, freePos)
+	}
+}
+
+func TestWitnessCalcScratchAlloc(t *testing.T) {
+	r := newFakeRuntime()
+	r.mem[0] = 0
+	_, err := NewWitnessCalculator(r)
+	require.EqualError(t, err, "the module has no free memory position and the runtime memory can't be grown")
+
+	witnessCalculator, err := NewWitnessCalculator(resizableFakeRuntime{r})
+	require.NoError(t, err)
+	assert.Equal(t, allocScratch, witnessCalculator.alloc)
+	assert.Len(t, r.mem, 2*wasmPageSize)
+	assert.Equal(t, int32(wasmPageSize), witnessCalculator.allocInt())
+	assert.Equal(t, int32(wasmPageSize+8), witnessCalculator.memFreePos())
+	assert.Equal(t, []byte{0, 0, 0, 0}, r.mem[:4])
+}
+
+func TestWitnessCalcScratchAllocCalculate(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.NoError(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	defer witnessCalculator.Close()
+	require.Equal(t, allocFreePos, witnessCalculator.alloc)
+
+	// Calculate allocating from scratch memory, leaving memory[0:4] alone
+	witnessCalculator.alloc = allocScratch
+	witnessCalculator.scratchPos, err = reserveScratch(witnessCalculator.runtime)
+	require.NoError(t, err)
+	scratchPos := witnessCalculator.scratchPos
+	freePos := binary.LittleEndian.Uint32(witnessCalculator.runtime.Memory()[:4])
+
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	w, err := witnessCalculator.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	assert.Equal(t, "33", w.At(1).String())
+	assert.Equal(t, freePos, binary.LittleEndian.Uint32(witnessCalculator.runtime.Memory()[:4]))
+	assert.Equal(t, scratchPos, witnessCalculator.scratchPos)
+}
@@ -0,0 +1,36 @@
+package witnesscalc
+
+import "context"
+
+// Result is the result of a witness calculation started with
+// CalculateWitnessAsync: the witness, or the error of the calculation.
+type Result struct {
+	Witness *Witness
+	Err     error
+}
+
+// canceled returns the error of ctx, nil for the calculations that are not
+// asynchronous.
+func canceled(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// calculateAsync runs calculate in a goroutine, with the context of the
+// calculator set to ctx with setCtx, and returns the channel of its result.
+func calculateAsync(ctx context.Context, setCtx func(ctx context.Context), calculate func() (*Witness, error)) (<-chan Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	res := make(chan Result, 1)
+	go func() {
+		defer close(res)
+		setCtx(ctx)
+		w, err := calculate()
+		setCtx(nil)
+		res <- Result{Witness: w, Err: err}
+	}()
+	return res, nil
+}
@@ -0,0 +1,141 @@
+package witnesscalc
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ConvertInputsDirToWTNS calculates the witnesses of the inputs JSON files of
+// fsys matching inputsGlob (see fs.Glob), for offline batch jobs, and writes
+// them in the wtns format into the directory outDir, created if needed, with
+// the names of the inputs files and the .wtns extension, e.g. "out/1.wtns"
+// for "inputs/1.json".  The witnesses are calculated concurrently by a
+// CalculatorPool of up to GOMAXPROCS calculators of the WitnessCalc WASM
+// module at wasmPath of fsys, created with opts, for circom 1 or circom 2
+// (see NewAutoWitnessCalculator), and every file is written through a
+// temporary file renamed once complete.  The {"$file": "path"} objects of the
+// inputs are resolved against fsys (see ParseInputsFS).  It returns the paths
+// of the written files, in the order of the inputs paths; no conversion is
+// started after a failed one, and the error is the one of the first failed
+// inputs.  Nothing is loaded nor created when no inputs file matches.
+func ConvertInputsDirToWTNS(fsys fs.FS, wasmPath, inputsGlob, outDir string, opts ...Option) ([]string, error) {
+	inputsPaths, err := fs.Glob(fsys, inputsGlob)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(inputsPaths)
+	outPaths := make([]string, len(inputsPaths))
+	seen := make(map[string]string, len(inputsPaths))
+	for i, p := range inputsPaths {
+		name := strings.TrimSuffix(path.Base(p), path.Ext(p)) + ".wtns"
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("inputs %s and %s would be written to the same file %s", other, p, name)
+		}
+		seen[name] = p
+		outPaths[i] = filepath.Join(outDir, name)
+	}
+	if len(inputsPaths) == 0 {
+		return nil, nil
+	}
+
+	wasmBytes, err := fs.ReadFile(fsys, wasmPath)
+	if err != nil {
+		return nil, err
+	}
+	// Decompressed once for all the calculators.
+	wasmBytes, err = DecompressWASM(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(inputsPaths) {
+		workers = len(inputsPaths)
+	}
+	pool := NewCalculatorPool(func() (Calculator, error) {
+		return NewAutoWitnessCalculator(wasmBytes, opts...)
+	}, PoolConfig{MaxSize: workers})
+	defer pool.Close()
+	// The module is loaded before creating outDir, to fail early.
+	calc, err := pool.Get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	pool.Put(calc)
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, err
+	}
+
+	sanityCheck := newOptions(opts).sanityCheck
+	errs := make([]error, len(inputsPaths))
+	written := make([]bool, len(inputsPaths))
+	next := make(chan int)
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = convertInputsToWTNS(pool, fsys, inputsPaths[i], outPaths[i], sanityCheck)
+				if errs[i] != nil {
+					failOnce.Do(func() { close(failed) })
+				}
+				written[i] = errs[i] == nil
+			}
+		}()
+	}
+dispatch:
+	for i := range inputsPaths {
+		select {
+		case next <- i:
+		case <-failed:
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	var paths []string
+	var firstErr error
+	for i, p := range inputsPaths {
+		if errs[i] != nil && firstErr == nil {
+			firstErr = fmt.Errorf("inputs %s: %w", p, errs[i])
+		}
+		if written[i] {
+			paths = append(paths, outPaths[i])
+		}
+	}
+	return paths, firstErr
+}
+
+// convertInputsToWTNS calculates the witness of the inputs file inputsPath of
+// fsys with a calculator of pool and writes it atomically in the wtns format
+// to outPath.
+func convertInputsToWTNS(pool *CalculatorPool, fsys fs.FS, inputsPath, outPath string, sanityCheck bool) error {
+	inputsBytes, err := fs.ReadFile(fsys, inputsPath)
+	if err != nil {
+		return err
+	}
+	inputs, err := ParseInputsFS(inputsBytes, fsys)
+	if err != nil {
+		return err
+	}
+	w, err := pool.CalculateWitness(context.Background(), inputs, sanityCheck)
+	if err != nil {
+		return err
+	}
+	wtns, err := w.ToWTNS()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(outPath, wtns)
+}
@@ -0,0 +1,44 @@
+package witnesscalc
+
+import "errors"
+
+// ErrNoWitness is the error of SampleWitness on calculators whose module
+// doesn't hold the witness of a successful calculation.
+var ErrNoWitness = errors.New("no witness calculated")
+
+// Calculator calculates the witnesses of a circuit.  It is implemented by
+// WitnessCalculator and Circom2WitnessCalculator, and by the fake in the
+// witnesscalctest package for tests that don't need a real circuit.
+type Calculator interface {
+	// CalculateWitness calculates the witness given the inputs.
+	CalculateWitness(inputs map[string]interface{}, sanityCheck bool) (*Witness, error)
+	// CalculateBinWitness calculates the witness in binary given the inputs.
+	CalculateBinWitness(inputs map[string]interface{}, sanityCheck bool) ([]byte, error)
+}
+
+var _ Calculator = (*Circom2WitnessCalculator)(nil)
+
+// NewAutoWitnessCalculator creates the calculator of the WitnessCalc WASM
+// module wasmBytes produced by either circom, for applications serving
+// circuits of both: modules exporting getVersion are loaded with
+// NewCircom2WitnessCalculator, the others with LoadWitnessCalculator, which
+// is not available under js.  The circom 1 calculators own their runtime,
+// which must be released with their Close method.
+func NewAutoWitnessCalculator(wasmBytes []byte, opts ...Option) (Calculator, error) {
+	wasmBytes, err := DecompressWASM(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	exports, err := parseWASMExports(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !isCircom2Module(exports) {
+		return loadCircom1Calculator(wasmBytes, opts)
+	}
+	wc, err := NewCircom2WitnessCalculator(wasmBytes, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
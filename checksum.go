@@ -0,0 +1,68 @@
+package witnesscalc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Checksum is the SHA-256 hash of a binary witness: the witness values
+// encoded in order as n8 bytes little-endian integers, which is the format of
+// CalculateBinWitness and of the witness section of wtns files.  It lets the
+// receiver of a witness check it wasn't truncated or corrupted in transit.
+type Checksum [sha256.Size]byte
+
+// String returns the checksum in hexadecimal.
+func (c Checksum) String() string {
+	return hex.EncodeToString(c[:])
+}
+
+// writeElems writes the values to w encoded as n8 bytes little-endian integers.
+func writeElems(w io.Writer, values []*big.Int, n8 int) error {
+	elem := make([]byte, n8)
+	for i, v := range values {
+		if v == nil || v.Sign() < 0 || (v.BitLen()+7)/8 > n8 {
+			return fmt.Errorf("witness value %d: %v doesn't fit in %d bytes", i, v, n8)
+		}
+		for j := range elem {
+			elem[j] = 0
+		}
+		b := v.Bytes()
+		for j := range b {
+			elem[j] = b[len(b)-1-j]
+		}
+		if _, err := w.Write(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WitnessChecksum returns the Checksum of the witness w with field elements of
+// n8 bytes.
+func WitnessChecksum(w []*big.Int, n8 int) (Checksum, error) {
+	var c Checksum
+	h := sha256.New()
+	if err := writeElems(h, w, n8); err != nil {
+		return c, err
+	}
+	copy(c[:], h.Sum(nil))
+	return c, nil
+}
+
+// BinWitnessChecksum returns the Checksum of a binary witness.
+func BinWitnessChecksum(binWitness []byte) Checksum {
+	return sha256.Sum256(binWitness)
+}
+
+// PublicSignalsChecksum returns the Checksum of the nPublic public signals
+// of the witness w (w[1:nPublic+1]) with field elements of n8 bytes.
+func PublicSignalsChecksum(w []*big.Int, nPublic int, n8 int) (Checksum, error) {
+	if nPublic < 0 || nPublic+1 > len(w) {
+		return Checksum{}, fmt.Errorf("witness of length %d can't hold %d public signals",
+			len(w), nPublic)
+	}
+	return WitnessChecksum(w[1:nPublic+1], n8)
+}
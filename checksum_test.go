@@ -0,0 +1,37 @@
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWitnessChecksum(t *testing.T) {
+	w := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+	binWitness := make([]byte, 4*32)
+	for i, v := range w {
+		binary.LittleEndian.PutUint64(binWitness[i*32:], v.Uint64())
+	}
+
+	c, err := WitnessChecksum(w, 32)
+	require.Nil(t, err)
+	assert.Equal(t, BinWitnessChecksum(binWitness), c)
+	assert.Len(t, c.String(), 64)
+
+	binWitness[len(binWitness)-1] = 1
+	assert.NotEqual(t, BinWitnessChecksum(binWitness), c)
+
+	p, err := PublicSignalsChecksum(w, 1, 32)
+	require.Nil(t, err)
+	expected, err := WitnessChecksum(w[1:2], 32)
+	require.Nil(t, err)
+	assert.Equal(t, expected, p)
+
+	_, err = PublicSignalsChecksum(w, 4, 32)
+	require.Error(t, err)
+	_, err = WitnessChecksum([]*big.Int{big.NewInt(-1)}, 32)
+	require.Error(t, err)
+}
@@ -2,71 +2,102 @@ package witnesscalc
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"io/ioutil"
 	"math/big"
-
-	"github.com/wasmerio/wasmer-go/wasmer"
+	"sort"
+	"time"
 )
 
 // Circom2WitnessCalculator is the object that allows performing witness calculation
-// from signal inputs using the WitnessCalc WASM module.
+// from signal inputs using the WitnessCalc WASM module.  It is not safe for
+// concurrent use: concurrent calculations need a calculator each, e.g. from a
+// CalculatorPool.
 type Circom2WitnessCalculator struct {
-	instance            *wasmer.Instance
-	sanityCheck         bool
+	instance            interface{} // keeps the backend instance alive
+	opts                options
 	n32                 int32
+	prime               *big.Int
+	curve               Curve
 	version             int32
 	witnessSize         int32
-	init                wasmer.NativeFunction
-	getFieldNumLen32    wasmer.NativeFunction
-	getInputSignalSize  wasmer.NativeFunction
-	getInputSize        wasmer.NativeFunction
-	getRawPrime         wasmer.NativeFunction
-	getVersion          wasmer.NativeFunction
-	getWitness          wasmer.NativeFunction
-	readSharedRWMemory  wasmer.NativeFunction
-	setInputSignal      wasmer.NativeFunction
-	writeSharedRWMemory wasmer.NativeFunction
+	init                nativeFunction
+	getFieldNumLen32    nativeFunction
+	getInputSignalSize  nativeFunction
+	getInputSize        nativeFunction
+	getRawPrime         nativeFunction
+	getVersion          nativeFunction
+	getWitness          nativeFunction
+	readSharedRWMemory  nativeFunction
+	setInputSignal      nativeFunction
+	writeSharedRWMemory nativeFunction
+
+	// writeMemory, if not nil, writes the field elements of the inputs
+	// straight into the shared memory at sharedRWMemoryStart.
+	writeMemory         circom2Memory
+	sharedRWMemoryStart int32
+	// getInputSignalBuffer and setInputSignalBuffer, if not nil, are the
+	// exports of the builds with a contiguous buffer for the values of each
+	// input signal array, which are then written with a single copy into
+	// the memory and set with a single call.
+	getInputSignalBuffer nativeFunction
+	setInputSignalBuffer nativeFunction
+	// memorySize, if not nil, returns the size of the module memory.
+	memorySize func() int
+	// snapshot, if not nil, returns the post-init state of the module, for
+	// Snapshot.
+	snapshot func() (*moduleSnapshot, error)
+
+	// logger emits the values logged by the circuit.
+	logger circuitLogger
+	// timer measures the running calculation, with WithStats, and wasmCalls
+	// counts the calls to the module.
+	timer     *statsTimer
+	wasmCalls int
+	// ctx is the context of the running CalculateWitnessAsync calculation.
+	ctx context.Context
+	// calculated is set when the module holds the witness of the last
+	// calculation, for SampleWitness.
+	calculated bool
+	// circuitHash is the hash of the module.
+	circuitHash CircuitHash
+	// abortErr is the error reported by the module through env.abort during
+	// the last call.
+	abortErr *AbortError
+	// inputSizes caches the sizes of the input signals looked up in the
+	// module by inputSignalSizes.
+	inputSizes map[string]int
 }
 
-// NewCircom2WitnessCalculator creates a new WitnessCalculator from the WitnessCalc
-// loaded WASM module in the runtime.
-func NewCircom2WitnessCalculator(wasmBytes []byte, sanityCheck bool) (*Circom2WitnessCalculator, error) {
-	engine := wasmer.NewEngine()
-	store := wasmer.NewStore(engine)
-
-	// Compiles the module
-	module, _ := wasmer.NewModule(store, wasmBytes)
-
-	limits, err := wasmer.NewLimits(2000, 100000)
-	if err != nil {
-		return nil, err
-	}
-
-	memType := wasmer.NewMemoryType(limits)
-
-	memory := wasmer.NewMemory(store, memType)
+// circom2Exports looks up a function exported by the WitnessCalc WASM module
+// instantiated by a backend.
+type circom2Exports func(name string) (nativeFunction, error)
 
-	// Instantiates the module
-	importObject := wasmer.NewImportObject()
-
-	importObject.Register("env", map[string]wasmer.IntoExtern{
-		"memory": memory,
-	})
+// circom2Memory writes b at offset of the linear memory exported by the
+// WitnessCalc WASM module instantiated by a backend.
+type circom2Memory func(offset int, b []byte) error
 
-	importObject.Register("runtime", map[string]wasmer.IntoExtern{
-		"exceptionHandler":   getExceptionHandler(store),
-		"showSharedRWMemory": getShowSharedRWMemory(store),
-		"log":                getLog(store),
-	})
+// nativeFunction calls a WASM exported function with int32 arguments,
+// returning its int32 result, if any.
+type nativeFunction func(args ...interface{}) (interface{}, error)
 
-	instance, err := wasmer.NewInstance(module, importObject)
-	if err != nil {
-		return nil, err
-	}
+// newModule returns a temporary Circom2WitnessCalculator bound to the exports
+// of the WitnessCalc WASM module instantiated by a backend, for swapModule.
+// writeMemory, if not nil, lets the inputs be written straight into the
+// shared memory of the module, and memorySize, if not nil, returns the size of
+// its memory.  A module replacing another one must have the same prime.  The
+// calculator is left unchanged.
+func (wc *Circom2WitnessCalculator) newModule(instance interface{}, exports circom2Exports, writeMemory circom2Memory, memorySize func() int) (*Circom2WitnessCalculator, error) {
+	exports = wc.countCalls(exports)
 
 	// Gets the `init` exported function from the WebAssembly instance.
-	init, err := instance.Exports.GetFunction("init")
+	init, err := exports("init")
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +109,7 @@ func NewCircom2WitnessCalculator(wasmBytes []byte, sanityCheck bool) (*Circom2Wi
 		return nil, err
 	}
 
-	getFieldNumLen32, err := instance.Exports.GetFunction("getFieldNumLen32")
+	getFieldNumLen32, err := exports("getFieldNumLen32")
 	if err != nil {
 		return nil, err
 	}
@@ -88,19 +119,19 @@ func NewCircom2WitnessCalculator(wasmBytes []byte, sanityCheck bool) (*Circom2Wi
 	}
 
 	// this function is missing in wasm files generated with circom version prior to v2.0.4
-	getInputSignalSize, _ := instance.Exports.GetFunction("getInputSignalSize")
+	getInputSignalSize, _ := exports("getInputSignalSize")
 
-	getInputSize, err := instance.Exports.GetFunction("getInputSize")
+	getInputSize, err := exports("getInputSize")
 	if err != nil {
 		return nil, err
 	}
 
-	getRawPrime, err := instance.Exports.GetFunction("getRawPrime")
+	getRawPrime, err := exports("getRawPrime")
 	if err != nil {
 		return nil, err
 	}
 
-	getVersion, err := instance.Exports.GetFunction("getVersion")
+	getVersion, err := exports("getVersion")
 	if err != nil {
 		return nil, err
 	}
@@ -110,12 +141,12 @@ func NewCircom2WitnessCalculator(wasmBytes []byte, sanityCheck bool) (*Circom2Wi
 		return nil, err
 	}
 
-	getWitness, err := instance.Exports.GetFunction("getWitness")
+	getWitness, err := exports("getWitness")
 	if err != nil {
 		return nil, err
 	}
 
-	getWitnessSize, err := instance.Exports.GetFunction("getWitnessSize")
+	getWitnessSize, err := exports("getWitnessSize")
 	if err != nil {
 		return nil, err
 	}
@@ -125,27 +156,23 @@ func NewCircom2WitnessCalculator(wasmBytes []byte, sanityCheck bool) (*Circom2Wi
 		return nil, err
 	}
 
-	setInputSignal, err := instance.Exports.GetFunction("setInputSignal")
+	setInputSignal, err := exports("setInputSignal")
 	if err != nil {
 		return nil, err
 	}
 
-	readSharedRWMemory, err := instance.Exports.GetFunction("readSharedRWMemory")
+	readSharedRWMemory, err := exports("readSharedRWMemory")
 	if err != nil {
 		return nil, err
 	}
 
-	writeSharedRWMemory, err := instance.Exports.GetFunction("writeSharedRWMemory")
+	writeSharedRWMemory, err := exports("writeSharedRWMemory")
 	if err != nil {
 		return nil, err
 	}
 
-	return &Circom2WitnessCalculator{
+	m := &Circom2WitnessCalculator{
 		instance:            instance,
-		sanityCheck:         sanityCheck,
-		n32:                 n32.(int32),
-		version:             version.(int32),
-		witnessSize:         witnessSize.(int32),
 		init:                init,
 		getFieldNumLen32:    getFieldNumLen32,
 		getInputSignalSize:  getInputSignalSize,
@@ -156,122 +183,609 @@ func NewCircom2WitnessCalculator(wasmBytes []byte, sanityCheck bool) (*Circom2Wi
 		setInputSignal:      setInputSignal,
 		readSharedRWMemory:  readSharedRWMemory,
 		writeSharedRWMemory: writeSharedRWMemory,
-	}, nil
+	}
+
+	if m.n32, err = int32Result("getFieldNumLen32", n32); err != nil {
+		return nil, err
+	}
+	if m.n32 <= 0 || m.n32 > maxFieldLen32 {
+		return nil, fmt.Errorf("invalid field element size %d", m.n32)
+	}
+	if m.version, err = int32Result("getVersion", version); err != nil {
+		return nil, err
+	}
+	if m.witnessSize, err = int32Result("getWitnessSize", witnessSize); err != nil {
+		return nil, err
+	}
+	if m.witnessSize < 0 {
+		return nil, fmt.Errorf("invalid witness size %d", m.witnessSize)
+	}
+
+	_, err = getRawPrime()
+	if err != nil {
+		return nil, err
+	}
+	m.prime, err = m.readSharedRWMemoryFr()
+	if err != nil {
+		return nil, err
+	}
+	if m.curve, err = checkCurve(m.prime, wc.opts); err != nil {
+		return nil, err
+	}
+
+	// this function is missing in wasm files generated with old circom versions
+	getSharedRWMemoryStart, _ := exports("getSharedRWMemoryStart")
+	if getSharedRWMemoryStart != nil && writeMemory != nil {
+		res, err := getSharedRWMemoryStart()
+		if err != nil {
+			return nil, err
+		}
+		if m.sharedRWMemoryStart, err = int32Result("getSharedRWMemoryStart", res); err != nil {
+			return nil, err
+		}
+		m.writeMemory = writeMemory
+	}
+	// these functions are only exported by the builds with input buffers
+	getInputSignalBuffer, _ := exports("getInputSignalBuffer")
+	setInputSignalBuffer, _ := exports("setInputSignalBuffer")
+	if getInputSignalBuffer != nil && setInputSignalBuffer != nil && writeMemory != nil {
+		m.getInputSignalBuffer = getInputSignalBuffer
+		m.setInputSignalBuffer = setInputSignalBuffer
+		m.writeMemory = writeMemory
+	}
+	if wc.prime != nil && m.prime.Cmp(wc.prime) != 0 {
+		return nil, fmt.Errorf("the prime of the module %v doesn't match the prime %v", m.prime, wc.prime)
+	}
+
+	m.memorySize = memorySize
+	return m, nil
 }
 
-// CalculateWitness calculates the witness given the inputs.
-func (wc *Circom2WitnessCalculator) CalculateWitness(inputs map[string]interface{}, sanityCheck bool) ([]*big.Int, error) {
+// swapModule binds the calculator to the module of m, returned by newModule,
+// and releases the instance of the module it replaces.
+func (wc *Circom2WitnessCalculator) swapModule(m *Circom2WitnessCalculator) {
+	old := wc.instance
+	wc.instance = m.instance
+	wc.n32 = m.n32
+	wc.prime = m.prime
+	wc.curve = m.curve
+	wc.version = m.version
+	wc.witnessSize = m.witnessSize
+	wc.init = m.init
+	wc.getFieldNumLen32 = m.getFieldNumLen32
+	wc.getInputSignalSize = m.getInputSignalSize
+	wc.getInputSize = m.getInputSize
+	wc.getRawPrime = m.getRawPrime
+	wc.getWitness = m.getWitness
+	wc.getVersion = m.getVersion
+	wc.setInputSignal = m.setInputSignal
+	wc.readSharedRWMemory = m.readSharedRWMemory
+	wc.writeSharedRWMemory = m.writeSharedRWMemory
+	wc.writeMemory = m.writeMemory
+	wc.sharedRWMemoryStart = m.sharedRWMemoryStart
+	wc.getInputSignalBuffer = m.getInputSignalBuffer
+	wc.setInputSignalBuffer = m.setInputSignalBuffer
+	wc.memorySize = m.memorySize
+	wc.snapshot = m.snapshot
+	wc.circuitHash = m.circuitHash
+	wc.inputSizes = nil
+	wc.calculated = false
+	if old != nil {
+		releaseCircom2Instance(old)
+	}
+}
 
-	w := make([]*big.Int, wc.witnessSize)
+// newCircom2WitnessCalculator creates a Circom2WitnessCalculator, without
+// module, with the options opts.
+func newCircom2WitnessCalculator(opts []Option) *Circom2WitnessCalculator {
+	o := newOptions(opts)
+	return &Circom2WitnessCalculator{
+		opts:   o,
+		logger: circuitLogger{circuit: o.circuitName, collect: o.circuitLogs},
+	}
+}
+
+// NewCircom2WitnessCalculatorFromReader creates a Circom2WitnessCalculator
+// from the WitnessCalc WASM module read from r until EOF, e.g. a network
+// response body, without writing it to a file.
+func NewCircom2WitnessCalculatorFromReader(r io.Reader, opts ...Option) (*Circom2WitnessCalculator, error) {
+	wasmBytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading the WASM module: %w", err)
+	}
+	return NewCircom2WitnessCalculator(wasmBytes, opts...)
+}
 
-	err := wc.doCalculateWitness(inputs, sanityCheck)
+// NewCircom2WitnessCalculatorFromFS creates a Circom2WitnessCalculator from
+// the WitnessCalc WASM module at path in fsys, e.g. an embed.FS with the
+// circuits embedded in the binary.
+func NewCircom2WitnessCalculatorFromFS(fsys fs.FS, path string, opts ...Option) (*Circom2WitnessCalculator, error) {
+	wasmBytes, err := fs.ReadFile(fsys, path)
 	if err != nil {
 		return nil, err
 	}
+	return NewCircom2WitnessCalculator(wasmBytes, opts...)
+}
+
+// ReloadModule replaces the WitnessCalc WASM module of the calculator by
+// newWasm, e.g. after the circuit has been recompiled, keeping its options and
+// metrics.  The new module must have the same prime.  It is loaded apart and
+// only replaces the previous module, which is released, once loaded: on
+// errors the calculator keeps running the previous module.
+func (wc *Circom2WitnessCalculator) ReloadModule(newWasm []byte) error {
+	return wc.loadCircuit(newWasm)
+}
+
+// loadCircuit loads the WitnessCalc WASM module with the loadModule of the
+// backend into a temporary calculator and, on success, swaps it in with its
+// hash.
+func (wc *Circom2WitnessCalculator) loadCircuit(wasmBytes []byte) (err error) {
+	start := time.Now()
+	defer func() { traceSpan(wc.opts.tracer, context.Background(), SpanLoad, start, time.Now(), err) }()
+	wasmBytes, err = DecompressWASM(wasmBytes)
+	if err != nil {
+		return err
+	}
+	if err := checkModuleABI(wasmBytes, true); err != nil {
+		return err
+	}
+	m, err := wc.loadModule(wasmBytes)
+	if err != nil {
+		return err
+	}
+	m.circuitHash = NewCircuitHash(wasmBytes)
+	wc.swapModule(m)
+	return nil
+}
+
+// Field returns the field of the circuit.
+func (wc *Circom2WitnessCalculator) Field() *Field {
+	return NewField(wc.prime)
+}
+
+// CircuitHash returns the SHA-256 hash of the WitnessCalc WASM module, to
+// check that the witnesses and the zkey of a prover come from the same
+// circuit build.  The bool is always true.
+func (wc *Circom2WitnessCalculator) CircuitHash() (CircuitHash, bool) {
+	return wc.circuitHash, true
+}
+
+// wtnsCircuitHash returns the hash embedded in the wtns files, with
+// WithCircuitHashInWTNS.
+func (wc *Circom2WitnessCalculator) wtnsCircuitHash() *CircuitHash {
+	if !wc.opts.wtnsCircuitHash {
+		return nil
+	}
+	h := wc.circuitHash
+	return &h
+}
+
+// newWitness creates the Witness of the values calculated by the module.
+func (wc *Circom2WitnessCalculator) newWitness(values []*big.Int) *Witness {
+	w := NewWitness(values, wc.prime)
+	w.circuitHash = wc.wtnsCircuitHash()
+	return w
+}
 
+// countCalls wraps exports to count the calls to the exported functions and
+// to return the AbortError of the calls aborted through env.abort.
+func (wc *Circom2WitnessCalculator) countCalls(exports circom2Exports) circom2Exports {
+	return func(name string) (nativeFunction, error) {
+		f, err := exports(name)
+		if err != nil || f == nil {
+			return f, err
+		}
+		return func(args ...interface{}) (interface{}, error) {
+			wc.wasmCalls++
+			wc.abortErr = nil
+			res, err := f(args...)
+			if err != nil && wc.abortErr != nil {
+				return nil, wc.abortErr
+			}
+			return res, err
+		}, nil
+	}
+}
+
+// Curve returns the curve of the field of the circuit.
+func (wc *Circom2WitnessCalculator) Curve() Curve {
+	return wc.curve
+}
+
+// startStats starts measuring a calculation, with WithStats.
+func (wc *Circom2WitnessCalculator) startStats() {
+	wc.timer = newStatsTimer(statsFunc(wc.opts), wc.opts.tracer, wc.ctx)
+	wc.wasmCalls = 0
+}
+
+// reportStats reports the Stats of the finished calculation.
+func (wc *Circom2WitnessCalculator) reportStats() {
+	memPeak := 0
+	if wc.memorySize != nil {
+		memPeak = wc.memorySize()
+	}
+	wc.timer.report(wc.wasmCalls, wc.binWitnessSize(), memPeak)
+}
+
+// exceptionMessage returns the description of an error code passed by the
+// WitnessCalc WASM module to the runtime.exceptionHandler import.
+func exceptionMessage(code int32) string {
+	switch code {
+	case 1:
+		return "Signal not found. "
+	case 2:
+		return "Too many signals set. "
+	case 3:
+		return "Signal already set. "
+	case 4:
+		return "Assert Failed. "
+	case 5:
+		return "Not enough memory. "
+	case 6:
+		return "Input signal array access exceeds the size"
+	default:
+		return "Unknown error"
+	}
+}
+
+// readSharedRWMemoryInt32 reads the 32 bit word j of the shared memory.
+func (wc *Circom2WitnessCalculator) readSharedRWMemoryInt32(j int) (int32, error) {
+	res, err := wc.readSharedRWMemory(int32(j))
+	if err != nil {
+		return 0, err
+	}
+	return int32Result("readSharedRWMemory", res)
+}
+
+// readWitness reads the witness signals from the module.
+func (wc *Circom2WitnessCalculator) readWitness() ([]*big.Int, error) {
+	w := make([]*big.Int, wc.witnessSize)
 	for i := 0; i < int(wc.witnessSize); i++ {
 		_, err := wc.getWitness(i)
 		if err != nil {
 			return nil, err
 		}
-		arr := make([]uint32, wc.n32)
-		for j := 0; j < int(wc.n32); j++ {
-			val, err := wc.readSharedRWMemory(int32(j))
-			if err != nil {
-				return nil, err
+		w[i], err = wc.readSharedRWMemoryFr()
+		if err != nil {
+			return nil, err
+		}
+		if wc.opts.postprocess != nil {
+			if err := wc.opts.postprocess(i, w[i]); err != nil {
+				return nil, fmt.Errorf("witness %d: %w", i, err)
 			}
-			arr[int(wc.n32)-1-j] = uint32(val.(int32))
 		}
-		w[i] = fromArray32(arr)
 	}
-
 	return w, nil
 }
 
-// CalculateBinWitness calculates the witness in binary given the inputs.
-func (wc *Circom2WitnessCalculator) CalculateBinWitness(inputs map[string]interface{}, sanityCheck bool) ([]byte, error) {
-	buff := new(bytes.Buffer)
+// SampleWitness returns the values at the indices of the witness of the last
+// calculation, reading only them from the module, e.g. to spot check a few
+// signals without loading the whole witness.  It returns ErrNoWitness if the
+// last calculation failed or no calculation has been made.
+func (wc *Circom2WitnessCalculator) SampleWitness(indices []int) ([]*big.Int, error) {
+	if !wc.calculated {
+		return nil, ErrNoWitness
+	}
+	values := make([]*big.Int, len(indices))
+	for j, i := range indices {
+		if i < 0 || i >= int(wc.witnessSize) {
+			return nil, fmt.Errorf("witness index %d out of range [0, %d)", i, wc.witnessSize)
+		}
+		if _, err := wc.getWitness(i); err != nil {
+			return nil, err
+		}
+		var err error
+		if values[j], err = wc.readSharedRWMemoryFr(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
 
-	err := wc.doCalculateWitness(inputs, sanityCheck)
+// InputNames returns the sorted names of the input signals the circuit
+// expects.  The module only holds the hashes of the names, so the signals of
+// the main component in the symbols given with WithSymbols are looked up in
+// its input signals hash map.
+func (wc *Circom2WitnessCalculator) InputNames() ([]string, error) {
+	if wc.getInputSignalSize == nil {
+		return nil, fmt.Errorf("the module doesn't export getInputSignalSize")
+	}
+	if wc.opts.symbols == nil {
+		return nil, fmt.Errorf("the symbols of the circuit are required (see WithSymbols)")
+	}
+	sizes, err := wc.moduleInputSizes()
 	if err != nil {
 		return nil, err
 	}
+	names := make([]string, 0, len(sizes))
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
 
-	for i := 0; i < int(wc.witnessSize); i++ {
-		_, err := wc.getWitness(i)
+// moduleInputSizes returns the sizes of the input signals by name, looking
+// the signals of the main component in the symbols up in the module.
+func (wc *Circom2WitnessCalculator) moduleInputSizes() (map[string]int, error) {
+	if wc.inputSizes != nil {
+		return wc.inputSizes, nil
+	}
+	seen := make(map[string]bool)
+	sizes := make(map[string]int)
+	for _, sym := range wc.opts.symbols {
+		name, ok := mainSignalName(sym.Name)
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		id := NewSignalID(name)
+		res, err := wc.getInputSignalSize(id.MSB, id.LSB)
+		if err != nil {
+			return nil, err
+		}
+		size, err := int32Result("getInputSignalSize", res)
 		if err != nil {
 			return nil, err
 		}
+		// the size of the signals missing from the hash map is 0
+		if size > 0 {
+			sizes[name] = int(size)
+		}
+	}
+	wc.inputSizes = sizes
+	return sizes, nil
+}
 
-		for j := 0; j < int(wc.n32); j++ {
-			val, err := wc.readSharedRWMemory(j)
-			if err != nil {
-				return nil, err
-			}
-			_ = binary.Write(buff, binary.LittleEndian, uint32(val.(int32)))
+// inputSignalSizes returns the sizes of the input signals of the circuit by
+// name, declared with WithInputSignals or looked up in the module, or nil if
+// they are unknown.
+func (wc *Circom2WitnessCalculator) inputSignalSizes() (map[string]int, error) {
+	if wc.opts.inputSignals != nil {
+		return wc.opts.inputSignals, nil
+	}
+	if wc.getInputSignalSize == nil || wc.opts.symbols == nil {
+		return nil, nil
+	}
+	return wc.moduleInputSizes()
+}
+
+// showSharedRWMemory logs the Field element held in the shared memory,
+// which is how the circuit logs its values.
+func (wc *Circom2WitnessCalculator) showSharedRWMemory() {
+	wc.logger.log(wc.readSharedRWMemoryFr())
+}
+
+// CircuitLogs returns the values logged by the circuit during the last
+// calculation, collected with WithCircuitLogs.
+func (wc *Circom2WitnessCalculator) CircuitLogs() []CircuitLog {
+	return wc.logger.logs
+}
+
+// readSharedRWMemoryFr reads the Field element held in the shared memory.
+func (wc *Circom2WitnessCalculator) readSharedRWMemoryFr() (*big.Int, error) {
+	arr := make([]uint32, wc.n32)
+	for j := 0; j < int(wc.n32); j++ {
+		val, err := wc.readSharedRWMemoryInt32(j)
+		if err != nil {
+			return nil, err
 		}
+		arr[int(wc.n32)-1-j] = uint32(val)
 	}
+	return fromArray32(arr), nil
+}
 
-	return buff.Bytes(), nil
+// Calculate calculates the witness given the inputs, with the sanity checks
+// of WithDefaultSanityCheck.
+func (wc *Circom2WitnessCalculator) Calculate(inputs map[string]interface{}) (*Witness, error) {
+	return wc.CalculateWitness(inputs, wc.opts.sanityCheck)
 }
 
-// CalculateWTNSBin calculates the witness in binary given the inputs.
-func (wc *Circom2WitnessCalculator) CalculateWTNSBin(inputs map[string]interface{}, sanityCheck bool) ([]byte, error) {
-	buff := new(bytes.Buffer)
+// CalculateWitnessAsync calculates the witness given the inputs, like
+// Calculate, in a goroutine, and sends the result to the returned channel,
+// which is closed afterwards.  Canceling ctx stops the calculation before the
+// next input value with the error of ctx.  The calculator must not be used
+// until the result is received.
+func (wc *Circom2WitnessCalculator) CalculateWitnessAsync(ctx context.Context, inputs map[string]interface{}) (<-chan Result, error) {
+	return calculateAsync(ctx, func(ctx context.Context) { wc.ctx = ctx }, func() (*Witness, error) {
+		return wc.Calculate(inputs)
+	})
+}
 
-	err := wc.doCalculateWitness(inputs, sanityCheck)
+// CalculateBin calculates the witness in binary given the inputs, with the
+// sanity checks of WithDefaultSanityCheck.
+func (wc *Circom2WitnessCalculator) CalculateBin(inputs map[string]interface{}) ([]byte, error) {
+	return wc.CalculateBinWitness(inputs, wc.opts.sanityCheck)
+}
+
+// CalculateWTNS calculates the witness in the wtns format given the inputs,
+// with the sanity checks of WithDefaultSanityCheck.
+func (wc *Circom2WitnessCalculator) CalculateWTNS(inputs map[string]interface{}) ([]byte, error) {
+	return wc.CalculateWTNSBin(inputs, wc.opts.sanityCheck)
+}
+
+// CalculateWitness calculates the witness given the inputs.
+func (wc *Circom2WitnessCalculator) CalculateWitness(inputs map[string]interface{}, sanityCheck bool) (_ *Witness, err error) {
+	wc.startStats()
+	defer func() { wc.timer.end(err) }()
+	err = wc.doCalculateWitness(inputs, sanityCheck)
 	if err != nil {
 		return nil, err
 	}
+	return wc.loadWitness()
+}
 
-	buff.Grow(int(wc.witnessSize*wc.n32 + wc.n32 + 11))
+// CalculateWitnessHashed calculates the witness given the inputs identified by
+// their precomputed SignalID, skipping the hashing of the signal names.
+// Callers calculating many witnesses of the same circuit can compute the IDs
+// once with NewSignalID.  The inputs are not linted.
+func (wc *Circom2WitnessCalculator) CalculateWitnessHashed(inputs []HashedInput, sanityCheck bool) (_ *Witness, err error) {
+	wc.startStats()
+	defer func() { wc.timer.end(err) }()
+	signals, err := newHashedSignalInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	if err := wc.doCalculateWitnessSignals(signals, sanityCheck); err != nil {
+		return nil, err
+	}
+	return wc.loadWitness()
+}
 
-	// wtns
-	_ = buff.WriteByte('w')
-	_ = buff.WriteByte('t')
-	_ = buff.WriteByte('n')
-	_ = buff.WriteByte('s')
+// CalculateWitnessStatic calculates the witness given the static inputs,
+// prepared once with NewStaticInputs, and the dynamic inputs, which must not
+// set static signals.
+func (wc *Circom2WitnessCalculator) CalculateWitnessStatic(static *StaticInputs, inputs map[string]interface{}, sanityCheck bool) (_ *Witness, err error) {
+	wc.startStats()
+	defer func() { wc.timer.end(err) }()
+	inputs, err = wc.opts.normalizeInputs(inputs, wc.prime)
+	if err != nil {
+		return nil, err
+	}
+	if wc.opts.lintInputs {
+		if err := logLintWarnings(inputs, wc.prime, wc.opts.binaryInputs); err != nil {
+			return nil, err
+		}
+	}
+	signals, err := static.withInputs("circom2 "+wc.prime.String(), wc.encodeFr, inputs)
+	if err != nil {
+		return nil, err
+	}
+	if err := wc.doCalculateWitnessSignals(signals, sanityCheck); err != nil {
+		return nil, err
+	}
+	return wc.loadWitness()
+}
 
-	//version 2
-	_ = binary.Write(buff, binary.LittleEndian, uint32(2))
+// loadWitness reads the calculated witness from the WASM module.
+func (wc *Circom2WitnessCalculator) loadWitness() (*Witness, error) {
+	w, err := wc.readWitness()
+	if err != nil {
+		return nil, err
+	}
 
-	//number of sections: 2
-	_ = binary.Write(buff, binary.LittleEndian, uint32(2))
+	wc.timer.lap(phaseExtract)
+	if wc.opts.checksum != nil {
+		c, err := WitnessChecksum(w, int(wc.n32*4))
+		if err != nil {
+			return nil, err
+		}
+		wc.opts.checksum(c)
+	}
+	wc.reportStats()
+	return wc.newWitness(w), nil
+}
 
-	//id section 1
-	_ = binary.Write(buff, binary.LittleEndian, uint32(1))
+// binWitnessSize returns the size in bytes of the binary witness, computed in
+// int: in int32 it overflows for the witnesses of 2^26 signals.
+func (wc *Circom2WitnessCalculator) binWitnessSize() int {
+	return int(wc.witnessSize) * int(wc.n32) * 4
+}
 
-	n8 := wc.n32 * 4
-	//id section 1 length in 64bytes
-	idSection1length := 8 + n8
-	_ = binary.Write(buff, binary.LittleEndian, uint64(idSection1length))
+// CalculateBinWitness calculates the witness in binary given the inputs.
+func (wc *Circom2WitnessCalculator) CalculateBinWitness(inputs map[string]interface{}, sanityCheck bool) ([]byte, error) {
+	buff := new(bytes.Buffer)
+	buff.Grow(wc.binWitnessSize())
+	if err := wc.CalculateBinWitnessTo(buff, inputs, sanityCheck); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
 
-	//this.n32
-	_ = binary.Write(buff, binary.LittleEndian, uint32(n8))
+// CalculateBinWitnessTo calculates the witness in binary given the inputs and
+// writes it to w one field element at a time, so that big witnesses can be
+// streamed without holding a copy in Go memory.
+func (wc *Circom2WitnessCalculator) CalculateBinWitnessTo(w io.Writer, inputs map[string]interface{}, sanityCheck bool) error {
+	_, err := wc.calculateBinWitnessTo(w, inputs, sanityCheck, wc.opts.checksum != nil)
+	return err
+}
 
-	//prime number
-	_, err = wc.getRawPrime()
+// CalculateBinWitnessChecksum calculates the witness in binary given the
+// inputs, like CalculateBinWitness, and returns it with its Checksum,
+// computed while reading it from the module.
+func (wc *Circom2WitnessCalculator) CalculateBinWitnessChecksum(inputs map[string]interface{}, sanityCheck bool) ([]byte, Checksum, error) {
+	var buff bytes.Buffer
+	buff.Grow(wc.binWitnessSize())
+	c, err := wc.calculateBinWitnessTo(&buff, inputs, sanityCheck, true)
 	if err != nil {
-		return nil, err
+		return nil, Checksum{}, err
 	}
+	return buff.Bytes(), c, nil
+}
 
-	for j := 0; j < int(wc.n32); j++ {
-		val, err := wc.readSharedRWMemory(int32(j))
+// calculateBinWitnessTo is CalculateBinWitnessTo, returning the Checksum of
+// the witness if checksum is set.
+func (wc *Circom2WitnessCalculator) calculateBinWitnessTo(w io.Writer, inputs map[string]interface{}, sanityCheck bool, checksum bool) (c Checksum, err error) {
+	wc.startStats()
+	defer func() { wc.timer.end(err) }()
+	err = wc.doCalculateWitness(inputs, sanityCheck)
+	if err != nil {
+		return c, err
+	}
+
+	var h hash.Hash
+	if checksum {
+		h = sha256.New()
+		w = io.MultiWriter(w, h)
+	}
+	elem := make([]byte, wc.n32*4)
+	for i := 0; i < int(wc.witnessSize); i++ {
+		_, err := wc.getWitness(i)
 		if err != nil {
-			return nil, err
+			return c, err
+		}
+
+		for j := 0; j < int(wc.n32); j++ {
+			val, err := wc.readSharedRWMemoryInt32(j)
+			if err != nil {
+				return c, err
+			}
+			binary.LittleEndian.PutUint32(elem[j*4:], uint32(val))
+		}
+		if _, err := w.Write(elem); err != nil {
+			return c, err
 		}
-		_ = binary.Write(buff, binary.LittleEndian, uint32(val.(int32)))
 	}
 
-	// witness size
-	_ = binary.Write(buff, binary.LittleEndian, uint32(wc.witnessSize))
+	wc.timer.lap(phaseExtract)
+	if h != nil {
+		copy(c[:], h.Sum(nil))
+		if wc.opts.checksum != nil {
+			wc.opts.checksum(c)
+		}
+	}
+	wc.reportStats()
+	return c, nil
+}
+
+// CalculateBinWitnessFile calculates the witness in binary given the inputs
+// and writes it to the file at path in chunks of field elements through a
+// write buffer, for witnesses too big to hold in Go memory.  The file is
+// removed on errors.
+func (wc *Circom2WitnessCalculator) CalculateBinWitnessFile(path string, inputs map[string]interface{}, sanityCheck bool) error {
+	return writeFile(path, func(w io.Writer) error {
+		return wc.CalculateBinWitnessTo(w, inputs, sanityCheck)
+	})
+}
+
+// CalculateWTNSBin calculates the witness given the inputs in the snarkjs wtns
+// version 2 format.
+func (wc *Circom2WitnessCalculator) CalculateWTNSBin(inputs map[string]interface{}, sanityCheck bool) (_ []byte, err error) {
+	buff := new(bytes.Buffer)
 
-	//id section 2
-	_ = binary.Write(buff, binary.LittleEndian, uint32(2))
+	wc.startStats()
+	defer func() { wc.timer.end(err) }()
+	err = wc.doCalculateWitness(inputs, sanityCheck)
+	if err != nil {
+		return nil, err
+	}
 
-	// section 2 length
-	idSection2length := n8 * wc.witnessSize
-	_ = binary.Write(buff, binary.LittleEndian, uint64(idSection2length))
+	n8 := wc.n32 * 4
+	buff.Grow(wc.binWitnessSize() + int(n8) + 44)
+	if err := writeWTNSHeader(buff, wc.prime, int(n8), int(wc.witnessSize), wc.wtnsCircuitHash()); err != nil {
+		return nil, err
+	}
+	witnessStart := buff.Len()
 
 	for i := 0; i < int(wc.witnessSize); i++ {
 		_, err := wc.getWitness(i)
@@ -280,141 +794,251 @@ func (wc *Circom2WitnessCalculator) CalculateWTNSBin(inputs map[string]interface
 		}
 
 		for j := 0; j < int(wc.n32); j++ {
-			val, err := wc.readSharedRWMemory(j)
+			val, err := wc.readSharedRWMemoryInt32(j)
 			if err != nil {
 				return nil, err
 			}
-			_ = binary.Write(buff, binary.LittleEndian, uint32(val.(int32)))
+			_ = binary.Write(buff, binary.LittleEndian, uint32(val))
 		}
 	}
 
+	wc.timer.lap(phaseExtract)
+	if wc.opts.checksum != nil {
+		wc.opts.checksum(BinWitnessChecksum(buff.Bytes()[witnessStart:]))
+	}
+	wc.reportStats()
 	return buff.Bytes(), nil
 }
 
-// CalculateWitness calculates the witness given the inputs.
+// doCalculateWitness is an internal function that calculates the witness.
 func (wc *Circom2WitnessCalculator) doCalculateWitness(inputs map[string]interface{}, sanityCheck bool) error {
-	//input is assumed to be a map from signals to arrays of bigInts
+	inputs, err := wc.opts.normalizeInputs(inputs, wc.prime)
+	if err != nil {
+		return err
+	}
+	if wc.opts.lintInputs {
+		if err := logLintWarnings(inputs, wc.prime, wc.opts.binaryInputs); err != nil {
+			return err
+		}
+	}
+	signals, err := newSignalInputs(inputs)
+	if err != nil {
+		return err
+	}
+	return wc.doCalculateWitnessSignals(signals, sanityCheck)
+}
+
+// doCalculateWitnessSignals is an internal function that calculates the
+// witness of the hashed input signals.
+func (wc *Circom2WitnessCalculator) doCalculateWitnessSignals(signals []signalInput, sanityCheck bool) error {
+	inputSizes, err := wc.inputSignalSizes()
+	if err != nil {
+		return err
+	}
+	if signals, err = wc.opts.fillMissingInputs(signals, inputSizes); err != nil {
+		return err
+	}
 	sanityCheckVal := int32(0)
 	if sanityCheck {
 		sanityCheckVal = 1
 	}
-	_, err := wc.init(sanityCheckVal)
+	wc.calculated = false
+	wc.logger.reset()
+	wc.timer.lap(phaseNone)
+	_, err = wc.init(sanityCheckVal)
 	if err != nil {
 		return err
 	}
+	wc.timer.lap(phaseInit)
 
 	inputCounter := 0
-	for inputName, inputValue := range inputs {
-		hMSB, hLSB := fnvHash(inputName)
-		fSlice := flatSlice(inputValue)
+	for _, signal := range signals {
+		hMSB, hLSB := signal.id.MSB, signal.id.LSB
+		fSlice := signal.values
 
 		if wc.getInputSignalSize != nil {
-			signalSize, err := wc.getInputSignalSize(hMSB, hLSB)
+			res, err := wc.getInputSignalSize(hMSB, hLSB)
+			if err != nil {
+				return err
+			}
+			signalSize, err := int32Result("getInputSignalSize", res)
 			if err != nil {
 				return err
 			}
 
-			if signalSize.(int32) < 0 {
-				return fmt.Errorf("signal %s not found", inputName)
+			// Unknown signals give -1, or 0 depending on the module state:
+			// input signals have at least one element.
+			if signalSize <= 0 {
+				return ErrUnknownInput{Name: signal.name}
 			}
-			if len(fSlice) < int(signalSize.(int32)) {
-				return fmt.Errorf("not enough values for input signal %s", inputName)
+			if a := signal.ndarray; a != nil && a.Size() != int(signalSize) {
+				return fmt.Errorf("shape %v of input signal %s doesn't match its size %d",
+					a.Shape, signal.name, signalSize)
 			}
-			if len(fSlice) > int(signalSize.(int32)) {
-				return fmt.Errorf("too many values for input signal %s", inputName)
+			if len(fSlice) != int(signalSize) {
+				return inputSizeError{name: signal.name, values: len(fSlice), size: int(signalSize)}
 			}
+		} else if err := signal.checkSize(wc.opts.signalSizes); err != nil {
+			return err
 		}
 
-		for i := 0; i < len(fSlice); i++ {
-			arrFr, err := toArray32(fSlice[i], int(wc.n32))
-			if err != nil {
-				return err
-			}
-			for j := 0; j < int(wc.n32); j++ {
-				_, err := wc.writeSharedRWMemory(j, int32(arrFr[int(wc.n32)-1-j]))
-				if err != nil {
-					return err
-				}
-			}
-			_, err = wc.setInputSignal(hMSB, hLSB, i)
-			if err != nil {
-				return err
-			}
-			inputCounter++
+		wc.timer.inputs(len(fSlice) * int(wc.n32*4))
+		if wc.getInputSignalBuffer != nil && wc.writeMemory != nil {
+			err = wc.setSignalBuffer(signal, sanityCheck)
+		} else {
+			err = wc.setSignalElements(signal, sanityCheck)
 		}
+		if err != nil {
+			return err
+		}
+		inputCounter += len(fSlice)
 	}
-	inputSize, err := wc.getInputSize()
-	if inputCounter < int(inputSize.(int32)) {
-		return fmt.Errorf("not all inputs have been set: only %d out of %d", inputCounter, inputSize)
+	res, err := wc.getInputSize()
+	if err != nil {
+		return err
+	}
+	inputSize, err := int32Result("getInputSize", res)
+	if err != nil {
+		return err
+	}
+	if inputCounter < int(inputSize) {
+		return missingInputsError{set: inputCounter, size: int(inputSize)}
 	}
+	wc.calculated = true
+	wc.timer.lap(phaseSetInputs)
 	return nil
 }
 
-func getExceptionHandler(store *wasmer.Store) wasmer.IntoExtern {
-	function := wasmer.NewFunction(
-		store,
-		wasmer.NewFunctionType(
-			wasmer.NewValueTypes(wasmer.I32), // one i32 argument
-			wasmer.NewValueTypes(),           // zero results
-		),
-		func(args []wasmer.Value) ([]wasmer.Value, error) {
-			if len(args) > 0 {
-				code := args[0].I32()
-				var errStr string
-				if code == 1 {
-					errStr = "Signal not found. "
-				} else if code == 2 {
-					errStr = "Too many signals set. "
-				} else if code == 3 {
-					errStr = "Signal already set. "
-				} else if code == 4 {
-					errStr = "Assert Failed. "
-				} else if code == 5 {
-					errStr = "Not enough memory. "
-				} else if code == 6 {
-					errStr = "Input signal array access exceeds the size"
-				} else {
-					errStr = "Unknown error"
-				}
-				fmt.Println(errStr)
-			}
-			return []wasmer.Value{}, nil
-		},
-	)
-	return function
-}
-
-func getShowSharedRWMemory(store *wasmer.Store) wasmer.IntoExtern {
-	function := wasmer.NewFunction(
-		store,
-		wasmer.NewFunctionType(
-			wasmer.NewValueTypes(),
-			wasmer.NewValueTypes(),
-		),
-		func(args []wasmer.Value) ([]wasmer.Value, error) {
-			return []wasmer.Value{}, nil
-		},
-	)
-	return function
-}
-
-func getLog(store *wasmer.Store) wasmer.IntoExtern {
-	function := wasmer.NewFunction(
-		store,
-		wasmer.NewFunctionType(
-			wasmer.NewValueTypes(),
-			wasmer.NewValueTypes(),
-		),
-		func(args []wasmer.Value) ([]wasmer.Value, error) {
-			return []wasmer.Value{}, nil
-		},
-	)
-	return function
+// signalLimbs returns the little-endian 32 bit limbs of the element i of the
+// input signal.
+func (wc *Circom2WitnessCalculator) signalLimbs(signal signalInput, i int) ([]byte, error) {
+	if signal.encoded != nil {
+		return signal.encoded[i], nil
+	}
+	limbs, err := wc.encodeFr(signal.values[i])
+	if err != nil {
+		return nil, fmt.Errorf("input %s[%d] = %v: %w", signal.name, i, signal.values[i], err)
+	}
+	return limbs, nil
+}
+
+// setInputError returns the error err of the module setting an input signal,
+// with the partial witness with WithPartialWitness.
+func (wc *Circom2WitnessCalculator) setInputError(err error, sanityCheck bool) error {
+	if sanityCheck && wc.opts.partialWitness {
+		return newPartialWitnessError(err, wc.readWitness)
+	}
+	return err
+}
+
+// setSignalElements sets the values of the input signal one at a time,
+// through the shared memory and a setInputSignal call each.
+func (wc *Circom2WitnessCalculator) setSignalElements(signal signalInput, sanityCheck bool) error {
+	for i := range signal.values {
+		limbs, err := wc.signalLimbs(signal, i)
+		if err != nil {
+			return err
+		}
+		if err := canceled(wc.ctx); err != nil {
+			return err
+		}
+		if err := wc.writeSharedRWMemoryLimbs(limbs); err != nil {
+			return err
+		}
+		if _, err := wc.setInputSignal(signal.id.MSB, signal.id.LSB, i); err != nil {
+			return wc.setInputError(err, sanityCheck)
+		}
+	}
+	return nil
+}
+
+// setSignalBuffer sets the values of the input signal array at once: their
+// limbs are copied into the buffer of the signal, whose offset in the memory
+// is looked up once, and set with a single setInputSignalBuffer call.
+func (wc *Circom2WitnessCalculator) setSignalBuffer(signal signalInput, sanityCheck bool) error {
+	size := int(wc.n32 * 4)
+	buf := make([]byte, len(signal.values)*size)
+	for i := range signal.values {
+		limbs, err := wc.signalLimbs(signal, i)
+		if err != nil {
+			return err
+		}
+		copy(buf[i*size:], limbs)
+	}
+	if err := canceled(wc.ctx); err != nil {
+		return err
+	}
+	res, err := wc.getInputSignalBuffer(signal.id.MSB, signal.id.LSB)
+	if err != nil {
+		return err
+	}
+	offset, err := int32Result("getInputSignalBuffer", res)
+	if err != nil {
+		return err
+	}
+	if offset <= 0 {
+		return fmt.Errorf("input signal %s has no buffer", signal.name)
+	}
+	if err := wc.writeMemory(int(offset), buf); err != nil {
+		return fmt.Errorf("input %s: %w", signal.name, err)
+	}
+	if _, err := wc.setInputSignalBuffer(signal.id.MSB, signal.id.LSB); err != nil {
+		return wc.setInputError(err, sanityCheck)
+	}
+	return nil
+}
+
+// encodeFr returns the little-endian 32 bit limbs of the Field element v.
+func (wc *Circom2WitnessCalculator) encodeFr(v SignalValue) ([]byte, error) {
+	limbs := make([]byte, wc.n32*4)
+	if err := fillLE(limbs, v); err != nil {
+		return nil, err
+	}
+	return limbs, nil
+}
+
+// limbsLE returns the little-endian bytes of the big-endian 32 bit words arr.
+func limbsLE(arr []uint32) []byte {
+	n32 := len(arr)
+	limbs := make([]byte, n32*4)
+	for j := 0; j < n32; j++ {
+		binary.LittleEndian.PutUint32(limbs[j*4:], arr[n32-1-j])
+	}
+	return limbs
+}
+
+// writeSharedRWMemoryFr writes the Field element arr, as returned by
+// toArray32, to the shared memory.
+func (wc *Circom2WitnessCalculator) writeSharedRWMemoryFr(arr []uint32) error {
+	return wc.writeSharedRWMemoryLimbs(limbsLE(arr))
+}
+
+// writeSharedRWMemoryLimbs writes the little-endian limbs of a Field element
+// to the shared memory: with a single copy into the module memory when the
+// backend supports it, or one writeSharedRWMemory call per 32 bit word
+// otherwise.
+func (wc *Circom2WitnessCalculator) writeSharedRWMemoryLimbs(limbs []byte) error {
+	if wc.writeMemory != nil {
+		return wc.writeMemory(int(wc.sharedRWMemoryStart), limbs)
+	}
+	for j := 0; j < int(wc.n32); j++ {
+		_, err := wc.writeSharedRWMemory(j, int32(binary.LittleEndian.Uint32(limbs[j*4:])))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func toArray32(s *big.Int, size int) ([]uint32, error) {
+	if s.Sign() < 0 {
+		return nil, fmt.Errorf("negative value")
+	}
+	if s.BitLen() > size*32 {
+		return nil, fmt.Errorf("value doesn't fit in %d bits", size*32)
+	}
 	res := make([]uint32, size)
-	rem := s
+	rem := new(big.Int).Set(s)
 
 	radix := big.NewInt(0x100000000)
 	zero := big.NewInt(0)
@@ -0,0 +1,256 @@
+//go:build js && wasm
+// +build js,wasm
+
+package witnesscalc
+
+import (
+	"errors"
+	"fmt"
+	"syscall/js"
+)
+
+// jsCircom2Instance is a WitnessCalc WASM module instantiated by the
+// WebAssembly API of the JavaScript host.
+type jsCircom2Instance struct {
+	exports js.Value
+	funcs   []js.Func
+	// exception is the last error reported by the module through the
+	// runtime.exceptionHandler import.
+	exception error
+}
+
+// circom2Imports are the imports provided to circom 2 WitnessCalc WASM
+// modules.
+var circom2Imports = map[string]bool{
+	"runtime.exceptionHandler":   true,
+	"runtime.showSharedRWMemory": true,
+	"runtime.log":                true,
+}
+
+// NewCircom2WitnessCalculator creates a new WitnessCalculator from the WitnessCalc
+// WASM module, instantiated with the WebAssembly API of the JavaScript host
+// (browser or Node.js).  The module is compiled synchronously, which browsers
+// only allow for big modules from Web Workers.
+func NewCircom2WitnessCalculator(wasmBytes []byte, opts ...Option) (*Circom2WitnessCalculator, error) {
+	wc := newCircom2WitnessCalculator(opts)
+	if err := wc.loadCircuit(wasmBytes); err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+// loadModule instantiates the WitnessCalc WASM module with the WebAssembly
+// API of the JavaScript host and returns the temporary calculator bound to it,
+// for swapModule.
+func (wc *Circom2WitnessCalculator) loadModule(wasmBytes []byte) (m *Circom2WitnessCalculator, err error) {
+	webAssembly := js.Global().Get("WebAssembly")
+	if webAssembly.IsUndefined() {
+		return nil, errors.New("WebAssembly is not supported by the JavaScript host")
+	}
+	provided := circom2Imports
+	var release []wasmImport
+	if wc.opts.releaseMode {
+		release, provided, err = releaseImports(wasmBytes, provided)
+		if err != nil {
+			return nil, err
+		}
+	}
+	stubs, err := stubImports(wasmBytes, provided, wc.opts.importMode)
+	if err != nil {
+		return nil, err
+	}
+
+	inst := &jsCircom2Instance{}
+	showSharedRWMemory := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		wc.showSharedRWMemory()
+		return nil
+	})
+	exceptionHandler := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) > 0 {
+			inst.exception = errors.New(exceptionMessage(int32(args[0].Int())))
+		}
+		return nil
+	})
+	noop := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return nil
+	})
+	inst.funcs = []js.Func{exceptionHandler, showSharedRWMemory, noop}
+	namespaces := map[string]map[string]interface{}{
+		"env": {},
+		"runtime": {
+			"exceptionHandler":   exceptionHandler,
+			"showSharedRWMemory": showSharedRWMemory,
+			"log":                noop,
+		},
+	}
+	for _, imp := range stubs {
+		stub := inst.stub(imp)
+		inst.funcs = append(inst.funcs, stub)
+		namespaces[imp.Module][imp.Name] = stub
+	}
+	for _, imp := range release {
+		namespaces[imp.Module][imp.Name] = releaseStub(imp)
+	}
+	if _, ok, err := abortImport(wasmBytes); err != nil {
+		return nil, err
+	} else if ok {
+		abort := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			values := make([]uint32, len(args))
+			for i, arg := range args {
+				values[i] = uint32(arg.Int())
+			}
+			wc.abortErr = decodeAbort(inst.readMemory, values)
+			// JavaScript functions can't trap: the call fails at the
+			// unreachable that follows abort in the modules.
+			return nil
+		})
+		inst.funcs = append(inst.funcs, abort)
+		namespaces["env"]["abort"] = abort
+	}
+	defer func() {
+		// Release the functions of the instance that won't be used.
+		if err != nil {
+			inst.release()
+		}
+	}()
+	defer recoverJSError(&err)
+	imports := make(map[string]interface{}, len(namespaces))
+	for name, namespace := range namespaces {
+		imports[name] = namespace
+	}
+
+	bytes := js.Global().Get("Uint8Array").New(len(wasmBytes))
+	js.CopyBytesToJS(bytes, wasmBytes)
+	module := webAssembly.Get("Module").New(bytes)
+	instance := webAssembly.Get("Instance").New(module, imports)
+	inst.exports = instance.Get("exports")
+
+	var writeMemory circom2Memory
+	var memorySize func() int
+	if inst.exports.Get("memory").Type() == js.TypeObject {
+		writeMemory = inst.writeMemory
+		memorySize = inst.memorySize
+	}
+	return wc.newModule(inst, inst.export, writeMemory, memorySize)
+}
+
+// stub returns a function for the import imp that does nothing and returns
+// zero.
+func (inst *jsCircom2Instance) stub(imp wasmImport) js.Func {
+	var zero interface{}
+	if len(imp.Results) > 0 {
+		zero = 0
+		if imp.Results[0] == wasmValueI64 {
+			zero = js.Global().Get("BigInt").Invoke(0)
+		}
+	}
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return zero
+	})
+}
+
+// releaseStub returns a JavaScript function for the import imp of
+// WithReleaseMode, which does nothing and returns zero without calling into
+// Go.
+func releaseStub(imp wasmImport) js.Value {
+	body := ""
+	if len(imp.Results) > 0 {
+		body = "return 0"
+		if imp.Results[0] == wasmValueI64 {
+			body = "return BigInt(0)"
+		}
+	}
+	return js.Global().Get("Function").New(body)
+}
+
+// loadSnapshot fails, as the WebAssembly API can't deserialize compiled
+// modules.
+func (wc *Circom2WitnessCalculator) loadSnapshot(s *moduleSnapshot) (*Circom2WitnessCalculator, error) {
+	return nil, ErrSnapshotUnsupported
+}
+
+// releaseCircom2Instance releases the Go functions imported by the instance of
+// a module replaced by swapModule.
+func releaseCircom2Instance(instance interface{}) {
+	if inst, ok := instance.(*jsCircom2Instance); ok {
+		inst.release()
+	}
+}
+
+// release releases the Go functions imported by the instance.
+func (inst *jsCircom2Instance) release() {
+	for _, f := range inst.funcs {
+		f.Release()
+	}
+}
+
+// export returns the exported function name, converting the thrown
+// JavaScript exceptions into errors.
+func (inst *jsCircom2Instance) export(name string) (nativeFunction, error) {
+	f := inst.exports.Get(name)
+	if f.Type() != js.TypeFunction {
+		return nil, fmt.Errorf("exported function %s not found", name)
+	}
+	return func(args ...interface{}) (res interface{}, err error) {
+		inst.exception = nil
+		defer func() {
+			if err != nil && inst.exception != nil {
+				err = fmt.Errorf("%v: %w", inst.exception, err)
+			}
+		}()
+		defer recoverJSError(&err)
+		v := f.Invoke(args...)
+		if v.Type() != js.TypeNumber {
+			return nil, nil
+		}
+		return int32(v.Int()), nil
+	}, nil
+}
+
+// memorySize returns the size of the memory exported by the module.
+func (inst *jsCircom2Instance) memorySize() int {
+	return inst.exports.Get("memory").Get("buffer").Get("byteLength").Int()
+}
+
+// readMemory returns the n bytes at offset p of the memory exported by the
+// module.
+func (inst *jsCircom2Instance) readMemory(p, n uint32) (b []byte, err error) {
+	defer recoverJSError(&err)
+	memory := inst.exports.Get("memory")
+	if memory.Type() != js.TypeObject {
+		return nil, errors.New("the module doesn't export its memory")
+	}
+	buffer := memory.Get("buffer")
+	if size := buffer.Get("byteLength").Int(); int64(p)+int64(n) > int64(size) {
+		return nil, fmt.Errorf("memory access [%d, %d) out of bounds (%d bytes)", p, int64(p)+int64(n), size)
+	}
+	b = make([]byte, n)
+	js.CopyBytesToGo(b, js.Global().Get("Uint8Array").New(buffer, p, n))
+	return b, nil
+}
+
+// writeMemory copies b at offset of the memory exported by the module.
+func (inst *jsCircom2Instance) writeMemory(offset int, b []byte) (err error) {
+	defer recoverJSError(&err)
+	// The buffer is replaced when the memory grows
+	buffer := inst.exports.Get("memory").Get("buffer")
+	if size := buffer.Get("byteLength").Int(); offset < 0 || offset > size-len(b) {
+		return fmt.Errorf("memory access [%d, %d) out of bounds (%d bytes)", offset, offset+len(b), size)
+	}
+	js.CopyBytesToJS(js.Global().Get("Uint8Array").New(buffer, offset, len(b)), b)
+	return nil
+}
+
+// recoverJSError recovers from the panic raised by syscall/js when a
+// JavaScript exception is thrown, storing it in err.
+func recoverJSError(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	jsErr, ok := r.(js.Error)
+	if !ok {
+		panic(r)
+	}
+	*err = jsErr
+}
@@ -1,9 +1,20 @@
 package witnesscalc
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io/fs"
 	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -17,7 +28,7 @@ func TestCircom2CalculateWitness(t *testing.T) {
 	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
 	require.NoError(t, err)
 
-	calc, err := NewCircom2WitnessCalculator(wasmBytes, true)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
 	require.NoError(t, err)
 	require.NotEmpty(t, calc)
 
@@ -36,7 +47,7 @@ func TestCircom2CalculateBinWitness(t *testing.T) {
 	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
 	require.NoError(t, err)
 
-	calc, err := NewCircom2WitnessCalculator(wasmBytes, true)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
 	require.NoError(t, err)
 	require.NotEmpty(t, calc)
 
@@ -48,6 +59,15 @@ func TestCircom2CalculateBinWitness(t *testing.T) {
 	require.NotEmpty(t, witnessBytes)
 }
 
+func TestCircom2BinWitnessSize(t *testing.T) {
+	if strconv.IntSize < 64 {
+		t.Skip("the witness size doesn't fit in int")
+	}
+	// 2^26 signals of 8 32-bit words overflow the witness size in int32.
+	wc := &Circom2WitnessCalculator{witnessSize: 1 << 26, n32: 8}
+	require.Equal(t, int64(1)<<31, int64(wc.binWitnessSize()))
+}
+
 func TestCircom2CalculateWTNSBin(t *testing.T) {
 	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
 	require.NoError(t, err)
@@ -55,7 +75,7 @@ func TestCircom2CalculateWTNSBin(t *testing.T) {
 	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
 	require.NoError(t, err)
 
-	calc, err := NewCircom2WitnessCalculator(wasmBytes, true)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
 	require.NoError(t, err)
 	require.NotEmpty(t, calc)
 
@@ -66,5 +86,1094 @@ func TestCircom2CalculateWTNSBin(t *testing.T) {
 	require.NoError(t, err)
 	require.NotEmpty(t, wtnsBytes)
 
+	h, err := VerifyWTNS(bytes.NewReader(wtnsBytes))
+	require.NoError(t, err)
+	require.Equal(t, uint32(32), h.N8)
+	require.Equal(t, bn254, h.Prime)
+	binWitness, err := calc.CalculateBinWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, uint32(len(binWitness)/32), h.NWitness)
+	require.Equal(t, binWitness, wtnsBytes[len(wtnsBytes)-len(binWitness):])
+
 	_ = ioutil.WriteFile("test_files/circom2/witness.wtns", wtnsBytes, fs.FileMode(defaultFileMode))
 }
+
+func TestCircom2CalculateWitnessHashed(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	witness, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+
+	var hashedInputs []HashedInput
+	for inputName, inputValue := range inputs {
+		values, err := FlattenSignal(inputValue)
+		require.NoError(t, err)
+		hashedInputs = append(hashedInputs, HashedInput{ID: NewSignalID(inputName), Values: values})
+	}
+	hashedWitness, err := calc.CalculateWitnessHashed(hashedInputs, true)
+	require.NoError(t, err)
+	require.Equal(t, witness, hashedWitness)
+}
+
+func TestCircom2CalculateWitnessStatic(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	witness, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+
+	staticInputs := make(map[string]interface{})
+	dynamicInputs := make(map[string]interface{})
+	for name, v := range inputs {
+		if name == "challenge" || name == "userAuthClaim" {
+			dynamicInputs[name] = v
+		} else {
+			staticInputs[name] = v
+		}
+	}
+	static, err := NewStaticInputs(staticInputs)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		staticWitness, err := calc.CalculateWitnessStatic(static, dynamicInputs, true)
+		require.NoError(t, err)
+		require.Equal(t, witness, staticWitness)
+	}
+
+	_, err = calc.CalculateWitnessStatic(static, inputs, true)
+	require.Error(t, err)
+}
+
+func TestCircom2UnknownInput(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	inputs["unknown"] = big.NewInt(1)
+	_, err = calc.CalculateWitness(inputs, true)
+	var unknownErr ErrUnknownInput
+	require.ErrorAs(t, err, &unknownErr)
+	require.Equal(t, "unknown", unknownErr.Name)
+	require.EqualError(t, err, "unknown input unknown")
+
+	// The calculator is still usable.
+	delete(inputs, "unknown")
+	_, err = calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+}
+
+func TestCircom2Checksum(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+
+	var checksums []Checksum
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithChecksum(func(c Checksum) {
+		checksums = append(checksums, c)
+	}))
+	require.NoError(t, err)
+
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	_, err = calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	binWitness, err := calc.CalculateBinWitness(inputs, true)
+	require.NoError(t, err)
+	_, err = calc.CalculateWTNSBin(inputs, true)
+	require.NoError(t, err)
+
+	expected := BinWitnessChecksum(binWitness)
+	require.Equal(t, []Checksum{expected, expected, expected}, checksums)
+}
+
+func TestCircom2Curve(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithCurve(CurveBN254))
+	require.NoError(t, err)
+	require.Equal(t, CurveBN254, calc.Curve())
+
+	_, err = NewCircom2WitnessCalculator(wasmBytes, WithCurve(CurvePallas))
+	require.Error(t, err)
+}
+
+func TestCircom2WriteMemory(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	var stats []Stats
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithStats(func(s Stats) {
+		stats = append(stats, s)
+	}))
+	require.NoError(t, err)
+	require.NotNil(t, calc.writeMemory)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+
+	// The same witness is calculated with writeSharedRWMemory calls.
+	calc.writeMemory = nil
+	slowW, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, slowW, w)
+	require.Less(t, stats[0].WASMCalls, stats[1].WASMCalls)
+}
+
+// bufferModule is a fake module of a build with input signal buffers: a
+// circuit of n32 = 1 whose witness is 1 followed by its inputs a[3] and b.
+type bufferModule struct {
+	mem     []byte
+	witness []int32
+	calls   map[string]int
+}
+
+func (b *bufferModule) exports(name string) (nativeFunction, error) {
+	ids := map[SignalID]int{NewSignalID("a"): 1, NewSignalID("b"): 4}
+	sizes := map[SignalID]int32{NewSignalID("a"): 3, NewSignalID("b"): 1}
+	id := func(args []interface{}) SignalID {
+		return SignalID{MSB: args[0].(int32), LSB: args[1].(int32)}
+	}
+	word := func(p int) int32 {
+		return int32(binary.LittleEndian.Uint32(b.mem[p:]))
+	}
+	funcs := map[string]nativeFunction{
+		"init": func(args ...interface{}) (interface{}, error) {
+			b.witness = []int32{1, 0, 0, 0, 0}
+			return nil, nil
+		},
+		"getFieldNumLen32":       func(args ...interface{}) (interface{}, error) { return int32(1), nil },
+		"getVersion":             func(args ...interface{}) (interface{}, error) { return int32(2), nil },
+		"getWitnessSize":         func(args ...interface{}) (interface{}, error) { return int32(5), nil },
+		"getInputSize":           func(args ...interface{}) (interface{}, error) { return int32(4), nil },
+		"getSharedRWMemoryStart": func(args ...interface{}) (interface{}, error) { return int32(0), nil },
+		"getRawPrime": func(args ...interface{}) (interface{}, error) {
+			binary.LittleEndian.PutUint32(b.mem, 4294967291)
+			return nil, nil
+		},
+		"getWitness": func(args ...interface{}) (interface{}, error) {
+			binary.LittleEndian.PutUint32(b.mem, uint32(b.witness[args[0].(int)]))
+			return nil, nil
+		},
+		"readSharedRWMemory": func(args ...interface{}) (interface{}, error) {
+			return word(4 * int(args[0].(int32))), nil
+		},
+		"writeSharedRWMemory": func(args ...interface{}) (interface{}, error) {
+			binary.LittleEndian.PutUint32(b.mem[4*args[0].(int):], uint32(args[1].(int32)))
+			return nil, nil
+		},
+		"getInputSignalSize": func(args ...interface{}) (interface{}, error) {
+			return sizes[id(args)], nil
+		},
+		"setInputSignal": func(args ...interface{}) (interface{}, error) {
+			b.witness[ids[id(args)]+args[2].(int)] = word(0)
+			return nil, nil
+		},
+		"getInputSignalBuffer": func(args ...interface{}) (interface{}, error) {
+			return int32(64 * ids[id(args)]), nil
+		},
+		"setInputSignalBuffer": func(args ...interface{}) (interface{}, error) {
+			i := ids[id(args)]
+			for j := 0; j < int(sizes[id(args)]); j++ {
+				b.witness[i+j] = word(64*i + 4*j)
+			}
+			return nil, nil
+		},
+	}
+	f, ok := funcs[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not exported", name)
+	}
+	return func(args ...interface{}) (interface{}, error) {
+		b.calls[name]++
+		return f(args...)
+	}, nil
+}
+
+func (b *bufferModule) writeMemory(offset int, data []byte) error {
+	dst, err := memRange(b.mem, int64(offset), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	copy(dst, data)
+	return nil
+}
+
+func TestCircom2InputSignalBuffer(t *testing.T) {
+	inputs := map[string]interface{}{"a": []int{2, 3, 4}, "b": 5}
+	expected := []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3), big.NewInt(4), big.NewInt(5)}
+
+	b := &bufferModule{mem: make([]byte, 512), calls: make(map[string]int)}
+	wc := newCircom2WitnessCalculator(nil)
+	m, err := wc.newModule(nil, b.exports, b.writeMemory, nil)
+	require.NoError(t, err)
+	wc.swapModule(m)
+	w, err := wc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, expected, w.Values())
+	// A single copy and call per input signal array
+	require.Equal(t, 2, b.calls["getInputSignalBuffer"])
+	require.Equal(t, 2, b.calls["setInputSignalBuffer"])
+	require.Equal(t, 0, b.calls["setInputSignal"])
+
+	// Buffers out of the memory are rejected.
+	b.mem = b.mem[:200]
+	_, err = wc.CalculateWitness(inputs, true)
+	require.EqualError(t, err, "input b: memory access [256, 260) out of bounds (200 bytes)")
+
+	// Without direct access to the memory, the values are set one at a time.
+	b = &bufferModule{mem: make([]byte, 512), calls: make(map[string]int)}
+	wc = newCircom2WitnessCalculator(nil)
+	m, err = wc.newModule(nil, b.exports, nil, nil)
+	require.NoError(t, err)
+	wc.swapModule(m)
+	w, err = wc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, expected, w.Values())
+	require.Equal(t, 0, b.calls["setInputSignalBuffer"])
+	require.Equal(t, 4, b.calls["setInputSignal"])
+}
+
+func TestCircom2CircuitLogs(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes,
+		WithCircuitName("circuit"), WithCircuitLogs())
+	require.NoError(t, err)
+
+	// The module calls runtime.showSharedRWMemory with the logged value in
+	// the shared memory.
+	arr, err := toArray32(big.NewInt(42), int(calc.n32))
+	require.NoError(t, err)
+	require.NoError(t, calc.writeSharedRWMemoryFr(arr))
+	calc.showSharedRWMemory()
+	require.Equal(t, []CircuitLog{{Circuit: "circuit", Seq: 0, Value: big.NewInt(42)}},
+		calc.CircuitLogs())
+}
+
+func TestCircom2InputNames(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	_, err = calc.InputNames()
+	require.Error(t, err)
+
+	// Symbols of the inputs, an output and a subcomponent signal.
+	syms := []Symbol{{Name: "main.out"}, {Name: "main.sub.in"}}
+	var expected []string
+	for name, value := range inputs {
+		expected = append(expected, name)
+		values, err := FlattenSignal(value)
+		require.NoError(t, err)
+		for i := range values {
+			syms = append(syms, Symbol{Name: fmt.Sprintf("main.%s[%d]", name, i)})
+		}
+	}
+	sort.Strings(expected)
+	calc, err = NewCircom2WitnessCalculator(wasmBytes, WithSymbols(syms))
+	require.NoError(t, err)
+	names, err := calc.InputNames()
+	require.NoError(t, err)
+	require.Equal(t, expected, names)
+}
+
+func TestCircom2ReloadModule(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+
+	instance := calc.instance
+	require.NoError(t, calc.ReloadModule(wasmBytes))
+	require.True(t, instance != calc.instance)
+	w2, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, w, w2)
+
+	// The calculator keeps the previous module on errors.
+	instance = calc.instance
+	require.Error(t, calc.ReloadModule([]byte("invalid")))
+	require.True(t, instance == calc.instance)
+	w2, err = calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, w, w2)
+}
+
+func TestCircom2Snapshot(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	snapshot, err := calc.Snapshot()
+	if errors.Is(err, ErrSnapshotUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+
+	// The snapshot doesn't depend on the calculations already made.
+	calc, err = NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	snapshot2, err := calc.Snapshot()
+	require.NoError(t, err)
+	require.Equal(t, len(snapshot), len(snapshot2))
+
+	restored, err := NewCircom2WitnessCalculatorFromSnapshot(snapshot)
+	require.NoError(t, err)
+	h, _ := restored.CircuitHash()
+	require.Equal(t, NewCircuitHash(wasmBytes), h)
+	w2, err := restored.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, w, w2)
+	// The restored calculators can be snapshotted too.
+	snapshot2, err = restored.Snapshot()
+	require.NoError(t, err)
+	require.Equal(t, len(snapshot), len(snapshot2))
+
+	corrupted := append([]byte(nil), snapshot...)
+	corrupted[len(corrupted)/2] ^= 1
+	_, err = NewCircom2WitnessCalculatorFromSnapshot(corrupted)
+	require.EqualError(t, err, "corrupted snapshot")
+	_, err = NewCircom2WitnessCalculatorFromSnapshot(snapshot[:len(snapshot)-1])
+	require.Error(t, err)
+	_, err = NewCircom2WitnessCalculatorFromSnapshot(wasmBytes)
+	require.EqualError(t, err, "invalid snapshot")
+}
+
+func TestCircom2WitnessCalculatorFromReaderFS(t *testing.T) {
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	f, err := os.Open("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	defer f.Close()
+	calc, err := NewCircom2WitnessCalculatorFromReader(f)
+	require.NoError(t, err)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+
+	calc, err = NewCircom2WitnessCalculatorFromFS(os.DirFS("test_files"), "circom2/circuit.wasm")
+	require.NoError(t, err)
+	w2, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, w, w2)
+
+	_, err = NewCircom2WitnessCalculatorFromFS(os.DirFS("test_files"), "circom2/missing.wasm")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestCircom2CalculateBinWitnessFile(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "circom2")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	wb, err := calc.CalculateBinWitness(inputs, true)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "witness.bin")
+	require.NoError(t, calc.CalculateBinWitnessFile(path, inputs, true))
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, wb, b)
+
+	// The file is removed on errors.
+	path = filepath.Join(dir, "failed.bin")
+	require.Error(t, calc.CalculateBinWitnessFile(path, map[string]interface{}{"x": big.NewInt(1)}, true))
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestCircom2ImportMode(t *testing.T) {
+	module := newImportsModule(false)
+	_, err := NewCircom2WitnessCalculator(module)
+	require.EqualError(t, err, "missing WASM imports: runtime.newThing")
+
+	// The module is instantiated, but it is not a WitnessCalc module.
+	_, err = NewCircom2WitnessCalculator(module, WithImportMode(ImportsPermissive))
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "missing WASM imports")
+}
+
+func TestCircom2ReleaseMode(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	expected, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	calc, err = NewCircom2WitnessCalculator(wasmBytes, WithReleaseMode(), WithCircuitLogs())
+	require.NoError(t, err)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, expected, w)
+	require.Empty(t, calc.CircuitLogs())
+
+	// The debug imports are resolved by the release stubs.
+	module := newRuntimeImportModule("printErrorMessage", false)
+	_, err = NewCircom2WitnessCalculator(module)
+	require.EqualError(t, err, "missing WASM imports: runtime.printErrorMessage")
+	_, err = NewCircom2WitnessCalculator(module, WithReleaseMode())
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "missing WASM imports")
+}
+
+func TestCircom2Compressed(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	expected, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+
+	compressed := gzipBytes(t, wasmBytes)
+	calc, err = NewCircom2WitnessCalculator(compressed)
+	require.NoError(t, err)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, expected, w)
+	h, ok := calc.CircuitHash()
+	require.True(t, ok)
+	require.Equal(t, NewCircuitHash(wasmBytes), h)
+	require.NoError(t, calc.ReloadModule(compressed))
+
+	auto, err := NewAutoWitnessCalculator(compressed)
+	require.NoError(t, err)
+	require.IsType(t, &Circom2WitnessCalculator{}, auto)
+}
+
+func TestCircom2DefaultSanityCheck(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithDefaultSanityCheck(true))
+	require.NoError(t, err)
+	expected, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	w, err := calc.Calculate(inputs)
+	require.NoError(t, err)
+	require.Equal(t, expected, w)
+	expectedBin, err := calc.CalculateBinWitness(inputs, true)
+	require.NoError(t, err)
+	binWitness, err := calc.CalculateBin(inputs)
+	require.NoError(t, err)
+	require.Equal(t, expectedBin, binWitness)
+	wtnsBytes, err := calc.CalculateWTNS(inputs)
+	require.NoError(t, err)
+	require.Equal(t, expectedBin, wtnsBytes[len(wtnsBytes)-len(expectedBin):])
+}
+
+func TestCircom2Stats(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	var stats []Stats
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithStats(func(s Stats) {
+		stats = append(stats, s)
+	}))
+	require.NoError(t, err)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	_, err = calc.CalculateWTNSBin(inputs, true)
+	require.NoError(t, err)
+
+	require.Len(t, stats, 2)
+	for _, s := range stats {
+		// every witness value is read with getWitness and n32 readSharedRWMemory
+		require.Greater(t, s.WASMCalls, w.Len()*9)
+		require.True(t, s.Total >= s.Init+s.SetInputs+s.Extract)
+		require.Greater(t, int64(s.Extract), int64(0))
+		require.Equal(t, w.Len()*32, s.WitnessBytes)
+		require.Greater(t, s.InputsBytes, 0)
+		require.Greater(t, s.MemPeak, 0)
+	}
+}
+
+func TestCircom2Tracer(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	var tracer testTracer
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithTracer(&tracer))
+	require.NoError(t, err)
+	require.Equal(t, []string{SpanLoad}, tracer.names())
+
+	tracer = testTracer{}
+	_, err = calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		SpanCalculate + "/" + SpanInit,
+		SpanCalculate + "/" + SpanSetInputs,
+		SpanCalculate + "/" + SpanExtract,
+		SpanCalculate,
+	}, tracer.names())
+
+	tracer = testTracer{}
+	ctx, _ := (&testTracer{}).Start(context.Background(), "prove", time.Now())
+	res, err := calc.CalculateWitnessAsync(ctx, inputs)
+	require.NoError(t, err)
+	require.NoError(t, (<-res).Err)
+	require.Contains(t, tracer.names(), "prove/"+SpanCalculate)
+
+	tracer = testTracer{}
+	_, err = calc.CalculateWTNSBin(map[string]interface{}{"z": big.NewInt(1)}, true)
+	require.Error(t, err)
+	names := tracer.names()
+	require.Equal(t, SpanCalculate, names[len(names)-1])
+	require.Equal(t, err, tracer.spans[len(names)-1].err)
+}
+
+func TestToArray32(t *testing.T) {
+	v := new(big.Int).SetUint64(0x100000002)
+	arr, err := toArray32(v, 4)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{0, 0, 1, 2}, arr)
+	require.Equal(t, "4294967298", v.String())
+	require.Equal(t, v, fromArray32(arr))
+
+	_, err = toArray32(new(big.Int).Lsh(big.NewInt(1), 128), 4)
+	require.Error(t, err)
+
+	_, err = toArray32(big.NewInt(-1), 4)
+	require.Error(t, err)
+}
+
+func TestCircom2MalformedModule(t *testing.T) {
+	results := map[string]interface{}{
+		"getFieldNumLen32":   int32(8),
+		"getVersion":         int32(2),
+		"getWitnessSize":     int32(4),
+		"readSharedRWMemory": int32(1),
+	}
+	exports := func(name string) (nativeFunction, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			return results[name], nil
+		}, nil
+	}
+	wc := newCircom2WitnessCalculator(nil)
+	m, err := wc.newModule(nil, exports, nil, nil)
+	require.NoError(t, err)
+	wc.swapModule(m)
+
+	for name, tc := range map[string]struct {
+		export string
+		result interface{}
+		errMsg string
+	}{
+		"result type": {"getFieldNumLen32", int64(8), "getFieldNumLen32 returned int64, expected i32"},
+		"field size":  {"getFieldNumLen32", int32(1 << 20), "invalid field element size 1048576"},
+		"witness":     {"getWitnessSize", int32(-4), "invalid witness size -4"},
+		"memory":      {"readSharedRWMemory", nil, "readSharedRWMemory returned <nil>, expected i32"},
+	} {
+		old := results[tc.export]
+		results[tc.export] = tc.result
+		_, err := newCircom2WitnessCalculator(nil).newModule(nil, exports, nil, nil)
+		require.EqualError(t, err, tc.errMsg, name)
+		results[tc.export] = old
+	}
+
+	// A module with another prime can't replace the module.
+	prime := wc.prime
+	results["readSharedRWMemory"] = int32(2)
+	_, err = wc.newModule(nil, exports, nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "doesn't match the prime")
+	require.Equal(t, prime, wc.prime)
+}
+
+func TestCircom2ReadModuleInfo(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	info, err := ReadModuleInfo(wasmBytes)
+	require.NoError(t, err)
+	require.Equal(t, 2, info.Circom)
+	require.Equal(t, int32(2), info.Version)
+	require.Equal(t, CurveBN254, info.Curve)
+	require.Equal(t, 0, info.Prime.Cmp(CurveBN254.Prime()))
+	require.Equal(t, 4, info.N64)
+	require.Contains(t, info.Exports, "getWitnessSize")
+	require.Contains(t, info.Imports, "runtime.exceptionHandler")
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, int(info.NVars), w.Len())
+}
+
+func TestCircom2SignalValues(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	expected, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+
+	root := inputs["userClaimsTreeRoot"].(*big.Int)
+	inputs["userClaimsTreeRoot"] = HexString(root.Text(16))
+	inputs["challenge"] = Uint64(1)
+	inputs["userAuthClaimNonRevMtpNoAux"] = BitArray{true}
+	inputs["userRevTreeRoot"] = BytesLE{0, 0}
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, expected, w)
+}
+
+func TestCircom2JSWitnessCalculator(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	expected, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	expectedWTNS, err := calc.CalculateWTNSBin(inputs, true)
+	require.NoError(t, err)
+
+	jsCalc, err := NewJSWitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), jsCalc.Version())
+	require.Equal(t, int32(8), jsCalc.N32())
+	require.Equal(t, int32(expected.Len()), jsCalc.WitnessSize())
+	require.Equal(t, 0, jsCalc.Prime().Cmp(CurveBN254.Prime()))
+
+	// values are reduced modulo the prime
+	p := CurveBN254.Prime()
+	inputs["challenge"] = new(big.Int).Add(p, big.NewInt(1))
+	inputs["userRevTreeRoot"] = new(big.Int).Neg(p)
+	w, err := jsCalc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, len(expected.Values()), len(w))
+	for i := range w {
+		require.Equal(t, 0, expected.At(i).Cmp(w[i]), "w[%d]", i)
+	}
+	wtns, err := jsCalc.CalculateWTNSBin(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, expectedWTNS, wtns)
+	bin, err := jsCalc.CalculateBinWitness(inputs, true)
+	require.NoError(t, err)
+	require.Len(t, bin, expected.Len()*32)
+
+	_, err = jsCalc.CalculateWitness(map[string]interface{}{"x": big.NewInt(1)}, true)
+	require.EqualError(t, err, "Signal x not found")
+	var unknownErr ErrUnknownInput
+	require.True(t, errors.As(err, &unknownErr))
+
+	inputs["challenge"] = []interface{}{big.NewInt(1), big.NewInt(2)}
+	_, err = jsCalc.CalculateWitness(inputs, true)
+	require.EqualError(t, err, "Too many values for input signal challenge")
+	inputs["challenge"] = []interface{}{}
+	_, err = jsCalc.CalculateWitness(inputs, true)
+	require.EqualError(t, err, "Not enough values for input signal challenge")
+	delete(inputs, "challenge")
+	_, err = jsCalc.CalculateWitness(inputs, true)
+	require.EqualError(t, err, "Not all inputs have been set. Only 83 out of 84")
+}
+
+func TestCircom2CalculateWitnessAsync(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	expected, err := calc.Calculate(inputs)
+	require.NoError(t, err)
+
+	res, err := calc.CalculateWitnessAsync(context.Background(), inputs)
+	require.NoError(t, err)
+	r := <-res
+	require.NoError(t, r.Err)
+	require.Equal(t, expected, r.Witness)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res, err = calc.CalculateWitnessAsync(ctx, inputs)
+	require.NoError(t, err)
+	cancel()
+	r = <-res
+	if r.Err != nil {
+		require.True(t, errors.Is(r.Err, context.Canceled))
+	}
+
+	w, err := calc.Calculate(inputs)
+	require.NoError(t, err)
+	require.Equal(t, expected, w)
+}
+
+func TestCircom2SampleWitness(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+
+	_, err = calc.SampleWitness([]int{0})
+	require.Equal(t, ErrNoWitness, err)
+
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	indices := []int{w.Len() - 1, 0, 1, 42}
+	values, err := calc.SampleWitness(indices)
+	require.NoError(t, err)
+	for j, i := range indices {
+		require.Equal(t, 0, w.At(i).Cmp(values[j]), "w[%d]", i)
+	}
+	_, err = calc.SampleWitness([]int{-1})
+	require.Error(t, err)
+
+	// the binary witness leaves the witness in the module
+	_, err = calc.CalculateBinWitness(inputs, true)
+	require.NoError(t, err)
+	values, err = calc.SampleWitness(indices)
+	require.NoError(t, err)
+	for j, i := range indices {
+		require.Equal(t, 0, w.At(i).Cmp(values[j]), "w[%d]", i)
+	}
+}
+
+func TestCircom2WitnessIter(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+
+	it := calc.WitnessIter()
+	_, ok := it.Next()
+	require.False(t, ok)
+	require.Equal(t, ErrNoWitness, it.Err())
+
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	it = calc.WitnessIter()
+	require.Equal(t, w.Len(), it.Len())
+	for v, ok := it.Next(); ok; v, ok = it.Next() {
+		i := it.Index() - 1
+		require.Equal(t, 0, w.At(i).Cmp(v), "w[%d]", i)
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, w.Len(), it.Index())
+}
+
+func TestCircom2CalculateBinWitnessChecksum(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+
+	expected, err := calc.CalculateBinWitness(inputs, true)
+	require.NoError(t, err)
+	bin, c, err := calc.CalculateBinWitnessChecksum(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, expected, bin)
+	require.Equal(t, BinWitnessChecksum(expected), c)
+}
+
+func TestCircom2CircuitHash(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	h, ok := calc.CircuitHash()
+	require.True(t, ok)
+	require.Equal(t, NewCircuitHash(wasmBytes), h)
+	wtnsBytes, err := calc.CalculateWTNSBin(inputs, true)
+	require.NoError(t, err)
+	header, err := VerifyWTNS(bytes.NewReader(wtnsBytes))
+	require.NoError(t, err)
+	require.Nil(t, header.CircuitHash)
+
+	calc, err = NewCircom2WitnessCalculator(wasmBytes, WithCircuitHashInWTNS())
+	require.NoError(t, err)
+	wtnsBytes, err = calc.CalculateWTNSBin(inputs, true)
+	require.NoError(t, err)
+	header, err = VerifyWTNS(bytes.NewReader(wtnsBytes))
+	require.NoError(t, err)
+	require.NotNil(t, header.CircuitHash)
+	require.Equal(t, h, *header.CircuitHash)
+
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	wh, ok := w.CircuitHash()
+	require.True(t, ok)
+	require.Equal(t, h, wh)
+	wtnsBytes2, err := w.ToWTNS()
+	require.NoError(t, err)
+	require.Equal(t, wtnsBytes, wtnsBytes2)
+}
+
+func TestCircom2Postprocess(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	var indices []int
+	sum := new(big.Int)
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithPostprocess(func(i int, v *big.Int) error {
+		indices = append(indices, i)
+		sum.Add(sum, v)
+		if i == 5 && len(indices) > 6 {
+			return errors.New("rejected")
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Len(t, indices, w.Len())
+	expected := new(big.Int)
+	for i, v := range w.Values() {
+		require.Equal(t, i, indices[i])
+		expected.Add(expected, v)
+	}
+	require.Equal(t, expected, sum)
+
+	// The hook runs once per extraction: the second calculation fails.
+	_, err = calc.CalculateWitness(inputs, true)
+	require.EqualError(t, err, "witness 5: rejected")
+	_, err = calc.CalculateBinWitness(inputs, true)
+	require.NoError(t, err)
+}
+
+func TestCircom2StrictInputs(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithStrictInputs())
+	require.NoError(t, err)
+	_, err = calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+
+	values := append([]interface{}{}, inputs["userAuthClaim"].([]interface{})...)
+	values[2] = 2.0
+	inputs["userAuthClaim"] = values
+	_, err = calc.CalculateWitness(inputs, true)
+	require.EqualError(t, err, "inputs[userAuthClaim][2]: unsupported type float64")
+}
+
+func TestCircom2ExportDescriptor(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithCircuitHashInWTNS())
+	require.NoError(t, err)
+	b, err := calc.ExportDescriptor()
+	require.NoError(t, err)
+	d, err := ImportDescriptor(b)
+	require.NoError(t, err)
+	hash := NewCircuitHash(wasmBytes)
+	require.Equal(t, 2, d.Circom)
+	require.Equal(t, calc.version, d.Version)
+	require.Equal(t, calc.prime, d.Prime)
+	require.Equal(t, int32(8), d.N32)
+	require.Equal(t, 4, d.N64)
+	require.Equal(t, calc.curve, d.Curve)
+	require.Equal(t, calc.witnessSize, d.NVars)
+	require.Nil(t, d.ShortMax)
+	require.Equal(t, &hash, d.CircuitHash)
+
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.NoError(t, d.CheckWitness(w))
+}
+
+func TestCircom2MissingInputs(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	var syms []Symbol
+	for name, value := range inputs {
+		values, err := FlattenSignal(value)
+		require.NoError(t, err)
+		for i := range values {
+			syms = append(syms, Symbol{Name: fmt.Sprintf("main.%s[%d]", name, i)})
+		}
+	}
+	expected := inputs["userAuthClaim"]
+	partial := make(map[string]interface{})
+	for name, value := range inputs {
+		if name != "userAuthClaim" {
+			partial[name] = value
+		}
+	}
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithSymbols(syms))
+	require.NoError(t, err)
+	_, err = calc.CalculateWitness(partial, true)
+	require.True(t, errors.Is(err, ErrMissingInputs))
+	require.EqualError(t, err, "missing inputs: userAuthClaim")
+
+	// Without the symbols, the module counts the missing values.
+	calc, err = NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	_, err = calc.CalculateWitness(partial, true)
+	require.True(t, errors.Is(err, ErrMissingInputs))
+
+	calc, err = NewCircom2WitnessCalculator(wasmBytes, WithSymbols(syms),
+		WithMissingInputFunc(func(name string, size int) (interface{}, error) {
+			return expected, nil
+		}))
+	require.NoError(t, err)
+	w, err := calc.CalculateWitness(partial, true)
+	require.NoError(t, err)
+	calc, err = NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	w2, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, w2, w)
+
+	calc, err = NewCircom2WitnessCalculator(wasmBytes, WithSymbols(syms),
+		WithMissingInputFunc(func(name string, size int) (interface{}, error) {
+			return []*big.Int{big.NewInt(1)}, nil
+		}))
+	require.NoError(t, err)
+	_, err = calc.CalculateWitness(partial, true)
+	require.EqualError(t, err, "not enough values for input signal userAuthClaim")
+}
+
+func TestCircom2NewAutoWitnessCalculator(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewAutoWitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	_, ok := calc.(*Circom2WitnessCalculator)
+	require.True(t, ok)
+	w, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	wc, err := NewCircom2WitnessCalculator(wasmBytes)
+	require.NoError(t, err)
+	expected, err := wc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, expected, w)
+}
+
+func TestCircom2ABINotSupported(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.NoError(t, err)
+	_, err = NewCircom2WitnessCalculator(wasmBytes)
+	require.True(t, errors.Is(err, ErrABINotSupported))
+	var abiErr *ABIError
+	require.True(t, errors.As(err, &abiErr))
+	require.Equal(t, &ABIError{Circom: 1, Constructor: "LoadWitnessCalculator"}, abiErr)
+}
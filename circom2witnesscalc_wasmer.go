@@ -0,0 +1,321 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wasmerio/wasmer-go/wasmer"
+)
+
+// circom2Imports are the imports provided to circom 2 WitnessCalc WASM
+// modules.
+var circom2Imports = map[string]bool{
+	"env.memory":                 true,
+	"runtime.exceptionHandler":   true,
+	"runtime.showSharedRWMemory": true,
+	"runtime.log":                true,
+}
+
+// NewCircom2WitnessCalculator creates a new WitnessCalculator from the WitnessCalc
+// loaded WASM module in the runtime.
+func NewCircom2WitnessCalculator(wasmBytes []byte, opts ...Option) (*Circom2WitnessCalculator, error) {
+	wc := newCircom2WitnessCalculator(opts)
+	if err := wc.loadCircuit(wasmBytes); err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+// loadModule compiles and instantiates the WitnessCalc WASM module with wasmer
+// and returns the temporary calculator bound to it, for swapModule.
+func (wc *Circom2WitnessCalculator) loadModule(wasmBytes []byte) (*Circom2WitnessCalculator, error) {
+	store := wasmer.NewStore(wasmer.NewEngine())
+
+	// Compiles the module
+	module, err := wasmer.NewModule(store, wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := wc.instantiate(store, module, wasmBytes, nil)
+	return m, err
+}
+
+// loadSnapshot instantiates the module compiled by wasmer of the snapshot s,
+// restoring its memory, and returns the temporary calculator bound to it, for
+// swapModule.
+func (wc *Circom2WitnessCalculator) loadSnapshot(s *moduleSnapshot) (*Circom2WitnessCalculator, error) {
+	store := wasmer.NewStore(wasmer.NewEngine())
+	module, err := wasmer.DeserializeModule(store, s.compiled)
+	if err != nil {
+		return nil, fmt.Errorf("loading the compiled module of the snapshot: %w", err)
+	}
+	m, _, err := wc.instantiate(store, module, s.wasm, s.memory)
+	return m, err
+}
+
+// snapshotModule returns the snapshot of the module of wasmBytes compiled by
+// wasmer, with the memory of a new instance once loaded by newModule.
+func (wc *Circom2WitnessCalculator) snapshotModule(store *wasmer.Store, module *wasmer.Module, wasmBytes []byte) (*moduleSnapshot, error) {
+	compiled, err := module.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	m, memory, err := wc.instantiate(store, module, wasmBytes, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseCircom2Instance(m.instance)
+	var data []byte
+	if memory != nil {
+		data = memory.Data()
+	}
+	// The memory is mostly free space
+	end := len(data)
+	for end > 0 && data[end-1] == 0 {
+		end--
+	}
+	return &moduleSnapshot{
+		wasm:     wasmBytes,
+		compiled: compiled,
+		memory:   append([]byte(nil), data[:end]...),
+	}, nil
+}
+
+// instantiate instantiates the WitnessCalc WASM module of wasmBytes, compiled
+// by wasmer into module, with the memory image, if not nil, written over its
+// memory before it is loaded by newModule.  It returns the temporary
+// calculator bound to the instance, for swapModule, and the memory it
+// exports, nil if none.
+func (wc *Circom2WitnessCalculator) instantiate(store *wasmer.Store, module *wasmer.Module, wasmBytes, image []byte) (*Circom2WitnessCalculator, *wasmer.Memory, error) {
+	provided := circom2Imports
+	var release []wasmImport
+	if wc.opts.releaseMode {
+		var err error
+		release, provided, err = releaseImports(wasmBytes, provided)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	stubs, err := stubImports(wasmBytes, provided, wc.opts.importMode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	limits, err := wasmer.NewLimits(wc.opts.memoryMinPages, wc.opts.memoryMaxPages)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	memType := wasmer.NewMemoryType(limits)
+
+	memory := wasmer.NewMemory(store, memType)
+
+	// Instantiates the module
+	namespaces := map[string]map[string]wasmer.IntoExtern{
+		"env": {
+			"memory": memory,
+		},
+		"runtime": {
+			"exceptionHandler":   getExceptionHandler(store),
+			"showSharedRWMemory": getShowSharedRWMemory(store, wc.showSharedRWMemory),
+			"log":                getLog(store),
+		},
+	}
+	for _, imp := range append(stubs, release...) {
+		namespaces[imp.Module][imp.Name] = getStub(store, imp)
+	}
+	if imp, ok, err := abortImport(wasmBytes); err != nil {
+		return nil, nil, err
+	} else if ok {
+		namespaces["env"]["abort"] = getAbort(store, imp, memory, func(e *AbortError) {
+			wc.abortErr = e
+		})
+	}
+	importObject := wasmer.NewImportObject()
+	for name, namespace := range namespaces {
+		importObject.Register(name, namespace)
+	}
+
+	instance, err := wasmer.NewInstance(module, importObject)
+	if err != nil {
+		return nil, nil, err
+	}
+	exported, err := instance.Exports.GetMemory("memory")
+	if err != nil {
+		exported = nil
+	}
+	if image != nil {
+		if err := restoreMemory(exported, image); err != nil {
+			instance.Close()
+			return nil, nil, err
+		}
+	}
+
+	exports := func(name string) (nativeFunction, error) {
+		f, err := instance.Exports.GetFunction(name)
+		if err != nil {
+			return nil, err
+		}
+		return nativeFunction(f), nil
+	}
+	var writeMemory circom2Memory
+	var memorySize func() int
+	if memory := exported; memory != nil {
+		memorySize = func() int {
+			return int(memory.DataSize())
+		}
+		writeMemory = func(offset int, b []byte) error {
+			// Data is invalidated when the memory grows
+			dst, err := memRange(memory.Data(), int64(offset), int64(len(b)))
+			if err != nil {
+				return err
+			}
+			copy(dst, b)
+			return nil
+		}
+	}
+	m, err := wc.newModule(instance, exports, writeMemory, memorySize)
+	if err != nil {
+		instance.Close()
+		return nil, nil, err
+	}
+	m.snapshot = func() (*moduleSnapshot, error) {
+		return wc.snapshotModule(store, module, wasmBytes)
+	}
+	return m, exported, nil
+}
+
+// restoreMemory writes the memory image of a snapshot at the start of memory,
+// exported by the module, growing it if needed.
+func restoreMemory(memory *wasmer.Memory, image []byte) error {
+	if memory == nil {
+		if len(image) > 0 {
+			return errors.New("the module of the snapshot doesn't export its memory")
+		}
+		return nil
+	}
+	if size := memory.DataSize(); uint(len(image)) > size {
+		pages := (uint(len(image)) - size + wasmPageSize - 1) / wasmPageSize
+		if !memory.Grow(wasmer.Pages(pages)) {
+			return fmt.Errorf("the snapshot memory of %d bytes exceeds the memory limit", len(image))
+		}
+	}
+	copy(memory.Data(), image)
+	return nil
+}
+
+// releaseCircom2Instance releases the wasmer instance of a module replaced by
+// swapModule.
+func releaseCircom2Instance(instance interface{}) {
+	if instance, ok := instance.(*wasmer.Instance); ok {
+		instance.Close()
+	}
+
+}
+
+func getExceptionHandler(store *wasmer.Store) wasmer.IntoExtern {
+	function := wasmer.NewFunction(
+		store,
+		wasmer.NewFunctionType(
+			wasmer.NewValueTypes(wasmer.I32), // one i32 argument
+			wasmer.NewValueTypes(),           // zero results
+		),
+		func(args []wasmer.Value) ([]wasmer.Value, error) {
+			if len(args) > 0 {
+				fmt.Println(exceptionMessage(args[0].I32()))
+			}
+			return []wasmer.Value{}, nil
+		},
+	)
+	return function
+}
+
+func getShowSharedRWMemory(store *wasmer.Store, show func()) wasmer.IntoExtern {
+	function := wasmer.NewFunction(
+		store,
+		wasmer.NewFunctionType(
+			wasmer.NewValueTypes(),
+			wasmer.NewValueTypes(),
+		),
+		func(args []wasmer.Value) ([]wasmer.Value, error) {
+			show()
+			return []wasmer.Value{}, nil
+		},
+	)
+	return function
+}
+
+func getLog(store *wasmer.Store) wasmer.IntoExtern {
+	function := wasmer.NewFunction(
+		store,
+		wasmer.NewFunctionType(
+			wasmer.NewValueTypes(),
+			wasmer.NewValueTypes(),
+		),
+		func(args []wasmer.Value) ([]wasmer.Value, error) {
+			return []wasmer.Value{}, nil
+		},
+	)
+	return function
+}
+
+// getAbort returns the env.abort function imp, which aborts the call after
+// passing the decoded AbortError to report.
+func getAbort(store *wasmer.Store, imp wasmImport, memory *wasmer.Memory, report func(*AbortError)) wasmer.IntoExtern {
+	params := make([]wasmer.ValueKind, len(imp.Params))
+	for i := range params {
+		params[i] = wasmer.I32
+	}
+	return wasmer.NewFunction(
+		store,
+		wasmer.NewFunctionType(
+			wasmer.NewValueTypes(params...),
+			wasmer.NewValueTypes(),
+		),
+		func(args []wasmer.Value) ([]wasmer.Value, error) {
+			values := make([]uint32, len(args))
+			for i, arg := range args {
+				values[i] = uint32(arg.I32())
+			}
+			e := decodeAbort(sliceMemReader(memory.Data()), values)
+			report(e)
+			return nil, e
+		},
+	)
+}
+
+// getStub returns a function for the import imp that does nothing and
+// returns zeros.
+func getStub(store *wasmer.Store, imp wasmImport) wasmer.IntoExtern {
+	kinds := map[byte]wasmer.ValueKind{
+		wasmValueI32: wasmer.I32, wasmValueI64: wasmer.I64,
+		wasmValueF32: wasmer.F32, wasmValueF64: wasmer.F64,
+	}
+	zeros := map[byte]wasmer.Value{
+		wasmValueI32: wasmer.NewI32(0), wasmValueI64: wasmer.NewI64(0),
+		wasmValueF32: wasmer.NewF32(float32(0)), wasmValueF64: wasmer.NewF64(float64(0)),
+	}
+	params := make([]wasmer.ValueKind, len(imp.Params))
+	for i, p := range imp.Params {
+		params[i] = kinds[p]
+	}
+	results := make([]wasmer.ValueKind, len(imp.Results))
+	values := make([]wasmer.Value, len(imp.Results))
+	for i, r := range imp.Results {
+		results[i] = kinds[r]
+		values[i] = zeros[r]
+	}
+	return wasmer.NewFunction(
+		store,
+		wasmer.NewFunctionType(
+			wasmer.NewValueTypes(params...),
+			wasmer.NewValueTypes(results...),
+		),
+		func(args []wasmer.Value) ([]wasmer.Value, error) {
+			return values, nil
+		},
+	)
+}
@@ -0,0 +1,255 @@
+//go:build !cgo && !js
+// +build !cgo,!js
+
+package witnesscalc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// wazeroCircom2Instance is a WitnessCalc WASM module instantiated by wazero,
+// the pure-Go runtime of the builds without cgo.
+type wazeroCircom2Instance struct {
+	runtime wazero.Runtime
+	module  api.Module
+	// exception is the last error reported by the module through the
+	// runtime.exceptionHandler import.
+	exception error
+}
+
+// circom2Imports are the imports provided to circom 2 WitnessCalc WASM
+// modules.
+var circom2Imports = map[string]bool{
+	"runtime.exceptionHandler":   true,
+	"runtime.showSharedRWMemory": true,
+	"runtime.log":                true,
+}
+
+// wazeroValueTypes are the wazero types of the WASM value types.
+var wazeroValueTypes = map[byte]api.ValueType{
+	wasmValueI32: api.ValueTypeI32, wasmValueI64: api.ValueTypeI64,
+	wasmValueF32: api.ValueTypeF32, wasmValueF64: api.ValueTypeF64,
+}
+
+// NewCircom2WitnessCalculator creates a new WitnessCalculator from the WitnessCalc
+// WASM module, instantiated with wazero, a pure-Go runtime, as the wasmer
+// bindings need cgo.  wazero compiles the module to machine code on amd64 and
+// arm64, and interprets it on the other platforms.
+func NewCircom2WitnessCalculator(wasmBytes []byte, opts ...Option) (*Circom2WitnessCalculator, error) {
+	wc := newCircom2WitnessCalculator(opts)
+	if err := wc.loadCircuit(wasmBytes); err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+// loadModule compiles and instantiates the WitnessCalc WASM module with wazero
+// and returns the temporary calculator bound to it, for swapModule.
+func (wc *Circom2WitnessCalculator) loadModule(wasmBytes []byte) (m *Circom2WitnessCalculator, err error) {
+	provided := circom2Imports
+	var release []wasmImport
+	if wc.opts.releaseMode {
+		release, provided, err = releaseImports(wasmBytes, provided)
+		if err != nil {
+			return nil, err
+		}
+	}
+	stubs, err := stubImports(wasmBytes, provided, wc.opts.importMode)
+	if err != nil {
+		return nil, err
+	}
+	abort, hasAbort, err := abortImport(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	config := wazero.NewRuntimeConfig()
+	if wc.opts.memoryLimitsSet {
+		config = config.WithMemoryLimitPages(wc.opts.memoryMaxPages)
+	}
+	inst := &wazeroCircom2Instance{runtime: wazero.NewRuntimeWithConfig(ctx, config)}
+	defer func() {
+		// Release the runtime of the instance that won't be used.
+		if err != nil {
+			inst.release()
+		}
+	}()
+
+	namespaces := map[string]wazero.HostModuleBuilder{
+		"runtime": inst.runtime.NewHostModuleBuilder("runtime"),
+	}
+	namespace := func(name string) wazero.HostModuleBuilder {
+		if _, ok := namespaces[name]; !ok {
+			namespaces[name] = inst.runtime.NewHostModuleBuilder(name)
+		}
+		return namespaces[name]
+	}
+	namespaces["runtime"].
+		NewFunctionBuilder().
+		WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			inst.exception = errors.New(exceptionMessage(api.DecodeI32(stack[0])))
+		}), []api.ValueType{api.ValueTypeI32}, nil).
+		Export("exceptionHandler").
+		NewFunctionBuilder().
+		WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			wc.showSharedRWMemory()
+		}), nil, nil).
+		Export("showSharedRWMemory").
+		NewFunctionBuilder().
+		WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {}), nil, nil).
+		Export("log")
+	for _, imp := range append(stubs, release...) {
+		exportStub(namespace(imp.Module), imp)
+	}
+	if hasAbort {
+		namespace("env").
+			NewFunctionBuilder().
+			WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+				values := make([]uint32, len(stack))
+				for i, v := range stack {
+					values[i] = api.DecodeU32(v)
+				}
+				e := decodeAbort(wazeroMemReader(mod.Memory()), values)
+				wc.abortErr = e
+				// wazero aborts the call with the panics of the host
+				// functions.
+				panic(e)
+			}), wazeroTypes(abort.Params), nil).
+			Export(abort.Name)
+	}
+	for name, builder := range namespaces {
+		if _, err := builder.Instantiate(ctx); err != nil {
+			return nil, fmt.Errorf("instantiating the %s imports: %w", name, err)
+		}
+	}
+
+	compiled, err := inst.runtime.CompileModule(ctx, wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	inst.module, err = inst.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return nil, err
+	}
+	memory := inst.module.Memory()
+	if memory != nil && wc.opts.memoryLimitsSet {
+		if pages := memory.Size() / wasmPageSize; pages < wc.opts.memoryMinPages {
+			if _, ok := memory.Grow(wc.opts.memoryMinPages - pages); !ok {
+				return nil, fmt.Errorf("growing the memory to %d pages", wc.opts.memoryMinPages)
+			}
+		}
+	}
+
+	var writeMemory circom2Memory
+	var memorySize func() int
+	if memory != nil {
+		memorySize = func() int {
+			return int(memory.Size())
+		}
+		writeMemory = func(offset int, b []byte) error {
+			// The buffer is replaced when the memory grows
+			buf, _ := memory.Read(0, memory.Size())
+			dst, err := memRange(buf, int64(offset), int64(len(b)))
+			if err != nil {
+				return err
+			}
+			copy(dst, b)
+			return nil
+		}
+	}
+	return wc.newModule(inst, inst.export, writeMemory, memorySize)
+}
+
+// exportStub exports from builder a function for the import imp that does
+// nothing and returns zeros.
+func exportStub(builder wazero.HostModuleBuilder, imp wasmImport) {
+	builder.
+		NewFunctionBuilder().
+		WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			for i := range imp.Results {
+				stack[i] = 0
+			}
+		}), wazeroTypes(imp.Params), wazeroTypes(imp.Results)).
+		Export(imp.Name)
+}
+
+// wazeroTypes returns the wazero types of the WASM value types.
+func wazeroTypes(types []byte) []api.ValueType {
+	res := make([]api.ValueType, len(types))
+	for i, t := range types {
+		res[i] = wazeroValueTypes[t]
+	}
+	return res
+}
+
+// wazeroMemReader returns the memReader of the memory of a module.
+func wazeroMemReader(memory api.Memory) memReader {
+	return func(p, n uint32) ([]byte, error) {
+		if memory == nil {
+			return nil, errors.New("the module doesn't export its memory")
+		}
+		buf, _ := memory.Read(0, memory.Size())
+		return memRange(buf, int64(p), int64(n))
+	}
+}
+
+// loadSnapshot fails, as wazero can't serialize compiled modules.
+func (wc *Circom2WitnessCalculator) loadSnapshot(s *moduleSnapshot) (*Circom2WitnessCalculator, error) {
+	return nil, ErrSnapshotUnsupported
+}
+
+// releaseCircom2Instance releases the wazero runtime of a module replaced by
+// swapModule.
+func releaseCircom2Instance(instance interface{}) {
+	if inst, ok := instance.(*wazeroCircom2Instance); ok {
+		inst.release()
+	}
+}
+
+// release releases the runtime of the instance, with its modules.
+func (inst *wazeroCircom2Instance) release() {
+	_ = inst.runtime.Close(context.Background())
+}
+
+// export returns the exported function name, adding the errors reported by
+// the module through runtime.exceptionHandler to the traps.
+func (inst *wazeroCircom2Instance) export(name string) (nativeFunction, error) {
+	f := inst.module.ExportedFunction(name)
+	if f == nil {
+		return nil, fmt.Errorf("exported function %s not found", name)
+	}
+	nResults := len(f.Definition().ResultTypes())
+	return func(args ...interface{}) (interface{}, error) {
+		params := make([]uint64, len(args))
+		for i, arg := range args {
+			switch v := arg.(type) {
+			case int:
+				params[i] = api.EncodeI32(int32(v))
+			case int32:
+				params[i] = api.EncodeI32(v)
+			case uint32:
+				params[i] = api.EncodeU32(v)
+			default:
+				return nil, fmt.Errorf("%s: unsupported argument type %T", name, arg)
+			}
+		}
+		inst.exception = nil
+		res, err := f.Call(context.Background(), params...)
+		if err != nil {
+			if inst.exception != nil {
+				err = fmt.Errorf("%v: %w", inst.exception, err)
+			}
+			return nil, err
+		}
+		if nResults == 0 {
+			return nil, nil
+		}
+		return api.DecodeI32(res[0]), nil
+	}, nil
+}
@@ -0,0 +1,40 @@
+//go:build !cgo && !js
+// +build !cgo,!js
+
+package witnesscalc
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircom2Wazero(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, WithMemoryLimits(300, 1000))
+	require.NoError(t, err)
+	_, ok := calc.instance.(*wazeroCircom2Instance)
+	require.True(t, ok)
+	require.Equal(t, 300*wasmPageSize, calc.memorySize())
+	witness, err := calc.CalculateWitness(inputs, true)
+	require.NoError(t, err)
+	require.Equal(t, int(calc.witnessSize), witness.Len())
+
+	// The memory can't grow over the limit.
+	_, err = NewCircom2WitnessCalculator(wasmBytes, WithMemoryLimits(1, 1))
+	require.Error(t, err)
+
+	// The circom 1 modules still need cgo.
+	wasmBytes, err = ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.NoError(t, err)
+	_, err = NewAutoWitnessCalculator(wasmBytes)
+	require.True(t, errors.Is(err, errNoCgo))
+}
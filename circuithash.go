@@ -0,0 +1,21 @@
+package witnesscalc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// CircuitHash is the SHA-256 hash of the WASM module of a circuit.  Embedded
+// in the wtns files with WithCircuitHashInWTNS, it lets provers check that a
+// witness and a zkey come from the same circuit build.
+type CircuitHash [sha256.Size]byte
+
+// NewCircuitHash returns the CircuitHash of the WASM module.
+func NewCircuitHash(wasmBytes []byte) CircuitHash {
+	return sha256.Sum256(wasmBytes)
+}
+
+// String returns the hash in hexadecimal.
+func (h CircuitHash) String() string {
+	return hex.EncodeToString(h[:])
+}
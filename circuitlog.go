@@ -0,0 +1,46 @@
+package witnesscalc
+
+import (
+	"math/big"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+)
+
+// CircuitLog is a value logged by a log() statement of the circuit.
+type CircuitLog struct {
+	// Circuit is the name given with WithCircuitName, if any.
+	Circuit string
+	// Seq is the position of the log in the calculation, starting at 0.
+	Seq   int
+	Value *big.Int
+}
+
+// circuitLogger emits the values logged by the circuit during a calculation
+// through the logger of the module, collecting them with WithCircuitLogs.
+type circuitLogger struct {
+	circuit string
+	collect bool
+	seq     int
+	logs    []CircuitLog
+}
+
+// reset starts the logs of a new calculation.
+func (l *circuitLogger) reset() {
+	l.seq = 0
+	l.logs = nil
+}
+
+// log emits the value v logged by the circuit, or a warning if it couldn't be
+// decoded from the module memory.
+func (l *circuitLogger) log(v *big.Int, err error) {
+	if err != nil {
+		log.Warn("Invalid circuit log", "circuit", l.circuit, "seq", l.seq, "err", err)
+		l.seq++
+		return
+	}
+	log.Info("Circuit log", "circuit", l.circuit, "seq", l.seq, "value", v.String())
+	if l.collect {
+		l.logs = append(l.logs, CircuitLog{Circuit: l.circuit, Seq: l.seq, Value: v})
+	}
+	l.seq++
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+const defaultFileMode = 0644
+
+// stdio is the path that selects stdin for inputs and stdout for the output.
+const stdio = "-"
+
+// calcCmd calculates the witness of a single input file.  Flags may be placed
+// anywhere in args, so that `witnesscalc circuit.wasm - --wtns` works.
+func calcCmd(args []string) error {
+	fs := newFlagSet("witnesscalc")
+	jsonOut := fs.Bool("json", false, "write the witness as a JSON array")
+	wtnsOut := fs.Bool("wtns", false, "write the witness in the wtns format (default)")
+	var flagArgs, posArgs []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && arg != stdio {
+			flagArgs = append(flagArgs, arg)
+		} else {
+			posArgs = append(posArgs, arg)
+		}
+	}
+	if err := parseFlags(fs, flagArgs); err != nil {
+		return err
+	}
+	if len(posArgs) < 2 || len(posArgs) > 3 {
+		return &usageError{fmt.Sprintf("expected 2 or 3 arguments, got %d", len(posArgs))}
+	}
+	if *jsonOut && *wtnsOut {
+		return &usageError{"--json and --wtns are exclusive"}
+	}
+	outputPath := stdio
+	if len(posArgs) == 3 {
+		outputPath = posArgs[2]
+	}
+
+	wasmBytes, err := ioutil.ReadFile(posArgs[0])
+	if err != nil {
+		return err
+	}
+	calc, err := witnesscalc.NewCircom2WitnessCalculator(wasmBytes)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		return calcJSON(calc, posArgs[1], outputPath)
+	}
+	return calcFile(calc, posArgs[1], outputPath)
+}
+
+// readInputs parses the inputs at inputPath, or from stdin if it is "-".
+// $file references are resolved relative to the inputs file directory, or to
+// the working directory for stdin.
+func readInputs(inputPath string) (map[string]interface{}, error) {
+	var inputBytes []byte
+	var err error
+	dir := "."
+	if inputPath == stdio {
+		inputBytes, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		inputBytes, err = ioutil.ReadFile(inputPath)
+		dir = filepath.Dir(inputPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return witnesscalc.ParseInputsFS(inputBytes, os.DirFS(dir))
+}
+
+// writeOutput writes data to outputPath, or to stdout if it is "-".  Binary
+// data is not written to a terminal.
+func writeOutput(outputPath string, data []byte, binary bool) error {
+	if outputPath != stdio {
+		return ioutil.WriteFile(outputPath, data, defaultFileMode)
+	}
+	if binary {
+		fi, err := os.Stdout.Stat()
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeCharDevice != 0 {
+			return errors.New("refusing to write a binary witness to a terminal, redirect stdout")
+		}
+	}
+	_, err := os.Stdout.Write(data)
+	return err
+}
+
+// calcFile reads the inputs at inputPath and writes the wtns witness to
+// outputPath.
+func calcFile(calc *witnesscalc.Circom2WitnessCalculator, inputPath, outputPath string) error {
+	inputs, err := readInputs(inputPath)
+	if err != nil {
+		return err
+	}
+	wtnsBytes, err := calc.CalculateWTNSBin(inputs, true)
+	if err != nil {
+		return err
+	}
+	return writeOutput(outputPath, wtnsBytes, true)
+}
+
+// calcJSON reads the inputs at inputPath and writes the witness as a JSON
+// array to outputPath.
+func calcJSON(calc *witnesscalc.Circom2WitnessCalculator, inputPath, outputPath string) error {
+	inputs, err := readInputs(inputPath)
+	if err != nil {
+		return err
+	}
+	w, err := calc.CalculateWitness(inputs, true)
+	if err != nil {
+		return err
+	}
+	wJSON, err := w.ToJSON()
+	if err != nil {
+		return err
+	}
+	return writeOutput(outputPath, append(wJSON, '\n'), false)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// infoCmd prints what a WitnessCalc WASM module was built for: the circom
+// version and ABI, the field and the size of the witness, and its exports and
+// imports.
+func infoCmd(args []string) error {
+	if len(args) != 1 {
+		return &usageError{fmt.Sprintf("info: expected 1 argument, got %d", len(args))}
+	}
+	wasmBytes, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	info, err := witnesscalc.ReadModuleInfo(wasmBytes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	abi := "circom 1"
+	if info.Circom == 2 {
+		abi = fmt.Sprintf("circom 2, version %d", info.Version)
+	}
+	fmt.Printf("ABI:     %s\n", abi)
+	fmt.Printf("prime:   %v (%v)\n", info.Prime, info.Curve)
+	fmt.Printf("nVars:   %d\n", info.NVars)
+	fmt.Printf("n64:     %d\n", info.N64)
+	fmt.Printf("exports: %s\n", strings.Join(info.Exports, ", "))
+	fmt.Printf("imports: %s\n", strings.Join(info.Imports, ", "))
+	return nil
+}
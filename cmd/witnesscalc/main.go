@@ -0,0 +1,84 @@
+// Command witnesscalc calculates circom 2 witnesses in the snarkjs wtns format.
+// The info subcommand describes a WitnessCalc WASM module: its circom version,
+// ABI version, prime, witness size and exports and imports.
+//
+// Usage:
+//
+//	witnesscalc [--wtns|--json] <circuit.wasm> <input.json|-> [<witness.wtns|->]
+//	witnesscalc watch [-workers n] [-interval d] <circuit.wasm> <inputs dir> <outputs dir>
+//	witnesscalc verify -r1cs <circuit.r1cs> -wtns <witness.wtns> [-sym <circuit.sym>]
+//	witnesscalc info <circuit.wasm>
+//
+// An input path of "-" reads the inputs from stdin, and an output path of "-"
+// or no output path writes the witness to stdout.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const usage = `Usage:
+  witnesscalc [--wtns|--json] <circuit.wasm> <input.json|-> [<witness.wtns|->]
+  witnesscalc watch [-workers n] [-interval d] <circuit.wasm> <inputs dir> <outputs dir>
+  witnesscalc verify -r1cs <circuit.r1cs> -wtns <witness.wtns> [-sym <circuit.sym>]
+  witnesscalc info <circuit.wasm>
+`
+
+// usageError is the error of invalid command line arguments, for which the
+// usage is printed.
+type usageError struct {
+	reason string
+}
+
+func (e *usageError) Error() string {
+	return e.reason
+}
+
+func main() {
+	err := run(os.Args[1:])
+	var uErr *usageError
+	if errors.As(err, &uErr) {
+		fmt.Fprintf(os.Stderr, "witnesscalc: %v\n%s", err, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "witnesscalc: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the subcommand of the command line arguments args.
+func run(args []string) error {
+	switch {
+	case len(args) == 0:
+		return &usageError{"missing arguments"}
+	case args[0] == "watch":
+		return watchCmd(args[1:])
+	case args[0] == "verify":
+		return verifyCmd(args[1:])
+	case args[0] == "info":
+		return infoCmd(args[1:])
+	default:
+		return calcCmd(args)
+	}
+}
+
+// newFlagSet creates the flag set of a subcommand, whose parsing errors are
+// returned as usageErrors instead of being printed.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+// parseFlags parses the flags of fs in args.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return &usageError{fmt.Sprintf("%s: %v", fs.Name(), err)}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunArgs(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+	notWasm := filepath.Join(dir, "circuit.wasm")
+	require.NoError(t, ioutil.WriteFile(notWasm, []byte("not wasm"), 0644))
+
+	tests := []struct {
+		name  string
+		args  []string
+		usage bool
+	}{
+		{"no args", nil, true},
+		{"calc one arg", []string{"circuit.wasm"}, true},
+		{"calc four args", []string{"a", "b", "c", "d"}, true},
+		{"calc unknown flag", []string{"--x", "circuit.wasm", "input.json"}, true},
+		{"calc json and wtns", []string{"--json", "--wtns", "circuit.wasm", "input.json"}, true},
+		{"calc missing wasm", []string{missing, "input.json"}, false},
+		{"calc invalid wasm", []string{notWasm, "input.json"}, false},
+		{"watch no args", []string{"watch"}, true},
+		{"watch two args", []string{"watch", "circuit.wasm", "in"}, true},
+		{"watch no workers", []string{"watch", "-workers", "0", "circuit.wasm", "in", "out"}, true},
+		{"watch bad interval", []string{"watch", "-interval", "0s", "circuit.wasm", "in", "out"}, true},
+		{"watch invalid workers", []string{"watch", "-workers", "x", "circuit.wasm", "in", "out"}, true},
+		{"watch missing wasm", []string{"watch", missing, "in", "out"}, false},
+		{"verify no flags", []string{"verify"}, true},
+		{"verify no wtns", []string{"verify", "-r1cs", "circuit.r1cs"}, true},
+		{"verify extra args", []string{"verify", "-r1cs", "a", "-wtns", "b", "c"}, true},
+		{"verify missing r1cs", []string{"verify", "-r1cs", missing, "-wtns", missing}, false},
+		{"info no args", []string{"info"}, true},
+		{"info two args", []string{"info", "a", "b"}, true},
+		{"info missing wasm", []string{"info", missing}, false},
+		{"info invalid wasm", []string{"info", notWasm}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(tt.args)
+			require.Error(t, err)
+			var uErr *usageError
+			require.Equal(t, tt.usage, errors.As(err, &uErr), err)
+		})
+	}
+}
+
+func TestScanInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.json", "b.json", "c.txt"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "d.json"), 0755))
+
+	seen := make(map[string]time.Time)
+	jobs := make(chan string, 2)
+	require.NoError(t, scanInputs(context.Background(), dir, 0, seen, jobs))
+	require.Equal(t, filepath.Join(dir, "a.json"), <-jobs)
+	require.Equal(t, filepath.Join(dir, "b.json"), <-jobs)
+
+	// Seen files are not sent again.
+	require.NoError(t, scanInputs(context.Background(), dir, 0, seen, jobs))
+	require.Len(t, jobs, 0)
+
+	// A canceled scan doesn't block on the jobs nobody receives, and leaves
+	// the unsent files for a later scan.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	seen = make(map[string]time.Time)
+	err := scanInputs(ctx, dir, 0, seen, make(chan string))
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, seen, 0)
+
+	// Files still being written are left for a later scan.
+	require.NoError(t, scanInputs(context.Background(), dir, time.Hour, seen, jobs))
+	require.Len(t, jobs, 0)
+}
+
+func TestWatchCanceled(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte("{}"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Without workers, nothing receives the inputs file.
+		watch(ctx, nil, dir, dir, time.Millisecond)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("watch didn't return once canceled")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// verifyCmd checks that a wtns witness satisfies every constraint of an r1cs
+// file, printing the first failing constraint with the names of its signals.
+func verifyCmd(args []string) error {
+	fs := newFlagSet("verify")
+	r1csPath := fs.String("r1cs", "", "circuit r1cs file")
+	wtnsPath := fs.String("wtns", "", "witness wtns file")
+	symPath := fs.String("sym", "", "circuit sym file for the signal names (default: the r1cs file with the .sym extension, if it exists)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return &usageError{fmt.Sprintf("verify: unexpected arguments %q", fs.Args())}
+	}
+	if *r1csPath == "" || *wtnsPath == "" {
+		return &usageError{"verify: -r1cs and -wtns are required"}
+	}
+
+	r1csFile, err := os.Open(*r1csPath)
+	if err != nil {
+		return err
+	}
+	defer r1csFile.Close()
+	h, constraints, err := witnesscalc.ReadR1CS(r1csFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *r1csPath, err)
+	}
+	wtnsFile, err := os.Open(*wtnsPath)
+	if err != nil {
+		return err
+	}
+	defer wtnsFile.Close()
+	prime, w, err := witnesscalc.ParseWTNS(wtnsFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *wtnsPath, err)
+	}
+	if prime.Cmp(h.Prime) != 0 {
+		return fmt.Errorf("the witness prime %v doesn't match the circuit prime %v", prime, h.Prime)
+	}
+
+	err = witnesscalc.VerifyConstraints(h, constraints, w)
+	var cErr *witnesscalc.ConstraintError
+	if errors.As(err, &cErr) {
+		names, nameErr := signalNames(*symPath, *r1csPath)
+		if nameErr != nil {
+			return nameErr
+		}
+		fmt.Println(cErr)
+		for _, wire := range cErr.Constraint.Wires() {
+			name := ""
+			if len(names[wire]) > 0 {
+				name = " " + strings.Join(names[wire], ", ")
+			}
+			fmt.Printf("  w[%d]%s = %v\n", wire, name, w[wire])
+		}
+		return errors.New("witness doesn't satisfy the constraints")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("OK: %d constraints satisfied\n", len(constraints))
+	return nil
+}
+
+// signalNames returns the signal names of every witness index from the sym
+// file at symPath or, if empty, next to the r1cs file.  A missing default sym
+// file gives no names.
+func signalNames(symPath, r1csPath string) (map[uint32][]string, error) {
+	optional := symPath == ""
+	if optional {
+		symPath = strings.TrimSuffix(r1csPath, ".r1cs") + ".sym"
+	}
+	f, err := os.Open(symPath)
+	if optional && errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	syms, err := witnesscalc.ParseSym(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", symPath, err)
+	}
+	names := make(map[uint32][]string)
+	for _, sym := range syms {
+		if sym.VarIdx >= 0 {
+			names[uint32(sym.VarIdx)] = append(names[uint32(sym.VarIdx)], sym.Name)
+		}
+	}
+	return names, nil
+}
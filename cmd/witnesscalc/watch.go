@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// watchCmd polls an inputs directory and calculates the witness of every new
+// JSON file with a pool of workers, writing <name>.wtns files into the
+// outputs directory.  It runs until interrupted.
+func watchCmd(args []string) error {
+	fs := newFlagSet("watch")
+	workers := fs.Int("workers", 4, "number of concurrent witness calculations")
+	interval := fs.Duration("interval", time.Second, "inputs directory polling interval")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 3 {
+		return &usageError{fmt.Sprintf("watch: expected 3 arguments, got %d", fs.NArg())}
+	}
+	if *workers < 1 {
+		return &usageError{fmt.Sprintf("watch: invalid number of workers %d", *workers)}
+	}
+	if *interval <= 0 {
+		return &usageError{fmt.Sprintf("watch: invalid interval %v", *interval)}
+	}
+	wasmPath, inputsDir, outputsDir := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+
+	wasmBytes, err := ioutil.ReadFile(wasmPath)
+	if err != nil {
+		return err
+	}
+	// Each worker owns a calculator, as they can't be used concurrently.
+	calcs := make([]*witnesscalc.Circom2WitnessCalculator, *workers)
+	for i := range calcs {
+		calcs[i], err = witnesscalc.NewCircom2WitnessCalculator(wasmBytes,
+			witnesscalc.WithDefaultSanityCheck(true))
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	log.Printf("watching %s with %d workers", inputsDir, *workers)
+	watch(ctx, calcs, inputsDir, outputsDir, *interval)
+	return nil
+}
+
+// watch scans inputsDir every interval and dispatches the new inputs files to
+// a worker per calculator until ctx is done.  It returns without waiting for
+// the running calculations, which are abandoned without writing their
+// outputs.
+func watch(ctx context.Context, calcs []*witnesscalc.Circom2WitnessCalculator,
+	inputsDir, outputsDir string, interval time.Duration) {
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for _, calc := range calcs {
+		wg.Add(1)
+		go func(calc *witnesscalc.Circom2WitnessCalculator) {
+			defer wg.Done()
+			for inputPath := range jobs {
+				processInput(ctx, calc, inputPath, outputsDir)
+			}
+		}(calc)
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	seen := make(map[string]time.Time)
+	for {
+		if err := scanInputs(ctx, inputsDir, interval, seen, jobs); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("scan %s: %v", inputsDir, err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scanInputs sends to jobs the JSON files of dir that are new or modified
+// since they were last seen, until ctx is done.  Files modified less than
+// settle ago are left for a later scan, as they may still be being written.
+func scanInputs(ctx context.Context, dir string, settle time.Duration,
+	seen map[string]time.Time, jobs chan<- string) error {
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		modTime := entry.ModTime()
+		if time.Since(modTime) < settle {
+			continue
+		}
+		inputPath := filepath.Join(dir, entry.Name())
+		if last, ok := seen[inputPath]; ok && !modTime.After(last) {
+			continue
+		}
+		select {
+		case jobs <- inputPath:
+			seen[inputPath] = modTime
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// processInput calculates the witness of inputPath into outputsDir.  The wtns
+// file is written under a temporary name and renamed once complete so that
+// consumers never see partial outputs.  processInput returns as soon as ctx
+// is done, leaving the calculation to finish in the background.
+func processInput(ctx context.Context, calc *witnesscalc.Circom2WitnessCalculator,
+	inputPath, outputsDir string) {
+
+	name := strings.TrimSuffix(filepath.Base(inputPath), ".json")
+	outputPath := filepath.Join(outputsDir, name+".wtns")
+	tmpPath := outputPath + ".tmp"
+
+	start := time.Now()
+	wtnsBytes, err := calcWTNS(ctx, calc, inputPath)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("%s: %v", inputPath, err)
+		}
+		return
+	}
+	if err := writeOutput(tmpPath, wtnsBytes, true); err != nil {
+		log.Printf("%s: %v", inputPath, err)
+		_ = os.Remove(tmpPath)
+		return
+	}
+	if err := os.Rename(tmpPath, outputPath); err != nil {
+		log.Printf("%s: %v", inputPath, err)
+		return
+	}
+	log.Printf("%s -> %s (%v)", inputPath, outputPath, time.Since(start))
+}
+
+// calcWTNS calculates the wtns witness of the inputs at inputPath, or returns
+// the error of ctx as soon as it is done.
+func calcWTNS(ctx context.Context, calc *witnesscalc.Circom2WitnessCalculator,
+	inputPath string) ([]byte, error) {
+
+	inputs, err := readInputs(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	res, err := calc.CalculateWitnessAsync(ctx, inputs)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-res:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Witness.ToWTNS()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,148 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ComponentNode is a component of the circuit in a ComponentTree.
+type ComponentNode struct {
+	Index int
+	// Name is the component name from the symbols (e.g. "main.hasher"), or
+	// "component <Index>" for components without signals in the symbols.
+	Name string
+	// FirstSignal and LastSignal are the range of label indexes of the
+	// signals of the component itself, -1 if unknown.
+	FirstSignal int
+	LastSignal  int
+	// Order is the position of the component in the execution order, -1 if
+	// it didn't run.
+	Order int
+	// Duration is the time between the start and the finish of the
+	// component, including the subcomponents triggered meanwhile.
+	Duration time.Duration
+	Children []*ComponentNode
+}
+
+// ComponentTree is the hierarchy of the components of a circuit with their
+// execution order and timings in a calculation, used to find the hot spots
+// of a circuit.
+type ComponentTree struct {
+	// Roots are the components without parent, usually only "main".
+	Roots []*ComponentNode
+	// Components maps the component indexes to their nodes.
+	Components map[int]*ComponentNode
+	// Order lists the components in the order they started.
+	Order []*ComponentNode
+}
+
+// Slowest returns up to n components sorted by decreasing Duration.
+func (t *ComponentTree) Slowest(n int) []*ComponentNode {
+	nodes := make([]*ComponentNode, len(t.Order))
+	copy(nodes, t.Order)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Duration > nodes[j].Duration
+	})
+	if n < len(nodes) {
+		nodes = nodes[:n]
+	}
+	return nodes
+}
+
+// componentProfile records the logStartComponent and logFinishComponent
+// calls of a calculation.
+type componentProfile struct {
+	starts    map[int32]time.Time
+	durations map[int32]time.Duration
+	order     []int32
+}
+
+func newComponentProfile() *componentProfile {
+	return &componentProfile{
+		starts:    make(map[int32]time.Time),
+		durations: make(map[int32]time.Duration),
+	}
+}
+
+func (p *componentProfile) start(cIdx int32) {
+	if _, ok := p.starts[cIdx]; !ok {
+		p.order = append(p.order, cIdx)
+	}
+	p.starts[cIdx] = time.Now()
+}
+
+func (p *componentProfile) finish(cIdx int32) {
+	if start, ok := p.starts[cIdx]; ok {
+		p.durations[cIdx] += time.Since(start)
+	}
+}
+
+// componentName returns the name of the component of a signal: the signal
+// name without its last part.
+func componentName(signal string) string {
+	if i := strings.LastIndexByte(signal, '.'); i >= 0 {
+		return signal[:i]
+	}
+	return ""
+}
+
+// newComponentTree builds the ComponentTree of the components in syms and
+// in the profile.
+func newComponentTree(syms []Symbol, p *componentProfile) *ComponentTree {
+	t := &ComponentTree{Components: make(map[int]*ComponentNode)}
+	node := func(idx int) *ComponentNode {
+		n, ok := t.Components[idx]
+		if !ok {
+			n = &ComponentNode{Index: idx, FirstSignal: -1, LastSignal: -1, Order: -1}
+			t.Components[idx] = n
+		}
+		return n
+	}
+	for _, sym := range syms {
+		n := node(sym.ComponentIdx)
+		if n.Name == "" {
+			n.Name = componentName(sym.Name)
+		}
+		if n.FirstSignal < 0 || sym.LabelIdx < n.FirstSignal {
+			n.FirstSignal = sym.LabelIdx
+		}
+		if sym.LabelIdx > n.LastSignal {
+			n.LastSignal = sym.LabelIdx
+		}
+	}
+	if p != nil {
+		for i, cIdx := range p.order {
+			n := node(int(cIdx))
+			n.Order = i
+			n.Duration = p.durations[cIdx]
+			t.Order = append(t.Order, n)
+		}
+	}
+
+	idxs := make([]int, 0, len(t.Components))
+	byName := make(map[string]*ComponentNode, len(t.Components))
+	for idx, n := range t.Components {
+		idxs = append(idxs, idx)
+		if n.Name == "" {
+			n.Name = fmt.Sprintf("component %d", idx)
+		} else {
+			byName[n.Name] = n
+		}
+	}
+	sort.Ints(idxs)
+	for _, idx := range idxs {
+		n := t.Components[idx]
+		var parent *ComponentNode
+		for name := componentName(n.Name); name != "" && parent == nil; name = componentName(name) {
+			parent = byName[name]
+		}
+		if parent == nil {
+			t.Roots = append(t.Roots, n)
+		} else {
+			parent.Children = append(parent.Children, n)
+		}
+	}
+	return t
+}
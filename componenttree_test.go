@@ -0,0 +1,56 @@
+package witnesscalc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewComponentTree(t *testing.T) {
+	syms := []Symbol{
+		{LabelIdx: 1, VarIdx: 1, ComponentIdx: 0, Name: "main.out"},
+		{LabelIdx: 2, VarIdx: 2, ComponentIdx: 0, Name: "main.in[0]"},
+		{LabelIdx: 3, VarIdx: 3, ComponentIdx: 0, Name: "main.in[1]"},
+		{LabelIdx: 4, VarIdx: 4, ComponentIdx: 1, Name: "main.h[0].x"},
+		{LabelIdx: 5, VarIdx: -1, ComponentIdx: 2, Name: "main.h[1].x"},
+		{LabelIdx: 6, VarIdx: 5, ComponentIdx: 3, Name: "main.h[1].sub.y"},
+	}
+	p := newComponentProfile()
+	p.start(0)
+	p.start(2)
+	p.start(3)
+	p.finish(3)
+	p.finish(2)
+	p.start(5)
+	p.finish(5)
+	p.finish(0)
+	p.durations = map[int32]time.Duration{0: 10, 2: 6, 3: 4, 5: 1}
+
+	tree := newComponentTree(syms, p)
+	require.Len(t, tree.Roots, 2)
+	main := tree.Roots[0]
+	assert.Equal(t, "main", main.Name)
+	assert.Equal(t, 1, main.FirstSignal)
+	assert.Equal(t, 3, main.LastSignal)
+	assert.Equal(t, 0, main.Order)
+	require.Len(t, main.Children, 2)
+	assert.Equal(t, "main.h[0]", main.Children[0].Name)
+	assert.Equal(t, -1, main.Children[0].Order)
+	assert.Equal(t, "main.h[1]", main.Children[1].Name)
+	require.Len(t, main.Children[1].Children, 1)
+	assert.Equal(t, "main.h[1].sub", main.Children[1].Children[0].Name)
+	assert.Equal(t, 6, main.Children[1].Children[0].FirstSignal)
+
+	assert.Equal(t, "component 5", tree.Roots[1].Name)
+	assert.Equal(t, -1, tree.Roots[1].FirstSignal)
+
+	require.Len(t, tree.Order, 4)
+	assert.Equal(t, []int{0, 2, 3, 5}, []int{tree.Order[0].Index, tree.Order[1].Index,
+		tree.Order[2].Index, tree.Order[3].Index})
+	slowest := tree.Slowest(2)
+	require.Len(t, slowest, 2)
+	assert.Equal(t, time.Duration(10), slowest[0].Duration)
+	assert.Equal(t, "main.h[1]", slowest[1].Name)
+}
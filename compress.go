@@ -0,0 +1,113 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// MaxDecompressedWASMSize bounds the size of the modules decompressed by
+// DecompressWASM, so that a small compressed file can't exhaust the memory
+// (a decompression bomb).  It can be raised, before loading modules, for
+// circuits whose modules are bigger.
+var MaxDecompressedWASMSize int64 = 1 << 30
+
+// WASMDecompressor returns a reader of the decompressed content of r, for
+// RegisterWASMDecompressor.  The reader is closed after reading, if it has a
+// Close method.
+type WASMDecompressor func(r io.Reader) (io.Reader, error)
+
+// wasmCompression is a compression format of the WitnessCalc WASM modules.
+type wasmCompression struct {
+	name       string
+	magic      string
+	decompress WASMDecompressor
+}
+
+var (
+	wasmCompressionsMu sync.RWMutex
+	// wasmCompressions are the formats recognized by DecompressWASM; zstd
+	// modules are only decompressed once a decompressor is registered.
+	wasmCompressions = []wasmCompression{
+		{name: "gzip", magic: "\x1f\x8b", decompress: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		}},
+		{name: "zstd", magic: "\x28\xb5\x2f\xfd"},
+	}
+)
+
+// RegisterWASMDecompressor registers the decompressor of the WitnessCalc WASM
+// modules compressed in the format name, recognized by their leading magic
+// bytes, replacing the one of a format of the same name or magic.  gzip is
+// registered by default; zstd is recognized but needs a decompressor, e.g.
+// with github.com/klauspost/compress/zstd:
+//
+//	witnesscalc.RegisterWASMDecompressor("zstd", "\x28\xb5\x2f\xfd", func(r io.Reader) (io.Reader, error) {
+//		return zstd.NewReader(r)
+//	})
+func RegisterWASMDecompressor(name, magic string, decompress WASMDecompressor) {
+	wasmCompressionsMu.Lock()
+	defer wasmCompressionsMu.Unlock()
+	c := wasmCompression{name: name, magic: magic, decompress: decompress}
+	for i, other := range wasmCompressions {
+		if other.name == name || other.magic == magic {
+			wasmCompressions[i] = c
+			return
+		}
+	}
+	wasmCompressions = append(wasmCompressions, c)
+}
+
+// DecompressWASM returns the WitnessCalc WASM module wasmBytes decompressed
+// if it is compressed in one of the formats of RegisterWASMDecompressor,
+// detected by their magic bytes, e.g. the .wasm.gz and .wasm.zst files of the
+// circuits distributed over networks, or wasmBytes otherwise.  All the
+// functions loading modules decompress them with it, so that the compressed
+// modules can be given to any of them.  Modules decompressing to more than
+// MaxDecompressedWASMSize bytes are rejected.
+func DecompressWASM(wasmBytes []byte) ([]byte, error) {
+	if bytes.HasPrefix(wasmBytes, []byte(wasmMagic)) {
+		return wasmBytes, nil
+	}
+	wasmCompressionsMu.RLock()
+	var format *wasmCompression
+	for i := range wasmCompressions {
+		if bytes.HasPrefix(wasmBytes, []byte(wasmCompressions[i].magic)) {
+			c := wasmCompressions[i]
+			format = &c
+			break
+		}
+	}
+	wasmCompressionsMu.RUnlock()
+	if format == nil {
+		return wasmBytes, nil
+	}
+	if format.decompress == nil {
+		return nil, fmt.Errorf("%s compressed WASM module: no decompressor registered, see RegisterWASMDecompressor", format.name)
+	}
+	r, err := format.decompress(bytes.NewReader(wasmBytes))
+	if err != nil {
+		return nil, fmt.Errorf("%s compressed WASM module: %w", format.name, err)
+	}
+	switch closer := r.(type) {
+	case io.Closer:
+		defer closer.Close()
+	case interface{ Close() }:
+		defer closer.Close()
+	}
+	limit := MaxDecompressedWASMSize
+	b, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s compressed WASM module: %w", format.name, err)
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("%s compressed WASM module: decompressed size exceeds %d bytes, see MaxDecompressedWASMSize", format.name, limit)
+	}
+	if !bytes.HasPrefix(b, []byte(wasmMagic)) {
+		return nil, fmt.Errorf("%s compressed file is not a WASM module", format.name)
+	}
+	return b, nil
+}
@@ -0,0 +1,83 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gzipBytes returns b compressed with gzip.
+func gzipBytes(t testing.TB, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestDecompressWASM(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.NoError(t, err)
+
+	b, err := DecompressWASM(wasmBytes)
+	require.NoError(t, err)
+	assert.Equal(t, wasmBytes, b)
+
+	b, err = DecompressWASM(gzipBytes(t, wasmBytes))
+	require.NoError(t, err)
+	assert.Equal(t, wasmBytes, b)
+
+	_, err = DecompressWASM(gzipBytes(t, []byte("not a module")))
+	assert.EqualError(t, err, "gzip compressed file is not a WASM module")
+	_, err = DecompressWASM(gzipBytes(t, wasmBytes)[:100])
+	assert.EqualError(t, err, "gzip compressed WASM module: unexpected EOF")
+
+	// A module bigger than MaxDecompressedWASMSize is a decompression bomb.
+	defer func(max int64) { MaxDecompressedWASMSize = max }(MaxDecompressedWASMSize)
+	MaxDecompressedWASMSize = int64(len(wasmBytes))
+	b, err = DecompressWASM(gzipBytes(t, wasmBytes))
+	require.NoError(t, err)
+	assert.Equal(t, wasmBytes, b)
+	MaxDecompressedWASMSize = int64(len(wasmBytes)) - 1
+	_, err = DecompressWASM(gzipBytes(t, wasmBytes))
+	assert.EqualError(t, err, fmt.Sprintf("gzip compressed WASM module: decompressed size exceeds %d bytes, see MaxDecompressedWASMSize", len(wasmBytes)-1))
+
+	// Unknown formats are left to the module parser.
+	b, err = DecompressWASM([]byte("invalid"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("invalid"), b)
+}
+
+func TestRegisterWASMDecompressor(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.NoError(t, err)
+	zstdMagic := "\x28\xb5\x2f\xfd"
+	compressed := append([]byte(zstdMagic), wasmBytes...)
+
+	_, err = DecompressWASM(compressed)
+	assert.EqualError(t, err, "zstd compressed WASM module: no decompressor registered, see RegisterWASMDecompressor")
+
+	wasmCompressionsMu.Lock()
+	saved := append([]wasmCompression{}, wasmCompressions...)
+	wasmCompressionsMu.Unlock()
+	defer func() {
+		wasmCompressionsMu.Lock()
+		wasmCompressions = saved
+		wasmCompressionsMu.Unlock()
+	}()
+	// A fake zstd that stores the module after the magic.
+	RegisterWASMDecompressor("zstd", zstdMagic, func(r io.Reader) (io.Reader, error) {
+		_, err := io.CopyN(ioutil.Discard, r, int64(len(zstdMagic)))
+		return r, err
+	})
+	b, err := DecompressWASM(compressed)
+	require.NoError(t, err)
+	assert.Equal(t, wasmBytes, b)
+}
@@ -0,0 +1,156 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests of this file lock in the concurrent use of the calculators: run
+// them with -race.
+
+const (
+	concurrentCalculators  = 8
+	concurrentCalculations = 10
+)
+
+func TestConcurrentCalculators(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	// Shared by the calculations, which must not modify them.
+	inputs := map[string]interface{}{"a": []interface{}{3}, "b": "11"}
+	expected := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+
+	// Shared by the calculators through their options.
+	var (
+		stats     bytes.Buffer
+		tracer    testTracer
+		layout    LayoutManifest
+		recording bytes.Buffer
+	)
+	opts := []Option{
+		WithStatsSink(NewJSONLStatsSink(&stats)),
+		WithTracer(&tracer),
+		WithLayoutRecord(&layout),
+		WithRecorder(&recording),
+		WithStrictInputs(),
+		WithInputLinting(),
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentCalculators)
+	for i := 0; i < concurrentCalculators; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wc, err := LoadWitnessCalculator(wasmBytes, opts...)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer wc.Close()
+			for j := 0; j < concurrentCalculations; j++ {
+				w, err := wc.CalculateWitness(inputs, true)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !assert.Equal(t, expected, w.Values()) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.Nil(t, err)
+	}
+
+	assert.Equal(t, map[string]interface{}{"a": []interface{}{3}, "b": "11"}, inputs)
+	n := concurrentCalculators * concurrentCalculations
+	assert.Equal(t, n, bytes.Count(stats.Bytes(), []byte("\n")))
+	assert.Len(t, tracer.spans, n*4+concurrentCalculators)
+	assert.Len(t, layout.SignalOffsets, 2)
+
+	// The recordings don't interleave.
+	wc, err := LoadWitnessCalculator(wasmBytes)
+	require.Nil(t, err)
+	defer wc.Close()
+	r := bytes.NewReader(recording.Bytes())
+	for i := 0; i < n; i++ {
+		w, err := wc.Replay(r)
+		require.Nil(t, err)
+		require.Equal(t, expected, w.Values())
+	}
+	assert.Zero(t, r.Len())
+}
+
+func TestConcurrentPool(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	pool := NewCalculatorPool(func() (Calculator, error) {
+		return LoadWitnessCalculator(wasmBytes)
+	}, PoolConfig{MinIdle: 2, MaxSize: concurrentCalculators / 2})
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentCalculators)
+	for i := 0; i < concurrentCalculators; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < concurrentCalculations; j++ {
+				a := int64(i*concurrentCalculations + j)
+				inputs := map[string]interface{}{"a": big.NewInt(a), "b": big.NewInt(11)}
+				w, err := pool.CalculateWitness(context.Background(), inputs, true)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !assert.Zero(t, w.At(1).Cmp(big.NewInt(a*11))) {
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.Nil(t, err)
+	}
+	s := pool.Stats()
+	assert.Zero(t, s.InUse)
+	assert.LessOrEqual(t, s.Created, concurrentCalculators/2)
+}
+
+func TestConcurrentLayoutManifest(t *testing.T) {
+	var m LayoutManifest
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentCalculators; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := string(rune('a' + i))
+			for j := 0; j < concurrentCalculations; j++ {
+				m.recordStart(1, 4)
+				m.recordSignal(name, int32(i))
+				assert.Nil(t, m.checkSignal(name, int32(i)))
+				_, err := m.WriteTo(ioutil.Discard)
+				assert.Nil(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, m.SignalOffsets, concurrentCalculators)
+	assert.Nil(t, m.checkStart(1, 4))
+}
@@ -0,0 +1,95 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+)
+
+// crashDumpInfo is the context of a failed calculation, written to info.json
+// in the crash dump directory.
+type crashDumpInfo struct {
+	Time       time.Time `json:"time"`
+	Error      string    `json:"error"`
+	MemFreePos int32     `json:"memFreePos"`
+	MemorySize int       `json:"memorySize"`
+	NVars      int32     `json:"nVars"`
+	Prime      string    `json:"prime"`
+	StackSize  uint      `json:"stackSize,omitempty"`
+}
+
+// crashDump writes the crash dump of the calculation of inputs that failed
+// with calcErr, if enabled with WithCrashDump.  Errors writing it are logged,
+// so that they don't hide calcErr.
+func (wc *WitnessCalculator) crashDump(inputs interface{}, calcErr error) {
+	if wc.opts.crashDumpDir == "" || wc.willRetry(calcErr) {
+		return
+	}
+	dir, err := wc.writeCrashDump(inputs, calcErr)
+	if err != nil {
+		log.Warn("WitnessCalculator unable to write crash dump", "error", err)
+		return
+	}
+	log.Warn("WitnessCalculator crash dump written", "dir", dir)
+}
+
+// writeCrashDump writes the crash dump files into a new subdirectory of the
+// crash dump directory and returns its path.
+func (wc *WitnessCalculator) writeCrashDump(inputs interface{}, calcErr error) (string, error) {
+	now := time.Now()
+	if err := os.MkdirAll(wc.opts.crashDumpDir, 0755); err != nil {
+		return "", err
+	}
+	dir, err := ioutil.TempDir(wc.opts.crashDumpDir,
+		fmt.Sprintf("crash-%s-", now.UTC().Format("20060102T150405")))
+	if err != nil {
+		return "", err
+	}
+
+	mem := wc.runtime.Memory()
+	info, err := json.MarshalIndent(crashDumpInfo{
+		Time:       now,
+		Error:      calcErr.Error(),
+		MemFreePos: wc.memFreePos(),
+		MemorySize: len(mem),
+		NVars:      wc.nVars,
+		Prime:      wc.prime.String(),
+		StackSize:  wc.stackSize,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	var inputsJSON []byte
+	if m, ok := inputs.(map[string]interface{}); ok {
+		inputsJSON, err = CanonicalizeInputs(m)
+	} else {
+		inputsJSON, err = json.Marshal(inputs)
+	}
+	if err != nil {
+		// Inputs that can't be serialized are often the cause of the failure.
+		inputsJSON = []byte(fmt.Sprintf("%q", fmt.Sprintf("%v", inputs)))
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"info.json", info},
+		{"inputs.json", inputsJSON},
+		{"memory.bin", mem},
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f.name), f.data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
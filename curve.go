@@ -0,0 +1,80 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Curve identifies the curve whose scalar field a circuit is compiled for,
+// detected from the prime of the field.
+type Curve int
+
+const (
+	// CurveUnknown is a field of a prime not in the known curves.
+	CurveUnknown Curve = iota
+	CurveBN254
+	CurveBLS12381
+	CurvePallas
+	CurveVesta
+	CurveGoldilocks
+)
+
+// curvePrimes are the primes of the known curves, as given to the circom
+// compiler.
+var curvePrimes = map[Curve]string{
+	CurveBN254:      "21888242871839275222246405745257275088548364400416034343698204186575808495617",
+	CurveBLS12381:   "52435875175126190479447740508185965837690552500527637822603658699938581184513",
+	CurvePallas:     "28948022309329048855892746252171976963363056481941560715954676764349967630337",
+	CurveVesta:      "28948022309329048855892746252171976963363056481941647379679742748393362948097",
+	CurveGoldilocks: "18446744069414584321",
+}
+
+// String returns the name of the curve as given to the circom compiler.
+func (c Curve) String() string {
+	switch c {
+	case CurveBN254:
+		return "bn128"
+	case CurveBLS12381:
+		return "bls12381"
+	case CurvePallas:
+		return "pallas"
+	case CurveVesta:
+		return "vesta"
+	case CurveGoldilocks:
+		return "goldilocks"
+	default:
+		return "unknown"
+	}
+}
+
+// Prime returns the prime of the field of the curve, or nil for CurveUnknown.
+func (c Curve) Prime() *big.Int {
+	s, ok := curvePrimes[c]
+	if !ok {
+		return nil
+	}
+	p, _ := new(big.Int).SetString(s, 10)
+	return p
+}
+
+// CurveFromPrime returns the curve whose field has the given prime, or
+// CurveUnknown.
+func CurveFromPrime(prime *big.Int) Curve {
+	s := prime.String()
+	for c, p := range curvePrimes {
+		if p == s {
+			return c
+		}
+	}
+	return CurveUnknown
+}
+
+// checkCurve checks that the prime of a circuit is the one of the curve
+// requested with WithCurve, if any, and returns the detected curve.
+func checkCurve(prime *big.Int, o options) (Curve, error) {
+	c := CurveFromPrime(prime)
+	if o.curve != CurveUnknown && c != o.curve {
+		return c, fmt.Errorf("circuit prime %v is not the %v prime", prime, o.curve)
+	}
+	return c, nil
+}
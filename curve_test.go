@@ -0,0 +1,27 @@
+package witnesscalc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurveFromPrime(t *testing.T) {
+	for _, c := range []Curve{CurveBN254, CurveBLS12381, CurvePallas, CurveVesta, CurveGoldilocks} {
+		require.NotNil(t, c.Prime(), c)
+		assert.True(t, c.Prime().ProbablyPrime(20), c)
+		assert.Equal(t, c, CurveFromPrime(c.Prime()))
+	}
+	assert.Equal(t, bn254, CurveBN254.Prime())
+	assert.Equal(t, "bn128", CurveBN254.String())
+	assert.Equal(t, CurveUnknown, CurveFromPrime(big.NewInt(7)))
+	assert.Nil(t, CurveUnknown.Prime())
+
+	c, err := checkCurve(bn254, newOptions([]Option{WithCurve(CurveBN254)}))
+	require.Nil(t, err)
+	assert.Equal(t, CurveBN254, c)
+	_, err = checkCurve(bn254, newOptions([]Option{WithCurve(CurveGoldilocks)}))
+	assert.EqualError(t, err, "circuit prime "+bn254.String()+" is not the goldilocks prime")
+}
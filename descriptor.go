@@ -0,0 +1,170 @@
+package witnesscalc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// CircuitDescriptor describes the circuit of a calculator: its field, the
+// size of its witness and the build of its module.  Exported as JSON by the
+// ExportDescriptor methods of the calculators and read by ImportDescriptor,
+// it lets orchestration layers check that cached witnesses, zkeys and
+// circuit builds are compatible without loading the WASM module.
+type CircuitDescriptor struct {
+	// ModuleInfo describes the module, without its Exports and Imports,
+	// which are not part of the descriptor.
+	ModuleInfo
+	// N32 is the size of the field elements in 32 bit words.
+	N32 int32
+	// ShortMax and ShortMin bound the field elements the circom 1 modules
+	// store in short form, nil for circom 2 modules.
+	ShortMax *big.Int
+	ShortMin *big.Int
+	// CircuitHash is the hash of the module, nil if unknown.
+	CircuitHash *CircuitHash
+}
+
+// circuitDescriptorJSON is the JSON encoding of a CircuitDescriptor, with
+// the numbers of the field in base 10 strings and the hash in hexadecimal.
+type circuitDescriptorJSON struct {
+	Circom      int    `json:"circom"`
+	Version     int32  `json:"version"`
+	Prime       string `json:"prime"`
+	N32         int32  `json:"n32"`
+	N64         int    `json:"n64"`
+	NVars       int32  `json:"nVars"`
+	ShortMax    string `json:"shortMax,omitempty"`
+	ShortMin    string `json:"shortMin,omitempty"`
+	CircuitHash string `json:"circuitHash,omitempty"`
+}
+
+// MarshalJSON encodes the descriptor like ExportDescriptor.
+func (d *CircuitDescriptor) MarshalJSON() ([]byte, error) {
+	if d.Prime == nil {
+		return nil, fmt.Errorf("circuit descriptor without prime")
+	}
+	j := circuitDescriptorJSON{
+		Circom:  d.Circom,
+		Version: d.Version,
+		Prime:   d.Prime.String(),
+		N32:     d.N32,
+		N64:     d.N64,
+		NVars:   d.NVars,
+	}
+	if d.ShortMax != nil {
+		j.ShortMax = d.ShortMax.String()
+	}
+	if d.ShortMin != nil {
+		j.ShortMin = d.ShortMin.String()
+	}
+	if d.CircuitHash != nil {
+		j.CircuitHash = d.CircuitHash.String()
+	}
+	return json.Marshal(&j)
+}
+
+// UnmarshalJSON decodes a descriptor encoded by MarshalJSON.
+func (d *CircuitDescriptor) UnmarshalJSON(b []byte) error {
+	var j circuitDescriptorJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	parse := func(name, s string) (*big.Int, error) {
+		if s == "" {
+			return nil, nil
+		}
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("circuit descriptor: invalid %s %q", name, s)
+		}
+		return n, nil
+	}
+	prime, err := parse("prime", j.Prime)
+	if err != nil {
+		return err
+	}
+	if prime == nil || prime.Sign() <= 0 {
+		return fmt.Errorf("circuit descriptor: invalid prime %q", j.Prime)
+	}
+	shortMax, err := parse("shortMax", j.ShortMax)
+	if err != nil {
+		return err
+	}
+	shortMin, err := parse("shortMin", j.ShortMin)
+	if err != nil {
+		return err
+	}
+	var circuitHash *CircuitHash
+	if j.CircuitHash != "" {
+		h, err := hex.DecodeString(j.CircuitHash)
+		if err != nil || len(h) != len(CircuitHash{}) {
+			return fmt.Errorf("circuit descriptor: invalid circuitHash %q", j.CircuitHash)
+		}
+		circuitHash = new(CircuitHash)
+		copy(circuitHash[:], h)
+	}
+	*d = CircuitDescriptor{
+		ModuleInfo: ModuleInfo{
+			Circom:  j.Circom,
+			Version: j.Version,
+			Prime:   prime,
+			Curve:   CurveFromPrime(prime),
+			NVars:   j.NVars,
+			N64:     j.N64,
+		},
+		N32:         j.N32,
+		ShortMax:    shortMax,
+		ShortMin:    shortMin,
+		CircuitHash: circuitHash,
+	}
+	return nil
+}
+
+// ImportDescriptor decodes a descriptor exported by the ExportDescriptor
+// methods of the calculators.
+func ImportDescriptor(b []byte) (*CircuitDescriptor, error) {
+	var d CircuitDescriptor
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CheckWitness checks that w is a witness of the circuit: a witness of its
+// field with NVars values, calculated by the same module build when both
+// hashes are known.
+func (d *CircuitDescriptor) CheckWitness(w *Witness) error {
+	if w.Prime() == nil || w.Prime().Cmp(d.Prime) != 0 {
+		return fmt.Errorf("witness field %v doesn't match the circuit field %v", w.Prime(), d.Prime)
+	}
+	if w.Len() != int(d.NVars) {
+		return fmt.Errorf("witness has %d values, the circuit has %d", w.Len(), d.NVars)
+	}
+	if h, ok := w.CircuitHash(); ok && d.CircuitHash != nil && h != *d.CircuitHash {
+		return fmt.Errorf("witness of circuit %s, expected circuit %s", h, d.CircuitHash)
+	}
+	return nil
+}
+
+// CheckZKey checks that the zkey of header h proves the circuit: it must be
+// of the field of the circuit and expect witnesses of NVars values.
+func (d *CircuitDescriptor) CheckZKey(h *ZKeyHeader) error {
+	if h.R.Cmp(d.Prime) != 0 {
+		return fmt.Errorf("%s zkey field %v doesn't match the circuit field %v", h.Protocol, h.R, d.Prime)
+	}
+	if h.NWitness() != int(d.NVars) {
+		return fmt.Errorf("%s zkey expects %d witness values, the circuit has %d", h.Protocol, h.NWitness(), d.NVars)
+	}
+	return nil
+}
+
+// ExportDescriptor returns the CircuitDescriptor of the calculator in JSON.
+func (wc *Circom2WitnessCalculator) ExportDescriptor() ([]byte, error) {
+	d := &CircuitDescriptor{ModuleInfo: wc.moduleInfo(), N32: wc.n32}
+	if h, ok := wc.CircuitHash(); ok {
+		d.CircuitHash = &h
+	}
+	return json.Marshal(d)
+}
@@ -0,0 +1,64 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitDescriptorJSON(t *testing.T) {
+	hash := NewCircuitHash([]byte("circuit"))
+	d := &CircuitDescriptor{ModuleInfo: ModuleInfo{Circom: 2, Version: 2, Prime: bn254, Curve: CurveBN254, NVars: 4, N64: 4},
+		N32: 8, CircuitHash: &hash}
+	b, err := json.Marshal(d)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"circom":2,"version":2,"prime":"`+bn254.String()+`","n32":8,"n64":4,"nVars":4,"circuitHash":"`+hash.String()+`"}`, string(b))
+	imported, err := ImportDescriptor(b)
+	require.NoError(t, err)
+	assert.Equal(t, d, imported)
+
+	d = &CircuitDescriptor{ModuleInfo: ModuleInfo{Circom: 1, Prime: bn254, Curve: CurveBN254, NVars: 4, N64: 4}, N32: 8,
+		ShortMax: big.NewInt(0x80000000), ShortMin: new(big.Int).Sub(bn254, big.NewInt(0x80000000))}
+	b, err = json.Marshal(d)
+	require.NoError(t, err)
+	imported, err = ImportDescriptor(b)
+	require.NoError(t, err)
+	assert.Equal(t, d, imported)
+
+	for _, invalid := range []string{
+		`{"circom":2}`,
+		`{"prime":"0x10"}`,
+		`{"prime":"7","shortMax":"a"}`,
+		`{"prime":"7","circuitHash":"00"}`,
+		`[]`,
+	} {
+		_, err := ImportDescriptor([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCircuitDescriptorCheck(t *testing.T) {
+	hash := NewCircuitHash([]byte("circuit"))
+	d := &CircuitDescriptor{ModuleInfo: ModuleInfo{Circom: 2, Version: 2, Prime: bn254, Curve: CurveBN254, NVars: 4, N64: 4},
+		N32: 8, CircuitHash: &hash}
+	w := NewWitness([]*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}, bn254)
+	require.NoError(t, d.CheckWitness(w))
+	w.circuitHash = &hash
+	require.NoError(t, d.CheckWitness(w))
+	other := NewCircuitHash([]byte("other"))
+	w.circuitHash = &other
+	assert.Error(t, d.CheckWitness(w))
+	assert.EqualError(t, d.CheckWitness(NewWitness(w.Values()[:3], bn254)), "witness has 3 values, the circuit has 4")
+	assert.Error(t, d.CheckWitness(NewWitness(w.Values(), big.NewInt(101))))
+
+	h, err := ReadZKeyHeader(bytes.NewReader(testZKey(ZKeyPlonk, 6, 1, 2)))
+	require.NoError(t, err)
+	require.NoError(t, d.CheckZKey(h))
+	h, err = ReadZKeyHeader(bytes.NewReader(testZKey(ZKeyGroth16, 6, 1, 0)))
+	require.NoError(t, err)
+	assert.EqualError(t, d.CheckZKey(h), "groth16 zkey expects 6 witness values, the circuit has 4")
+}
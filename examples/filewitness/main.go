@@ -0,0 +1,63 @@
+// Command filewitness calculates the witness of a circom 2 circuit from an
+// inputs file and writes it in the snarkjs wtns format, like
+// `snarkjs wtns calculate`.
+//
+// Usage:
+//
+//	filewitness <circuit.wasm> <input.json> <witness.wtns>
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+func main() {
+	if len(os.Args) != 4 {
+		fmt.Fprintln(os.Stderr, "Usage: filewitness <circuit.wasm> <input.json> <witness.wtns>")
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2], os.Args[3]); err != nil {
+		fmt.Fprintf(os.Stderr, "filewitness: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(wasmPath, inputPath, wtnsPath string) error {
+	wasmBytes, err := ioutil.ReadFile(wasmPath)
+	if err != nil {
+		return err
+	}
+	inputBytes, err := ioutil.ReadFile(inputPath)
+	if err != nil {
+		return err
+	}
+	// {"$file": "path"} references are resolved next to the inputs file.
+	inputs, err := witnesscalc.ParseInputsFS(inputBytes, os.DirFS(filepath.Dir(inputPath)))
+	if err != nil {
+		return err
+	}
+
+	calc, err := witnesscalc.NewCircom2WitnessCalculator(wasmBytes, witnesscalc.WithCircuitHashInWTNS())
+	if err != nil {
+		return err
+	}
+	w, err := calc.CalculateWitness(inputs, true)
+	if err != nil {
+		return err
+	}
+	wtnsBytes, err := w.ToWTNS()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(wtnsPath, wtnsBytes, 0644); err != nil {
+		return err
+	}
+	hash, _ := w.CircuitHash()
+	fmt.Printf("%d witness values of circuit %s written to %s\n", w.Len(), hash, wtnsPath)
+	return nil
+}
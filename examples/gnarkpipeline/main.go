@@ -0,0 +1,123 @@
+// Command gnarkpipeline prepares the witness of a circom 2 circuit for a
+// gnark prover: it calculates the witness, checks it against the r1cs file
+// of the circuit, and writes the public and secret variables in the binary
+// format of gnark's witness.Witness, which the prover reads with
+// UnmarshalBinary.
+//
+// The public variables are the public outputs and inputs of the circuit and
+// the secret variables its private inputs, in the order of the witness: the
+// gnark circuit must declare its variables in that order.  The file is
+// written without importing gnark, which the witnesscalc module doesn't
+// depend on:
+//
+//	uint32 number of public variables (big-endian)
+//	uint32 number of secret variables
+//	uint32 number of values, public then secret
+//	the values, as big-endian field elements of the r1cs field size
+//
+// Usage:
+//
+//	gnarkpipeline <circuit.wasm> <circuit.r1cs> <input.json> <witness.bin>
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+func main() {
+	if len(os.Args) != 5 {
+		fmt.Fprintln(os.Stderr, "Usage: gnarkpipeline <circuit.wasm> <circuit.r1cs> <input.json> <witness.bin>")
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2], os.Args[3], os.Args[4]); err != nil {
+		fmt.Fprintf(os.Stderr, "gnarkpipeline: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(wasmPath, r1csPath, inputPath, outputPath string) error {
+	f, err := os.Open(r1csPath)
+	if err != nil {
+		return err
+	}
+	header, err := witnesscalc.ReadR1CSHeader(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", r1csPath, err)
+	}
+
+	wasmBytes, err := ioutil.ReadFile(wasmPath)
+	if err != nil {
+		return err
+	}
+	inputBytes, err := ioutil.ReadFile(inputPath)
+	if err != nil {
+		return err
+	}
+	inputs, err := witnesscalc.ParseInputs(inputBytes)
+	if err != nil {
+		return err
+	}
+	// Reject the inputs the r1cs doesn't expect before calculating.
+	if err := header.CheckInputs(inputs); err != nil {
+		return err
+	}
+	calc, err := witnesscalc.NewCircom2WitnessCalculator(wasmBytes)
+	if err != nil {
+		return err
+	}
+	w, err := calc.CalculateWitness(inputs, true)
+	if err != nil {
+		return err
+	}
+	values := w.Values()
+	if err := header.CheckWitness(values); err != nil {
+		return err
+	}
+
+	_, publicOutputs, publicInputs, privateInputs, err := witnesscalc.SplitWitness(values, header)
+	if err != nil {
+		return err
+	}
+	public := append(append([]*big.Int{}, publicOutputs...), publicInputs...)
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := writeGnarkWitness(out, int(header.FieldSize), public, privateInputs); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%d public and %d secret variables written to %s\n", len(public), len(privateInputs), outputPath)
+	return nil
+}
+
+// writeGnarkWitness writes the public and secret variables in the binary
+// format of gnark's witness.Witness, with field elements of n8 bytes.
+func writeGnarkWitness(f *os.File, n8 int, public, secret []*big.Int) error {
+	w := bufio.NewWriter(f)
+	for _, n := range []int{len(public), len(secret), len(public) + len(secret)} {
+		if err := binary.Write(w, binary.BigEndian, uint32(n)); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, n8)
+	for _, values := range [][]*big.Int{public, secret} {
+		for _, v := range values {
+			if _, err := w.Write(v.FillBytes(buf)); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
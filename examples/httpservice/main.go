@@ -0,0 +1,116 @@
+// Command httpservice serves the witnesses of a circom 2 circuit over HTTP:
+// POST /witness with the JSON inputs as body returns the witness in the
+// snarkjs wtns format.  The calculations run on a CalculatorPool, pre-warmed
+// so that the first requests don't pay the load latency of the module.
+//
+// Usage:
+//
+//	httpservice [-addr :8080] [-max-inputs bytes] <circuit.wasm>
+//
+// e.g.
+//
+//	curl --data-binary @input.json -o witness.wtns localhost:8080/witness
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	maxInputs := flag.Int64("max-inputs", 10<<20, "maximum size of the inputs in bytes")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: httpservice [-addr :8080] [-max-inputs bytes] <circuit.wasm>")
+		os.Exit(2)
+	}
+	wasmBytes, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pool := witnesscalc.NewCircom2CalculatorPool(wasmBytes, witnesscalc.PoolConfig{
+		MinIdle:     1,
+		MaxSize:     runtime.NumCPU(),
+		IdleTimeout: time.Minute,
+	})
+	defer pool.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/witness", &witnessHandler{pool: pool, maxInputs: *maxInputs})
+	srv := &http.Server{Addr: *addr, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Print(err)
+		}
+	}()
+	log.Printf("Serving witnesses on %s", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// witnessHandler calculates the witnesses of the JSON inputs it is posted.
+type witnessHandler struct {
+	pool      *witnesscalc.CalculatorPool
+	maxInputs int64
+}
+
+func (h *witnessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, h.maxInputs))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	inputs, err := witnesscalc.ParseInputs(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The request context stops the wait for a calculator when the client
+	// goes away.
+	witness, err := h.pool.CalculateWitness(r.Context(), inputs, true)
+	var unknownErr witnesscalc.ErrUnknownInput
+	switch {
+	case errors.As(err, &unknownErr), errors.Is(err, witnesscalc.ErrTooManyValues):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		// Unsatisfied constraints and the other failures of the circuit.
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	wtnsBytes, err := witness.ToWTNS()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := w.Write(wtnsBytes); err != nil {
+		log.Print(err)
+	}
+}
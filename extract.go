@@ -0,0 +1,49 @@
+package witnesscalc
+
+import (
+	"math/big"
+	"sync"
+)
+
+// minExtractChunk is the smallest number of values converted by a goroutine
+// of decodeWitnessBuffer, below which the goroutines cost more than they
+// save.
+const minExtractChunk = 1 << 14
+
+// decodeWitnessBuffer converts the witness buffer buf, the little-endian
+// field elements of n8 bytes in witness order, to the values of the witness,
+// splitting the conversion across up to workers goroutines.  The values are
+// allocated at once.
+func decodeWitnessBuffer(buf []byte, n8, workers int) []*big.Int {
+	n := len(buf) / n8
+	w := make([]*big.Int, n)
+	values := make([]big.Int, n)
+	decode := func(start, end int) {
+		var codec LimbCodec
+		for i := start; i < end; i++ {
+			w[i] = codec.DecodeTo(&values[i], buf[i*n8:(i+1)*n8])
+		}
+	}
+	if max := (n + minExtractChunk - 1) / minExtractChunk; workers > max {
+		workers = max
+	}
+	if workers <= 1 {
+		decode(0, n)
+		return w
+	}
+	var wg sync.WaitGroup
+	chunk := (n + workers - 1) / workers
+	for start := 0; start < n; start += chunk {
+		end := start + chunk
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			decode(start, end)
+		}(start, end)
+	}
+	wg.Wait()
+	return w
+}
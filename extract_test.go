@@ -0,0 +1,58 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWitnessBuffer returns a witness buffer of n values of 32 bytes and its
+// values.
+func testWitnessBuffer(n int) ([]byte, []*big.Int) {
+	buf := make([]byte, n*32)
+	values := make([]*big.Int, n)
+	for i := range values {
+		values[i] = new(big.Int).Mul(big.NewInt(int64(i)), bn254)
+		values[i].Rsh(values[i], 7).Mod(values[i], bn254)
+		le := buf[i*32 : (i+1)*32]
+		values[i].FillBytes(le)
+		ReverseBytes(le, le)
+	}
+	return buf, values
+}
+
+func TestDecodeWitnessBuffer(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 3*minExtractChunk + 5} {
+		buf, values := testWitnessBuffer(n)
+		for _, workers := range []int{1, 2, 7} {
+			w := decodeWitnessBuffer(buf, 32, workers)
+			require.Len(t, w, n)
+			for i := range w {
+				require.Equal(t, 0, values[i].Cmp(w[i]), "n=%d workers=%d i=%d", n, workers, i)
+			}
+		}
+	}
+}
+
+func BenchmarkDecodeWitnessBuffer(b *testing.B) {
+	buf, _ := testWitnessBuffer(1 << 20)
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(buf)))
+			for i := 0; i < b.N; i++ {
+				decodeWitnessBuffer(buf, 32, workers)
+			}
+		})
+	}
+}
+
+func TestWithParallelExtraction(t *testing.T) {
+	var o options
+	WithParallelExtraction(3)(&o)
+	assert.Equal(t, 3, o.extractWorkers)
+	WithParallelExtraction(0)(&o)
+	assert.True(t, o.extractWorkers >= 1)
+}
@@ -0,0 +1,251 @@
+// Package fetch downloads the WitnessCalc WASM modules of circuits on demand
+// from HTTP(S) or S3 URLs, verifies them against a pinned digest and caches
+// them on disk, so that wallets don't need to ship their circuits.
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// ErrPinMismatch is returned when a fetched module doesn't match its pin.
+var ErrPinMismatch = errors.New("the module doesn't match its pin")
+
+// multicodec and multihash codes of the supported CIDs
+const (
+	cidCodecRaw     = 0x55
+	multihashSHA256 = 0x12
+)
+
+// Pin is the expected SHA-256 digest of a module.
+type Pin struct {
+	digest [sha256.Size]byte
+}
+
+// SHA256Pin returns the Pin of the hex encoded SHA-256 digest of a module,
+// e.g. the output of sha256sum.
+func SHA256Pin(hexDigest string) (Pin, error) {
+	var p Pin
+	b, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return p, fmt.Errorf("invalid sha256 digest: %w", err)
+	}
+	if len(b) != sha256.Size {
+		return p, fmt.Errorf("invalid sha256 digest length %d", len(b))
+	}
+	copy(p.digest[:], b)
+	return p, nil
+}
+
+// CIDPin returns the Pin of an IPFS CID.  Only CIDv1 with the raw codec and a
+// SHA-256 multihash, in the default base32 multibase ("bafkrei..."), are
+// supported: the digest of the others is the one of their UnixFS DAG, not of
+// the module.  Such CIDs are given by "ipfs add --cid-version=1
+// --raw-leaves" for modules that fit in a single block.
+func CIDPin(cid string) (Pin, error) {
+	var p Pin
+	if strings.HasPrefix(cid, "Qm") {
+		return p, fmt.Errorf("CIDv0 %s hashes a UnixFS DAG, not the module", cid)
+	}
+	if !strings.HasPrefix(cid, "b") {
+		return p, fmt.Errorf("CID %s is not base32 encoded", cid)
+	}
+	b, err := base32.StdEncoding.WithPadding(base32.NoPadding).
+		DecodeString(strings.ToUpper(cid[1:]))
+	if err != nil {
+		return p, fmt.Errorf("invalid CID %s: %w", cid, err)
+	}
+	var fields [4]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return p, fmt.Errorf("invalid CID %s", cid)
+		}
+		fields[i] = v
+		b = b[n:]
+	}
+	version, codec, hashCode, hashLen := fields[0], fields[1], fields[2], fields[3]
+	switch {
+	case version != 1:
+		return p, fmt.Errorf("unsupported CID version %d", version)
+	case codec != cidCodecRaw:
+		return p, fmt.Errorf("CID %s codec 0x%x is not raw, so it doesn't hash the module", cid, codec)
+	case hashCode != multihashSHA256 || hashLen != sha256.Size || len(b) != sha256.Size:
+		return p, fmt.Errorf("CID %s multihash is not sha2-256", cid)
+	}
+	copy(p.digest[:], b)
+	return p, nil
+}
+
+// String returns the hex encoded digest of the pin.
+func (p Pin) String() string {
+	return hex.EncodeToString(p.digest[:])
+}
+
+// Verify returns an error wrapping ErrPinMismatch if the module wasmBytes
+// doesn't match the pin.
+func (p Pin) Verify(wasmBytes []byte) error {
+	if digest := sha256.Sum256(wasmBytes); digest != p.digest {
+		return fmt.Errorf("%w: sha256 %x, expected %v", ErrPinMismatch, digest, p)
+	}
+	return nil
+}
+
+// Option configures a Fetcher.
+type Option func(*Fetcher)
+
+// WithHTTPClient sets the HTTP client of the downloads, which defaults to
+// http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(f *Fetcher) {
+		f.client = client
+	}
+}
+
+// WithCacheDir enables the disk cache in dir, created if needed.  The
+// modules are stored by digest, so modules of different URLs with the same
+// pin share their entry.
+func WithCacheDir(dir string) Option {
+	return func(f *Fetcher) {
+		f.cacheDir = dir
+	}
+}
+
+// Fetcher downloads pinned WitnessCalc WASM modules.  It is safe for
+// concurrent use.
+type Fetcher struct {
+	client   *http.Client
+	cacheDir string
+}
+
+// NewFetcher creates a Fetcher configured with opts.  Without WithCacheDir
+// every fetch downloads the module.
+func NewFetcher(opts ...Option) *Fetcher {
+	f := &Fetcher{client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// httpURL returns the HTTP URL of rawURL, which is either an HTTP(S) URL or
+// an s3://bucket/key URL of a public S3 object.  Private objects are fetched
+// with presigned HTTPS URLs.
+func httpURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return rawURL, nil
+	case "s3":
+		if u.Host == "" || strings.TrimPrefix(u.Path, "/") == "" {
+			return "", fmt.Errorf("S3 URL %s without bucket or key", rawURL)
+		}
+		return (&url.URL{Scheme: "https", Host: u.Host + ".s3.amazonaws.com", Path: u.Path}).String(), nil
+	default:
+		return "", fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+}
+
+// cachePath returns the path of the cache entry of the pin.
+func (f *Fetcher) cachePath(pin Pin) string {
+	return filepath.Join(f.cacheDir, pin.String()+".wasm")
+}
+
+// Fetch returns the module at rawURL, an HTTP(S) or s3:// URL, verified with
+// pin.  Cached modules are verified again, and downloaded again if they don't
+// match.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, pin Pin) ([]byte, error) {
+	if f.cacheDir != "" {
+		wasmBytes, err := ioutil.ReadFile(f.cachePath(pin))
+		if err == nil && pin.Verify(wasmBytes) == nil {
+			return wasmBytes, nil
+		}
+	}
+	wasmBytes, err := f.download(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := pin.Verify(wasmBytes); err != nil {
+		return nil, fmt.Errorf("%s: %w", rawURL, err)
+	}
+	if f.cacheDir != "" {
+		if err := f.store(pin, wasmBytes); err != nil {
+			return nil, fmt.Errorf("caching %s: %w", rawURL, err)
+		}
+	}
+	return wasmBytes, nil
+}
+
+// download returns the body of the GET request of rawURL.
+func (f *Fetcher) download(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := httpURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", rawURL, resp.Status)
+	}
+	wasmBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rawURL, err)
+	}
+	return wasmBytes, nil
+}
+
+// store writes the module in the cache, through a temporary file so that
+// concurrent fetches never read a partial entry.
+func (f *Fetcher) store(pin Pin, wasmBytes []byte) error {
+	if err := os.MkdirAll(f.cacheDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(f.cacheDir, ".fetch-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(wasmBytes)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.cachePath(pin))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Circom2WitnessCalculator fetches the circom 2 module at rawURL with Fetch
+// and creates its calculator with opts.
+func (f *Fetcher) Circom2WitnessCalculator(ctx context.Context, rawURL string, pin Pin, opts ...witnesscalc.Option) (*witnesscalc.Circom2WitnessCalculator, error) {
+	wasmBytes, err := f.Fetch(ctx, rawURL, pin)
+	if err != nil {
+		return nil, err
+	}
+	return witnesscalc.NewCircom2WitnessCalculator(wasmBytes, opts...)
+}
@@ -0,0 +1,120 @@
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPins(t *testing.T) {
+	empty := sha256.Sum256(nil)
+	p, err := SHA256Pin(hex.EncodeToString(empty[:]))
+	require.Nil(t, err)
+	assert.Nil(t, p.Verify(nil))
+	assert.True(t, errors.Is(p.Verify([]byte("x")), ErrPinMismatch))
+
+	// raw CIDv1 of the empty file
+	c, err := CIDPin("bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku")
+	require.Nil(t, err)
+	assert.Equal(t, p, c)
+
+	_, err = SHA256Pin("e3b0")
+	assert.Error(t, err)
+	_, err = SHA256Pin("not hex")
+	assert.Error(t, err)
+	// dag-pb CIDs
+	_, err = CIDPin("QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH")
+	assert.Error(t, err)
+	_, err = CIDPin("bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi")
+	assert.Error(t, err)
+	_, err = CIDPin("zdj7WWeQ43G6JJvLWQWZpyHuAMq6uYWRjkBXFad11vE2LHhQ7")
+	assert.Error(t, err)
+}
+
+func TestHTTPURL(t *testing.T) {
+	u, err := httpURL("s3://circuits/auth/v2/circuit.wasm")
+	require.Nil(t, err)
+	assert.Equal(t, "https://circuits.s3.amazonaws.com/auth/v2/circuit.wasm", u)
+	u, err = httpURL("https://example.com/circuit.wasm")
+	require.Nil(t, err)
+	assert.Equal(t, "https://example.com/circuit.wasm", u)
+	_, err = httpURL("s3://circuits")
+	assert.Error(t, err)
+	_, err = httpURL("ftp://example.com/circuit.wasm")
+	assert.Error(t, err)
+}
+
+// roundTripFunc is an http.RoundTripper serving the requests without network.
+type roundTripFunc func(r *http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r), nil
+}
+
+func TestFetch(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("../test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	digest := sha256.Sum256(wasmBytes)
+	pin, err := SHA256Pin(hex.EncodeToString(digest[:]))
+	require.Nil(t, err)
+
+	requests := 0
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+		requests++
+		w := httptest.NewRecorder()
+		switch r.URL.Path {
+		case "/circuit.wasm":
+			w.Write(wasmBytes)
+		case "/tampered.wasm":
+			w.Write(append(wasmBytes[:len(wasmBytes):len(wasmBytes)], 0))
+		default:
+			http.NotFound(w, r)
+		}
+		return w.Result()
+	})}
+	const url = "https://circuits.example.com"
+
+	dir, err := ioutil.TempDir("", "fetch")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+	f := NewFetcher(WithHTTPClient(client), WithCacheDir(cacheDir))
+	ctx := context.Background()
+
+	_, err = f.Fetch(ctx, url+"/tampered.wasm", pin)
+	assert.True(t, errors.Is(err, ErrPinMismatch))
+	_, err = f.Fetch(ctx, url+"/missing.wasm", pin)
+	assert.Error(t, err)
+	assert.Equal(t, 2, requests)
+
+	b, err := f.Fetch(ctx, url+"/circuit.wasm", pin)
+	require.Nil(t, err)
+	assert.Equal(t, wasmBytes, b)
+	assert.Equal(t, 3, requests)
+
+	// cached
+	b, err = f.Fetch(ctx, url+"/circuit.wasm", pin)
+	require.Nil(t, err)
+	assert.Equal(t, wasmBytes, b)
+	assert.Equal(t, 3, requests)
+	entries, err := ioutil.ReadDir(cacheDir)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+
+	// a corrupted cache entry is downloaded again
+	require.Nil(t, ioutil.WriteFile(f.cachePath(pin), []byte("corrupted"), 0644))
+	b, err = f.Fetch(ctx, url+"/circuit.wasm", pin)
+	require.Nil(t, err)
+	assert.Equal(t, wasmBytes, b)
+	assert.Equal(t, 4, requests)
+}
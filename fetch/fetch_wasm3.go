@@ -0,0 +1,21 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package fetch
+
+import (
+	"context"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// WitnessCalculator fetches the circom 1 module at rawURL with Fetch and
+// loads it with witnesscalc.LoadWitnessCalculator and opts.  Close must be
+// called to release its runtime.
+func (f *Fetcher) WitnessCalculator(ctx context.Context, rawURL string, pin Pin, opts ...witnesscalc.Option) (*witnesscalc.WitnessCalculator, error) {
+	wasmBytes, err := f.Fetch(ctx, rawURL, pin)
+	if err != nil {
+		return nil, err
+	}
+	return witnesscalc.LoadWitnessCalculator(wasmBytes, opts...)
+}
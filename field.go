@@ -0,0 +1,69 @@
+package witnesscalc
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Field is the prime field of a circuit, to compute derived inputs, like
+// nullifiers or commitments, with the prime of the circuit instead of a
+// duplicated constant.  The operations take any integers, negative or above
+// the prime, and return new field elements, in [0, prime).  A Field is safe
+// for concurrent use.
+type Field struct {
+	prime *big.Int
+}
+
+// NewField returns the field of the prime.
+func NewField(prime *big.Int) *Field {
+	return &Field{prime: new(big.Int).Set(prime)}
+}
+
+// Prime returns the prime of the field.
+func (f *Field) Prime() *big.Int {
+	return new(big.Int).Set(f.prime)
+}
+
+// Mod returns x reduced to a field element.
+func (f *Field) Mod(x *big.Int) *big.Int {
+	return new(big.Int).Mod(x, f.prime)
+}
+
+// Add returns x + y in the field.
+func (f *Field) Add(x, y *big.Int) *big.Int {
+	z := new(big.Int).Add(x, y)
+	return z.Mod(z, f.prime)
+}
+
+// Sub returns x - y in the field.
+func (f *Field) Sub(x, y *big.Int) *big.Int {
+	z := new(big.Int).Sub(x, y)
+	return z.Mod(z, f.prime)
+}
+
+// Mul returns x * y in the field.
+func (f *Field) Mul(x, y *big.Int) *big.Int {
+	z := new(big.Int).Mul(x, y)
+	return z.Mod(z, f.prime)
+}
+
+// Inverse returns the multiplicative inverse of x in the field, or an error
+// if x is zero in the field.
+func (f *Field) Inverse(x *big.Int) (*big.Int, error) {
+	z := f.Mod(x)
+	if z.Sign() == 0 {
+		return nil, fmt.Errorf("inverse of zero")
+	}
+	return z.ModInverse(z, f.prime), nil
+}
+
+// Rand returns a uniformly random field element read from r, or from
+// crypto/rand if r is nil.
+func (f *Field) Rand(r io.Reader) (*big.Int, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	return rand.Int(r, f.prime)
+}
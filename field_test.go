@@ -0,0 +1,41 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestField(t *testing.T) {
+	f := NewField(big.NewInt(101))
+	assert.Equal(t, big.NewInt(101), f.Prime())
+	assert.Equal(t, big.NewInt(100), f.Mod(big.NewInt(-1)))
+	assert.Equal(t, big.NewInt(1), f.Mod(big.NewInt(203)))
+	assert.Equal(t, 0, f.Add(big.NewInt(100), big.NewInt(1)).Sign())
+	assert.Equal(t, big.NewInt(99), f.Sub(big.NewInt(1), big.NewInt(3)))
+	assert.Equal(t, big.NewInt(1), f.Mul(big.NewInt(50), big.NewInt(-2)))
+
+	x := big.NewInt(7)
+	inv, err := f.Inverse(x)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1), f.Mul(x, inv))
+	assert.Equal(t, big.NewInt(7), x, "arguments are not modified")
+	_, err = f.Inverse(big.NewInt(202))
+	assert.EqualError(t, err, "inverse of zero")
+
+	r, err := f.Rand(nil)
+	require.NoError(t, err)
+	assert.True(t, r.Sign() >= 0 && r.Cmp(f.Prime()) < 0)
+	r1, err := f.Rand(bytes.NewReader([]byte{42}))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(42), r1)
+
+	// The field doesn't share the prime of the caller.
+	p := big.NewInt(13)
+	g := NewField(p)
+	p.SetInt64(17)
+	assert.Equal(t, big.NewInt(1), g.Mod(big.NewInt(14)))
+}
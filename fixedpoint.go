@@ -0,0 +1,35 @@
+package witnesscalc
+
+import (
+	"math"
+	"math/big"
+)
+
+// FixedPoint returns the fixed-point encoding of value with bits fractional
+// bits, the integer nearest to value*2^bits, with halfway cases rounded away
+// from zero.  Negative values give negative integers, which must be reduced
+// modulo the prime to be given as inputs (see InputsBuilder.SetFixedPoint).
+// It returns nil if value is NaN or value*2^bits overflows a float64.
+func FixedPoint(value float64, bits uint) *big.Int {
+	x := math.Round(math.Ldexp(value, int(bits)))
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return nil
+	}
+	res, _ := new(big.Float).SetFloat64(x).Int(nil)
+	return res
+}
+
+// FromFixedPoint decodes the fixed-point value v with bits fractional bits,
+// rounding to the nearest float64.  If prime is not nil, v is a field element
+// and the values above (prime-1)/2 are negative, like the outputs of the
+// circuits working with signed fixed-point values.
+func FromFixedPoint(v *big.Int, bits uint, prime *big.Int) float64 {
+	signed := v
+	if prime != nil && v.Cmp(new(big.Int).Rsh(prime, 1)) > 0 {
+		signed = new(big.Int).Sub(v, prime)
+	}
+	f := new(big.Float).SetInt(signed)
+	f.SetMantExp(f, -int(bits))
+	res, _ := f.Float64()
+	return res
+}
@@ -0,0 +1,49 @@
+package witnesscalc
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedPoint(t *testing.T) {
+	for _, tt := range []struct {
+		value    float64
+		bits     uint
+		expected string
+	}{
+		{1.5, 8, "384"},
+		{-1.5, 8, "-384"},
+		{0.1, 16, "6554"},
+		// halfway cases are rounded away from zero
+		{0.5, 0, "1"},
+		{-2.5, 0, "-3"},
+	} {
+		v := FixedPoint(tt.value, tt.bits)
+		require.NotNil(t, v)
+		assert.Equal(t, tt.expected, v.String(), "%v", tt.value)
+		assert.InDelta(t, tt.value, FromFixedPoint(v, tt.bits, nil), math.Ldexp(1, -int(tt.bits)))
+	}
+	assert.Nil(t, FixedPoint(math.NaN(), 8))
+	assert.Nil(t, FixedPoint(math.MaxFloat64, 8))
+
+	p := CurveBN254.Prime()
+	inputs, err := NewInputsBuilder().
+		SetFixedPoint("a", 2.25, 4, p).
+		SetFixedPoint("b", -0.25, 4, p).
+		Build()
+	require.Nil(t, err)
+	assert.Equal(t, "36", inputs["a"].(*big.Int).String())
+	b := inputs["b"].(*big.Int)
+	assert.Equal(t, new(big.Int).Sub(p, big.NewInt(4)), b)
+	assert.Equal(t, -0.25, FromFixedPoint(b, 4, p))
+	assert.Equal(t, 2.25, FromFixedPoint(inputs["a"].(*big.Int), 4, p))
+
+	_, err = NewInputsBuilder().SetFixedPoint("a", -1, 4, nil).Build()
+	assert.EqualError(t, err, "input a: negative value -1 requires the prime")
+	_, err = NewInputsBuilder().SetFixedPoint("a", math.Inf(1), 4, p).Build()
+	assert.EqualError(t, err, "input a: +Inf can't be encoded with 4 fractional bits")
+}
@@ -0,0 +1,124 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// FrEncoding is how a circom 1 module encodes a field element in its memory.
+type FrEncoding int
+
+// The encodings of the field elements: 4 bytes holding a 32 bit signed
+// integer, the short form, followed by 4 bytes of type flags and, for the long
+// forms, the n32 bytes of the value in little-endian.  Bit 31 of the type
+// flags is set for the long forms, and bit 30 for the values in Montgomery
+// form.
+const (
+	// FrShortPositive is the short form of the values in [0, 2^31).
+	FrShortPositive FrEncoding = iota
+	// FrShortNegative is the short form of the values in [prime - 2^31,
+	// prime), held as their negative difference to the prime.
+	FrShortNegative
+	// FrLongNormal is the long form of the values as is.
+	FrLongNormal
+	// FrLongMontgomery is the long form of the values in Montgomery form,
+	// multiplied by 2^(8 n32) modulo the prime.
+	FrLongMontgomery
+)
+
+// String returns the name of the encoding.
+func (e FrEncoding) String() string {
+	switch e {
+	case FrShortPositive:
+		return "short positive"
+	case FrShortNegative:
+		return "short negative"
+	case FrLongNormal:
+		return "long normal"
+	case FrLongMontgomery:
+		return "long Montgomery"
+	}
+	return fmt.Sprintf("encoding %d", int(e))
+}
+
+// FrDescription explains how the field element at a position of the memory
+// of a circom 1 module is encoded, see DebugDescribeFr.
+type FrDescription struct {
+	Pos      int32
+	Encoding FrEncoding
+	// Short is the 32 bit signed integer of the short forms.
+	Short int32
+	// Type holds the type flags.
+	Type uint32
+	// Raw are the bytes of the element: the 8 bytes of the short form and
+	// the type flags, followed by the value of the long forms.
+	Raw []byte
+	// Value is the field element, as loaded with the witness.
+	Value *big.Int
+}
+
+// String describes the element in a line, e.g. "short negative -1 at 2192:
+// 21888242871839275222246405745257275088548364400416034343698204186575808495616".
+func (d *FrDescription) String() string {
+	if d.Encoding == FrShortPositive || d.Encoding == FrShortNegative {
+		return fmt.Sprintf("%s %d at %d: %v", d.Encoding, d.Short, d.Pos, d.Value)
+	}
+	return fmt.Sprintf("%s %x at %d: %v", d.Encoding, d.Raw[8:], d.Pos, d.Value)
+}
+
+// DebugDescribeFr describes the field element at position p of the module
+// memory, decoded like the values of the witness, to inspect the encoding of
+// the signals while debugging a circuit or the calculator.
+func (wc *WitnessCalculator) DebugDescribeFr(p int32) (*FrDescription, error) {
+	m, err := memRange(wc.runtime.Memory(), int64(p), 8)
+	if err != nil {
+		return nil, err
+	}
+	d := &FrDescription{
+		Pos:   p,
+		Short: int32(binary.LittleEndian.Uint32(m[:4])),
+		Type:  binary.LittleEndian.Uint32(m[4:8]),
+	}
+	n := int64(8)
+	switch {
+	case d.Type&0x80000000 != 0 && d.Type&0x40000000 != 0:
+		d.Encoding = FrLongMontgomery
+		n += int64(wc.n32)
+	case d.Type&0x80000000 != 0:
+		d.Encoding = FrLongNormal
+		n += int64(wc.n32)
+	case d.Short < 0:
+		d.Encoding = FrShortNegative
+	default:
+		d.Encoding = FrShortPositive
+	}
+	if m, err = memRange(wc.runtime.Memory(), int64(p), n); err != nil {
+		return nil, err
+	}
+	d.Raw = append([]byte(nil), m...)
+	if d.Value, err = wc.loadFr(p); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// DebugDescribeWitness describes the element i of the witness of the last
+// calculation like DebugDescribeFr.  It returns ErrNoWitness if the module
+// doesn't hold the witness, like SampleWitness.
+func (wc *WitnessCalculator) DebugDescribeWitness(i int) (*FrDescription, error) {
+	if !wc.calculated {
+		return nil, ErrNoWitness
+	}
+	if i < 0 || i >= int(wc.nVars) {
+		return nil, fmt.Errorf("witness index %d out of range [0, %d)", i, wc.nVars)
+	}
+	pWitness, err := wc.fns.getPWitness(int32(i))
+	if err != nil {
+		return nil, err
+	}
+	return wc.DebugDescribeFr(pWitness)
+}
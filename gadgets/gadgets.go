@@ -0,0 +1,127 @@
+// Package gadgets builds correctly shaped inputs for the common circomlib
+// templates: bit decompositions for Num2Bits, padded Merkle proofs and the
+// packed Baby Jubjub points and scalars of the bit based EdDSA verifiers, so
+// that callers don't need to split values into bits by hand.
+package gadgets
+
+import (
+	"fmt"
+	"math/big"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// bn254 is the prime of the field of the Baby Jubjub coordinates.
+var bn254 = witnesscalc.CurveBN254.Prime()
+
+var one = big.NewInt(1)
+
+// Num2Bits returns the n bits of v in little-endian order, as taken and
+// returned by circomlib's Num2Bits(n).  v must be non-negative and fit in n
+// bits.
+func Num2Bits(v *big.Int, n int) ([]*big.Int, error) {
+	if v == nil || v.Sign() < 0 {
+		return nil, fmt.Errorf("value %v is not a non-negative integer", v)
+	}
+	if v.BitLen() > n {
+		return nil, fmt.Errorf("value %v doesn't fit in %d bits", v, n)
+	}
+	bits := make([]*big.Int, n)
+	for i := range bits {
+		bits[i] = big.NewInt(int64(v.Bit(i)))
+	}
+	return bits, nil
+}
+
+// Bits2Num returns the value of the little-endian bits, as taken by
+// circomlib's Bits2Num.
+func Bits2Num(bits []*big.Int) (*big.Int, error) {
+	v := new(big.Int)
+	for i, b := range bits {
+		switch {
+		case b == nil:
+			return nil, fmt.Errorf("bit %d is nil", i)
+		case b.Cmp(one) == 0:
+			v.SetBit(v, i, 1)
+		case b.Sign() != 0:
+			return nil, fmt.Errorf("bit %d is %v", i, b)
+		}
+	}
+	return v, nil
+}
+
+// PadSiblings returns the siblings of a Merkle proof padded with zeros to the
+// levels of the circuit, as taken by the SMTVerifier and the binary Merkle
+// tree templates.
+func PadSiblings(siblings []*big.Int, levels int) ([]*big.Int, error) {
+	if len(siblings) > levels {
+		return nil, fmt.Errorf("%d siblings exceed the %d levels", len(siblings), levels)
+	}
+	padded := make([]*big.Int, levels)
+	for i := range padded {
+		if i >= len(siblings) {
+			padded[i] = new(big.Int)
+			continue
+		}
+		if siblings[i] == nil {
+			return nil, fmt.Errorf("sibling %d is nil", i)
+		}
+		padded[i] = new(big.Int).Set(siblings[i])
+	}
+	return padded, nil
+}
+
+// PathIndices returns the path of the leaf at index in a binary Merkle tree
+// of the given levels: one bit per level, from the leaf up, 1 when the node
+// is the right child.
+func PathIndices(index uint64, levels int) ([]*big.Int, error) {
+	return Num2Bits(new(big.Int).SetUint64(index), levels)
+}
+
+// PackPointBits returns the 256 bits of the Baby Jubjub point (x, y) packed
+// like circomlibjs's babyJub.packPoint, the A and R8 inputs of EdDSAVerifier:
+// the little-endian bits of y, with the sign of x, set if x > (p-1)/2, as
+// the last bit.
+func PackPointBits(x, y *big.Int) ([]*big.Int, error) {
+	if x == nil || y == nil || x.Sign() < 0 || x.Cmp(bn254) >= 0 || y.Sign() < 0 || y.Cmp(bn254) >= 0 {
+		return nil, fmt.Errorf("point (%v, %v) is not in the field", x, y)
+	}
+	bits, err := Num2Bits(y, 256)
+	if err != nil {
+		return nil, err
+	}
+	half := new(big.Int).Rsh(bn254, 1)
+	if x.Cmp(half) > 0 {
+		bits[255] = big.NewInt(1)
+	}
+	return bits, nil
+}
+
+// EdDSASignature is a Baby Jubjub EdDSA signature: the point R8 and the
+// scalar S.
+type EdDSASignature struct {
+	R8X, R8Y *big.Int
+	S        *big.Int
+}
+
+// Bits returns the R8 and S inputs of circomlib's EdDSAVerifier: the packed
+// R8 point and the 256 little-endian bits of S.
+func (sig EdDSASignature) Bits() (r8, s []*big.Int, err error) {
+	if r8, err = PackPointBits(sig.R8X, sig.R8Y); err != nil {
+		return nil, nil, fmt.Errorf("R8: %w", err)
+	}
+	if s, err = Num2Bits(sig.S, 256); err != nil {
+		return nil, nil, fmt.Errorf("S: %w", err)
+	}
+	return r8, s, nil
+}
+
+// Inputs returns the signature as the R8x, R8y and S inputs of circomlib's
+// EdDSAPoseidonVerifier and EdDSAMiMCVerifier.
+func (sig EdDSASignature) Inputs() map[string]interface{} {
+	return map[string]interface{}{
+		"R8x": new(big.Int).Set(sig.R8X),
+		"R8y": new(big.Int).Set(sig.R8Y),
+		"S":   new(big.Int).Set(sig.S),
+	}
+}
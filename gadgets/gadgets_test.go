@@ -0,0 +1,84 @@
+package gadgets
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ints(vs ...int64) []*big.Int {
+	res := make([]*big.Int, len(vs))
+	for i, v := range vs {
+		res[i] = big.NewInt(v)
+	}
+	return res
+}
+
+func TestNum2Bits(t *testing.T) {
+	bits, err := Num2Bits(big.NewInt(6), 4)
+	require.Nil(t, err)
+	assert.Equal(t, ints(0, 1, 1, 0), bits)
+	v, err := Bits2Num(bits)
+	require.Nil(t, err)
+	assert.Equal(t, big.NewInt(6), v)
+
+	_, err = Num2Bits(big.NewInt(16), 4)
+	assert.Error(t, err)
+	_, err = Num2Bits(big.NewInt(-1), 4)
+	assert.Error(t, err)
+	_, err = Bits2Num(ints(0, 2))
+	assert.Error(t, err)
+}
+
+func TestMerkle(t *testing.T) {
+	padded, err := PadSiblings(ints(7, 8), 4)
+	require.Nil(t, err)
+	assert.Equal(t, ints(7, 8, 0, 0), padded)
+	_, err = PadSiblings(ints(7, 8), 1)
+	assert.Error(t, err)
+	_, err = PadSiblings([]*big.Int{nil}, 1)
+	assert.Error(t, err)
+
+	path, err := PathIndices(5, 4)
+	require.Nil(t, err)
+	assert.Equal(t, ints(1, 0, 1, 0), path)
+	_, err = PathIndices(16, 4)
+	assert.Error(t, err)
+}
+
+func TestEdDSA(t *testing.T) {
+	// Baby Jubjub base point
+	x, _ := new(big.Int).SetString("5299619240641551281634865583518297030282874472190772894086521144482721001553", 10)
+	y, _ := new(big.Int).SetString("16950150798460657717958625567821834550301663161624707787222815936182638968203", 10)
+	bits, err := PackPointBits(x, y)
+	require.Nil(t, err)
+	require.Len(t, bits, 256)
+	assert.Equal(t, int64(0), bits[255].Int64())
+	packed, err := Bits2Num(bits)
+	require.Nil(t, err)
+	assert.Equal(t, y, packed)
+
+	// -x has the sign bit set
+	negX := new(big.Int).Sub(bn254, x)
+	bits, err = PackPointBits(negX, y)
+	require.Nil(t, err)
+	packed, err = Bits2Num(bits)
+	require.Nil(t, err)
+	assert.Equal(t, new(big.Int).SetBit(y, 255, 1), packed)
+
+	_, err = PackPointBits(bn254, y)
+	assert.Error(t, err)
+
+	sig := EdDSASignature{R8X: x, R8Y: y, S: big.NewInt(5)}
+	r8, s, err := sig.Bits()
+	require.Nil(t, err)
+	assert.Len(t, r8, 256)
+	assert.Equal(t, append(ints(1, 0, 1), ints(make([]int64, 253)...)...), s)
+	assert.Equal(t, map[string]interface{}{"R8x": x, "R8y": y, "S": big.NewInt(5)}, sig.Inputs())
+
+	sig.S = new(big.Int).Lsh(big.NewInt(1), 256)
+	_, _, err = sig.Bits()
+	assert.Error(t, err)
+}
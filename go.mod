@@ -1,4 +1,4 @@
-module github.com/iden3/go-circom-witnesscalc
+module github.com/iden3/go-circom-witnesscalc/v2
 
 go 1.17
 
@@ -6,6 +6,7 @@ require (
 	github.com/iden3/go-wasm3 v0.0.1
 	github.com/sirupsen/logrus v1.9.0
 	github.com/stretchr/testify v1.7.0
+	github.com/tetratelabs/wazero v1.3.1
 	github.com/wasmerio/wasmer-go v1.0.4
 )
 
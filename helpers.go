@@ -1,47 +1,33 @@
+//go:build cgo && !js
+// +build cgo,!js
+
 package witnesscalc
 
 import (
 	"io/ioutil"
-	"math/big"
 	"time"
 
-	"github.com/iden3/go-wasm3"
-
-	log "github.com/sirupsen/logrus"
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
 )
 
-func CalculateWitnessBinWASM(wasmBytes []byte, inputs map[string]interface{}) ([]*big.Int, error) {
-	runtime := wasm3.NewRuntime(&wasm3.Config{
-		Environment: wasm3.NewEnvironment(),
-		StackSize:   64 * 1024,
-	})
-	defer runtime.Destroy()
-
-	module, err := runtime.ParseModule(wasmBytes)
-	if err != nil {
-		return nil, err
-	}
-	module, err = runtime.LoadModule(module)
-	if err != nil {
-		return nil, err
-	}
-
-	witnessCalculator, err := NewWitnessCalculator(runtime, module)
+func CalculateWitnessBinWASM(wasmBytes []byte, inputs map[string]interface{}) (*Witness, error) {
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes)
 	if err != nil {
 		return nil, err
 	}
+	defer witnessCalculator.Close()
 
 	start := time.Now()
 	witness, err := witnessCalculator.CalculateWitness(inputs, true)
 	if err != nil {
 		return nil, err
 	}
-	log.WithField("elapsed", time.Now().Sub(start)).Debug("Witness calculated")
+	log.Debug("Witness calculated", "elapsed", time.Now().Sub(start))
 
 	return witness, err
 }
 
-func CalculateWitness(wasmFilePath string, inputs map[string]interface{}) ([]*big.Int, error) {
+func CalculateWitness(wasmFilePath string, inputs map[string]interface{}) (*Witness, error) {
 	wasmBytes, err := ioutil.ReadFile(wasmFilePath)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,71 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+// BigIntValuer is an input value of a single field element given by its
+// BigInt method, like the merkle tree hashes and the identifiers of the
+// iden3 libraries, which are accepted in the inputs without converting them.
+type BigIntValuer interface {
+	BigInt() *big.Int
+}
+
+// bigIntType is the type of the coordinates of the points.
+var bigIntType = reflect.TypeOf((*big.Int)(nil))
+
+// pointCoordinates returns the coordinates [X, Y] of v if it is a point: a
+// struct, or a pointer to a struct, with only the *big.Int fields X and Y,
+// like the babyjub.Point and babyjub.PublicKey of go-iden3-crypto.  Only
+// InputsBuilder.SetPoint takes values for points, so that the structs of the
+// inputs are never flattened by their shape.
+func pointCoordinates(v interface{}) ([]*big.Int, bool, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Type().Elem().Kind() == reflect.Struct {
+		if rv.IsNil() {
+			if isPointType(rv.Type().Elem()) {
+				return nil, true, fmt.Errorf("nil point %T", v)
+			}
+			return nil, false, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || !isPointType(rv.Type()) {
+		return nil, false, nil
+	}
+	x := rv.FieldByName("X").Interface().(*big.Int)
+	y := rv.FieldByName("Y").Interface().(*big.Int)
+	if x == nil || y == nil {
+		return nil, true, fmt.Errorf("point %T with nil coordinates", v)
+	}
+	return []*big.Int{x, y}, true, nil
+}
+
+// isPointType returns true if t is a struct with only the *big.Int fields X
+// and Y.
+func isPointType(t reflect.Type) bool {
+	if t.NumField() != 2 {
+		return false
+	}
+	for _, name := range []string{"X", "Y"} {
+		f, ok := t.FieldByName(name)
+		if !ok || f.Type != bigIntType {
+			return false
+		}
+	}
+	return true
+}
+
+// valuerBigInt returns the value of v, checking that it is not nil.
+func valuerBigInt(v BigIntValuer) (*big.Int, error) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil, fmt.Errorf("nil %T", v)
+	}
+	x := v.BigInt()
+	if x == nil {
+		return nil, fmt.Errorf("%T with nil value", v)
+	}
+	return x, nil
+}
@@ -0,0 +1,68 @@
+package witnesscalc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPoint has the layout of babyjub.Point and babyjub.PublicKey.
+type testPoint struct {
+	X *big.Int
+	Y *big.Int
+}
+
+// testHash has the BigInt method of merkletree.Hash.
+type testHash [4]byte
+
+func (h *testHash) BigInt() *big.Int {
+	return new(big.Int).SetBytes(h[:])
+}
+
+func TestIden3Types(t *testing.T) {
+	one := big.NewInt(1)
+	two := big.NewInt(2)
+	p := &testPoint{X: one, Y: two}
+	h := &testHash{0, 0, 1, 0}
+
+	fh, err := FlattenSignal(h)
+	require.Nil(t, err)
+	assert.Equal(t, []*big.Int{big.NewInt(256)}, fh)
+	fhs, err := FlattenSignal([]*testHash{h, h})
+	require.Nil(t, err)
+	assert.Len(t, fhs, 2)
+	_, err = FlattenSignal((*testHash)(nil))
+	require.Error(t, err)
+
+	// Only SetPoint takes structs for points.
+	_, err = FlattenSignal(p)
+	require.Error(t, err)
+	_, err = FlattenSignal(*p)
+	require.Error(t, err)
+
+	checked, err := CheckInputTypes(map[string]interface{}{"root": h})
+	require.Nil(t, err)
+	assert.Equal(t, big.NewInt(256), checked["root"])
+	_, err = CheckInputTypes(map[string]interface{}{"pk": p})
+	var typeErr *InputTypeError
+	require.ErrorAs(t, err, &typeErr)
+	assert.Equal(t, "inputs[pk]", typeErr.Path)
+
+	inputs, err := NewInputsBuilder().SetPoint("pk", p).SetValuer("root", h).Build()
+	require.Nil(t, err)
+	canonical, err := CanonicalizeInputs(inputs)
+	require.Nil(t, err)
+	assert.Equal(t, `{"pk":["1","2"],"root":"256"}`, string(canonical))
+	_, err = NewInputsBuilder().SetPoint("pk", one).Build()
+	assert.EqualError(t, err, "input pk: *big.Int is not a point")
+	_, err = NewInputsBuilder().SetPoint("pk", (*testPoint)(nil)).Build()
+	assert.EqualError(t, err, "input pk: nil point *witnesscalc.testPoint")
+	_, err = NewInputsBuilder().SetPoint("pk", &testPoint{X: one}).Build()
+	assert.EqualError(t, err, "input pk: point *witnesscalc.testPoint with nil coordinates")
+	_, err = NewInputsBuilder().SetPoint("pk", struct{ X, Y, Z *big.Int }{one, two, one}).Build()
+	assert.EqualError(t, err, "input pk: struct { X *big.Int; Y *big.Int; Z *big.Int } is not a point")
+	_, err = NewInputsBuilder().SetValuer("root", (*testHash)(nil)).Build()
+	assert.EqualError(t, err, "input root: nil *witnesscalc.testHash")
+}
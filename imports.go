@@ -0,0 +1,354 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+)
+
+// ImportMode is how the calculators handle the imports of a WitnessCalc WASM
+// module that they don't provide, e.g. the ones added by new circom versions.
+type ImportMode int
+
+const (
+	// ImportsStrict fails the load with an error listing all the missing
+	// imports.
+	ImportsStrict ImportMode = iota
+	// ImportsPermissive provides no-op functions, returning zeros, for the
+	// missing function imports of the "runtime" and "env" modules, logging a
+	// warning for each of them.  Other missing imports fail the load.
+	ImportsPermissive
+)
+
+// WASM binary format constants.
+const (
+	wasmMagic          = "\x00asm"
+	wasmSectionType    = 1
+	wasmSectionImport  = 2
+	wasmSectionExport  = 7
+	wasmFuncType       = 0x60
+	wasmExternFunction = 0x00
+	wasmExternTable    = 0x01
+	wasmExternMemory   = 0x02
+	wasmExternGlobal   = 0x03
+	wasmValueI32       = 0x7f
+	wasmValueI64       = 0x7e
+	wasmValueF32       = 0x7d
+	wasmValueF64       = 0x7c
+)
+
+// wasmPageSize is the size in bytes of a WASM memory page.
+const wasmPageSize = 64 * 1024
+
+// wasmImport is an entry of the import section of a WASM module.
+type wasmImport struct {
+	Module string
+	Name   string
+	Kind   byte
+	// Params and Results are the value types of function imports.
+	Params  []byte
+	Results []byte
+}
+
+// String returns the "module.name" of the import.
+func (i wasmImport) String() string {
+	return i.Module + "." + i.Name
+}
+
+// wasmReader reads the values of the WASM binary format.
+type wasmReader struct {
+	r *bytes.Reader
+}
+
+func (r wasmReader) byte() (byte, error) {
+	return r.r.ReadByte()
+}
+
+func (r wasmReader) u32() (uint32, error) {
+	v, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return 0, err
+	}
+	if v > 0xffffffff {
+		return 0, errors.New("invalid u32")
+	}
+	return uint32(v), nil
+}
+
+// bytes reads a vector of bytes, e.g. a name or a list of value types.
+func (r wasmReader) bytes() ([]byte, error) {
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	if int(n) > r.r.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r.r, b)
+	return b, err
+}
+
+// limits skips the limits of a table or a memory.
+func (r wasmReader) limits() error {
+	flags, err := r.byte()
+	if err != nil {
+		return err
+	}
+	if _, err := r.u32(); err != nil {
+		return err
+	}
+	if flags&1 != 0 {
+		_, err = r.u32()
+	}
+	return err
+}
+
+// wasmSections calls f with the id and the content of every section of the
+// WASM module wasmBytes, in order.
+func wasmSections(wasmBytes []byte, f func(id byte, section []byte) error) error {
+	if len(wasmBytes) < 8 || string(wasmBytes[:4]) != wasmMagic {
+		return errors.New("invalid WASM module")
+	}
+	r := wasmReader{bytes.NewReader(wasmBytes[8:])}
+	for {
+		id, err := r.byte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		section, err := r.bytes()
+		if err != nil {
+			return fmt.Errorf("WASM section %d: %w", id, err)
+		}
+		if err := f(id, section); err != nil {
+			return err
+		}
+	}
+}
+
+// parseWASMImports returns the imports of the WASM module wasmBytes.
+func parseWASMImports(wasmBytes []byte) ([]wasmImport, error) {
+	var types [][2][]byte
+	var imports []wasmImport
+	err := wasmSections(wasmBytes, func(id byte, section []byte) error {
+		var err error
+		switch id {
+		case wasmSectionType:
+			if types, err = parseWASMTypes(section); err != nil {
+				return fmt.Errorf("WASM type section: %w", err)
+			}
+		case wasmSectionImport:
+			if imports, err = parseWASMImportSection(section, types); err != nil {
+				return fmt.Errorf("WASM import section: %w", err)
+			}
+		}
+		return nil
+	})
+	return imports, err
+}
+
+// wasmExport is an entry of the export section of a WASM module.
+type wasmExport struct {
+	Name  string
+	Kind  byte
+	Index uint32
+}
+
+// parseWASMExports returns the exports of the WASM module wasmBytes.
+func parseWASMExports(wasmBytes []byte) ([]wasmExport, error) {
+	var exports []wasmExport
+	err := wasmSections(wasmBytes, func(id byte, section []byte) error {
+		if id != wasmSectionExport {
+			return nil
+		}
+		r := wasmReader{bytes.NewReader(section)}
+		n, err := r.u32()
+		if err != nil {
+			return fmt.Errorf("WASM export section: %w", err)
+		}
+		for i := uint32(0); i < n; i++ {
+			name, err := r.bytes()
+			if err != nil {
+				return fmt.Errorf("WASM export section: %w", err)
+			}
+			exp := wasmExport{Name: string(name)}
+			if exp.Kind, err = r.byte(); err != nil {
+				return fmt.Errorf("WASM export section: %w", err)
+			}
+			if exp.Index, err = r.u32(); err != nil {
+				return fmt.Errorf("WASM export section: %w", err)
+			}
+			exports = append(exports, exp)
+		}
+		return nil
+	})
+	return exports, err
+}
+
+// parseWASMTypes parses the function types, (params, results), of the type
+// section.
+func parseWASMTypes(section []byte) ([][2][]byte, error) {
+	r := wasmReader{bytes.NewReader(section)}
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	var types [][2][]byte
+	for i := uint32(0); i < n; i++ {
+		form, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if form != wasmFuncType {
+			return nil, fmt.Errorf("invalid function type 0x%x", form)
+		}
+		params, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		results, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, [2][]byte{params, results})
+	}
+	return types, nil
+}
+
+// parseWASMImportSection parses the entries of the import section.
+func parseWASMImportSection(section []byte, types [][2][]byte) ([]wasmImport, error) {
+	r := wasmReader{bytes.NewReader(section)}
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	imports := make([]wasmImport, 0, n)
+	for i := uint32(0); i < n; i++ {
+		module, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		name, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		imp := wasmImport{Module: string(module), Name: string(name)}
+		if imp.Kind, err = r.byte(); err != nil {
+			return nil, err
+		}
+		switch imp.Kind {
+		case wasmExternFunction:
+			idx, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if int(idx) >= len(types) {
+				return nil, fmt.Errorf("import %v: invalid type index %d", imp, idx)
+			}
+			imp.Params, imp.Results = types[idx][0], types[idx][1]
+		case wasmExternTable:
+			if _, err := r.byte(); err != nil {
+				return nil, err
+			}
+			err = r.limits()
+		case wasmExternMemory:
+			err = r.limits()
+		case wasmExternGlobal:
+			// value type and mutability
+			if _, err = r.byte(); err == nil {
+				_, err = r.byte()
+			}
+		default:
+			err = fmt.Errorf("import %v: invalid kind 0x%x", imp, imp.Kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, imp)
+	}
+	return imports, nil
+}
+
+// missingImports returns the imports of the module that are not provided,
+// provided being a set of "module.name".
+func missingImports(imports []wasmImport, provided map[string]bool) []wasmImport {
+	var missing []wasmImport
+	for _, imp := range imports {
+		if !provided[imp.String()] {
+			missing = append(missing, imp)
+		}
+	}
+	return missing
+}
+
+// debugImports are the logging and debugging imports of the circom 1 and 2
+// modules, stubbed with WithReleaseMode.
+var debugImports = map[string]bool{
+	"runtime.logSetSignal":       true,
+	"runtime.logGetSignal":       true,
+	"runtime.logFinishComponent": true,
+	"runtime.logStartComponent":  true,
+	"runtime.log":                true,
+	"runtime.showSharedRWMemory": true,
+	"runtime.printErrorMessage":  true,
+	"runtime.writeBufferMessage": true,
+}
+
+// releaseImports returns the function imports of the module wasmBytes in
+// debugImports, which WithReleaseMode stubs instead of attaching the
+// functions of the calculators, and provided with them, for stubImports.
+func releaseImports(wasmBytes []byte, provided map[string]bool) ([]wasmImport, map[string]bool, error) {
+	imports, err := parseWASMImports(wasmBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	all := make(map[string]bool, len(provided)+len(debugImports))
+	for name := range provided {
+		all[name] = true
+	}
+	var release []wasmImport
+	for _, imp := range imports {
+		if imp.Kind == wasmExternFunction && debugImports[imp.String()] {
+			release = append(release, imp)
+			all[imp.String()] = true
+		}
+	}
+	return release, all, nil
+}
+
+// stubImports returns the imports of the module wasmBytes that are not
+// provided and must be stubbed according to mode, or an error listing the
+// missing imports that can't be stubbed.  provided is a set of "module.name".
+func stubImports(wasmBytes []byte, provided map[string]bool, mode ImportMode) ([]wasmImport, error) {
+	imports, err := parseWASMImports(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	var stubs []wasmImport
+	var unresolved []string
+	for _, imp := range missingImports(imports, provided) {
+		if isAbortImport(imp) {
+			// Provided by the calculators, which return an AbortError.
+			continue
+		}
+		if mode == ImportsPermissive && imp.Kind == wasmExternFunction &&
+			(imp.Module == "runtime" || imp.Module == "env") {
+			log.Warn("Stubbing missing WASM import", "import", imp.String())
+			stubs = append(stubs, imp)
+		} else {
+			unresolved = append(unresolved, imp.String())
+		}
+	}
+	if len(unresolved) > 0 {
+		return nil, fmt.Errorf("missing WASM imports: %s", strings.Join(unresolved, ", "))
+	}
+	return stubs, nil
+}
@@ -0,0 +1,98 @@
+package witnesscalc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wasmSection encodes a small section of a WASM module.
+func wasmSection(id byte, content ...byte) []byte {
+	return append([]byte{id, byte(len(content))}, content...)
+}
+
+// wasmName encodes a short name.
+func wasmName(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+// newImportsModule returns a WASM module importing the runtime.newThing
+// function, and the other.memory memory if withMemory, and exporting
+// f(x) = newThing(x).
+func newImportsModule(withMemory bool) []byte {
+	return newRuntimeImportModule("newThing", withMemory)
+}
+
+// newRuntimeImportModule is newImportsModule importing the runtime.name
+// function instead.
+func newRuntimeImportModule(name string, withMemory bool) []byte {
+	imports := []byte{1}
+	imports = append(imports, wasmName("runtime")...)
+	imports = append(imports, wasmName(name)...)
+	imports = append(imports, wasmExternFunction, 0)
+	if withMemory {
+		imports[0]++
+		imports = append(imports, wasmName("other")...)
+		imports = append(imports, wasmName("memory")...)
+		imports = append(imports, wasmExternMemory, 0, 1)
+	}
+	m := []byte(wasmMagic + "\x01\x00\x00\x00")
+	// (i32) -> i32
+	m = append(m, wasmSection(wasmSectionType, 1, wasmFuncType, 1, wasmValueI32, 1, wasmValueI32)...)
+	m = append(m, wasmSection(wasmSectionImport, imports...)...)
+	m = append(m, wasmSection(3, 1, 0)...)
+	m = append(m, wasmSection(7, 1, 1, 'f', wasmExternFunction, 1)...)
+	// local.get 0, call 0
+	m = append(m, wasmSection(10, 1, 6, 0, 0x20, 0, 0x10, 0, 0x0b)...)
+	return m
+}
+
+func TestParseWASMImports(t *testing.T) {
+	module := newImportsModule(true)
+	imports, err := parseWASMImports(module)
+	require.NoError(t, err)
+	assert.Equal(t, []wasmImport{
+		{Module: "runtime", Name: "newThing", Kind: wasmExternFunction,
+			Params: []byte{wasmValueI32}, Results: []byte{wasmValueI32}},
+		{Module: "other", Name: "memory", Kind: wasmExternMemory},
+	}, imports)
+
+	_, err = parseWASMImports([]byte("invalid"))
+	require.Error(t, err)
+	_, err = parseWASMImports(module[:30])
+	require.Error(t, err)
+}
+
+func TestStubImports(t *testing.T) {
+	module := newImportsModule(true)
+	provided := map[string]bool{"runtime.log": true}
+	_, err := stubImports(module, provided, ImportsStrict)
+	require.EqualError(t, err, "missing WASM imports: runtime.newThing, other.memory")
+	_, err = stubImports(module, provided, ImportsPermissive)
+	require.EqualError(t, err, "missing WASM imports: other.memory")
+
+	provided["other.memory"] = true
+	stubs, err := stubImports(module, provided, ImportsPermissive)
+	require.NoError(t, err)
+	require.Len(t, stubs, 1)
+	assert.Equal(t, "runtime.newThing", stubs[0].String())
+}
+
+func TestReleaseImports(t *testing.T) {
+	module := newRuntimeImportModule("printErrorMessage", true)
+	provided := map[string]bool{"runtime.log": true}
+	release, all, err := releaseImports(module, provided)
+	require.NoError(t, err)
+	require.Len(t, release, 1)
+	assert.Equal(t, "runtime.printErrorMessage", release[0].String())
+	assert.Equal(t, map[string]bool{"runtime.log": true, "runtime.printErrorMessage": true}, all)
+	assert.Len(t, provided, 1)
+
+	_, err = stubImports(module, all, ImportsStrict)
+	require.EqualError(t, err, "missing WASM imports: other.memory")
+
+	release, _, err = releaseImports(newImportsModule(false), provided)
+	require.NoError(t, err)
+	assert.Empty(t, release)
+}
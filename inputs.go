@@ -0,0 +1,168 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// InputsBuilder builds the inputs map taken by the witness calculators with
+// typed setters.  Values are validated when set; the first error is returned
+// by Build.
+type InputsBuilder struct {
+	inputs map[string]interface{}
+	err    error
+}
+
+// NewInputsBuilder creates an empty InputsBuilder.
+func NewInputsBuilder() *InputsBuilder {
+	return &InputsBuilder{inputs: make(map[string]interface{})}
+}
+
+// set stores the input value, recording an error if the name is empty or
+// already set.
+func (b *InputsBuilder) set(name string, v interface{}) *InputsBuilder {
+	if b.err != nil {
+		return b
+	}
+	if name == "" {
+		b.err = fmt.Errorf("empty input name")
+		return b
+	}
+	if _, ok := b.inputs[name]; ok {
+		b.err = fmt.Errorf("input %s already set", name)
+		return b
+	}
+	b.inputs[name] = v
+	return b
+}
+
+// fail records the error of the input name.
+func (b *InputsBuilder) fail(name string, err error) *InputsBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("input %s: %w", name, err)
+	}
+	return b
+}
+
+// copyBigs copies the values, checking that none of them is nil.
+func copyBigs(vs []*big.Int) ([]*big.Int, error) {
+	res := make([]*big.Int, len(vs))
+	for i, v := range vs {
+		if v == nil {
+			return nil, fmt.Errorf("nil value at index %d", i)
+		}
+		res[i] = new(big.Int).Set(v)
+	}
+	return res, nil
+}
+
+// SetInt sets a single value input.
+func (b *InputsBuilder) SetInt(name string, v int64) *InputsBuilder {
+	return b.set(name, big.NewInt(v))
+}
+
+// SetBig sets a single value input.
+func (b *InputsBuilder) SetBig(name string, v *big.Int) *InputsBuilder {
+	if v == nil {
+		return b.fail(name, fmt.Errorf("nil value"))
+	}
+	return b.set(name, new(big.Int).Set(v))
+}
+
+// SetArray sets a one dimensional signal array input.
+func (b *InputsBuilder) SetArray(name string, vs []*big.Int) *InputsBuilder {
+	if len(vs) == 0 {
+		return b.fail(name, fmt.Errorf("empty array"))
+	}
+	values, err := copyBigs(vs)
+	if err != nil {
+		return b.fail(name, err)
+	}
+	return b.set(name, values)
+}
+
+// SetMatrix sets a two dimensional signal array input.  All the rows must have
+// the same length.
+func (b *InputsBuilder) SetMatrix(name string, m [][]*big.Int) *InputsBuilder {
+	if len(m) == 0 || len(m[0]) == 0 {
+		return b.fail(name, fmt.Errorf("empty matrix"))
+	}
+	rows := make([][]*big.Int, len(m))
+	for i, row := range m {
+		if len(row) != len(m[0]) {
+			return b.fail(name, fmt.Errorf("row %d has %d values, expected %d",
+				i, len(row), len(m[0])))
+		}
+		var err error
+		if rows[i], err = copyBigs(row); err != nil {
+			return b.fail(name, fmt.Errorf("row %d: %w", i, err))
+		}
+	}
+	return b.set(name, rows)
+}
+
+// SetBytesLE sets a single value input from its little-endian encoding.
+func (b *InputsBuilder) SetBytesLE(name string, bs []byte) *InputsBuilder {
+	if len(bs) == 0 {
+		return b.fail(name, fmt.Errorf("empty bytes"))
+	}
+	return b.set(name, new(big.Int).SetBytes(swap(bs)))
+}
+
+// SetFixedPoint sets a single value input to the FixedPoint encoding of value
+// with bits fractional bits.  Negative values are encoded as field elements,
+// modulo prime, and are rejected if prime is nil.
+func (b *InputsBuilder) SetFixedPoint(name string, value float64, bits uint, prime *big.Int) *InputsBuilder {
+	v := FixedPoint(value, bits)
+	if v == nil {
+		return b.fail(name, fmt.Errorf("%v can't be encoded with %d fractional bits", value, bits))
+	}
+	if v.Sign() < 0 {
+		if prime == nil {
+			return b.fail(name, fmt.Errorf("negative value %v requires the prime", value))
+		}
+		v.Mod(v, prime)
+	}
+	return b.set(name, v)
+}
+
+// SetValuer sets a single value input to the value of v, e.g. a merkle tree
+// hash.
+func (b *InputsBuilder) SetValuer(name string, v BigIntValuer) *InputsBuilder {
+	x, err := valuerBigInt(v)
+	if err != nil {
+		return b.fail(name, err)
+	}
+	return b.set(name, new(big.Int).Set(x))
+}
+
+// SetPoint sets a two element signal array input to the coordinates [X, Y]
+// of the point p, a struct or a pointer to a struct with only the *big.Int
+// fields X and Y, like a babyjub.Point or a babyjub.PublicKey.
+func (b *InputsBuilder) SetPoint(name string, p interface{}) *InputsBuilder {
+	coords, ok, err := pointCoordinates(p)
+	if err != nil {
+		return b.fail(name, err)
+	}
+	if !ok {
+		return b.fail(name, fmt.Errorf("%T is not a point", p))
+	}
+	values, err := copyBigs(coords)
+	if err != nil {
+		return b.fail(name, err)
+	}
+	return b.set(name, values)
+}
+
+// Build returns the inputs map, or the first error found while setting the
+// inputs.
+func (b *InputsBuilder) Build() (map[string]interface{}, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	inputs := make(map[string]interface{}, len(b.inputs))
+	for name, v := range b.inputs {
+		inputs[name] = v
+	}
+	return inputs, nil
+}
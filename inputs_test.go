@@ -0,0 +1,36 @@
+package witnesscalc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputsBuilder(t *testing.T) {
+	inputs, err := NewInputsBuilder().
+		SetInt("a", 3).
+		SetBig("b", big.NewInt(11)).
+		SetArray("c", []*big.Int{big.NewInt(1), big.NewInt(2)}).
+		SetMatrix("d", [][]*big.Int{{big.NewInt(1), big.NewInt(2)}, {big.NewInt(3), big.NewInt(4)}}).
+		SetBytesLE("e", []byte{0x01, 0x02}).
+		Build()
+	require.Nil(t, err)
+	canonical, err := CanonicalizeInputs(inputs)
+	require.Nil(t, err)
+	assert.Equal(t, `{"a":"3","b":"11","c":["1","2"],"d":[["1","2"],["3","4"]],"e":"513"}`,
+		string(canonical))
+	d, err := FlattenSignal(inputs["d"])
+	require.Nil(t, err)
+	assert.Len(t, d, 4)
+
+	_, err = NewInputsBuilder().SetInt("a", 1).SetInt("a", 2).Build()
+	assert.EqualError(t, err, "input a already set")
+	_, err = NewInputsBuilder().SetBig("a", nil).SetInt("b", 2).Build()
+	assert.EqualError(t, err, "input a: nil value")
+	_, err = NewInputsBuilder().SetArray("a", []*big.Int{big.NewInt(1), nil}).Build()
+	assert.EqualError(t, err, "input a: nil value at index 1")
+	_, err = NewInputsBuilder().SetMatrix("a", [][]*big.Int{{big.NewInt(1)}, {}}).Build()
+	assert.EqualError(t, err, "input a: row 1 has 0 values, expected 1")
+}
@@ -0,0 +1,178 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Inputs are witness calculation inputs that keep the shape of the JSON
+// document they were parsed from: the order of the signals and whether each
+// value was a string or a number.  MarshalJSON reproduces the document, with
+// the values as canonical base-10 integers, so that audit logs and input
+// hashes can be computed from the re-encoded inputs.  File references are
+// not supported.
+type Inputs struct {
+	names  []string
+	values map[string]*inputValue
+}
+
+// inputValue is a value of Inputs: a number, or an array of values if elems
+// is not nil.
+type inputValue struct {
+	num      *big.Int
+	isString bool
+	elems    []*inputValue
+}
+
+// Names returns the names of the signals in document order.
+func (in *Inputs) Names() []string {
+	return append([]string(nil), in.names...)
+}
+
+// Map returns the inputs in the format of ParseInputs, taken by the
+// calculators: *big.Int values and []interface{} arrays.
+func (in *Inputs) Map() map[string]interface{} {
+	inputs := make(map[string]interface{}, len(in.names))
+	for _, name := range in.names {
+		inputs[name] = in.values[name].toInput()
+	}
+	return inputs
+}
+
+// toInput converts the value to the format of ParseInputs.
+func (v *inputValue) toInput() interface{} {
+	if v.elems == nil {
+		return new(big.Int).Set(v.num)
+	}
+	res := make([]interface{}, len(v.elems))
+	for i, elem := range v.elems {
+		res[i] = elem.toInput()
+	}
+	return res
+}
+
+// UnmarshalJSON parses a JSON object of inputs, with the values accepted by
+// ParseInputs.
+func (in *Inputs) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("inputs must be a JSON object")
+	}
+	names := []string{}
+	values := make(map[string]*inputValue)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name := tok.(string)
+		if _, ok := values[name]; ok {
+			return fmt.Errorf("duplicated input %s", name)
+		}
+		v, err := decodeInputValue(dec)
+		if err != nil {
+			return fmt.Errorf("input %s: %w", name, err)
+		}
+		names = append(names, name)
+		values[name] = v
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after the inputs")
+	}
+	in.names = names
+	in.values = values
+	return nil
+}
+
+// decodeInputValue decodes the next value of dec.
+func decodeInputValue(dec *json.Decoder) (*inputValue, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case string:
+		n, err := parseInputString(t)
+		if err != nil {
+			return nil, err
+		}
+		return &inputValue{num: n, isString: true}, nil
+	case json.Number:
+		n, err := parseInputString(t.String())
+		if err != nil {
+			return nil, err
+		}
+		return &inputValue{num: n}, nil
+	case json.Delim:
+		if t != '[' {
+			return nil, fmt.Errorf("unexpected %v", t)
+		}
+		elems := []*inputValue{}
+		for dec.More() {
+			elem, err := decodeInputValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return &inputValue{elems: elems}, nil
+	default:
+		return nil, fmt.Errorf("unexpected value %v", t)
+	}
+}
+
+// MarshalJSON encodes the inputs in document order.
+func (in *Inputs) MarshalJSON() ([]byte, error) {
+	var buff bytes.Buffer
+	buff.WriteByte('{')
+	for i, name := range in.names {
+		if i > 0 {
+			buff.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buff.Write(key)
+		buff.WriteByte(':')
+		in.values[name].writeJSON(&buff)
+	}
+	buff.WriteByte('}')
+	return buff.Bytes(), nil
+}
+
+// writeJSON writes the value to buff.
+func (v *inputValue) writeJSON(buff *bytes.Buffer) {
+	if v.elems == nil {
+		if v.isString {
+			buff.WriteByte('"')
+		}
+		buff.WriteString(v.num.String())
+		if v.isString {
+			buff.WriteByte('"')
+		}
+		return
+	}
+	buff.WriteByte('[')
+	for i, elem := range v.elems {
+		if i > 0 {
+			buff.WriteByte(',')
+		}
+		elem.writeJSON(buff)
+	}
+	buff.WriteByte(']')
+}
@@ -0,0 +1,62 @@
+package witnesscalc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputsRoundTrip(t *testing.T) {
+	doc := `{"z":"12345678901234567890123456789","a":[[1,"2"],[3,"-4"]],"m":7,"e":[]}`
+	var in Inputs
+	require.Nil(t, json.Unmarshal([]byte(doc), &in))
+	assert.Equal(t, []string{"z", "a", "m", "e"}, in.Names())
+	b, err := json.Marshal(&in)
+	require.Nil(t, err)
+	assert.Equal(t, doc, string(b))
+
+	expected, err := ParseInputs([]byte(doc))
+	require.Nil(t, err)
+	assert.Equal(t, expected, in.Map())
+
+	// Values are re-encoded in base 10, and the whitespace is dropped.
+	require.Nil(t, json.Unmarshal([]byte("{\n  \"a\": \"0x1f\",\n  \"b\": 1e3\n}"), &in))
+	b, err = json.Marshal(&in)
+	require.Nil(t, err)
+	assert.Equal(t, `{"a":"31","b":1000}`, string(b))
+
+	inputsJSON, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.Nil(t, err)
+	require.Nil(t, json.Unmarshal(inputsJSON, &in))
+	b, err = json.Marshal(&in)
+	require.Nil(t, err)
+	var expectedJSON, gotJSON interface{}
+	require.Nil(t, json.Unmarshal(inputsJSON, &expectedJSON))
+	require.Nil(t, json.Unmarshal(b, &gotJSON))
+	assert.Equal(t, expectedJSON, gotJSON)
+
+	for _, doc := range []string{
+		`[]`,
+		`{"a":1,"a":2}`,
+		`{"a":1.5}`,
+		`{"a":{"$file":"a.json"}}`,
+		`{"a":true}`,
+		`{"a":"x"}`,
+		`{"a":1} {}`,
+		`{"a":[1`,
+	} {
+		assert.Error(t, json.Unmarshal([]byte(doc), &in), doc)
+	}
+}
+
+func TestInputsBig(t *testing.T) {
+	var in Inputs
+	require.Nil(t, json.Unmarshal([]byte(`{"a":21888242871839275222246405745257275088548364400416034343698204186575808495616}`), &in))
+	v, ok := new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495616", 10)
+	require.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"a": v}, in.Map())
+}
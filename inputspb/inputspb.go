@@ -0,0 +1,187 @@
+// Package inputspb is a custom codec of the protobuf wire encoding of the
+// witness calculation inputs described by inputs.proto: it decodes the bytes
+// of the messages into the inputs of the calculators, so that gRPC services
+// don't need to exchange JSON.
+//
+// The messages are encoded and decoded without a protobuf runtime dependency,
+// so the types of the package are not generated and are not proto.Message:
+// gRPC services receive the message bytes, e.g. with a bytes codec or a
+// message of their own embedding them, and clients generate their types from
+// inputs.proto in their own packages.
+package inputspb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Inputs are the input signals of a witness calculation.
+type Inputs struct {
+	Signals []*SignalAssignment
+}
+
+// SignalAssignment assigns the values of an input signal.
+type SignalAssignment struct {
+	// Name is the name of the signal without the "main." prefix.
+	Name string
+	// Values are the field elements of the signal, flattened in row-major
+	// order for arrays, as unsigned big-endian integers.
+	Values [][]byte
+}
+
+// protobuf wire types
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireLen    = 2
+	wireI32    = 5
+)
+
+// NewSignalAssignment returns the assignment of the values to the signal
+// name.  The values must be non-negative.
+func NewSignalAssignment(name string, values ...*big.Int) (*SignalAssignment, error) {
+	s := &SignalAssignment{Name: name, Values: make([][]byte, len(values))}
+	for i, v := range values {
+		if v.Sign() < 0 {
+			return nil, fmt.Errorf("%s[%d] = %v is negative", name, i, v)
+		}
+		s.Values[i] = v.Bytes()
+	}
+	return s, nil
+}
+
+// ToInputs converts the protobuf inputs into the inputs of the calculators:
+// a *big.Int for the signals with one value and a []*big.Int for the others.
+func ToInputs(in *Inputs) (map[string]interface{}, error) {
+	inputs := make(map[string]interface{}, len(in.Signals))
+	for _, s := range in.Signals {
+		if s.Name == "" {
+			return nil, errors.New("signal without name")
+		}
+		if _, ok := inputs[s.Name]; ok {
+			return nil, fmt.Errorf("duplicated signal %s", s.Name)
+		}
+		if len(s.Values) == 0 {
+			return nil, fmt.Errorf("signal %s has no values", s.Name)
+		}
+		values := make([]*big.Int, len(s.Values))
+		for i, v := range s.Values {
+			values[i] = new(big.Int).SetBytes(v)
+		}
+		if len(values) == 1 {
+			inputs[s.Name] = values[0]
+		} else {
+			inputs[s.Name] = values
+		}
+	}
+	return inputs, nil
+}
+
+// Marshal encodes the inputs in the protobuf wire format.
+func (in *Inputs) Marshal() []byte {
+	var b []byte
+	for _, s := range in.Signals {
+		var sb []byte
+		if s.Name != "" {
+			sb = appendBytes(sb, 1, []byte(s.Name))
+		}
+		for _, v := range s.Values {
+			sb = appendBytes(sb, 2, v)
+		}
+		b = appendBytes(b, 1, sb)
+	}
+	return b
+}
+
+// Unmarshal decodes inputs encoded in the protobuf wire format, skipping
+// unknown fields.
+func Unmarshal(b []byte) (*Inputs, error) {
+	var in Inputs
+	err := parseFields(b, func(field uint64, value []byte) error {
+		if field != 1 {
+			return nil
+		}
+		var s SignalAssignment
+		err := parseFields(value, func(field uint64, value []byte) error {
+			switch field {
+			case 1:
+				s.Name = string(value)
+			case 2:
+				s.Values = append(s.Values, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("signal %d: %w", len(in.Signals), err)
+		}
+		in.Signals = append(in.Signals, &s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &in, nil
+}
+
+// appendBytes appends the length-delimited field to b.
+func appendBytes(b []byte, field uint64, value []byte) []byte {
+	b = appendUvarint(b, field<<3|wireLen)
+	b = appendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// appendUvarint appends the varint encoding of v to b.
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// parseFields calls f with the length-delimited fields of the message b, and
+// skips the fields of the other wire types.
+func parseFields(b []byte, f func(field uint64, value []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		b = b[n:]
+		field, wireType := key>>3, key&7
+		if field == 0 {
+			return errors.New("invalid field number 0")
+		}
+		switch wireType {
+		case wireVarint:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return fmt.Errorf("field %d: invalid varint", field)
+			}
+			b = b[n:]
+		case wireI64, wireI32:
+			size := 8
+			if wireType == wireI32 {
+				size = 4
+			}
+			if len(b) < size {
+				return fmt.Errorf("field %d: unexpected end of message", field)
+			}
+			b = b[size:]
+		case wireLen:
+			size, n := binary.Uvarint(b)
+			if n <= 0 {
+				return fmt.Errorf("field %d: invalid length", field)
+			}
+			b = b[n:]
+			if size > uint64(len(b)) {
+				return fmt.Errorf("field %d: unexpected end of message", field)
+			}
+			if err := f(field, b[:size:size]); err != nil {
+				return err
+			}
+			b = b[size:]
+		default:
+			return fmt.Errorf("field %d: unsupported wire type %d", field, wireType)
+		}
+	}
+	return nil
+}
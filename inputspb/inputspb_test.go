@@ -0,0 +1,69 @@
+package inputspb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputsRoundTrip(t *testing.T) {
+	a, err := NewSignalAssignment("a", big.NewInt(3))
+	require.NoError(t, err)
+	in, err := NewSignalAssignment("in", big.NewInt(0), big.NewInt(0x0102), big.NewInt(11))
+	require.NoError(t, err)
+	msg := &Inputs{Signals: []*SignalAssignment{a, in}}
+
+	b := msg.Marshal()
+	// signals {name: "a", values: "\x03"}
+	assert.Equal(t, []byte{0x0a, 6, 0x0a, 1, 'a', 0x12, 1, 3}, b[:8])
+	decoded, err := Unmarshal(b)
+	require.NoError(t, err)
+	assert.Equal(t, msg.Signals[0], decoded.Signals[0])
+	assert.Equal(t, "in", decoded.Signals[1].Name)
+
+	inputs, err := ToInputs(decoded)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a":  big.NewInt(3),
+		"in": []*big.Int{new(big.Int), big.NewInt(0x0102), big.NewInt(11)},
+	}, inputs)
+
+	_, err = NewSignalAssignment("a", big.NewInt(-1))
+	require.EqualError(t, err, "a[0] = -1 is negative")
+}
+
+func TestUnmarshalUnknownFields(t *testing.T) {
+	// field 3 varint, field 4 fixed64, then signals {name: "b", field 5 fixed32, values: "\x07"}
+	b := []byte{0x18, 0x96, 0x01, 0x21, 1, 2, 3, 4, 5, 6, 7, 8,
+		0x0a, 11, 0x0a, 1, 'b', 0x2d, 1, 2, 3, 4, 0x12, 1, 7}
+	in, err := Unmarshal(b)
+	require.NoError(t, err)
+	inputs, err := ToInputs(in)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"b": big.NewInt(7)}, inputs)
+
+	for _, b := range [][]byte{
+		{0x0a, 5, 0x0a}, // truncated signal
+		{0x0a, 2, 0x0a}, // truncated name
+		{0x00},          // field 0
+		{0x0b},          // start group
+		{0x21, 1, 2},    // truncated fixed64
+		{0x18, 0x80},    // truncated varint
+	} {
+		_, err := Unmarshal(b)
+		require.Error(t, err, b)
+	}
+}
+
+func TestToInputsErrors(t *testing.T) {
+	for _, in := range []*Inputs{
+		{Signals: []*SignalAssignment{{Values: [][]byte{{1}}}}},
+		{Signals: []*SignalAssignment{{Name: "a"}}},
+		{Signals: []*SignalAssignment{{Name: "a", Values: [][]byte{{1}}}, {Name: "a", Values: [][]byte{{2}}}}},
+	} {
+		_, err := ToInputs(in)
+		require.Error(t, err)
+	}
+}
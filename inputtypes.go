@@ -0,0 +1,119 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// InputTypeError is the error of CheckInputTypes for a value of an
+// unsupported type.
+type InputTypeError struct {
+	// Path locates the value, e.g. "inputs[b][2]".
+	Path string
+	// Type is the type of the value, "nil" for nil values.
+	Type string
+}
+
+// Error returns the path and the type of the value.
+func (e *InputTypeError) Error() string {
+	return fmt.Sprintf("%s: unsupported type %s", e.Path, e.Type)
+}
+
+// CheckInputTypes checks that the values of the inputs are only *big.Int,
+// Go integers, decimal strings, byte arrays, SignalValues, NDArrays,
+// BigIntValuers and nested slices or arrays of them, returning an
+// InputTypeError with the path of the first value of another type
+// otherwise, e.g. a float64, a non-decimal string or a negative Go integer.
+// The Go integers, the decimal strings and the byte arrays are converted to
+// *big.Int in the returned inputs, which share the other values with inputs.
+// It is applied to the inputs of every calculation with WithStrictInputs.
+func CheckInputTypes(inputs map[string]interface{}) (map[string]interface{}, error) {
+	// Sorted, for the error to report the same path on every call.
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checked := make(map[string]interface{}, len(inputs))
+	for _, name := range names {
+		v, err := checkInputType(fmt.Sprintf("inputs[%s]", name), inputs[name])
+		if err != nil {
+			return nil, err
+		}
+		checked[name] = v
+	}
+	return checked, nil
+}
+
+// checkInputType checks the type of the value v at path, returning it with
+// the Go values converted to *big.Int.
+func checkInputType(path string, v interface{}) (interface{}, error) {
+	switch a := v.(type) {
+	case nil:
+		return nil, &InputTypeError{Path: path, Type: "nil"}
+	case *big.Int:
+		if a == nil {
+			return nil, &InputTypeError{Path: path, Type: "nil *big.Int"}
+		}
+		return a, nil
+	case BigInt:
+		if a.Int == nil {
+			return nil, &InputTypeError{Path: path, Type: "nil *big.Int"}
+		}
+		return a, nil
+	case *NDArray:
+		if a == nil {
+			return nil, &InputTypeError{Path: path, Type: "nil *NDArray"}
+		}
+		return a, nil
+	case NDArray, SignalValue:
+		return a, nil
+	case BigIntValuer:
+		x, err := valuerBigInt(a)
+		if err != nil {
+			return nil, &InputTypeError{Path: path, Type: err.Error()}
+		}
+		return x, nil
+	}
+	if x, ok, err := goInputValue(v); err != nil {
+		return nil, &InputTypeError{Path: path, Type: err.Error()}
+	} else if ok {
+		return x, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		values := make([]interface{}, rv.Len())
+		for i := range values {
+			var err error
+			values[i], err = checkInputType(fmt.Sprintf("%s[%d]", path, i), rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, &InputTypeError{Path: path, Type: fmt.Sprintf("%T", v)}
+}
+
+// normalizeInputs coerces the inputs to the field of prime with
+// WithInputSchema, checks their types with WithStrictInputs and normalizes
+// their names, see NormalizeInputs.
+func (o options) normalizeInputs(inputs map[string]interface{}, prime *big.Int) (map[string]interface{}, error) {
+	var err error
+	if o.inputSchema != nil {
+		inputs, err = o.inputSchema.Coerce(inputs, prime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.strictInputs {
+		inputs, err = CheckInputTypes(inputs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NormalizeInputs(inputs, o.symbols)
+}
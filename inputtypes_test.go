@@ -0,0 +1,51 @@
+package witnesscalc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckInputTypes(t *testing.T) {
+	checked, err := CheckInputTypes(map[string]interface{}{
+		"a": big.NewInt(3),
+		"b": []interface{}{1, uint8(2), [2]int64{3, 4}},
+		"c": []*big.Int{big.NewInt(5)},
+		"d": Uint64(6),
+		"e": HexString("0x7"),
+		"f": []interface{}{"8", [2]byte{0, 9}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": big.NewInt(3),
+		"b": []interface{}{big.NewInt(1), big.NewInt(2), []interface{}{big.NewInt(3), big.NewInt(4)}},
+		"c": []interface{}{big.NewInt(5)},
+		"d": Uint64(6),
+		"e": HexString("0x7"),
+		"f": []interface{}{big.NewInt(8), big.NewInt(9)},
+	}, checked)
+
+	for _, tc := range []struct {
+		inputs map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"b": []interface{}{1, 2, 3.5}}, "inputs[b][2]: unsupported type float64"},
+		{map[string]interface{}{"a": "0x3"}, `inputs[a]: unsupported type non-decimal string "0x3"`},
+		{map[string]interface{}{"a": []interface{}{1, int64(-2)}}, "inputs[a][1]: unsupported type negative value -2"},
+		{map[string]interface{}{"a": "-5"}, `inputs[a]: unsupported type negative value "-5"`},
+		{map[string]interface{}{"a": [][]interface{}{{1}, {true}}}, "inputs[a][1][0]: unsupported type bool"},
+		{map[string]interface{}{"a": nil}, "inputs[a]: unsupported type nil"},
+		{map[string]interface{}{"a": []*big.Int{nil}}, "inputs[a][0]: unsupported type nil *big.Int"},
+		{map[string]interface{}{"a": map[string]int{}}, "inputs[a]: unsupported type map[string]int"},
+		// The first name in order is reported.
+		{map[string]interface{}{"z": 1.0, "y": 2.0}, "inputs[y]: unsupported type float64"},
+	} {
+		_, err := CheckInputTypes(tc.inputs)
+		assert.EqualError(t, err, tc.err)
+		var typeErr *InputTypeError
+		assert.True(t, errors.As(err, &typeErr))
+	}
+}
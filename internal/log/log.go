@@ -0,0 +1,7 @@
+// Package log is the logging facade of the module.  By default it logs with
+// logrus; the witnesscalc_slog build tag redirects the logs to log/slog (Go
+// 1.21 or later) and the witnesscalc_nolog build tag discards them, so that
+// logrus isn't linked into the binaries.
+//
+// Like log/slog, the functions take a message followed by key-value pairs.
+package log
@@ -0,0 +1,34 @@
+//go:build !witnesscalc_slog && !witnesscalc_nolog
+// +build !witnesscalc_slog,!witnesscalc_nolog
+
+package log
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fields converts key-value pairs into logrus fields.
+func fields(kv []interface{}) logrus.Fields {
+	f := make(logrus.Fields, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		f[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	return f
+}
+
+// Debug logs a debug message.
+func Debug(msg string, kv ...interface{}) {
+	logrus.WithFields(fields(kv)).Debug(msg)
+}
+
+// Info logs an informational message.
+func Info(msg string, kv ...interface{}) {
+	logrus.WithFields(fields(kv)).Info(msg)
+}
+
+// Warn logs a warning.
+func Warn(msg string, kv ...interface{}) {
+	logrus.WithFields(fields(kv)).Warn(msg)
+}
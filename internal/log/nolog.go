@@ -0,0 +1,13 @@
+//go:build witnesscalc_nolog
+// +build witnesscalc_nolog
+
+package log
+
+// Debug discards a debug message.
+func Debug(msg string, kv ...interface{}) {}
+
+// Info discards an informational message.
+func Info(msg string, kv ...interface{}) {}
+
+// Warn discards a warning.
+func Warn(msg string, kv ...interface{}) {}
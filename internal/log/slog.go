@@ -0,0 +1,21 @@
+//go:build witnesscalc_slog && !witnesscalc_nolog
+// +build witnesscalc_slog,!witnesscalc_nolog
+
+package log
+
+import "log/slog"
+
+// Debug logs a debug message.
+func Debug(msg string, kv ...interface{}) {
+	slog.Debug(msg, kv...)
+}
+
+// Info logs an informational message.
+func Info(msg string, kv ...interface{}) {
+	slog.Info(msg, kv...)
+}
+
+// Warn logs a warning.
+func Warn(msg string, kv ...interface{}) {
+	slog.Warn(msg, kv...)
+}
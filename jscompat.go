@@ -0,0 +1,139 @@
+package witnesscalc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JSWitnessCalculator wraps a Circom2WitnessCalculator with the API of the
+// witness_calculator.js generated by circom and used by snarkjs, to port
+// JavaScript proving code to Go without changing its semantics: input values
+// are reduced modulo the prime, so negative values and values above the prime
+// are accepted, arrays are flattened and counted against the size of their
+// signals, and the errors have the messages of witness_calculator.js.
+type JSWitnessCalculator struct {
+	wc *Circom2WitnessCalculator
+}
+
+// NewJSWitnessCalculator creates a JSWitnessCalculator from the circom 2
+// WitnessCalc WASM module, like the builder of witness_calculator.js.
+func NewJSWitnessCalculator(wasmBytes []byte, opts ...Option) (*JSWitnessCalculator, error) {
+	wc, err := NewCircom2WitnessCalculator(wasmBytes, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &JSWitnessCalculator{wc: wc}, nil
+}
+
+// Version returns the version of the module ABI, like version().
+func (c *JSWitnessCalculator) Version() int32 {
+	return c.wc.version
+}
+
+// Prime returns the prime of the field, like the prime property.
+func (c *JSWitnessCalculator) Prime() *big.Int {
+	return new(big.Int).Set(c.wc.prime)
+}
+
+// N32 returns the size of the field elements in 32 bit words, like the n32
+// property.
+func (c *JSWitnessCalculator) N32() int32 {
+	return c.wc.n32
+}
+
+// WitnessSize returns the number of elements of the witness, like the
+// witnessSize property.
+func (c *JSWitnessCalculator) WitnessSize() int32 {
+	return c.wc.witnessSize
+}
+
+// CalculateWitness returns the witness of the input, like calculateWitness.
+func (c *JSWitnessCalculator) CalculateWitness(input map[string]interface{}, sanityCheck bool) ([]*big.Int, error) {
+	inputs, err := c.normalize(input)
+	if err != nil {
+		return nil, err
+	}
+	w, err := c.wc.CalculateWitness(inputs, sanityCheck)
+	if err != nil {
+		return nil, toJSError(err)
+	}
+	return w.Values(), nil
+}
+
+// CalculateBinWitness returns the witness of the input as the little-endian
+// bytes of its 32 bit words, like the Uint32Array of calculateBinWitness.
+func (c *JSWitnessCalculator) CalculateBinWitness(input map[string]interface{}, sanityCheck bool) ([]byte, error) {
+	inputs, err := c.normalize(input)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.wc.CalculateBinWitness(inputs, sanityCheck)
+	return b, toJSError(err)
+}
+
+// CalculateWTNSBin returns the witness of the input in the wtns format, like
+// calculateWTNSBin.
+func (c *JSWitnessCalculator) CalculateWTNSBin(input map[string]interface{}, sanityCheck bool) ([]byte, error) {
+	inputs, err := c.normalize(input)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.wc.CalculateWTNSBin(inputs, sanityCheck)
+	return b, toJSError(err)
+}
+
+// normalize flattens the values of the input and reduces them modulo the
+// prime, like the normalize function of witness_calculator.js.
+func (c *JSWitnessCalculator) normalize(input map[string]interface{}) (map[string]interface{}, error) {
+	inputs := make(map[string]interface{}, len(input))
+	for name, v := range input {
+		values, err := flatSignalValues(v)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", name, err)
+		}
+		fArr := make([]*big.Int, len(values))
+		for i, value := range values {
+			fArr[i] = new(big.Int).Mod(bigValue(value), c.wc.prime)
+		}
+		inputs[name] = fArr
+	}
+	return inputs, nil
+}
+
+// jsError is an error of the calculator with the message of
+// witness_calculator.js.
+type jsError struct {
+	msg string
+	err error
+}
+
+func (e *jsError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the error of the calculator.
+func (e *jsError) Unwrap() error {
+	return e.err
+}
+
+// toJSError returns err with the message of witness_calculator.js for the
+// input errors.
+func toJSError(err error) error {
+	var unknownErr ErrUnknownInput
+	var sizeErr inputSizeError
+	var missingErr missingInputsError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &unknownErr):
+		return &jsError{fmt.Sprintf("Signal %s not found", unknownErr.Name), err}
+	case errors.As(err, &sizeErr) && sizeErr.values < sizeErr.size:
+		return &jsError{fmt.Sprintf("Not enough values for input signal %s", sizeErr.name), err}
+	case errors.As(err, &sizeErr):
+		return &jsError{fmt.Sprintf("Too many values for input signal %s", sizeErr.name), err}
+	case errors.As(err, &missingErr):
+		return &jsError{fmt.Sprintf("Not all inputs have been set. Only %d out of %d", missingErr.set, missingErr.size), err}
+	}
+	return err
+}
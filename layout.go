@@ -0,0 +1,105 @@
+package witnesscalc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LayoutManifest is the memory layout of a circom 1 WitnessCalc module seen
+// by its calculations: the offsets of the input signals, the free memory
+// position when the calculations start and the length of the witness.
+// Recorded with WithLayoutRecord and asserted with WithLayoutCheck, it
+// detects rebuilds of the module that silently changed the layout that
+// downstream code relies on, like the witness indexes of the signals.  A
+// manifest can be shared by calculators running concurrently, e.g. the
+// calculators of a pool.
+type LayoutManifest struct {
+	SignalOffsets map[string]int32 `json:"signalOffsets"`
+	MemFreePos    int32            `json:"memFreePos"`
+	WitnessLen    int32            `json:"witnessLen"`
+
+	// mu guards the manifest against the calculations recording or checking
+	// it concurrently.
+	mu sync.Mutex
+}
+
+// ReadLayoutManifest reads a LayoutManifest written by WriteTo.
+func ReadLayoutManifest(r io.Reader) (*LayoutManifest, error) {
+	var m LayoutManifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("layout manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// WriteTo writes the manifest in JSON to w.
+func (m *LayoutManifest) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	b, err := json.MarshalIndent(m, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// LayoutError is the error of the calculations with WithLayoutCheck whose
+// layout doesn't match the manifest.
+type LayoutError struct {
+	// Item is what changed, e.g. "offset of signal in".
+	Item     string
+	Expected int32
+	Got      int32
+}
+
+// Error describes the change.
+func (e *LayoutError) Error() string {
+	return fmt.Sprintf("module layout changed: %s is %d, expected %d", e.Item, e.Got, e.Expected)
+}
+
+// recordStart records the free memory position and the witness length of a
+// calculation.
+func (m *LayoutManifest) recordStart(freePos, witnessLen int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.MemFreePos = freePos
+	m.WitnessLen = witnessLen
+}
+
+// checkStart checks the free memory position and the witness length of a
+// calculation.
+func (m *LayoutManifest) checkStart(freePos, witnessLen int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if freePos != m.MemFreePos {
+		return &LayoutError{Item: "memory free position", Expected: m.MemFreePos, Got: freePos}
+	}
+	if witnessLen != m.WitnessLen {
+		return &LayoutError{Item: "witness length", Expected: m.WitnessLen, Got: witnessLen}
+	}
+	return nil
+}
+
+// recordSignal records the offset of the input signal name.
+func (m *LayoutManifest) recordSignal(name string, offset int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.SignalOffsets == nil {
+		m.SignalOffsets = make(map[string]int32)
+	}
+	m.SignalOffsets[name] = offset
+}
+
+// checkSignal checks the offset of the input signal name, if it is in the
+// manifest.
+func (m *LayoutManifest) checkSignal(name string, offset int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if expected, ok := m.SignalOffsets[name]; ok && offset != expected {
+		return &LayoutError{Item: "offset of signal " + name, Expected: expected, Got: offset}
+	}
+	return nil
+}
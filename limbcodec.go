@@ -0,0 +1,81 @@
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// ReverseBytes stores in dst the bytes of src in reverse order, converting
+// between little and big endian.  dst and src must have the same length and
+// may be the same slice.  It moves 64 bit words instead of bytes.
+func ReverseBytes(dst, src []byte) {
+	if len(dst) != len(src) {
+		panic("ReverseBytes: dst and src lengths differ")
+	}
+	if len(src) == 32 {
+		// unrolled for the 254 bit fields
+		a := binary.BigEndian.Uint64(src[0:])
+		b := binary.BigEndian.Uint64(src[8:])
+		c := binary.BigEndian.Uint64(src[16:])
+		d := binary.BigEndian.Uint64(src[24:])
+		binary.LittleEndian.PutUint64(dst[0:], d)
+		binary.LittleEndian.PutUint64(dst[8:], c)
+		binary.LittleEndian.PutUint64(dst[16:], b)
+		binary.LittleEndian.PutUint64(dst[24:], a)
+		return
+	}
+	i, j := 0, len(src)
+	for ; j-i >= 16; i, j = i+8, j-8 {
+		a := binary.BigEndian.Uint64(src[i:])
+		b := binary.BigEndian.Uint64(src[j-8:])
+		binary.LittleEndian.PutUint64(dst[i:], b)
+		binary.LittleEndian.PutUint64(dst[j-8:], a)
+	}
+	for ; i < j; i, j = i+1, j-1 {
+		dst[i], dst[j-1] = src[j-1], src[i]
+	}
+}
+
+// LimbCodec converts field elements between the little-endian encoding of
+// the WASM memory and the witness files, and *big.Int.  It reuses a buffer
+// across conversions, so it must not be used concurrently.  The zero value is
+// ready to use.
+type LimbCodec struct {
+	buf []byte
+}
+
+// buffer returns the reused buffer of n bytes.
+func (c *LimbCodec) buffer(n int) []byte {
+	if cap(c.buf) < n {
+		c.buf = make([]byte, n)
+	}
+	return c.buf[:n]
+}
+
+// Decode returns the value of the little-endian bytes le.
+func (c *LimbCodec) Decode(le []byte) *big.Int {
+	return c.DecodeTo(new(big.Int), le)
+}
+
+// DecodeTo sets z to the value of the little-endian bytes le and returns z.
+func (c *LimbCodec) DecodeTo(z *big.Int, le []byte) *big.Int {
+	be := c.buffer(len(le))
+	ReverseBytes(be, le)
+	return z.SetBytes(be)
+}
+
+// Encode writes the non-negative v into dst in little-endian, padded with
+// zeros to len(dst), or returns an error if it doesn't fit.
+func (c *LimbCodec) Encode(dst []byte, v *big.Int) error {
+	if v.Sign() < 0 {
+		return fmt.Errorf("negative value %v", v)
+	}
+	if (v.BitLen()+7)/8 > len(dst) {
+		return fmt.Errorf("value doesn't fit in %d bytes", len(dst))
+	}
+	be := c.buffer(len(dst))
+	v.FillBytes(be)
+	ReverseBytes(dst, be)
+	return nil
+}
@@ -0,0 +1,59 @@
+package witnesscalc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseBytes(t *testing.T) {
+	for n := 0; n <= 70; n++ {
+		src := make([]byte, n)
+		expected := make([]byte, n)
+		for i := range src {
+			src[i] = byte(i + 1)
+			expected[n-1-i] = byte(i + 1)
+		}
+		dst := make([]byte, n)
+		ReverseBytes(dst, src)
+		assert.Equal(t, expected, dst, n)
+		// in place
+		ReverseBytes(src, src)
+		assert.Equal(t, expected, src, n)
+	}
+	assert.Panics(t, func() { ReverseBytes(make([]byte, 2), make([]byte, 3)) })
+}
+
+func TestLimbCodec(t *testing.T) {
+	var c LimbCodec
+	for _, v := range []*big.Int{big.NewInt(0), big.NewInt(0x0102), new(big.Int).Sub(bn254, big.NewInt(1))} {
+		le := make([]byte, 32)
+		require.NoError(t, c.Encode(le, v))
+		assert.Equal(t, swap(v.FillBytes(make([]byte, 32))), le)
+		assert.Equal(t, v.String(), c.Decode(le).String())
+		// odd sizes
+		assert.Equal(t, v.String(), c.Decode(append(le, 0)).String())
+	}
+	le := make([]byte, 2)
+	require.NoError(t, c.Encode(le, big.NewInt(0x0102)))
+	assert.Equal(t, []byte{2, 1}, le)
+	require.EqualError(t, c.Encode(le, big.NewInt(0x010203)), "value doesn't fit in 2 bytes")
+	require.Error(t, c.Encode(le, big.NewInt(-1)))
+
+	z := new(big.Int)
+	assert.Same(t, z, c.DecodeTo(z, []byte{1, 0, 0}))
+	assert.Equal(t, int64(1), z.Int64())
+}
+
+func BenchmarkLimbCodecDecode(b *testing.B) {
+	var c LimbCodec
+	le := make([]byte, 32)
+	require.NoError(b, c.Encode(le, new(big.Int).Sub(bn254, big.NewInt(1))))
+	z := new(big.Int)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.DecodeTo(z, le)
+	}
+}
@@ -0,0 +1,140 @@
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+// montgomeryParams holds the constants needed to multiply field elements
+// represented as little-endian 64-bit limbs in Montgomery form.
+type montgomeryParams struct {
+	p   []uint64 // prime
+	inv uint64   // -p⁻¹ mod 2⁶⁴
+	r2  []uint64 // R² mod p, with R = 2^(64·len(p))
+}
+
+// newMontgomeryParams computes the Montgomery constants for the prime.
+func newMontgomeryParams(prime *big.Int) (*montgomeryParams, error) {
+	if prime.Sign() <= 0 || prime.Bit(0) == 0 {
+		return nil, fmt.Errorf("prime must be odd and positive")
+	}
+	n := (prime.BitLen() + 63) / 64
+	p := bigToLimbs(prime, n)
+	// Newton iteration for p⁻¹ mod 2⁶⁴: each step doubles the correct bits
+	inv := uint64(1)
+	for i := 0; i < 6; i++ {
+		inv *= 2 - p[0]*inv
+	}
+	r2 := new(big.Int).Lsh(big.NewInt(1), uint(128*n))
+	r2.Mod(r2, prime)
+	return &montgomeryParams{
+		p:   p,
+		inv: -inv,
+		r2:  bigToLimbs(r2, n),
+	}, nil
+}
+
+// bigToLimbs returns v as n little-endian 64-bit limbs.
+func bigToLimbs(v *big.Int, n int) []uint64 {
+	limbs := make([]uint64, n)
+	b := v.Bytes()
+	for i := 0; i < len(b); i++ {
+		limbs[i/8] |= uint64(b[len(b)-1-i]) << (8 * (i % 8))
+	}
+	return limbs
+}
+
+// lessThan returns true if a < b, both being little-endian limbs of the same
+// length.
+func lessThan(a, b []uint64) bool {
+	for i := len(a) - 1; i >= 0; i-- {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// mul stores in z the Montgomery product a·b·R⁻¹ mod p, using the CIOS
+// method.  t is a scratch buffer of len(p)+2 limbs.  a and b must be lower
+// than p.
+func (m *montgomeryParams) mul(z, a, b, t []uint64) {
+	n := len(m.p)
+	for i := range t {
+		t[i] = 0
+	}
+	for i := 0; i < n; i++ {
+		var c uint64
+		for j := 0; j < n; j++ {
+			c, t[j] = madd(a[j], b[i], t[j], c)
+		}
+		var carry uint64
+		t[n], carry = bits.Add64(t[n], c, 0)
+		t[n+1] = carry
+
+		q := t[0] * m.inv
+		c, _ = madd(q, m.p[0], t[0], 0)
+		for j := 1; j < n; j++ {
+			c, t[j-1] = madd(q, m.p[j], t[j], c)
+		}
+		t[n-1], carry = bits.Add64(t[n], c, 0)
+		t[n] = t[n+1] + carry
+	}
+	if t[n] != 0 || !lessThan(t[:n], m.p) {
+		var borrow uint64
+		for j := 0; j < n; j++ {
+			t[j], borrow = bits.Sub64(t[j], m.p[j], borrow)
+		}
+	}
+	copy(z, t[:n])
+}
+
+// madd returns (hi, lo) of a·b + c + d.
+func madd(a, b, c, d uint64) (uint64, uint64) {
+	hi, lo := bits.Mul64(a, b)
+	var carry uint64
+	lo, carry = bits.Add64(lo, c, 0)
+	hi += carry
+	lo, carry = bits.Add64(lo, d, 0)
+	hi += carry
+	return hi, lo
+}
+
+// ExportLimbs converts a binary witness, as returned by CalculateBinWitness
+// (little-endian field elements in regular form), into little-endian 64-bit
+// limbs in Montgomery form (v·R mod p, with R = 2^(64·limbs)), which is the
+// internal representation of field elements in provers like gnark-crypto.
+// For a 254 bit prime each element has 4 limbs and can be copied into a
+// [4]uint64.  The conversion works on limbs directly, without big.Int.
+func ExportLimbs(binWitness []byte, prime *big.Int) ([][]uint64, error) {
+	m, err := newMontgomeryParams(prime)
+	if err != nil {
+		return nil, err
+	}
+	n := len(m.p)
+	elemLen := n * 8
+	if len(binWitness)%elemLen != 0 {
+		return nil, fmt.Errorf("binary witness length %d is not a multiple of %d",
+			len(binWitness), elemLen)
+	}
+	nElems := len(binWitness) / elemLen
+	backing := make([]uint64, nElems*n)
+	res := make([][]uint64, nElems)
+	a := make([]uint64, n)
+	t := make([]uint64, n+2)
+	for i := 0; i < nElems; i++ {
+		elem := binWitness[i*elemLen : (i+1)*elemLen]
+		for j := 0; j < n; j++ {
+			a[j] = binary.LittleEndian.Uint64(elem[j*8:])
+		}
+		if !lessThan(a, m.p) {
+			return nil, fmt.Errorf("witness element %d is not lower than the prime", i)
+		}
+		res[i] = backing[i*n : (i+1)*n : (i+1)*n]
+		// a·R²·R⁻¹ = a·R
+		m.mul(res[i], a, m.r2, t)
+	}
+	return res, nil
+}
@@ -0,0 +1,43 @@
+package witnesscalc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportLimbs(t *testing.T) {
+	prime, ok := new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+	require.True(t, ok)
+	r := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	values := []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(0x7fffffff),
+		new(big.Int).Sub(prime, big.NewInt(1)),
+		new(big.Int).Rsh(prime, 1),
+	}
+	binWitness := make([]byte, 0, len(values)*32)
+	for _, v := range values {
+		binWitness = append(binWitness, swap(append(make([]byte, 32-len(v.Bytes())), v.Bytes()...))...)
+	}
+
+	limbs, err := ExportLimbs(binWitness, prime)
+	require.Nil(t, err)
+	require.Len(t, limbs, len(values))
+	for i, v := range values {
+		expected := new(big.Int).Mul(v, r)
+		expected.Mod(expected, prime)
+		assert.Equal(t, bigToLimbs(expected, 4), limbs[i], "value %v", v)
+	}
+
+	_, err = ExportLimbs(binWitness[:33], prime)
+	require.Error(t, err)
+
+	overflow := swap(append(make([]byte, 32-len(prime.Bytes())), prime.Bytes()...))
+	_, err = ExportLimbs(overflow, prime)
+	require.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+)
+
+// LintWarning describes an input value that is likely to produce an invalid
+// witness.
+type LintWarning struct {
+	// Input is the input signal name with the index of the value in the
+	// flattened input, e.g. "siblings[3]".
+	Input string
+	Value *big.Int
+	Msg   string
+}
+
+// String returns a human readable description of the warning.
+func (w LintWarning) String() string {
+	return fmt.Sprintf("input %s = %v: %s", w.Input, w.Value, w.Msg)
+}
+
+// isBinaryName guesses from its name whether an input signal is expected to
+// only hold 0 or 1, following common circom naming conventions: isX, hasX,
+// enabled, xBits, flag.
+func isBinaryName(name string) bool {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, prefix := range []string{"is", "has"} {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			next := rune(name[len(prefix)])
+			if unicode.IsUpper(next) || unicode.IsDigit(next) || next == '_' {
+				return true
+			}
+		}
+	}
+	lower := strings.ToLower(name)
+	return lower == "enabled" || lower == "enable" || strings.HasSuffix(lower, "bits") ||
+		strings.HasSuffix(lower, "flag")
+}
+
+// LintInputs checks the inputs against the field prime and returns a warning
+// for every value that is greater or equal than the prime (it would be
+// silently reduced) and for every value of a binary input that is not 0 or 1.
+// Binary inputs are the ones listed in binaryInputs plus the ones whose name
+// follows a boolean naming convention (isX, hasX, enabled, xBits, flag).
+// Warnings are sorted by input name.
+func LintInputs(inputs map[string]interface{}, prime *big.Int, binaryInputs ...string) ([]LintWarning, error) {
+	declaredBinary := make(map[string]bool, len(binaryInputs))
+	for _, name := range binaryInputs {
+		declaredBinary[name] = true
+	}
+	names := make([]string, 0, len(inputs))
+	for inputName := range inputs {
+		names = append(names, inputName)
+	}
+	sort.Strings(names)
+
+	var warnings []LintWarning
+	one := big.NewInt(1)
+	for _, inputName := range names {
+		fSlice, err := FlattenSignal(inputs[inputName])
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", inputName, err)
+		}
+		binary := declaredBinary[inputName] || isBinaryName(inputName)
+		for i, v := range fSlice {
+			name := inputName
+			if len(fSlice) > 1 {
+				name = fmt.Sprintf("%s[%d]", inputName, i)
+			}
+			if v.Cmp(prime) >= 0 {
+				warnings = append(warnings, LintWarning{Input: name, Value: v,
+					Msg: "value is not lower than the prime and will be reduced"})
+			} else if binary && v.Sign() != 0 && v.Cmp(one) != 0 {
+				warnings = append(warnings, LintWarning{Input: name, Value: v,
+					Msg: "binary input is neither 0 nor 1"})
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// logLintWarnings logs the LintInputs warnings of the inputs.
+func logLintWarnings(inputs map[string]interface{}, prime *big.Int, binaryInputs []string) error {
+	warnings, err := LintInputs(inputs, prime, binaryInputs...)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		log.Warn(w.String())
+	}
+	return nil
+}
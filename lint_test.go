@@ -0,0 +1,36 @@
+package witnesscalc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintInputs(t *testing.T) {
+	prime, ok := new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+	require.True(t, ok)
+
+	inputs, err := ParseInputs([]byte(`{
+		"isOld0": 2,
+		"enabled": 1,
+		"fnc": 3,
+		"siblings": [1, "21888242871839275222246405745257275088548364400416034343698204186575808495617"],
+		"inBits": [0, 1, 1, 5]
+	}`))
+	require.Nil(t, err)
+
+	warnings, err := LintInputs(inputs, prime, "fnc")
+	require.Nil(t, err)
+	require.Len(t, warnings, 4)
+	assert.Equal(t, "fnc", warnings[0].Input)
+	assert.Equal(t, "inBits[3]", warnings[1].Input)
+	assert.Equal(t, "isOld0", warnings[2].Input)
+	assert.Equal(t, "siblings[1]", warnings[3].Input)
+	assert.Equal(t, "input isOld0 = 2: binary input is neither 0 nor 1", warnings[2].String())
+
+	assert.True(t, isBinaryName("main.isZero"))
+	assert.False(t, isBinaryName("issuer"))
+	assert.False(t, isBinaryName("hash"))
+}
@@ -0,0 +1,216 @@
+// Package lowlevel reads and writes the memory of the circom 1 WitnessCalc
+// WASM modules, for tools that manipulate their signals directly: the free
+// memory pointer, the 32 bit integers and the field elements in the short,
+// long and Montgomery forms of the circom 1 runtime.  It only depends on the
+// memory of the module, so it works with any WASM runtime, like the one of a
+// witnesscalc.WitnessCalculator (see witnesscalc.Runtime).
+//
+// The API of the package is stable: it follows the compatibility guarantees
+// of the module, and is not changed within a major version.
+package lowlevel
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// The bits of the circom 1 field elements.
+const (
+	// Mask32 masks the 32 bit words of the field elements.
+	Mask32 = 0xFFFFFFFF
+	// TypeLong is the type flag of the field elements in long form.
+	TypeLong = 0x80000000
+	// TypeMontgomery is the type flag of the long field elements in
+	// Montgomery form.
+	TypeMontgomery = 0x40000000
+	// ShortLimit bounds the short forms: the values in [0, ShortLimit) and
+	// [prime - ShortLimit, prime).
+	ShortLimit = 0x80000000
+)
+
+// Memory holds the linear memory of a module.  It is called on every access,
+// as the module may grow its memory and move it.
+type Memory interface {
+	Memory() []byte
+}
+
+// memRange returns the n bytes at position p of the memory of m, or an error
+// if they are out of bounds.
+func memRange(m Memory, p, n int32) ([]byte, error) {
+	mem := m.Memory()
+	if p < 0 || n < 0 || int64(p)+int64(n) > int64(len(mem)) {
+		return nil, fmt.Errorf("memory access of %d bytes at %d out of bounds [0, %d)", n, p, len(mem))
+	}
+	return mem[p : p+n], nil
+}
+
+// GetInt returns the 32 bit integer at position p.
+func GetInt(m Memory, p int32) (int32, error) {
+	b, err := memRange(m, p, 4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(b)), nil
+}
+
+// SetInt stores the 32 bit integer v at position p.
+func SetInt(m Memory, p, v int32) error {
+	b, err := memRange(m, p, 4)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b, uint32(v))
+	return nil
+}
+
+// MemFreePos returns the next free memory position, which the circom 1
+// modules store at position 0.
+func MemFreePos(m Memory) (int32, error) {
+	return GetInt(m, 0)
+}
+
+// SetMemFreePos sets the next free memory position.
+func SetMemFreePos(m Memory, p int32) error {
+	return SetInt(m, 0, p)
+}
+
+// Alloc reserves n bytes at the next free memory position, rounded up to 8
+// bytes, and returns their position.  The memory is released by setting the
+// free position back with SetMemFreePos.
+func Alloc(m Memory, n int32) (int32, error) {
+	p, err := MemFreePos(m)
+	if err != nil {
+		return 0, err
+	}
+	end := p + (n+7)/8*8
+	if _, err := memRange(m, p, end-p); err != nil {
+		return 0, err
+	}
+	return p, SetMemFreePos(m, end)
+}
+
+// Fr encodes the field elements of a prime in the memory of the circom 1
+// modules: 4 bytes of a 32 bit signed integer, the short form, followed by 4
+// bytes of type flags and, for the long forms, the little-endian value of
+// N8 bytes, the size of the prime rounded up to 64 bits.
+type Fr struct {
+	prime *big.Int
+	n8    int32
+	rInv  *big.Int
+}
+
+// NewFr returns the Fr of the field of prime.
+func NewFr(prime *big.Int) *Fr {
+	n8 := int32((prime.BitLen()-1)/64+1) * 8
+	r := new(big.Int).Lsh(big.NewInt(1), uint(n8)*8)
+	return &Fr{
+		prime: new(big.Int).Set(prime),
+		n8:    n8,
+		rInv:  new(big.Int).ModInverse(r, prime),
+	}
+}
+
+// N8 returns the size in bytes of the values of the long forms.
+func (f *Fr) N8() int32 {
+	return f.n8
+}
+
+// Size returns the size in bytes of the field elements in memory.
+func (f *Fr) Size() int32 {
+	return 8 + f.n8
+}
+
+// Alloc reserves the memory of a field element, see Alloc.
+func (f *Fr) Alloc(m Memory) (int32, error) {
+	return Alloc(m, f.Size())
+}
+
+// Load returns the field element at position p, in any form.
+func (f *Fr) Load(m Memory, p int32) (*big.Int, error) {
+	b, err := memRange(m, p, 8)
+	if err != nil {
+		return nil, err
+	}
+	short := int32(binary.LittleEndian.Uint32(b[:4]))
+	typ := binary.LittleEndian.Uint32(b[4:8])
+	if typ&TypeLong == 0 {
+		v := big.NewInt(int64(short))
+		if short < 0 {
+			v.Add(v, f.prime)
+		}
+		return v, nil
+	}
+	if b, err = memRange(m, p+8, f.n8); err != nil {
+		return nil, err
+	}
+	v := new(big.Int).SetBytes(swap(b))
+	if typ&TypeMontgomery != 0 {
+		v.Mul(v, f.rInv)
+		v.Mod(v, f.prime)
+	}
+	return v, nil
+}
+
+// Store stores the field element v at position p, in short form if it is in
+// the range of the short forms, and in long form otherwise.
+func (f *Fr) Store(m Memory, p int32, v *big.Int) error {
+	if v.Sign() < 0 || v.Cmp(f.prime) >= 0 {
+		return fmt.Errorf("%v is not an element of the field", v)
+	}
+	short := new(big.Int).Sub(v, f.prime)
+	switch {
+	case v.Cmp(big.NewInt(ShortLimit)) < 0:
+		short = v
+	case short.Cmp(big.NewInt(-ShortLimit)) >= 0:
+	default:
+		b, err := memRange(m, p, f.Size())
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(b[:4], 0)
+		binary.LittleEndian.PutUint32(b[4:8], TypeLong)
+		copy(b[8:], swap(v.FillBytes(make([]byte, f.n8))))
+		return nil
+	}
+	b, err := memRange(m, p, 8)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b[:4], uint32(short.Int64()))
+	binary.LittleEndian.PutUint32(b[4:8], 0)
+	return nil
+}
+
+// Words returns the n little-endian 32 bit words of v, the layout of the
+// values of the long forms, truncated to n words.  v must not be negative.
+func Words(v *big.Int, n int) []uint32 {
+	words := make([]uint32, n)
+	w := new(big.Int).Set(v)
+	mask := big.NewInt(Mask32)
+	word := new(big.Int)
+	for i := range words {
+		words[i] = uint32(word.And(w, mask).Uint64())
+		w.Rsh(w, 32)
+	}
+	return words
+}
+
+// FromWords returns the integer of the little-endian 32 bit words.
+func FromWords(words []uint32) *big.Int {
+	v := new(big.Int)
+	for i := len(words) - 1; i >= 0; i-- {
+		v.Lsh(v, 32)
+		v.Or(v, big.NewInt(int64(words[i])))
+	}
+	return v
+}
+
+// swap returns a copy of b with its bytes reversed.
+func swap(b []byte) []byte {
+	bs := make([]byte, len(b))
+	for i := range b {
+		bs[len(b)-1-i] = b[i]
+	}
+	return bs
+}
@@ -0,0 +1,94 @@
+package lowlevel
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memory is a Memory of a fixed slice.
+type memory []byte
+
+func (m memory) Memory() []byte {
+	return m
+}
+
+// bn254 is the prime of the field of the tests.
+var bn254, _ = new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+
+func TestInt(t *testing.T) {
+	m := make(memory, 64)
+	require.Nil(t, SetMemFreePos(m, 8))
+	p, err := Alloc(m, 5)
+	require.Nil(t, err)
+	assert.Equal(t, int32(8), p)
+	freePos, err := MemFreePos(m)
+	require.Nil(t, err)
+	assert.Equal(t, int32(16), freePos)
+
+	require.Nil(t, SetInt(m, p, -2))
+	v, err := GetInt(m, p)
+	require.Nil(t, err)
+	assert.Equal(t, int32(-2), v)
+	assert.Equal(t, []byte{0xfe, 0xff, 0xff, 0xff}, []byte(m[p:p+4]))
+
+	_, err = Alloc(m, 64)
+	require.Error(t, err)
+	_, err = GetInt(m, 62)
+	require.Error(t, err)
+	require.Error(t, SetInt(m, -1, 0))
+}
+
+func TestFr(t *testing.T) {
+	f := NewFr(bn254)
+	assert.Equal(t, int32(32), f.N8())
+	m := make(memory, 128)
+	require.Nil(t, SetMemFreePos(m, 8))
+	p, err := f.Alloc(m)
+	require.Nil(t, err)
+
+	minusOne := new(big.Int).Sub(bn254, big.NewInt(1))
+	large := new(big.Int).Lsh(big.NewInt(1), 100)
+	for _, tc := range []struct {
+		v     *big.Int
+		short int32
+		typ   int32
+	}{
+		{big.NewInt(5), 5, 0},
+		{minusOne, -1, 0},
+		{new(big.Int).Sub(bn254, big.NewInt(ShortLimit)), -ShortLimit, 0},
+		{big.NewInt(ShortLimit), 0, -TypeLong},
+		{large, 0, -TypeLong},
+	} {
+		require.Nil(t, f.Store(m, p, tc.v))
+		short, err := GetInt(m, p)
+		require.Nil(t, err)
+		assert.Equal(t, tc.short, short, tc.v)
+		typ, err := GetInt(m, p+4)
+		require.Nil(t, err)
+		assert.Equal(t, tc.typ, typ, tc.v)
+		v, err := f.Load(m, p)
+		require.Nil(t, err)
+		assert.Equal(t, 0, tc.v.Cmp(v), tc.v)
+	}
+	require.Error(t, f.Store(m, p, bn254))
+	require.Error(t, f.Store(m, p, big.NewInt(-1)))
+
+	// large in Montgomery form
+	r := new(big.Int).Lsh(big.NewInt(1), 256)
+	require.Nil(t, f.Store(m, p, new(big.Int).Mod(new(big.Int).Mul(large, r), bn254)))
+	require.Nil(t, SetInt(m, p+4, -(TypeLong-TypeMontgomery)))
+	v, err := f.Load(m, p)
+	require.Nil(t, err)
+	assert.Equal(t, large, v)
+}
+
+func TestWords(t *testing.T) {
+	v := new(big.Int).SetUint64(0x1122334455667788)
+	words := Words(v, 3)
+	assert.Equal(t, []uint32{0x55667788, 0x11223344, 0}, words)
+	assert.Equal(t, v, FromWords(words))
+	assert.Equal(t, []uint32{0x55667788}, Words(v, 1))
+}
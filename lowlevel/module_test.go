@@ -0,0 +1,58 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package lowlevel_test
+
+import (
+	"io/ioutil"
+	"math/big"
+	"testing"
+
+	wasm3 "github.com/iden3/go-wasm3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+	"github.com/iden3/go-circom-witnesscalc/v2/lowlevel"
+)
+
+func TestModuleWitness(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("../test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	runtime := wasm3.NewRuntime(&wasm3.Config{
+		Environment: wasm3.NewEnvironment(),
+		StackSize:   64 * 1024,
+	})
+	defer runtime.Destroy()
+	module, err := runtime.ParseModule(wasmBytes)
+	require.Nil(t, err)
+	_, err = runtime.LoadModule(module)
+	require.Nil(t, err)
+	wc, err := witnesscalc.NewWitnessCalculator(runtime)
+	require.Nil(t, err)
+	w, err := wc.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(-1)}, true)
+	require.Nil(t, err)
+
+	getPWitness, err := runtime.FindFunction("getPWitness")
+	require.Nil(t, err)
+	f := lowlevel.NewFr(wc.Field().Prime())
+	for i, expected := range w.Values() {
+		p, err := getPWitness(i)
+		require.Nil(t, err)
+		v, err := f.Load(runtime, p.(int32))
+		require.Nil(t, err)
+		assert.Equal(t, 0, expected.Cmp(v), i)
+	}
+
+	// The free position is left as found by the calculator.
+	freePos, err := lowlevel.MemFreePos(runtime)
+	require.Nil(t, err)
+	p, err := f.Alloc(runtime)
+	require.Nil(t, err)
+	assert.Equal(t, freePos, p)
+	require.Nil(t, f.Store(runtime, p, w.At(1)))
+	v, err := f.Load(runtime, p)
+	require.Nil(t, err)
+	assert.Equal(t, 0, w.At(1).Cmp(v))
+	require.Nil(t, lowlevel.SetMemFreePos(runtime, freePos))
+}
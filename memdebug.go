@@ -0,0 +1,27 @@
+//go:build witnesscalc_memdebug
+// +build witnesscalc_memdebug
+
+package witnesscalc
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+)
+
+// traceMemAccess logs the access to the n bytes at position p of the WASM
+// memory mem, with the call site of memRange: at the debug level, or as a
+// warning if the access, which failed with err, is out of bounds.
+func traceMemAccess(mem []byte, p, n int64, err error) {
+	site := "unknown"
+	if _, file, line, ok := runtime.Caller(2); ok {
+		site = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	if err != nil {
+		log.Warn("Out of bounds WASM memory access", "site", site, "pos", p, "size", n, "memory", len(mem))
+		return
+	}
+	log.Debug("WASM memory access", "site", site, "pos", p, "size", n, "memory", len(mem))
+}
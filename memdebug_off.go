@@ -0,0 +1,7 @@
+//go:build !witnesscalc_memdebug
+// +build !witnesscalc_memdebug
+
+package witnesscalc
+
+// traceMemAccess does nothing without the witnesscalc_memdebug build tag.
+func traceMemAccess(mem []byte, p, n int64, err error) {}
@@ -0,0 +1,36 @@
+//go:build witnesscalc_memdebug && !witnesscalc_slog && !witnesscalc_nolog
+// +build witnesscalc_memdebug,!witnesscalc_slog,!witnesscalc_nolog
+
+package witnesscalc
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemRangeDebug(t *testing.T) {
+	var buff bytes.Buffer
+	logrus.SetOutput(&buff)
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.DebugLevel)
+	defer func() {
+		logrus.SetOutput(os.Stderr)
+		logrus.SetLevel(level)
+	}()
+
+	mem := make([]byte, 16)
+	_, err := memRange(mem, 4, 8)
+	assert.Nil(t, err)
+	assert.Contains(t, buff.String(), "WASM memory access")
+	assert.Contains(t, buff.String(), "site=\"memdebug_test.go:")
+
+	buff.Reset()
+	_, err = memRange(mem, 12, 8)
+	assert.Error(t, err)
+	assert.Contains(t, buff.String(), "Out of bounds WASM memory access")
+	assert.Contains(t, buff.String(), "pos=12")
+}
@@ -0,0 +1,96 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+)
+
+// MissingInputMode is how the calculators handle the input signals of the
+// circuit missing from the inputs of a calculation, see WithMissingInputs.
+type MissingInputMode int
+
+const (
+	// MissingInputsError fails the calculations with an ErrMissingInputs
+	// error naming the missing inputs.
+	MissingInputsError MissingInputMode = iota
+	// MissingInputsZero sets the missing input signals to zero, logging a
+	// warning.
+	MissingInputsZero
+)
+
+// MissingInputFunc returns the value of the input signal name, of size
+// elements, missing from the inputs of a calculation: a value of any of the
+// types accepted in the inputs, see WithMissingInputFunc.
+type MissingInputFunc func(name string, size int) (interface{}, error)
+
+// fillMissingInputs returns the signals with the input signals of the
+// circuit missing from them, given by inputSizes, set as configured by
+// WithMissingInputs and WithMissingInputFunc.  The signals are returned as is
+// if inputSizes is nil, when the inputs of the circuit are unknown, after
+// rejecting or warning about empty inputs (see WithRequireInputs).
+func (o options) fillMissingInputs(signals []signalInput, inputSizes map[string]int) ([]signalInput, error) {
+	if inputSizes == nil {
+		if len(signals) == 0 {
+			if o.requireInputs {
+				return nil, ErrNoInputs
+			}
+			log.Warn("Calculating a witness without inputs")
+		}
+		return signals, nil
+	}
+	given := make(map[SignalID]bool, len(signals))
+	for _, signal := range signals {
+		given[signal.id] = true
+	}
+	// Sorted, for the signals to be set and reported in the same order on
+	// every call.
+	names := make([]string, 0, len(inputSizes))
+	for name := range inputSizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// The signals may share their array with StaticInputs: the missing ones
+	// are appended to a copy.
+	signals = signals[:len(signals):len(signals)]
+	var missing []string
+	set, size := 0, 0
+	for _, name := range names {
+		n := inputSizes[name]
+		size += n
+		id := NewSignalID(name)
+		if given[id] {
+			set += n
+			continue
+		}
+		switch {
+		case o.missingInputFn != nil:
+			v, err := o.missingInputFn(name, n)
+			if err != nil {
+				return nil, fmt.Errorf("missing input %s: %w", name, err)
+			}
+			values, err := flatSignalValues(v)
+			if err != nil {
+				return nil, fmt.Errorf("missing input %s: %w", name, err)
+			}
+			if len(values) != n {
+				return nil, inputSizeError{name: name, values: len(values), size: n}
+			}
+			signals = append(signals, signalInput{name: name, id: id, values: values})
+		case o.missingInputs == MissingInputsZero:
+			log.Warn("Input signal missing, set to zero", "input", name, "size", n)
+			values := make([]SignalValue, n)
+			for i := range values {
+				values[i] = Uint64(0)
+			}
+			signals = append(signals, signalInput{name: name, id: id, values: values})
+		default:
+			missing = append(missing, name)
+		}
+	}
+	if missing != nil {
+		return nil, missingInputsError{set: set, size: size, names: missing}
+	}
+	return signals, nil
+}
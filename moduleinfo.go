@@ -0,0 +1,86 @@
+package witnesscalc
+
+import "math/big"
+
+// ModuleInfo describes a WitnessCalc WASM module, to tell which circom
+// produced it and for which field.
+type ModuleInfo struct {
+	// Circom is the major version of the circom that produced the module: 1
+	// or 2.
+	Circom int
+	// Version is the version of the circom 2 ABI, from getVersion, or 0 for
+	// circom 1 modules.
+	Version int32
+	Prime   *big.Int
+	Curve   Curve
+	// NVars is the number of elements of the witness.
+	NVars int32
+	// N64 is the size of the field elements in 64 bit words.
+	N64 int
+	// Exports are the names of the exports of the module.
+	Exports []string
+	// Imports are the imports of the module, as "module.name".
+	Imports []string
+}
+
+// ReadModuleInfo instantiates the WitnessCalc WASM module wasmBytes to
+// describe it.  Modules exporting getVersion are loaded as circom 2 modules,
+// the others as circom 1 modules, which are not supported under js.
+func ReadModuleInfo(wasmBytes []byte) (*ModuleInfo, error) {
+	wasmBytes, err := DecompressWASM(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	exports, err := parseWASMExports(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	imports, err := parseWASMImports(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	var info ModuleInfo
+	if isCircom2Module(exports) {
+		wc, err := NewCircom2WitnessCalculator(wasmBytes)
+		if err != nil {
+			return nil, err
+		}
+		info = wc.moduleInfo()
+	} else {
+		info, err = readCircom1ModuleInfo(wasmBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, exp := range exports {
+		info.Exports = append(info.Exports, exp.Name)
+	}
+	for _, imp := range imports {
+		info.Imports = append(info.Imports, imp.String())
+	}
+	return &info, nil
+}
+
+// moduleInfo returns the ModuleInfo of the module of the calculator, without
+// its exports and imports.
+func (wc *Circom2WitnessCalculator) moduleInfo() ModuleInfo {
+	return ModuleInfo{
+		Circom:  2,
+		Version: wc.version,
+		Prime:   new(big.Int).Set(wc.prime),
+		Curve:   wc.curve,
+		NVars:   wc.witnessSize,
+		N64:     int(wc.n32+1) / 2,
+	}
+}
+
+// isCircom2Module returns true if the module of the exports was produced by
+// circom 2, which exports getVersion.
+func isCircom2Module(exports []wasmExport) bool {
+	for _, exp := range exports {
+		if exp.Name == "getVersion" {
+			return true
+		}
+	}
+	return false
+}
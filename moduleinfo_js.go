@@ -0,0 +1,16 @@
+//go:build js && wasm
+// +build js,wasm
+
+package witnesscalc
+
+import "errors"
+
+// readCircom1ModuleInfo fails, as circom 1 modules need the wasm3 runtime.
+func readCircom1ModuleInfo(wasmBytes []byte) (ModuleInfo, error) {
+	return ModuleInfo{}, errors.New("circom 1 modules are not supported under js")
+}
+
+// loadCircom1Calculator fails, as circom 1 modules need the wasm3 runtime.
+func loadCircom1Calculator(wasmBytes []byte, opts []Option) (Calculator, error) {
+	return nil, errors.New("circom 1 modules are not supported under js")
+}
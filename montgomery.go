@@ -0,0 +1,94 @@
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+)
+
+// montgomeryReducer converts field elements out of the Montgomery form of
+// the circom 1 runtime, with R = 2^(64*n64), by Montgomery reduction over 64
+// bit limbs instead of a big.Int multiplication by R^-1 and a modular
+// reduction.  It reuses its buffers, so it must not be used concurrently.
+type montgomeryReducer struct {
+	p    []uint64 // the prime in little-endian limbs
+	pInv uint64   // -p^-1 mod 2^64
+	t    []uint64 // reduction buffer, 2*n64+1 limbs
+	be   []byte   // big-endian result buffer
+}
+
+// newMontgomeryReducer creates the montgomeryReducer of the odd prime with
+// n64 limbs.
+func newMontgomeryReducer(prime *big.Int, n64 int) *montgomeryReducer {
+	be := make([]byte, n64*8)
+	prime.FillBytes(be)
+	p := make([]uint64, n64)
+	for i := range p {
+		p[i] = binary.BigEndian.Uint64(be[len(be)-8*(i+1):])
+	}
+	// Newton iteration: each step doubles the correct low bits of the
+	// inverse, starting from the 1 bit of p[0]^-1 = 1 mod 2
+	inv := uint64(1)
+	for i := 0; i < 6; i++ {
+		inv *= 2 - p[0]*inv
+	}
+	return &montgomeryReducer{
+		p:    p,
+		pInv: -inv,
+		t:    make([]uint64, 2*n64+1),
+		be:   be,
+	}
+}
+
+// reduce sets z to x*R^-1 mod p, with x the little-endian bytes of n64
+// limbs of the Montgomery form, and returns z.
+func (r *montgomeryReducer) reduce(z *big.Int, x []byte) *big.Int {
+	n := len(r.p)
+	t := r.t
+	for i := range t {
+		t[i] = 0
+	}
+	for i := 0; i < n; i++ {
+		t[i] = binary.LittleEndian.Uint64(x[i*8:])
+	}
+	for i := 0; i < n; i++ {
+		m := t[i] * r.pInv
+		var carry uint64
+		for j := 0; j < n; j++ {
+			hi, lo := bits.Mul64(m, r.p[j])
+			var c uint64
+			lo, c = bits.Add64(lo, t[i+j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			t[i+j] = lo
+			carry = hi
+		}
+		for k := i + n; carry != 0 && k < len(t); k++ {
+			t[k], carry = bits.Add64(t[k], carry, 0)
+		}
+	}
+	// t[n:] < 2p: subtract p once if needed
+	res := t[n:]
+	if res[n] != 0 || !lessLimbs(res[:n], r.p) {
+		var borrow uint64
+		for i := 0; i < n; i++ {
+			res[i], borrow = bits.Sub64(res[i], r.p[i], borrow)
+		}
+	}
+	for i := 0; i < n; i++ {
+		binary.BigEndian.PutUint64(r.be[len(r.be)-8*(i+1):], res[i])
+	}
+	return z.SetBytes(r.be)
+}
+
+// lessLimbs returns whether the little-endian limbs a are less than b, of the
+// same length.
+func lessLimbs(a, b []uint64) bool {
+	for i := len(a) - 1; i >= 0; i-- {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
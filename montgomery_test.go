@@ -0,0 +1,62 @@
+package witnesscalc
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// montgomeryLE returns the little-endian bytes of v in n64 limbs.
+func montgomeryLE(v *big.Int, n64 int) []byte {
+	le := make([]byte, n64*8)
+	v.FillBytes(le)
+	ReverseBytes(le, le)
+	return le
+}
+
+func TestMontgomeryReducer(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, curve := range []Curve{CurveBN254, CurveBLS12381, CurvePallas, CurveGoldilocks} {
+		prime := curve.Prime()
+		n64 := (prime.BitLen()-1)/64 + 1
+		rInv := new(big.Int).Lsh(big.NewInt(1), uint(n64*64))
+		rInv.ModInverse(rInv, prime)
+		r := newMontgomeryReducer(prime, n64)
+
+		values := []*big.Int{big.NewInt(0), big.NewInt(1), new(big.Int).Sub(prime, big.NewInt(1))}
+		for i := 0; i < 100; i++ {
+			values = append(values, new(big.Int).Rand(rnd, prime))
+		}
+		for _, v := range values {
+			expected := new(big.Int).Mul(v, rInv)
+			expected.Mod(expected, prime)
+			got := r.reduce(new(big.Int), montgomeryLE(v, n64))
+			assert.Equal(t, 0, expected.Cmp(got), "%v %v: %v != %v", curve, v, got, expected)
+		}
+	}
+}
+
+func BenchmarkMontgomeryReducer(b *testing.B) {
+	prime := CurveBN254.Prime()
+	v := new(big.Int).Rand(rand.New(rand.NewSource(1)), prime)
+	le := montgomeryLE(v, 4)
+	b.Run("reducer", func(b *testing.B) {
+		r := newMontgomeryReducer(prime, 4)
+		var z big.Int
+		for i := 0; i < b.N; i++ {
+			r.reduce(&z, le)
+		}
+	})
+	b.Run("big.Int", func(b *testing.B) {
+		var codec LimbCodec
+		rInv := new(big.Int).Lsh(big.NewInt(1), 256)
+		rInv.ModInverse(rInv, prime)
+		for i := 0; i < b.N; i++ {
+			z := codec.Decode(le)
+			z.Mul(z, rInv)
+			z.Mod(z, prime)
+		}
+	})
+}
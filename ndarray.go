@@ -0,0 +1,46 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// NDArray is a multi-dimensional input signal array with an explicit shape.
+// Values are stored in row-major order, which is the order in which circom
+// lays out the elements of a signal array.
+type NDArray struct {
+	Shape  []int
+	Values []*big.Int
+}
+
+// NewNDArray creates an NDArray checking that the number of values matches
+// the shape.
+func NewNDArray(shape []int, values []*big.Int) (*NDArray, error) {
+	a := &NDArray{Shape: shape, Values: values}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Size returns the number of elements described by the shape.
+func (a *NDArray) Size() int {
+	size := 1
+	for _, d := range a.Shape {
+		size *= d
+	}
+	return size
+}
+
+// validate checks that the dimensions are valid and match the number of values.
+func (a *NDArray) validate() error {
+	for i, d := range a.Shape {
+		if d <= 0 {
+			return fmt.Errorf("invalid dimension %d at position %d of shape %v", d, i, a.Shape)
+		}
+	}
+	if len(a.Values) != a.Size() {
+		return fmt.Errorf("shape %v requires %d values, got %d", a.Shape, a.Size(), len(a.Values))
+	}
+	return nil
+}
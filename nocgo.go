@@ -0,0 +1,21 @@
+//go:build !cgo && !js
+// +build !cgo,!js
+
+package witnesscalc
+
+import "errors"
+
+// errNoCgo is the error of the circom 1 calculators built without cgo: wasm3,
+// their runtime, is a cgo binding, while the circom 2 modules fall back to
+// wazero.
+var errNoCgo = errors.New("the circom 1 WitnessCalc WASM runtime requires cgo (built with CGO_ENABLED=0)")
+
+// readCircom1ModuleInfo fails, as circom 1 modules need the wasm3 runtime.
+func readCircom1ModuleInfo(wasmBytes []byte) (ModuleInfo, error) {
+	return ModuleInfo{}, errNoCgo
+}
+
+// loadCircom1Calculator fails, as circom 1 modules need the wasm3 runtime.
+func loadCircom1Calculator(wasmBytes []byte, opts []Option) (Calculator, error) {
+	return nil, errNoCgo
+}
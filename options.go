@@ -0,0 +1,433 @@
+package witnesscalc
+
+import (
+	"io"
+	"math/big"
+	"runtime"
+)
+
+const (
+	// defaultStackSize is the initial wasm3 stack size of the runtimes owned
+	// by a WitnessCalculator.
+	defaultStackSize = 64 * 1024
+	// defaultMaxStackSize is the largest wasm3 stack size a WitnessCalculator
+	// grows its runtime to on stack overflows.
+	defaultMaxStackSize = 16 * 1024 * 1024
+)
+
+// Option configures a WitnessCalculator or a Circom2WitnessCalculator at
+// construction time.
+type Option func(*options)
+
+// options holds the configuration shared by the witness calculators.
+type options struct {
+	memoryMinPages  uint32
+	memoryMaxPages  uint32
+	memoryLimitsSet bool
+	preGrowMemory   bool
+	stackSize       uint
+	maxStackSize    uint
+	lintInputs      bool
+	binaryInputs    []string
+	recorder        io.Writer
+	checksum        func(Checksum)
+	symbols         []Symbol
+	signalSizes     map[SignalID]int // by symbols
+	crashDumpDir    string
+	componentTree   bool
+	stats           func(Stats)
+	statsSink       StatsSink
+	tracer          Tracer
+	curve           Curve
+	circuitName     string
+	circuitLogs     bool
+	partialWitness  bool
+	importMode      ImportMode
+	releaseMode     bool
+	sanityCheck     bool
+	batchMontgomery bool
+	layoutRecord    *LayoutManifest
+	layoutCheck     *LayoutManifest
+	wtnsCircuitHash bool
+	postprocess     func(i int, v *big.Int) error
+	strictInputs    bool
+	inputSchema     InputSchema
+	extractWorkers  int
+	inputSignals    map[string]int
+	missingInputs   MissingInputMode
+	missingInputFn  MissingInputFunc
+	requireInputs   bool
+}
+
+// defaultOptions returns the configuration used when no Option is given.
+func defaultOptions() options {
+	return options{
+		memoryMinPages: 2000,
+		memoryMaxPages: 100000,
+		stackSize:      defaultStackSize,
+		maxStackSize:   defaultMaxStackSize,
+	}
+}
+
+// newOptions applies opts on top of the default configuration.
+func newOptions(opts []Option) options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithMemoryLimits sets the minimum and maximum number of 64KiB pages of the
+// WASM linear memory.  It applies to the memory created by
+// Circom2WitnessCalculator and to the runtime created by
+// LoadWitnessCalculator, which is resized to minPages (wasm3 has no maximum).
+// The runtime given to NewWitnessCalculator is sized by the caller.
+func WithMemoryLimits(minPages, maxPages uint32) Option {
+	return func(o *options) {
+		o.memoryMinPages = minPages
+		o.memoryMaxPages = maxPages
+		o.memoryLimitsSet = true
+	}
+}
+
+// WithMemoryPregrow makes the WitnessCalculator grow the runtime memory to
+// EstimateMemory when it is created, instead of letting the WASM module grow it
+// page by page during the calculations.  It has no effect on runtimes that
+// can't be resized from the host.
+func WithMemoryPregrow() Option {
+	return func(o *options) {
+		o.preGrowMemory = true
+	}
+}
+
+// WithStackSize sets the initial stack size in bytes of the wasm3 runtime
+// created by LoadWitnessCalculator.  Defaults to 64KiB.
+func WithStackSize(size uint) Option {
+	return func(o *options) {
+		o.stackSize = size
+	}
+}
+
+// WithMaxStackSize sets the largest stack size in bytes the runtime created by
+// LoadWitnessCalculator is grown to when a calculation traps with a stack
+// overflow.  Defaults to 16MiB.  A value lower than twice the stack size
+// disables the retries.
+func WithMaxStackSize(size uint) Option {
+	return func(o *options) {
+		o.maxStackSize = size
+	}
+}
+
+// WithInputLinting enables a check of the inputs before every calculation
+// that logs a warning for each value that is likely to produce an invalid
+// witness (see LintInputs).  binaryInputs lists the inputs that must only hold
+// 0 or 1 on top of the ones guessed from their names.
+func WithInputLinting(binaryInputs ...string) Option {
+	return func(o *options) {
+		o.lintInputs = true
+		o.binaryInputs = binaryInputs
+	}
+}
+
+// WithRecorder makes the WitnessCalculator write to w, for every calculation,
+// the exact ordered sequence of signal assignments passed to the WASM module,
+// so that the calculation can be reproduced with Replay.  Calculators sharing
+// w, e.g. the calculators of a pool, write their recordings one at a time.
+func WithRecorder(w io.Writer) Option {
+	return func(o *options) {
+		o.recorder = w
+	}
+}
+
+// WithChecksum makes the calculators pass to f the Checksum of every witness
+// they calculate, before returning it, so that it can be sent along with the
+// witness to the prover.
+func WithChecksum(f func(Checksum)) Option {
+	return func(o *options) {
+		o.checksum = f
+	}
+}
+
+// WithSymbols gives the WitnessCalculator the symbols of the circuit (see
+// ParseSym), used to name the signals in the errors reported by the module,
+// to accept indexed input names like "main.in[0]" (see NormalizeInputs) and
+// to reject the inputs with more values than their signals (see
+// ErrTooManyValues).
+func WithSymbols(syms []Symbol) Option {
+	sizes := symSignalSizes(syms)
+	return func(o *options) {
+		o.symbols = syms
+		o.signalSizes = sizes
+	}
+}
+
+// WithCrashDump makes the WitnessCalculator write, when a calculation fails,
+// the WASM linear memory, the free memory pointer, the inputs and the error
+// into a new subdirectory of dir, for offline debugging.  Failures that are
+// retried with a bigger stack are not dumped.
+func WithCrashDump(dir string) Option {
+	return func(o *options) {
+		o.crashDumpDir = dir
+	}
+}
+
+// WithComponentTree makes the WitnessCalculator record the components started
+// and finished by the module during every calculation, to build the
+// ComponentTree returned by its ComponentTree method.  The module only reports
+// the components of calculations with sanityCheck enabled.  The names and
+// signal ranges of the components are taken from WithSymbols.
+func WithComponentTree() Option {
+	return func(o *options) {
+		o.componentTree = true
+	}
+}
+
+// WithStats makes the calculators pass to f the Stats of every successful
+// witness calculation.
+func WithStats(f func(Stats)) Option {
+	return func(o *options) {
+		o.stats = f
+	}
+}
+
+// WithStatsSink makes the calculators record the Stats of every successful
+// witness calculation into sink, with the circuit name given with
+// WithCircuitName.  The errors of the sink are logged.
+func WithStatsSink(sink StatsSink) Option {
+	return func(o *options) {
+		o.statsSink = sink
+	}
+}
+
+// WithTracer makes the calculators record with t the spans of the loading of
+// their module (SpanLoad) and of every witness calculation (SpanCalculate),
+// with the spans of its phases: SpanInit, SpanSetInputs, which includes the
+// execution of the circuit, and SpanExtract.  The spans of
+// CalculateWitnessAsync are children of the span of its context; the others
+// are roots unless the Tracer parents them, e.g. to the span of the request
+// being proved.
+func WithTracer(t Tracer) Option {
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
+// WithCurve makes the calculators fail at creation if the prime of the
+// circuit isn't the one of the scalar field of the curve, to prevent proving
+// on an unexpected field.
+func WithCurve(c Curve) Option {
+	return func(o *options) {
+		o.curve = c
+	}
+}
+
+// WithCircuitName sets the name of the circuit in the logs of the calculators,
+// e.g. in the values logged by the log() statements of the circuit.
+func WithCircuitName(name string) Option {
+	return func(o *options) {
+		o.circuitName = name
+	}
+}
+
+// WithCircuitLogs makes the calculators collect the values logged by the
+// log() statements of the circuit during every calculation, returned by their
+// CircuitLogs method, e.g. for assertions in tests.
+func WithCircuitLogs() Option {
+	return func(o *options) {
+		o.circuitLogs = true
+	}
+}
+
+// WithPartialWitness makes the calculations with sanityCheck enabled that are
+// aborted by the module return a *PartialWitnessError holding the witness
+// computed until the failure, to speed up the debugging of constraint
+// failures.
+func WithPartialWitness() Option {
+	return func(o *options) {
+		o.partialWitness = true
+	}
+}
+
+// WithImportMode sets how the calculators handle the imports of the WASM
+// module that they don't provide.  Defaults to ImportsStrict.
+func WithImportMode(mode ImportMode) Option {
+	return func(o *options) {
+		o.importMode = mode
+	}
+}
+
+// WithReleaseMode makes the calculators stub the logging and debugging
+// imports of the module, the ones it actually imports, instead of attaching
+// the functions that log and profile the circuit: the circom 1 modules loaded
+// by LoadWitnessCalculator get native wasm3 functions, which the calls don't
+// leave the interpreter for, and the circom 2 modules functions that only
+// return.  It cuts the overhead of the circuits calling them for every signal
+// and component, but the circuit logs (WithCircuitLogs) and the component
+// tree (WithComponentTree) are not collected.
+func WithReleaseMode() Option {
+	return func(o *options) {
+		o.releaseMode = true
+	}
+}
+
+// WithDefaultSanityCheck sets whether the calculation methods without a
+// sanityCheck argument, like Calculate, run the sanity checks of the module,
+// which verify the assignments of the signals and the constraints they carry.
+// It defaults to false: the checks cost ~10% of the calculation time of the
+// smtverifier10 and mycircuit circom 1 test circuits (see
+// BenchmarkSanityCheck), and are best enabled while developing a circuit.
+func WithDefaultSanityCheck(enabled bool) Option {
+	return func(o *options) {
+		o.sanityCheck = enabled
+	}
+}
+
+// WithBatchMontgomery makes the circom 1 WitnessCalculator convert the
+// witness values out of the Montgomery form in a single pass, reducing their
+// 64 bit limbs straight from the runtime memory instead of multiplying each
+// value by R^-1 with big.Int arithmetic, ~8x faster per BN254 value (see
+// BenchmarkMontgomeryReducer).  It has no effect on circom 2
+// calculators, whose modules return the values in normal form.
+func WithBatchMontgomery() Option {
+	return func(o *options) {
+		o.batchMontgomery = true
+	}
+}
+
+// WithLayoutRecord makes the circom 1 WitnessCalculator record the memory
+// layout seen by its calculations in m, to be asserted by later runs with
+// WithLayoutCheck.  The signal offsets of all the calculations are merged.
+func WithLayoutRecord(m *LayoutManifest) Option {
+	return func(o *options) {
+		o.layoutRecord = m
+	}
+}
+
+// WithLayoutCheck makes the calculations of the circom 1 WitnessCalculator
+// fail with a *LayoutError when the memory layout doesn't match the manifest
+// m recorded with WithLayoutRecord.  Inputs missing in m are not checked.
+// It is meant for debugging: it adds a map lookup per input signal.
+func WithLayoutCheck(m *LayoutManifest) Option {
+	return func(o *options) {
+		o.layoutCheck = m
+	}
+}
+
+// WithCircuitHashInWTNS makes the calculators embed the CircuitHash of their
+// module in the wtns files they write, in a section ignored by snarkjs (see
+// WTNSHeader.CircuitHash).  It has no effect when the hash is unknown, like
+// for the WitnessCalculators created from a runtime with NewWitnessCalculator.
+func WithCircuitHashInWTNS() Option {
+	return func(o *options) {
+		o.wtnsCircuitHash = true
+	}
+}
+
+// WithPostprocess makes the calculators call f with every value of the
+// witnesses they load as values (CalculateWitness and its variants), in
+// witness order, as it is extracted from the module, e.g. to range check,
+// log masked or hash the values without a second pass over the witness.  v is
+// the value of the witness: f must not modify it.  An error of f fails the
+// calculation.  The binary encodings copied out of the module memory, like
+// CalculateBinWitness, don't call f.
+func WithPostprocess(f func(i int, v *big.Int) error) Option {
+	return func(o *options) {
+		o.postprocess = f
+	}
+}
+
+// WithStrictInputs makes the calculators reject the inputs with values of
+// unsupported types, like float64 or string, with an InputTypeError locating
+// the value, e.g. "inputs[b][2]: unsupported type float64", before any of
+// them is written to the module.  Go integers and Go arrays are accepted and
+// converted to *big.Int and slices.  See CheckInputTypes.
+func WithStrictInputs() Option {
+	return func(o *options) {
+		o.strictInputs = true
+	}
+}
+
+// WithInputSchema makes the calculators coerce the inputs of every
+// calculation to the field elements of the types declared by schema, like
+// InputSchema.Coerce with the prime of the circuit, before any other check of
+// the inputs, rejecting the inputs not in the schema and the values that
+// can't be converted exactly.
+func WithInputSchema(schema InputSchema) Option {
+	return func(o *options) {
+		o.inputSchema = schema
+	}
+}
+
+// WithParallelExtraction makes the circom 1 WitnessCalculator load the
+// witnesses of CalculateWitness from the witness buffer of the module
+// (getWitnessBuffer), copied out of the runtime memory with a single call,
+// and convert its values to *big.Int on up to workers goroutines, or
+// GOMAXPROCS goroutines if workers is not positive, instead of reading the
+// values one at a time.  The conversion dominates the extraction of
+// witnesses of millions of values; small witnesses are converted on fewer
+// goroutines.  The WithPostprocess hook is still called in witness order,
+// after the conversion.
+//
+// The buffer holds the first signals of the module, which are the witness
+// only for circuits without optimized signals: the first witness is
+// extracted one value at a time and compared with the buffer, and the
+// calculator keeps extracting the values one at a time if they differ.  The
+// module builds the buffer over its signals, so SampleWitness returns
+// ErrNoWitness after a witness is loaded from it.
+func WithParallelExtraction(workers int) Option {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return func(o *options) {
+		o.extractWorkers = workers
+	}
+}
+
+// WithInputSignals declares the input signals of the circuit, with their
+// number of elements by name, for the calculators to find the inputs missing
+// from a calculation (see WithMissingInputs).  They can be read from the
+// symbols and the r1cs file of the circuit with InputSignals.  The circom 2
+// calculators given the symbols with WithSymbols look them up in the module
+// when they aren't declared; the circom 1 calculators only know the declared
+// inputs.
+func WithInputSignals(sizes map[string]int) Option {
+	return func(o *options) {
+		o.inputSignals = sizes
+	}
+}
+
+// WithMissingInputs sets how the calculators handle the input signals of the
+// circuit missing from the inputs of a calculation, by default an
+// ErrMissingInputs error naming them.  The circom 1 modules would otherwise
+// calculate the witness with the missing signals set to zero, which fails
+// proving later.  The inputs of the circuit must be known, see
+// WithInputSignals; without them the circom 2 calculators still fail the
+// calculations missing input values, and the circom 1 calculators don't
+// detect them.
+func WithMissingInputs(mode MissingInputMode) Option {
+	return func(o *options) {
+		o.missingInputs = mode
+	}
+}
+
+// WithMissingInputFunc makes the calculators set the input signals of the
+// circuit missing from the inputs of a calculation to the values returned by
+// fn, e.g. defaults read from a configuration, instead of handling them as
+// set with WithMissingInputs.  The calculation fails with the errors of fn.
+func WithMissingInputFunc(fn MissingInputFunc) Option {
+	return func(o *options) {
+		o.missingInputFn = fn
+	}
+}
+
+// WithRequireInputs makes the calculations given a nil or empty inputs map
+// fail with ErrNoInputs, instead of logging a warning, when the inputs of the
+// circuit are unknown: the modules would calculate a witness of default
+// values.  The calculators that know the inputs of the circuit (see
+// WithInputSignals) report them missing instead.
+func WithRequireInputs() Option {
+	return func(o *options) {
+		o.requireInputs = true
+	}
+}
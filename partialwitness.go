@@ -0,0 +1,37 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// PartialWitnessError is returned, with WithPartialWitness, by the witness
+// calculations with sanityCheck enabled that are aborted by the module while
+// setting the inputs, e.g. on a constraint that doesn't match.  Witness holds
+// the signals as they were at the failure, to inspect which of them were
+// already assigned; the signals not assigned yet hold zero, or their value
+// from a previous calculation.
+type PartialWitnessError struct {
+	Err     error
+	Witness []*big.Int
+}
+
+// Error returns the message of the error that aborted the calculation.
+func (e *PartialWitnessError) Error() string {
+	return fmt.Sprintf("%v (partial witness of %d signals available)", e.Err, len(e.Witness))
+}
+
+// Unwrap returns the error that aborted the calculation.
+func (e *PartialWitnessError) Unwrap() error {
+	return e.Err
+}
+
+// newPartialWitnessError returns a PartialWitnessError for err with the
+// witness read by loadWitness, or err if the witness can't be read.
+func newPartialWitnessError(err error, loadWitness func() ([]*big.Int, error)) error {
+	w, loadErr := loadWitness()
+	if loadErr != nil {
+		return err
+	}
+	return &PartialWitnessError{Err: err, Witness: w}
+}
@@ -0,0 +1,316 @@
+package witnesscalc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+)
+
+// ErrPoolClosed is the error of the Get calls of a closed CalculatorPool.
+var ErrPoolClosed = errors.New("calculator pool closed")
+
+// CalculatorFactory creates a calculator of a CalculatorPool: it parses,
+// loads and initializes the WitnessCalc WASM module.
+type CalculatorFactory func() (Calculator, error)
+
+// PoolConfig sizes a CalculatorPool.
+type PoolConfig struct {
+	// MinIdle is the number of idle calculators the pool keeps ready,
+	// creating them in the background when it is created and when Get takes
+	// them, so that requests don't pay the load latency of the module.
+	MinIdle int
+	// MaxSize bounds the calculators of the pool, idle, in use or being
+	// created; Get waits for one to be returned when it is reached.  Zero
+	// means no bound.
+	MaxSize int
+	// IdleTimeout is how long the idle calculators above MinIdle are kept
+	// before they are evicted.  Zero keeps them until the pool is closed.
+	IdleTimeout time.Duration
+}
+
+// PoolStats holds the state and the metrics of a CalculatorPool.
+type PoolStats struct {
+	Idle     int // idle calculators
+	InUse    int // calculators taken by Get and not returned yet
+	Creating int // calculators being created
+	Created  int // calculators created
+	Failures int // failed creations
+	Evicted  int // idle calculators evicted after IdleTimeout
+	Waits    int // Get calls that waited for a calculator
+}
+
+// pooledCalculator is an idle calculator of a CalculatorPool.
+type pooledCalculator struct {
+	calc  Calculator
+	since time.Time
+}
+
+// CalculatorPool holds calculators of a circuit for concurrent calculations:
+// every calculator is used by one goroutine at a time, between a Get and the
+// Put that returns it.  The pool pre-warms MinIdle calculators in the
+// background and grows up to MaxSize on demand.  It is safe for concurrent
+// use.
+type CalculatorPool struct {
+	newCalc CalculatorFactory
+	cfg     PoolConfig
+
+	mu    sync.Mutex
+	idle  []pooledCalculator
+	stats PoolStats
+	// changed is closed and replaced when a calculator is returned or
+	// created, or a creation fails, to wake up the waiting Get calls.
+	changed chan struct{}
+	closed  bool
+
+	// warm triggers the pre-warming of the background goroutine, which exits
+	// when done is closed.
+	warm chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewCalculatorPool creates a CalculatorPool of the calculators created by
+// newCalc and starts pre-warming it.  Close must be called to stop the
+// background goroutine and release the idle calculators.
+func NewCalculatorPool(newCalc CalculatorFactory, cfg PoolConfig) *CalculatorPool {
+	p := &CalculatorPool{
+		newCalc: newCalc,
+		cfg:     cfg,
+		changed: make(chan struct{}),
+		warm:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.run()
+	p.triggerWarm()
+	return p
+}
+
+// NewCircom2CalculatorPool creates a CalculatorPool of Circom2WitnessCalculators
+// of the WitnessCalc WASM module, created with opts.
+func NewCircom2CalculatorPool(wasmBytes []byte, cfg PoolConfig, opts ...Option) *CalculatorPool {
+	// Decompressed once for all the calculators; the errors are returned by
+	// their creations.
+	if b, err := DecompressWASM(wasmBytes); err == nil {
+		wasmBytes = b
+	}
+	return NewCalculatorPool(func() (Calculator, error) {
+		return NewCircom2WitnessCalculator(wasmBytes, opts...)
+	}, cfg)
+}
+
+// Get takes an idle calculator, creating one if there is none and MaxSize
+// isn't reached, or waits for one to be returned until ctx is done.  The
+// calculator must be returned with Put.
+func (p *CalculatorPool) Get(ctx context.Context) (Calculator, error) {
+	waited := false
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if n := len(p.idle); n > 0 {
+			c := p.idle[n-1].calc
+			p.idle = p.idle[:n-1]
+			p.stats.InUse++
+			p.mu.Unlock()
+			p.triggerWarm()
+			return c, nil
+		}
+		if !p.full() {
+			break
+		}
+		if !waited {
+			waited = true
+			p.stats.Waits++
+		}
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		p.mu.Lock()
+	}
+	p.stats.Creating++
+	p.mu.Unlock()
+
+	c, err := p.newCalc()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Creating--
+	if err != nil {
+		p.stats.Failures++
+		p.notify()
+		return nil, err
+	}
+	p.stats.Created++
+	p.stats.InUse++
+	p.triggerWarm()
+	return c, nil
+}
+
+// Put returns the calculator c, taken with Get, to the pool.  The calculators
+// returned to a closed pool are closed.
+func (p *CalculatorPool) Put(c Calculator) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.InUse--
+	if p.closed {
+		closeCalculator(c)
+		return
+	}
+	p.idle = append(p.idle, pooledCalculator{calc: c, since: time.Now()})
+	p.notify()
+}
+
+// CalculateWitness calculates the witness given the inputs with a calculator
+// of the pool.
+func (p *CalculatorPool) CalculateWitness(ctx context.Context, inputs map[string]interface{}, sanityCheck bool) (*Witness, error) {
+	c, err := p.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Put(c)
+	return c.CalculateWitness(inputs, sanityCheck)
+}
+
+// Stats returns the state and the metrics of the pool.
+func (p *CalculatorPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.Idle = len(p.idle)
+	return s
+}
+
+// Close stops the pre-warming and the eviction and closes the idle
+// calculators.  The calculators in use are closed when they are returned.
+func (p *CalculatorPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.notify()
+	p.mu.Unlock()
+
+	close(p.done)
+	p.wg.Wait()
+	for _, c := range idle {
+		closeCalculator(c.calc)
+	}
+}
+
+// full returns whether the pool has MaxSize calculators.  p.mu must be held.
+func (p *CalculatorPool) full() bool {
+	return p.cfg.MaxSize > 0 && len(p.idle)+p.stats.InUse+p.stats.Creating >= p.cfg.MaxSize
+}
+
+// notify wakes up the waiting Get calls.  p.mu must be held.
+func (p *CalculatorPool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// triggerWarm makes the background goroutine create the missing idle
+// calculators.
+func (p *CalculatorPool) triggerWarm() {
+	select {
+	case p.warm <- struct{}{}:
+	default:
+	}
+}
+
+// run is the background goroutine of the pool, which pre-warms it and
+// evicts the idle calculators.
+func (p *CalculatorPool) run() {
+	defer p.wg.Done()
+	var evict <-chan time.Time
+	if p.cfg.IdleTimeout > 0 {
+		ticker := time.NewTicker(p.cfg.IdleTimeout / 2)
+		defer ticker.Stop()
+		evict = ticker.C
+	}
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.warm:
+			p.prewarm()
+		case now := <-evict:
+			p.evict(now)
+		}
+	}
+}
+
+// prewarm creates idle calculators, one at a time, until the pool has
+// MinIdle of them or MaxSize calculators.
+func (p *CalculatorPool) prewarm() {
+	for {
+		p.mu.Lock()
+		if p.closed || len(p.idle) >= p.cfg.MinIdle || p.full() {
+			p.mu.Unlock()
+			return
+		}
+		p.stats.Creating++
+		p.mu.Unlock()
+
+		start := time.Now()
+		c, err := p.newCalc()
+
+		p.mu.Lock()
+		p.stats.Creating--
+		if err != nil {
+			p.stats.Failures++
+			p.notify()
+			p.mu.Unlock()
+			// Retried on the next Get, instead of looping on a broken module.
+			log.Warn("Pre-warming calculator failed", "err", err)
+			return
+		}
+		p.stats.Created++
+		if p.closed {
+			p.mu.Unlock()
+			closeCalculator(c)
+			return
+		}
+		p.idle = append(p.idle, pooledCalculator{calc: c, since: time.Now()})
+		p.notify()
+		p.mu.Unlock()
+		log.Debug("Pre-warmed calculator", "elapsed", time.Since(start))
+	}
+}
+
+// evict closes the idle calculators above MinIdle that have been idle for
+// IdleTimeout at now, the least recently used first.
+func (p *CalculatorPool) evict(now time.Time) {
+	p.mu.Lock()
+	var evicted []Calculator
+	// p.idle is in the order the calculators were returned.
+	for len(p.idle) > p.cfg.MinIdle && now.Sub(p.idle[0].since) >= p.cfg.IdleTimeout {
+		evicted = append(evicted, p.idle[0].calc)
+		p.idle = p.idle[1:]
+	}
+	p.stats.Evicted += len(evicted)
+	p.mu.Unlock()
+	for _, c := range evicted {
+		closeCalculator(c)
+	}
+}
+
+// closeCalculator releases the runtime of c, if it has one to release.
+func closeCalculator(c Calculator) {
+	if closer, ok := c.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
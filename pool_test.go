@@ -0,0 +1,119 @@
+package witnesscalc
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// poolTestCalculator is a Calculator counting its calculations and closes.
+type poolTestCalculator struct {
+	calcs  int32
+	closes *int32
+}
+
+func (c *poolTestCalculator) CalculateWitness(inputs map[string]interface{}, sanityCheck bool) (*Witness, error) {
+	atomic.AddInt32(&c.calcs, 1)
+	return NewWitness([]*big.Int{big.NewInt(1)}, bn254), nil
+}
+
+func (c *poolTestCalculator) CalculateBinWitness(inputs map[string]interface{}, sanityCheck bool) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *poolTestCalculator) Close() {
+	atomic.AddInt32(c.closes, 1)
+}
+
+// waitPoolStats waits until the stats of the pool satisfy cond.
+func waitPoolStats(t *testing.T, p *CalculatorPool, cond func(PoolStats) bool) {
+	require.Eventually(t, func() bool {
+		return cond(p.Stats())
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestCalculatorPool(t *testing.T) {
+	var creations, closes int32
+	p := NewCalculatorPool(func() (Calculator, error) {
+		atomic.AddInt32(&creations, 1)
+		return &poolTestCalculator{closes: &closes}, nil
+	}, PoolConfig{MinIdle: 2, MaxSize: 3})
+
+	// The pool is pre-warmed in the background.
+	waitPoolStats(t, p, func(s PoolStats) bool { return s.Idle == 2 })
+	ctx := context.Background()
+	c1, err := p.Get(ctx)
+	require.NoError(t, err)
+	waitPoolStats(t, p, func(s PoolStats) bool { return s.Idle == 2 && s.InUse == 1 })
+	require.Equal(t, int32(3), atomic.LoadInt32(&creations))
+
+	// MaxSize is reached: Get waits for Put.
+	c2, err := p.Get(ctx)
+	require.NoError(t, err)
+	c3, err := p.Get(ctx)
+	require.NoError(t, err)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(timeout)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	got := make(chan Calculator)
+	go func() {
+		c, _ := p.Get(ctx)
+		got <- c
+	}()
+	waitPoolStats(t, p, func(s PoolStats) bool { return s.Waits == 2 })
+	p.Put(c2)
+	require.Equal(t, c2, <-got)
+
+	p.Put(c1)
+	w, err := p.CalculateWitness(ctx, nil, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, w.Len())
+	require.Equal(t, int32(1), c1.(*poolTestCalculator).calcs)
+
+	stats := p.Stats()
+	require.Equal(t, PoolStats{Idle: 1, InUse: 2, Created: 3}, PoolStats{
+		Idle: stats.Idle, InUse: stats.InUse, Created: stats.Created})
+
+	p.Close()
+	require.Equal(t, int32(1), atomic.LoadInt32(&closes))
+	_, err = p.Get(ctx)
+	require.True(t, errors.Is(err, ErrPoolClosed))
+	p.Put(c2)
+	p.Put(c3)
+	require.Equal(t, int32(3), atomic.LoadInt32(&closes))
+}
+
+func TestCalculatorPoolEviction(t *testing.T) {
+	var closes int32
+	p := NewCalculatorPool(func() (Calculator, error) {
+		return &poolTestCalculator{closes: &closes}, nil
+	}, PoolConfig{MinIdle: 1, IdleTimeout: 10 * time.Millisecond})
+	defer p.Close()
+
+	ctx := context.Background()
+	c1, err := p.Get(ctx)
+	require.NoError(t, err)
+	c2, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(c1)
+	p.Put(c2)
+	waitPoolStats(t, p, func(s PoolStats) bool { return s.Evicted >= 1 && s.Idle == 1 })
+}
+
+func TestCalculatorPoolFailures(t *testing.T) {
+	p := NewCalculatorPool(func() (Calculator, error) {
+		return nil, errors.New("broken module")
+	}, PoolConfig{MinIdle: 1})
+	defer p.Close()
+
+	waitPoolStats(t, p, func(s PoolStats) bool { return s.Failures == 1 })
+	_, err := p.Get(context.Background())
+	require.EqualError(t, err, "broken module")
+	require.Equal(t, 0, p.Stats().InUse)
+}
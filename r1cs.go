@@ -0,0 +1,417 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// r1cs section types
+const (
+	r1csSectionHeader      = 1
+	r1csSectionConstraints = 2
+	r1csSectionWire2Label  = 3
+)
+
+// CircuitHeader is the header of a circom r1cs file, describing the layout of
+// the witness: [1, public outputs, public inputs, private inputs, internal
+// signals].
+type CircuitHeader struct {
+	// FieldSize is the size in bytes of a field element.
+	FieldSize    uint32
+	Prime        *big.Int
+	NWires       uint32
+	NPubOut      uint32
+	NPubIn       uint32
+	NPrvIn       uint32
+	NLabels      uint64
+	NConstraints uint32
+}
+
+// NPublic returns the number of public signals (outputs and inputs).
+func (h *CircuitHeader) NPublic() int {
+	return int(h.NPubOut + h.NPubIn)
+}
+
+// NInputs returns the number of input signals (public and private).
+func (h *CircuitHeader) NInputs() int {
+	return int(h.NPubIn + h.NPrvIn)
+}
+
+// CheckInputs checks that the inputs hold as many values as input signals the
+// circuit has.
+func (h *CircuitHeader) CheckInputs(inputs map[string]interface{}) error {
+	n := 0
+	for inputName, inputValue := range inputs {
+		fSlice, err := FlattenSignal(inputValue)
+		if err != nil {
+			return fmt.Errorf("input %s: %w", inputName, err)
+		}
+		n += len(fSlice)
+	}
+	if n != h.NInputs() {
+		return fmt.Errorf("inputs have %d values, the circuit has %d input signals", n, h.NInputs())
+	}
+	return nil
+}
+
+// CheckWitness checks that the witness has one value per wire, starting with
+// the constant 1, and that all values are field elements.
+func (h *CircuitHeader) CheckWitness(w []*big.Int) error {
+	if len(w) != int(h.NWires) {
+		return fmt.Errorf("witness has %d values, the circuit has %d wires", len(w), h.NWires)
+	}
+	if len(w) > 0 && w[0].Cmp(big.NewInt(1)) != 0 {
+		return fmt.Errorf("witness[0] = %v, expected 1", w[0])
+	}
+	for i, v := range w {
+		if v.Sign() < 0 || v.Cmp(h.Prime) >= 0 {
+			return fmt.Errorf("witness[%d] = %v is not a field element", i, v)
+		}
+	}
+	return nil
+}
+
+// SplitWitness splits the witness w following the layout of the circuit h
+// into the constant one, the public outputs, the public inputs and the
+// private inputs.  The slices share the memory of w.
+func SplitWitness(w []*big.Int, h *CircuitHeader) (one *big.Int, publicOutputs, publicInputs, privateInputs []*big.Int, err error) {
+	nOut, nPubIn, nPrvIn := int(h.NPubOut), int(h.NPubIn), int(h.NPrvIn)
+	if n := 1 + nOut + nPubIn + nPrvIn; len(w) < n {
+		return nil, nil, nil, nil, fmt.Errorf("witness has %d values, expected at least %d", len(w), n)
+	}
+	one, w = w[0], w[1:]
+	publicOutputs, w = w[:nOut:nOut], w[nOut:]
+	publicInputs, w = w[:nPubIn:nPubIn], w[nPubIn:]
+	privateInputs = w[:nPrvIn:nPrvIn]
+	return one, publicOutputs, publicInputs, privateInputs, nil
+}
+
+// InputSignals returns the number of elements of the input signals of the
+// main component by name, the signals of syms at the witness positions of
+// the inputs in the layout of the circuit h, for WithInputSignals.
+func InputSignals(syms []Symbol, h *CircuitHeader) map[string]int {
+	start := 1 + int(h.NPubOut)
+	end := start + h.NInputs()
+	sizes := make(map[string]int)
+	for _, sym := range syms {
+		if sym.VarIdx < start || sym.VarIdx >= end {
+			continue
+		}
+		if name, ok := mainSignalName(sym.Name); ok {
+			sizes[name]++
+		}
+	}
+	return sizes
+}
+
+// readR1CSFileHeader reads and validates the r1cs magic, version and number
+// of sections.
+func readR1CSFileHeader(r io.Reader) (uint32, error) {
+	return readBinFileHeader(r, "r1cs", 1)
+}
+
+// readBinFileHeader reads and validates the magic, version and number of
+// sections of the binary files of the circom toolchain.
+func readBinFileHeader(r io.Reader, magic string, version uint32) (uint32, error) {
+	var fileHeader struct {
+		Magic     [4]byte
+		Version   uint32
+		NSections uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &fileHeader); err != nil {
+		return 0, err
+	}
+	if string(fileHeader.Magic[:]) != magic {
+		return 0, fmt.Errorf("invalid %s magic %q", magic, fileHeader.Magic[:])
+	}
+	if fileHeader.Version != version {
+		return 0, fmt.Errorf("unsupported %s version %d", magic, fileHeader.Version)
+	}
+	return fileHeader.NSections, nil
+}
+
+// readSectionHeader reads the type and size of the next section.
+func readSectionHeader(r io.Reader) (uint32, uint64, error) {
+	var sectionHeader struct {
+		Type uint32
+		Size uint64
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sectionHeader); err != nil {
+		return 0, 0, err
+	}
+	return sectionHeader.Type, sectionHeader.Size, nil
+}
+
+// readSection reads the content of a section of size bytes.  The content is
+// buffered as it is read, so that a corrupted size allocates no more than the
+// data left in r.
+func readSection(r io.Reader, size uint64) ([]byte, error) {
+	if size > math.MaxInt64 {
+		return nil, fmt.Errorf("invalid section size %d", size)
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, 512))
+	if _, err := io.CopyN(buf, r, int64(size)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// skipSection skips the content of a section of size bytes.
+func skipSection(r io.Reader, size uint64) error {
+	if size > math.MaxInt64 {
+		return fmt.Errorf("invalid section size %d", size)
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, int64(size)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// parseR1CSHeader parses the content of the r1cs header section.
+func parseR1CSHeader(section []byte) (*CircuitHeader, error) {
+	r := bytes.NewReader(section)
+	var h CircuitHeader
+	if err := binary.Read(r, binary.LittleEndian, &h.FieldSize); err != nil {
+		return nil, err
+	}
+	if h.FieldSize == 0 || h.FieldSize%8 != 0 {
+		return nil, fmt.Errorf("invalid field size %d", h.FieldSize)
+	}
+	if int64(h.FieldSize) > int64(r.Len()) {
+		return nil, fmt.Errorf("field size %d exceeds the header section", h.FieldSize)
+	}
+	primeBytes := make([]byte, h.FieldSize)
+	if _, err := io.ReadFull(r, primeBytes); err != nil {
+		return nil, err
+	}
+	h.Prime = new(big.Int).SetBytes(swap(primeBytes))
+	for _, v := range []interface{}{&h.NWires, &h.NPubOut, &h.NPubIn, &h.NPrvIn,
+		&h.NLabels, &h.NConstraints} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	return &h, nil
+}
+
+// ReadR1CSHeader reads the header of a circom r1cs file.  Sections preceding
+// the header are skipped; r is not read past the header section.
+func ReadR1CSHeader(r io.Reader) (*CircuitHeader, error) {
+	nSections, err := readR1CSFileHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < nSections; i++ {
+		sectionType, size, err := readSectionHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		if sectionType != r1csSectionHeader {
+			if err := skipSection(r, size); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		section, err := readSection(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return parseR1CSHeader(section)
+	}
+	return nil, fmt.Errorf("r1cs header section not found")
+}
+
+// Term is a term of a LinearCombination: Coeff × w[Wire].
+type Term struct {
+	Wire  uint32
+	Coeff *big.Int
+}
+
+// LinearCombination is a linear combination of witness values.
+type LinearCombination []Term
+
+// Eval evaluates the linear combination on the witness w modulo prime.
+func (lc LinearCombination) Eval(w []*big.Int, prime *big.Int) (*big.Int, error) {
+	res := new(big.Int)
+	tmp := new(big.Int)
+	for _, t := range lc {
+		if int64(t.Wire) >= int64(len(w)) {
+			return nil, fmt.Errorf("wire %d out of the witness (%d values)", t.Wire, len(w))
+		}
+		res.Add(res, tmp.Mul(t.Coeff, w[t.Wire]))
+	}
+	return res.Mod(res, prime), nil
+}
+
+// Constraint is a R1CS constraint: A·w × B·w = C·w.
+type Constraint struct {
+	A, B, C LinearCombination
+}
+
+// Wires returns the wires involved in the constraint, in increasing order.
+func (c *Constraint) Wires() []uint32 {
+	seen := make(map[uint32]bool)
+	var wires []uint32
+	for _, lc := range []LinearCombination{c.A, c.B, c.C} {
+		for _, t := range lc {
+			if !seen[t.Wire] {
+				seen[t.Wire] = true
+				wires = append(wires, t.Wire)
+			}
+		}
+	}
+	sort.Slice(wires, func(i, j int) bool { return wires[i] < wires[j] })
+	return wires
+}
+
+// ConstraintError is the error of VerifyConstraints for a constraint that the
+// witness doesn't satisfy.
+type ConstraintError struct {
+	// Index is the position of the constraint in the r1cs file.
+	Index      int
+	Constraint Constraint
+	// A, B and C are the evaluations of the linear combinations.
+	A, B, C *big.Int
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("constraint %d not satisfied: A·w × B·w = %v × %v, C·w = %v",
+		e.Index, e.A, e.B, e.C)
+}
+
+// VerifyConstraints checks the witness w with CheckWitness and that it
+// satisfies every constraint of the circuit h, returning a *ConstraintError
+// for the first one that fails.
+func VerifyConstraints(h *CircuitHeader, constraints []Constraint, w []*big.Int) error {
+	if err := h.CheckWitness(w); err != nil {
+		return err
+	}
+	ab := new(big.Int)
+	for i, c := range constraints {
+		a, err := c.A.Eval(w, h.Prime)
+		if err != nil {
+			return fmt.Errorf("constraint %d: %w", i, err)
+		}
+		b, err := c.B.Eval(w, h.Prime)
+		if err != nil {
+			return fmt.Errorf("constraint %d: %w", i, err)
+		}
+		cv, err := c.C.Eval(w, h.Prime)
+		if err != nil {
+			return fmt.Errorf("constraint %d: %w", i, err)
+		}
+		ab.Mul(a, b)
+		if ab.Mod(ab, h.Prime).Cmp(cv) != 0 {
+			return &ConstraintError{Index: i, Constraint: c, A: a, B: b, C: cv}
+		}
+	}
+	return nil
+}
+
+// parseR1CSConstraints parses the content of the r1cs constraints section of
+// the circuit h.
+func parseR1CSConstraints(section []byte, h *CircuitHeader) ([]Constraint, error) {
+	if int64(h.FieldSize) > int64(len(section)) && h.NConstraints > 0 {
+		return nil, fmt.Errorf("field size %d exceeds the constraints section", h.FieldSize)
+	}
+	r := bytes.NewReader(section)
+	coeffBytes := make([]byte, h.FieldSize)
+	readLC := func() (LinearCombination, error) {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		if int64(n)*int64(4+h.FieldSize) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		lc := make(LinearCombination, n)
+		for i := range lc {
+			if err := binary.Read(r, binary.LittleEndian, &lc[i].Wire); err != nil {
+				return nil, err
+			}
+			if _, err := io.ReadFull(r, coeffBytes); err != nil {
+				return nil, err
+			}
+			lc[i].Coeff = new(big.Int).SetBytes(swap(coeffBytes))
+		}
+		return lc, nil
+	}
+	// every constraint has at least the number of terms of A, B and C
+	if int64(h.NConstraints)*12 > int64(len(section)) {
+		return nil, fmt.Errorf("section too short for %d constraints", h.NConstraints)
+	}
+	constraints := make([]Constraint, h.NConstraints)
+	for i := range constraints {
+		c := &constraints[i]
+		for _, lc := range []*LinearCombination{&c.A, &c.B, &c.C} {
+			var err error
+			if *lc, err = readLC(); err != nil {
+				return nil, fmt.Errorf("constraint %d: %w", i, err)
+			}
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d bytes after the last constraint", r.Len())
+	}
+	return constraints, nil
+}
+
+// ReadR1CS reads a circom r1cs file, returning its header and constraints.
+func ReadR1CS(r io.Reader) (*CircuitHeader, []Constraint, error) {
+	nSections, err := readR1CSFileHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	var headerSection, constraintsSection []byte
+	for i := uint32(0); i < nSections; i++ {
+		sectionType, size, err := readSectionHeader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		var section *[]byte
+		switch sectionType {
+		case r1csSectionHeader:
+			section = &headerSection
+		case r1csSectionConstraints:
+			section = &constraintsSection
+		default:
+			if err := skipSection(r, size); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if *section != nil {
+			return nil, nil, fmt.Errorf("duplicated r1cs section %d", sectionType)
+		}
+		if *section, err = readSection(r, size); err != nil {
+			return nil, nil, err
+		}
+	}
+	if headerSection == nil {
+		return nil, nil, fmt.Errorf("r1cs header section not found")
+	}
+	if constraintsSection == nil {
+		return nil, nil, fmt.Errorf("r1cs constraints section not found")
+	}
+	h, err := parseR1CSHeader(headerSection)
+	if err != nil {
+		return nil, nil, err
+	}
+	constraints, err := parseR1CSConstraints(constraintsSection, h)
+	if err != nil {
+		return nil, nil, fmt.Errorf("r1cs constraints: %w", err)
+	}
+	return h, constraints, nil
+}
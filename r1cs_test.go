@@ -0,0 +1,207 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testR1CSHeader is the header of test_files/mycircuit.circom
+func testR1CSHeader(t *testing.T) *CircuitHeader {
+	prime, ok := new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+	require.True(t, ok)
+	return &CircuitHeader{
+		FieldSize:    32,
+		Prime:        prime,
+		NWires:       4,
+		NPubOut:      1,
+		NPubIn:       0,
+		NPrvIn:       2,
+		NLabels:      4,
+		NConstraints: 1,
+	}
+}
+
+// writeTestR1CSHeader encodes an r1cs file with the header h preceded by an
+// empty constraints section.
+func writeTestR1CSHeader(t *testing.T, h *CircuitHeader) []byte {
+	var section bytes.Buffer
+	le := binary.LittleEndian
+	require.Nil(t, binary.Write(&section, le, h.FieldSize))
+	primeBytes := swap(h.Prime.Bytes())
+	section.Write(append(primeBytes, make([]byte, int(h.FieldSize)-len(primeBytes))...))
+	for _, v := range []interface{}{h.NWires, h.NPubOut, h.NPubIn, h.NPrvIn, h.NLabels, h.NConstraints} {
+		require.Nil(t, binary.Write(&section, le, v))
+	}
+
+	var r1cs bytes.Buffer
+	r1cs.WriteString("r1cs")
+	for _, v := range []interface{}{uint32(1), uint32(2),
+		uint32(r1csSectionConstraints), uint64(3), []byte{1, 2, 3},
+		uint32(r1csSectionHeader), uint64(section.Len())} {
+		require.Nil(t, binary.Write(&r1cs, le, v))
+	}
+	r1cs.Write(section.Bytes())
+	return r1cs.Bytes()
+}
+
+func TestReadR1CSHeader(t *testing.T) {
+	expected := testR1CSHeader(t)
+	h, err := ReadR1CSHeader(bytes.NewReader(writeTestR1CSHeader(t, expected)))
+	require.Nil(t, err)
+	assert.Equal(t, expected, h)
+	assert.Equal(t, 1, h.NPublic())
+	assert.Equal(t, 2, h.NInputs())
+
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	require.Nil(t, h.CheckInputs(inputs))
+	require.Error(t, h.CheckInputs(map[string]interface{}{"a": big.NewInt(3)}))
+
+	w := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+	require.Nil(t, h.CheckWitness(w))
+	require.Error(t, h.CheckWitness(w[:3]))
+	require.Error(t, h.CheckWitness([]*big.Int{big.NewInt(1), h.Prime, big.NewInt(3), big.NewInt(11)}))
+
+	_, err = ReadR1CSHeader(bytes.NewReader([]byte("wtns")))
+	require.Error(t, err)
+
+	// A corrupted section size fails without allocating it.
+	r1cs := writeTestR1CSHeader(t, expected)
+	// the file header, the 3 bytes constraints section and the header type
+	headerSize := r1cs[12+15+4 : 12+15+4+8]
+	require.Equal(t, uint64(len(r1cs)-12-15-12), binary.LittleEndian.Uint64(headerSize))
+	for _, size := range []uint64{1 << 40, math.MaxUint64} {
+		binary.LittleEndian.PutUint64(headerSize, size)
+		_, err = ReadR1CSHeader(bytes.NewReader(r1cs))
+		require.Error(t, err)
+		_, _, err = ReadR1CS(bytes.NewReader(r1cs))
+		require.Error(t, err)
+	}
+	binary.LittleEndian.PutUint64(headerSize, 1<<40)
+	_, err = ReadR1CSHeader(bytes.NewReader(r1cs))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// So do the sizes of the skipped sections and of the field elements.
+	r1cs = writeTestR1CSHeader(t, expected)
+	skippedSize := r1cs[12+4 : 12+12]
+	binary.LittleEndian.PutUint64(skippedSize, math.MaxUint64)
+	_, err = ReadR1CSHeader(bytes.NewReader(r1cs))
+	assert.EqualError(t, err, "invalid section size 18446744073709551615")
+	_, _, err = ReadR1CS(bytes.NewReader(r1cs))
+	assert.EqualError(t, err, "invalid section size 18446744073709551615")
+	binary.LittleEndian.PutUint64(skippedSize, 1<<40)
+	_, err = ReadR1CSHeader(bytes.NewReader(r1cs))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	r1cs = writeTestR1CSHeader(t, expected)
+	binary.LittleEndian.PutUint32(r1cs[12+15+12:], 0xfffffff8)
+	_, err = ReadR1CSHeader(bytes.NewReader(r1cs))
+	assert.EqualError(t, err, "field size 4294967288 exceeds the header section")
+}
+
+func TestSplitWitness(t *testing.T) {
+	h := testR1CSHeader(t)
+	h.NPubIn, h.NPrvIn = 1, 1
+	w := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+	one, outputs, pubInputs, prvInputs, err := SplitWitness(w, h)
+	require.Nil(t, err)
+	assert.Equal(t, big.NewInt(1), one)
+	assert.Equal(t, []*big.Int{big.NewInt(33)}, outputs)
+	assert.Equal(t, []*big.Int{big.NewInt(3)}, pubInputs)
+	assert.Equal(t, []*big.Int{big.NewInt(11)}, prvInputs)
+
+	_, _, _, _, err = SplitWitness(w[:3], h)
+	require.Error(t, err)
+}
+
+func TestInputSignals(t *testing.T) {
+	h := testR1CSHeader(t)
+	syms := []Symbol{
+		{LabelIdx: 1, VarIdx: 2, Name: "main.a"},
+		{LabelIdx: 2, VarIdx: 3, Name: "main.b"},
+		{LabelIdx: 3, VarIdx: 1, Name: "main.c"},
+		{LabelIdx: 4, VarIdx: -1, Name: "main.sub.in"},
+	}
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, InputSignals(syms, h))
+
+	h.NPrvIn = 1
+	assert.Equal(t, map[string]int{"a": 1}, InputSignals(syms, h))
+}
+
+// writeTestR1CS encodes an r1cs file with the header h followed by the
+// constraints.
+func writeTestR1CS(t *testing.T, h *CircuitHeader, constraints []Constraint) []byte {
+	le := binary.LittleEndian
+	writeFr := func(b *bytes.Buffer, v *big.Int) {
+		vBytes := swap(v.Bytes())
+		b.Write(append(vBytes, make([]byte, int(h.FieldSize)-len(vBytes))...))
+	}
+	var header bytes.Buffer
+	require.Nil(t, binary.Write(&header, le, h.FieldSize))
+	writeFr(&header, h.Prime)
+	for _, v := range []interface{}{h.NWires, h.NPubOut, h.NPubIn, h.NPrvIn, h.NLabels, h.NConstraints} {
+		require.Nil(t, binary.Write(&header, le, v))
+	}
+	var section bytes.Buffer
+	for _, c := range constraints {
+		for _, lc := range []LinearCombination{c.A, c.B, c.C} {
+			require.Nil(t, binary.Write(&section, le, uint32(len(lc))))
+			for _, term := range lc {
+				require.Nil(t, binary.Write(&section, le, term.Wire))
+				writeFr(&section, term.Coeff)
+			}
+		}
+	}
+
+	var r1cs bytes.Buffer
+	r1cs.WriteString("r1cs")
+	for _, v := range []interface{}{uint32(1), uint32(2),
+		uint32(r1csSectionHeader), uint64(header.Len()), header.Bytes(),
+		uint32(r1csSectionConstraints), uint64(section.Len()), section.Bytes()} {
+		require.Nil(t, binary.Write(&r1cs, le, v))
+	}
+	return r1cs.Bytes()
+}
+
+func TestVerifyConstraints(t *testing.T) {
+	h := testR1CSHeader(t)
+	// c <== a*b, with w = [1, c, a, b]
+	minusOne := new(big.Int).Sub(h.Prime, big.NewInt(1))
+	expected := []Constraint{{
+		A: LinearCombination{{Wire: 2, Coeff: minusOne}},
+		B: LinearCombination{{Wire: 3, Coeff: big.NewInt(1)}},
+		C: LinearCombination{{Wire: 1, Coeff: minusOne}},
+	}}
+	r1cs := writeTestR1CS(t, h, expected)
+	h2, constraints, err := ReadR1CS(bytes.NewReader(r1cs))
+	require.Nil(t, err)
+	assert.Equal(t, h, h2)
+	assert.Equal(t, expected, constraints)
+	assert.Equal(t, []uint32{1, 2, 3}, constraints[0].Wires())
+
+	w := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+	require.Nil(t, VerifyConstraints(h, constraints, w))
+
+	w[1] = big.NewInt(34)
+	err = VerifyConstraints(h, constraints, w)
+	var cErr *ConstraintError
+	require.ErrorAs(t, err, &cErr)
+	assert.Equal(t, 0, cErr.Index)
+	assert.Equal(t, new(big.Int).Sub(h.Prime, big.NewInt(3)), cErr.A)
+	assert.Equal(t, "11", cErr.B.String())
+	assert.Equal(t, new(big.Int).Sub(h.Prime, big.NewInt(34)), cErr.C)
+
+	require.Error(t, VerifyConstraints(h, constraints, w[:3]))
+	constraints[0].B[0].Wire = 4
+	require.Error(t, VerifyConstraints(h, constraints, w))
+
+	_, _, err = ReadR1CS(bytes.NewReader(r1cs[:len(r1cs)-1]))
+	require.Error(t, err)
+	_, _, err = ReadR1CS(bytes.NewReader(writeTestR1CSHeader(t, h)))
+	require.Error(t, err)
+}
@@ -0,0 +1,165 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// recordingMagic identifies the start of a recorded calculation.
+var recordingMagic = [4]byte{'w', 'c', 'r', 'p'}
+
+const recordingVersion = 1
+
+// recorderMu serializes the writes of the recordings.
+var recorderMu sync.Mutex
+
+// Recording format, all integers in little-endian:
+//
+//	magic "wcrp" | version u32 | sanityCheck u32 | frLen u32 | nRecords u32
+//	nRecords × (hashMSB i32 | hashLSB i32 | signal offset i32 | frLen bytes)
+//
+// where the frLen bytes are the Field element exactly as stored in the
+// runtime memory for setSignal.
+
+// recordingHeader is the header of a recorded calculation.
+type recordingHeader struct {
+	Magic       [4]byte
+	Version     uint32
+	SanityCheck uint32
+	FrLen       uint32
+	NRecords    uint32
+}
+
+// recordHeader precedes the Field element bytes of every record.
+type recordHeader struct {
+	HashMSB int32
+	HashLSB int32
+	Offset  int32
+}
+
+// recording accumulates the signal assignments of a calculation.
+type recording struct {
+	wc      *WitnessCalculator
+	header  recordingHeader
+	records bytes.Buffer
+}
+
+// frLen is the size in bytes of a Field element in the runtime memory.
+func (wc *WitnessCalculator) frLen() int32 {
+	return wc.n32 + 8
+}
+
+// newRecording starts the recording of a calculation.
+func (wc *WitnessCalculator) newRecording(sanityCheck bool) *recording {
+	rec := &recording{
+		wc: wc,
+		header: recordingHeader{
+			Magic:   recordingMagic,
+			Version: recordingVersion,
+			FrLen:   uint32(wc.frLen()),
+		},
+	}
+	if sanityCheck {
+		rec.header.SanityCheck = 1
+	}
+	return rec
+}
+
+// add records the assignment of the Field element at pFr to the signal at
+// offset, which was resolved from the (hashMSB, hashLSB) signal name hash.
+func (rec *recording) add(hashMSB, hashLSB, offset, pFr int32) error {
+	fr, err := memRange(rec.wc.runtime.Memory(), int64(pFr), int64(rec.wc.frLen()))
+	if err != nil {
+		return err
+	}
+	_ = binary.Write(&rec.records, binary.LittleEndian, recordHeader{hashMSB, hashLSB, offset})
+	rec.records.Write(fr)
+	rec.header.NRecords++
+	return nil
+}
+
+// writeTo writes the recorded calculation to w.
+func (rec *recording) writeTo(w io.Writer) error {
+	var buff bytes.Buffer
+	buff.Grow(binary.Size(rec.header) + rec.records.Len())
+	_ = binary.Write(&buff, binary.LittleEndian, rec.header)
+	buff.Write(rec.records.Bytes())
+	// A single write, serialized with the other calculators that may share
+	// the writer, for the recordings not to interleave.
+	recorderMu.Lock()
+	defer recorderMu.Unlock()
+	_, err := w.Write(buff.Bytes())
+	return err
+}
+
+// Replay calculates the witness from a calculation recorded with the
+// WithRecorder option, assigning the recorded Field elements in the recorded
+// order.  Every signal offset is resolved again from its name hash and an
+// error is returned if it differs from the recorded one, which means the
+// recording comes from a different circuit build.  Consecutive calls replay
+// consecutive recorded calculations of r.
+func (wc *WitnessCalculator) Replay(r io.Reader) (*Witness, error) {
+	var header recordingHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != recordingMagic {
+		return nil, fmt.Errorf("invalid recording magic %q", header.Magic[:])
+	}
+	if header.Version != recordingVersion {
+		return nil, fmt.Errorf("unsupported recording version %d", header.Version)
+	}
+	if header.FrLen != uint32(wc.frLen()) {
+		return nil, fmt.Errorf("recording Field element length %d doesn't match the circuit's %d",
+			header.FrLen, wc.frLen())
+	}
+
+	oldMemFreePos := wc.memFreePos()
+	defer wc.setMemFreePos(oldMemFreePos)
+
+	if err := wc.fns.init(int32(header.SanityCheck)); err != nil {
+		return nil, err
+	}
+	pSigOffset := wc.allocInt()
+	pFr := wc.allocFr()
+
+	var rec recordHeader
+	for i := uint32(0); i < header.NRecords; i++ {
+		if err := binary.Read(r, binary.LittleEndian, &rec); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		fr, err := memRange(wc.runtime.Memory(), int64(pFr), int64(wc.frLen()))
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		if _, err := io.ReadFull(r, fr); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		if err := wc.fns.getSignalOffset32(pSigOffset, 0, rec.HashMSB, rec.HashLSB); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		sigOffset, err := wc.getInt(pSigOffset)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		if sigOffset > rec.Offset {
+			return nil, fmt.Errorf("record %d: signal offset %d is out of the recorded signal starting at %d",
+				i, rec.Offset, sigOffset)
+		}
+		if err := wc.fns.setSignal(0, 0, rec.Offset, pFr); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+	}
+
+	w, err := wc.loadWitness()
+	if err != nil {
+		return nil, err
+	}
+	return wc.newWitness(w), nil
+}
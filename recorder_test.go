@@ -0,0 +1,55 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	wasm3 "github.com/iden3/go-wasm3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	runtime := wasm3.NewRuntime(&wasm3.Config{
+		Environment: wasm3.NewEnvironment(),
+		StackSize:   64 * 1024,
+	})
+	defer runtime.Destroy()
+	wasmBytes, err := ioutil.ReadFile("test_files/smtverifier10.wasm")
+	require.Nil(t, err)
+	module, err := runtime.ParseModule(wasmBytes)
+	require.Nil(t, err)
+	_, err = runtime.LoadModule(module)
+	require.Nil(t, err)
+
+	var recording bytes.Buffer
+	witnessCalculator, err := NewWitnessCalculator(runtime, WithRecorder(&recording))
+	require.Nil(t, err)
+
+	inputsBytes, err := ioutil.ReadFile("test_files/smtverifier10-input.json")
+	require.Nil(t, err)
+	inputs, err := ParseInputs(inputsBytes)
+	require.Nil(t, err)
+
+	w1, err := witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+	inputs["key"] = inputs["value"]
+	w2, err := witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+
+	r := bytes.NewReader(recording.Bytes())
+	rw1, err := witnessCalculator.Replay(r)
+	require.Nil(t, err)
+	assert.Equal(t, w1, rw1)
+	rw2, err := witnessCalculator.Replay(r)
+	require.Nil(t, err)
+	assert.Equal(t, w2, rw2)
+	assert.Equal(t, 0, r.Len())
+
+	_, err = witnessCalculator.Replay(bytes.NewReader([]byte("invalid recording header")))
+	require.Error(t, err)
+}
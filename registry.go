@@ -0,0 +1,420 @@
+package witnesscalc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+)
+
+// CircuitLoader returns the circom 2 WitnessCalc WASM module of the named
+// circuit, e.g. reading it from disk or fetching it from a store.
+type CircuitLoader func(name string) ([]byte, error)
+
+// LoadStats holds the load latency metrics of a circuit in a Registry.
+type LoadStats struct {
+	Loads    int           // completed loads, successful or not
+	Failures int           // failed loads
+	Shared   int           // requests that waited for a load in flight
+	Restored int           // loads from the snapshots saved by SaveWarm
+	Last     time.Duration // latency of the last load
+	Total    time.Duration // accumulated latency of all the loads
+}
+
+// registryCall is a load in flight.  Requests for the same circuit wait on
+// wg instead of loading it again.
+type registryCall struct {
+	wg    sync.WaitGroup
+	entry *registryEntry
+	err   error
+	// restore is set for the loads of RestoreWarm, which the requests retry
+	// with the CircuitLoader if they fail.
+	restore bool
+}
+
+// registryEntry is a loaded circuit.  mu serializes its calculations, as a
+// calculator can't be used concurrently.
+type registryEntry struct {
+	mu   sync.Mutex
+	calc *Circom2WitnessCalculator
+}
+
+// Registry holds the calculators of several circom 2 circuits, loading each of
+// them lazily the first time it is requested.  Concurrent requests for a
+// circuit that is not loaded yet share a single load.  It is safe for
+// concurrent use.
+type Registry struct {
+	load  CircuitLoader
+	opts  []Option
+	mu    sync.Mutex
+	calls map[string]*registryCall
+	// entries holds the loaded circuits.  Failed loads are not cached.
+	entries map[string]*registryEntry
+	stats   map[string]*LoadStats
+}
+
+// NewRegistry creates an empty Registry that loads circuits with load and
+// creates their calculators with opts.
+func NewRegistry(load CircuitLoader, opts ...Option) *Registry {
+	return &Registry{
+		load:    load,
+		opts:    opts,
+		calls:   make(map[string]*registryCall),
+		entries: make(map[string]*registryEntry),
+		stats:   make(map[string]*LoadStats),
+	}
+}
+
+// entry returns the loaded circuit name, loading it if needed.
+func (r *Registry) entry(name string) (*registryEntry, error) {
+	r.mu.Lock()
+	if e, ok := r.entries[name]; ok {
+		r.mu.Unlock()
+		return e, nil
+	}
+	stats := r.loadStats(name)
+	if c, ok := r.calls[name]; ok {
+		stats.Shared++
+		r.mu.Unlock()
+		c.wg.Wait()
+		if c.restore && c.err != nil {
+			return r.entry(name)
+		}
+		return c.entry, c.err
+	}
+	c := &registryCall{}
+	c.wg.Add(1)
+	r.calls[name] = c
+	r.mu.Unlock()
+
+	start := time.Now()
+	c.entry, c.err = r.loadEntry(name)
+	elapsed := time.Since(start)
+
+	r.mu.Lock()
+	stats.Loads++
+	stats.Last = elapsed
+	stats.Total += elapsed
+	if c.err != nil {
+		stats.Failures++
+	} else {
+		r.entries[name] = c.entry
+	}
+	delete(r.calls, name)
+	r.mu.Unlock()
+	c.wg.Done()
+	return c.entry, c.err
+}
+
+// loadStats returns the LoadStats of the circuit name, created if needed.  r.mu
+// must be held.
+func (r *Registry) loadStats(name string) *LoadStats {
+	stats, ok := r.stats[name]
+	if !ok {
+		stats = &LoadStats{}
+		r.stats[name] = stats
+	}
+	return stats
+}
+
+// loadEntry loads the circuit name and creates its calculator.
+func (r *Registry) loadEntry(name string) (*registryEntry, error) {
+	wasmBytes, err := r.load(name)
+	if err != nil {
+		return nil, fmt.Errorf("circuit %s: %w", name, err)
+	}
+	calc, err := NewCircom2WitnessCalculator(wasmBytes, r.calcOptions(name)...)
+	if err != nil {
+		return nil, fmt.Errorf("circuit %s: %w", name, err)
+	}
+	return &registryEntry{calc: calc}, nil
+}
+
+// calcOptions returns the options of the calculator of the circuit name.
+func (r *Registry) calcOptions(name string) []Option {
+	return append([]Option{WithCircuitName(name)}, r.opts...)
+}
+
+// Load loads the circuit name if it is not loaded yet, e.g. to warm up the
+// registry before serving requests.
+func (r *Registry) Load(name string) error {
+	_, err := r.entry(name)
+	return err
+}
+
+// CalculateWitness calculates the witness of the circuit name given the
+// inputs, loading the circuit if needed.  Calculations of the same circuit
+// are serialized.
+func (r *Registry) CalculateWitness(name string, inputs map[string]interface{}, sanityCheck bool) (*Witness, error) {
+	e, err := r.entry(name)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calc.CalculateWitness(inputs, sanityCheck)
+}
+
+// Calculate calculates the witness of the circuit name like
+// CalculateWitness, with the sanity checks of the WithDefaultSanityCheck
+// option of the registry.
+func (r *Registry) Calculate(name string, inputs map[string]interface{}) (*Witness, error) {
+	e, err := r.entry(name)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calc.Calculate(inputs)
+}
+
+// ReloadModule replaces the WitnessCalc WASM module of the loaded circuit
+// name by newWasm (see Circom2WitnessCalculator.ReloadModule), once its
+// calculation in progress, if any, is done.  Its load metrics are kept.
+func (r *Registry) ReloadModule(name string, newWasm []byte) error {
+	r.mu.Lock()
+	e, ok := r.entries[name]
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("circuit %s is not loaded", name)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.calc.ReloadModule(newWasm); err != nil {
+		return fmt.Errorf("circuit %s: %w", name, err)
+	}
+	return nil
+}
+
+// LoadStats returns the load latency metrics of every circuit requested from
+// the registry.
+func (r *Registry) LoadStats() map[string]LoadStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[string]LoadStats, len(r.stats))
+	for name, s := range r.stats {
+		stats[name] = *s
+	}
+	return stats
+}
+
+// warmManifest is the file of the directory of SaveWarm listing the saved
+// circuits, with the CircuitHash of their module by name.  The snapshots are
+// saved in the files named after the hash, with the warmExt extension.
+const (
+	warmManifest = "registry.json"
+	warmExt      = ".snapshot"
+)
+
+// readWarmManifest reads the manifest of the directory dir of SaveWarm, nil
+// if there is none.
+func readWarmManifest(dir string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, warmManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var manifest map[string]string
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", warmManifest, err)
+	}
+	return manifest, nil
+}
+
+// isCircuitHashString returns whether s is a CircuitHash in hexadecimal, the
+// name of a snapshot saved by SaveWarm, so that a corrupted manifest can't
+// name other files.
+func isCircuitHashString(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == len(CircuitHash{})
+}
+
+// SaveWarm saves the post-init snapshots (see Circom2WitnessCalculator.Snapshot)
+// of the loaded circuits, the hot circuits of the registry, into the cache
+// directory dir, created if needed, e.g. on graceful shutdown, for
+// RestoreWarm to load them at startup without fetching, compiling nor
+// initializing their modules.  The snapshots saved by a previous call that
+// are not hot anymore are removed; the other files of dir are left untouched.
+// It fails with ErrSnapshotUnsupported if the WASM runtime can't take
+// snapshots.
+func (r *Registry) SaveWarm(dir string) error {
+	r.mu.Lock()
+	entries := make(map[string]*registryEntry, len(r.entries))
+	for name, e := range r.entries {
+		entries[name] = e
+	}
+	r.mu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// A corrupted manifest only leaves its snapshots behind.
+	previous, err := readWarmManifest(dir)
+	if err != nil {
+		log.Warn("Reading the previous registry manifest failed", "dir", dir, "err", err)
+	}
+	manifest := make(map[string]string, len(entries))
+	saved := make(map[string]bool)
+	for name, e := range entries {
+		if err := e.save(dir, name, manifest, saved); err != nil {
+			return fmt.Errorf("circuit %s: %w", name, err)
+		}
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, warmManifest), b); err != nil {
+		return err
+	}
+	// The snapshots of the circuits that are no longer hot, among the ones
+	// saved by the previous call: dir may be shared with other files.
+	for _, hash := range previous {
+		if saved[hash] || !isCircuitHashString(hash) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, hash+warmExt)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// save saves the snapshot of the circuit name into dir, unless a circuit of
+// the same module is already saved, and adds it to the manifest.
+func (e *registryEntry) save(dir, name string, manifest map[string]string, saved map[string]bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	h, _ := e.calc.CircuitHash()
+	hash := h.String()
+	manifest[name] = hash
+	if saved[hash] {
+		return nil
+	}
+	snapshot, err := e.calc.Snapshot()
+	if err != nil {
+		return err
+	}
+	saved[hash] = true
+	return writeFileAtomic(filepath.Join(dir, hash+warmExt), snapshot)
+}
+
+// RestoreWarm loads the circuits saved by SaveWarm into the directory dir
+// that are not loaded nor being loaded yet, e.g. at startup before serving
+// requests, and returns their sorted names.  The requests for a circuit being
+// restored wait for it.  The circuits whose snapshot is missing, corrupted,
+// or of another WASM runtime or machine are skipped, with a warning, and
+// loaded with the CircuitLoader when requested.  Nothing is restored if dir
+// has no saved circuits.
+func (r *Registry) RestoreWarm(dir string) ([]string, error) {
+	manifest, err := readWarmManifest(dir)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(manifest))
+	for name := range manifest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var restored []string
+	for _, name := range names {
+		hash := manifest[name]
+		if !isCircuitHashString(hash) {
+			log.Warn("Restoring circuit failed", "circuit", name, "err", fmt.Errorf("invalid hash %q", hash))
+			continue
+		}
+		ok, err := r.restoreEntry(name, filepath.Join(dir, hash+warmExt), hash)
+		if err != nil {
+			log.Warn("Restoring circuit failed", "circuit", name, "err", err)
+		} else if ok {
+			restored = append(restored, name)
+		}
+	}
+	return restored, nil
+}
+
+// restoreEntry loads the circuit name from the snapshot at path, of the
+// module of CircuitHash hash, unless it is loaded or being loaded.  It is
+// registered as the load in flight of the circuit meanwhile.
+func (r *Registry) restoreEntry(name, path, hash string) (bool, error) {
+	r.mu.Lock()
+	_, loaded := r.entries[name]
+	_, loading := r.calls[name]
+	if loaded || loading {
+		r.mu.Unlock()
+		return false, nil
+	}
+	stats := r.loadStats(name)
+	c := &registryCall{restore: true}
+	c.wg.Add(1)
+	r.calls[name] = c
+	r.mu.Unlock()
+
+	start := time.Now()
+	c.entry, c.err = r.readSnapshot(name, path, hash)
+	elapsed := time.Since(start)
+
+	r.mu.Lock()
+	// Failed restores aren't failed loads: the circuit is loaded with the
+	// CircuitLoader instead.
+	if c.err == nil {
+		stats.Loads++
+		stats.Restored++
+		stats.Last = elapsed
+		stats.Total += elapsed
+		r.entries[name] = c.entry
+	}
+	delete(r.calls, name)
+	r.mu.Unlock()
+	c.wg.Done()
+	return c.err == nil, c.err
+}
+
+// readSnapshot creates the calculator of the circuit name from the snapshot
+// at path, checking that its module has the CircuitHash hash.
+func (r *Registry) readSnapshot(name, path, hash string) (*registryEntry, error) {
+	snapshot, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	calc, err := NewCircom2WitnessCalculatorFromSnapshot(snapshot, r.calcOptions(name)...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if h, _ := calc.CircuitHash(); h.String() != hash {
+		releaseCircom2Instance(calc.instance)
+		return nil, fmt.Errorf("snapshot %s has hash %s", path, h)
+	}
+	return &registryEntry{calc: calc}, nil
+}
+
+// writeFileAtomic writes the file path, with the permissions 0644, through a
+// temporary file, so that it is never read partially written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
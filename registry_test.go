@@ -0,0 +1,188 @@
+package witnesscalc
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// runConcurrently runs f n times concurrently, after all goroutines are started.
+func runConcurrently(n int, f func()) {
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			start.Wait()
+			f()
+		}()
+	}
+	start.Done()
+	done.Wait()
+}
+
+func TestRegistry(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+
+	var loads int32
+	registry := NewRegistry(func(name string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		if name != "circuit" {
+			return nil, errors.New("not found")
+		}
+		return wasmBytes, nil
+	})
+
+	errs := make(chan error, 8)
+	runConcurrently(8, func() {
+		_, err := registry.CalculateWitness("circuit", inputs, true)
+		errs <- err
+	})
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(1), loads)
+
+	stats := registry.LoadStats()["circuit"]
+	require.Equal(t, 1, stats.Loads)
+	require.Equal(t, 0, stats.Failures)
+	require.Equal(t, stats.Last, stats.Total)
+
+	require.Error(t, registry.ReloadModule("missing", wasmBytes))
+	require.NoError(t, registry.ReloadModule("circuit", wasmBytes))
+	_, err = registry.CalculateWitness("circuit", inputs, true)
+	require.NoError(t, err)
+	_, err = registry.Calculate("circuit", inputs)
+	require.NoError(t, err)
+	require.Equal(t, stats, registry.LoadStats()["circuit"])
+}
+
+func TestRegistryLoadError(t *testing.T) {
+	var loads int32
+	block := make(chan struct{})
+	registry := NewRegistry(func(name string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		<-block
+		return nil, errors.New("not found")
+	})
+
+	errs := make(chan error, 4)
+	go func() {
+		runConcurrently(4, func() { errs <- registry.Load("missing") })
+		close(errs)
+	}()
+	// Let the requests pile up on the load in flight.
+	for {
+		stats := registry.LoadStats()["missing"]
+		if stats.Shared == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(block)
+	for err := range errs {
+		require.EqualError(t, err, "circuit missing: not found")
+	}
+	require.Equal(t, int32(1), loads)
+
+	// Failed loads are retried.
+	require.Error(t, registry.Load("missing"))
+	require.Equal(t, int32(2), loads)
+	stats := registry.LoadStats()["missing"]
+	require.Equal(t, 2, stats.Loads)
+	require.Equal(t, 2, stats.Failures)
+	require.Equal(t, 3, stats.Shared)
+}
+
+func TestRegistryWarm(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.NoError(t, err)
+	inputBytes, err := ioutil.ReadFile("test_files/circom2/input.json")
+	require.NoError(t, err)
+	inputs, err := ParseInputs(inputBytes)
+	require.NoError(t, err)
+	dir := filepath.Join(t.TempDir(), "warm")
+
+	var loads int32
+	load := func(name string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return wasmBytes, nil
+	}
+	registry := NewRegistry(load)
+	restored, err := registry.RestoreWarm(dir)
+	require.NoError(t, err)
+	require.Empty(t, restored)
+	require.NoError(t, registry.Load("a"))
+	require.NoError(t, registry.Load("b"))
+	// The files that were not saved by the registry are kept.
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	other := filepath.Join(dir, "other.wasm")
+	require.NoError(t, ioutil.WriteFile(other, []byte("other"), 0644))
+	err = registry.SaveWarm(dir)
+	if errors.Is(err, ErrSnapshotUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	// a and b share their module, and so their snapshot.
+	files, err := filepath.Glob(filepath.Join(dir, "*.snapshot"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	saved := files[0]
+
+	// The restarted registry loads the hot circuits from their snapshots.
+	registry = NewRegistry(load)
+	require.NoError(t, registry.Load("a"))
+	restored, err = registry.RestoreWarm(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, restored)
+	require.Equal(t, int32(3), loads)
+	_, err = registry.CalculateWitness("b", inputs, true)
+	require.NoError(t, err)
+	stats := registry.LoadStats()["b"]
+	require.Equal(t, 1, stats.Loads)
+	require.Equal(t, 1, stats.Restored)
+
+	// The requests during a restore share it.
+	registry = NewRegistry(load)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, registry.Load("a"))
+		}()
+	}
+	_, err = registry.RestoreWarm(dir)
+	require.NoError(t, err)
+	wg.Wait()
+	stats = registry.LoadStats()["a"]
+	require.Equal(t, 1, stats.Loads)
+	require.Equal(t, 4, int(loads)+stats.Restored)
+
+	// Corrupted snapshots are skipped.
+	require.NoError(t, ioutil.WriteFile(saved, []byte("corrupted"), 0644))
+	registry = NewRegistry(load)
+	restored, err = registry.RestoreWarm(dir)
+	require.NoError(t, err)
+	require.Empty(t, restored)
+
+	// The snapshots of the circuits no longer hot are removed.
+	require.NoError(t, NewRegistry(load).SaveWarm(dir))
+	files, err = filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{other, filepath.Join(dir, warmManifest)}, files)
+}
@@ -0,0 +1,44 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+/*
+#include <stdint.h>
+
+// witnesscalcReleaseStub is the M3RawCall of the imports stubbed by
+// WithReleaseMode: it returns m3Err_none without calling into Go.
+const void *witnesscalcReleaseStub(void *runtime, uint64_t *sp, void *mem) {
+	return 0;
+}
+
+// witnesscalcReleaseStubZero is witnesscalcReleaseStub for the imports with a
+// result, zero.
+const void *witnesscalcReleaseStubZero(void *runtime, uint64_t *sp, void *mem) {
+	sp[0] = 0;
+	return 0;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	wasm3 "github.com/iden3/go-wasm3"
+)
+
+// linkReleaseStub links the import imp of the module to a native function
+// that does nothing and returns zero, for WithReleaseMode.  Unlike the
+// functions attached with AttachFunction, its calls don't go through cgo and
+// the callback lock of go-wasm3.
+func linkReleaseStub(module *wasm3.Module, imp wasmImport) error {
+	stub := unsafe.Pointer(C.witnesscalcReleaseStub)
+	if len(imp.Results) > 0 {
+		stub = unsafe.Pointer(C.witnesscalcReleaseStubZero)
+	}
+	if err := module.LinkRawFunction(imp.Module, imp.Name, wasm3Signature(imp), stub); err != nil {
+		return fmt.Errorf("link %s: %w", imp, err)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+	wasm3 "github.com/iden3/go-wasm3"
+)
+
+// circom1Imports are the imports provided to circom 1 WitnessCalc WASM
+// modules: the memory by wasm3 and the functions by newWitnessCalcFns.
+var circom1Imports = map[string]bool{
+	"env.memory":                 true,
+	"runtime.error":              true,
+	"runtime.logSetSignal":       true,
+	"runtime.logGetSignal":       true,
+	"runtime.logFinishComponent": true,
+	"runtime.logStartComponent":  true,
+	"runtime.log":                true,
+}
+
+// wasm3Signature returns the wasm3 signature of a function import, e.g.
+// "i(iI)".
+func wasm3Signature(imp wasmImport) string {
+	chars := map[byte]byte{wasmValueI32: 'i', wasmValueI64: 'I', wasmValueF32: 'f', wasmValueF64: 'F'}
+	sig := []byte{'v'}
+	if len(imp.Results) > 0 {
+		sig[0] = chars[imp.Results[0]]
+	}
+	sig = append(sig, '(')
+	for _, p := range imp.Params {
+		sig = append(sig, chars[p])
+	}
+	return string(append(sig, ')'))
+}
+
+// attachStub attaches to the runtime a function for the import imp that does
+// nothing and returns zero.
+func attachStub(runtime *wasm3.Runtime, imp wasmImport) {
+	nResults := len(imp.Results)
+	runtime.AttachFunction(imp.Module, imp.Name, wasm3Signature(imp), wasm3.CallbackFunction(
+		func(runtime wasm3.RuntimeT, sp unsafe.Pointer, mem unsafe.Pointer) int {
+			if nResults > 0 {
+				getStack(sp, 1)[0] = 0
+			}
+			return 0
+		},
+	))
+}
+
+// newRuntime creates a wasm3 runtime with the WitnessCalc WASM module loaded.
+// Every calculator of LoadWitnessCalculator gets its own runtime, while the
+// ones of a SharedRuntime share one.
+func newRuntime(wasmBytes []byte, stackSize uint, o options) (*wasm3.Runtime, error) {
+	runtime := wasm3.NewRuntime(&wasm3.Config{
+		Environment: wasm3.NewEnvironment(),
+		StackSize:   stackSize,
+	})
+	if _, err := loadModule(runtime, wasmBytes, o); err != nil {
+		runtime.Destroy()
+		return nil, err
+	}
+	return runtime, nil
+}
+
+// loadModule loads the WitnessCalc WASM module into the runtime, attaching
+// the stubs of its unknown imports.  With WithReleaseMode, the debug imports
+// of the module are linked to native stubs.  The functions are attached to
+// the last module loaded, so the module must stay the last one until its
+// calculator is created.
+func loadModule(runtime *wasm3.Runtime, wasmBytes []byte, o options) (*wasm3.Module, error) {
+	if err := checkModuleABI(wasmBytes, false); err != nil {
+		return nil, err
+	}
+	provided := circom1Imports
+	var release []wasmImport
+	if o.releaseMode {
+		var err error
+		release, provided, err = releaseImports(wasmBytes, provided)
+		if err != nil {
+			return nil, err
+		}
+	}
+	stubs, err := stubImports(wasmBytes, provided, o.importMode)
+	if err != nil {
+		return nil, err
+	}
+	module, err := runtime.ParseModule(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := runtime.LoadModule(module)
+	if err != nil {
+		return nil, err
+	}
+	for _, imp := range stubs {
+		attachStub(runtime, imp)
+	}
+	for _, imp := range release {
+		if err := linkReleaseStub(loaded, imp); err != nil {
+			return nil, err
+		}
+	}
+	if o.memoryLimitsSet {
+		if err := runtime.ResizeMemory(int32(o.memoryMinPages)); err != nil {
+			return nil, err
+		}
+	}
+	return loaded, nil
+}
+
+// LoadWitnessCalculator creates a WitnessCalculator that owns its wasm3
+// runtime, loading the WitnessCalc WASM module into it.  The runtime is sized
+// with the WithStackSize and WithMemoryLimits options; calculations that trap
+// with a stack overflow are retried on a new runtime with twice the stack size,
+// up to the WithMaxStackSize limit.  Close must be called to release the
+// runtime.
+func LoadWitnessCalculator(wasmBytes []byte, opts ...Option) (_ *WitnessCalculator, err error) {
+	o := newOptions(opts)
+	start := time.Now()
+	defer func() { traceSpan(o.tracer, context.Background(), SpanLoad, start, time.Now(), err) }()
+	wasmBytes, err = DecompressWASM(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	runtime, err := newRuntime(wasmBytes, o.stackSize, o)
+	if err != nil {
+		return nil, err
+	}
+	wc, err := newWitnessCalculator(runtime, wasmBytes, opts)
+	if err != nil {
+		runtime.Destroy()
+		return nil, err
+	}
+	wc.wasm = wasmBytes
+	wc.ownRuntime = runtime
+	wc.stackSize = o.stackSize
+	return wc, nil
+}
+
+// loadCircom1Calculator creates the calculator of NewAutoWitnessCalculator
+// for circom 1 modules.
+func loadCircom1Calculator(wasmBytes []byte, opts []Option) (Calculator, error) {
+	wc, err := LoadWitnessCalculator(wasmBytes, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+// readCircom1ModuleInfo returns the ModuleInfo of the circom 1 WitnessCalc
+// WASM module wasmBytes, without its exports and imports.
+func readCircom1ModuleInfo(wasmBytes []byte) (ModuleInfo, error) {
+	wc, err := LoadWitnessCalculator(wasmBytes)
+	if err != nil {
+		return ModuleInfo{}, err
+	}
+	defer wc.Close()
+	return wc.moduleInfo(), nil
+}
+
+// NewWitnessCalculatorFromReader is LoadWitnessCalculator with the
+// WitnessCalc WASM module read from r until EOF, e.g. a network response
+// body, without writing it to a file.  Close must be called to release the
+// runtime.
+func NewWitnessCalculatorFromReader(r io.Reader, opts ...Option) (*WitnessCalculator, error) {
+	wasmBytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading the WASM module: %w", err)
+	}
+	return LoadWitnessCalculator(wasmBytes, opts...)
+}
+
+// NewWitnessCalculatorFromFS is LoadWitnessCalculator with the WitnessCalc
+// WASM module at path in fsys, e.g. an embed.FS with the circuits embedded in
+// the binary.  Close must be called to release the runtime.
+func NewWitnessCalculatorFromFS(fsys fs.FS, path string, opts ...Option) (*WitnessCalculator, error) {
+	wasmBytes, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadWitnessCalculator(wasmBytes, opts...)
+}
+
+// Close releases the runtime owned by a WitnessCalculator created with
+// LoadWitnessCalculator.  It does nothing for calculators created with
+// NewWitnessCalculator, whose runtime is owned by the caller.
+func (wc *WitnessCalculator) Close() {
+	if wc.ownRuntime != nil {
+		wc.ownRuntime.Destroy()
+		wc.ownRuntime = nil
+	}
+}
+
+// ReloadModule replaces the WitnessCalc WASM module of a WitnessCalculator
+// created with LoadWitnessCalculator by newWasm, e.g. after the circuit has
+// been recompiled, keeping its options and metrics.  The new module must have
+// the same prime.  On errors the calculator keeps running the previous module.
+func (wc *WitnessCalculator) ReloadModule(newWasm []byte) error {
+	if wc.ownRuntime == nil {
+		return errors.New("ReloadModule requires a WitnessCalculator created with LoadWitnessCalculator")
+	}
+	newWasm, err := DecompressWASM(newWasm)
+	if err != nil {
+		return err
+	}
+	runtime, err := newRuntime(newWasm, wc.stackSize, wc.opts)
+	if err != nil {
+		return err
+	}
+	if err := wc.setRuntime(runtime, newWasm); err != nil {
+		runtime.Destroy()
+		return err
+	}
+	wc.ownRuntime.Destroy()
+	wc.ownRuntime = runtime
+	wc.wasm = newWasm
+	return nil
+}
+
+// isStackOverflow returns true if err is a wasm3 stack overflow trap.
+func isStackOverflow(err error) bool {
+	return strings.Contains(err.Error(), "stack overflow")
+}
+
+// willRetry returns true if retryOnStackOverflow retries a calculation that
+// failed with err.
+func (wc *WitnessCalculator) willRetry(err error) bool {
+	return err != nil && isStackOverflow(err) && wc.ownRuntime != nil &&
+		wc.stackSize*2 <= wc.opts.maxStackSize
+}
+
+// retryOnStackOverflow runs f and, while it fails with a stack overflow trap,
+// replaces the owned runtime by one with twice the stack size and runs f
+// again.
+func (wc *WitnessCalculator) retryOnStackOverflow(f func() error) error {
+	for {
+		err := f()
+		if !wc.willRetry(err) {
+			return err
+		}
+		stackSize := wc.stackSize * 2
+		log.Warn("WitnessCalculator stack overflow, growing stack", "stackSize", stackSize)
+		runtime, err := newRuntime(wc.wasm, stackSize, wc.opts)
+		if err != nil {
+			return err
+		}
+		if err := wc.setRuntime(runtime, wc.wasm); err != nil {
+			runtime.Destroy()
+			return err
+		}
+		wc.ownRuntime.Destroy()
+		wc.ownRuntime = runtime
+		wc.stackSize = stackSize
+	}
+}
+
+// memoryEstimateFactor is the number of field elements per witness variable
+// reserved by EstimateMemory, covering the signals and the temporaries of
+// their computation.
+const memoryEstimateFactor = 4
+
+// memoryResizer is implemented by runtimes whose memory can be grown from the
+// host, like *wasm3.Runtime.
+type memoryResizer interface {
+	ResizeMemory(numPages int32) error
+}
+
+// EstimateMemory returns an estimate in bytes, rounded up to whole WASM
+// pages, of the runtime memory used by a witness calculation, derived from
+// the number of witness variables and the field element size.
+func (wc *WitnessCalculator) EstimateMemory() int {
+	frLen := int(wc.n64)*8 + 8
+	size := int(wc.memFreePos()) + int(wc.nVars)*frLen*memoryEstimateFactor
+	return (size + wasmPageSize - 1) / wasmPageSize * wasmPageSize
+}
+
+// preGrowMemory grows the runtime memory to EstimateMemory if it is smaller,
+// so that the calculations don't stall growing it.
+func (wc *WitnessCalculator) preGrowMemory() error {
+	resizer, ok := wc.runtime.(memoryResizer)
+	if !ok {
+		return nil
+	}
+	size := wc.EstimateMemory()
+	if wc.runtime.GetAllocatedMemoryLength() >= size {
+		return nil
+	}
+	return resizer.ResizeMemory(int32(size / wasmPageSize))
+}
@@ -0,0 +1,375 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadWitnessCalculatorStackRetry(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/smtverifier10.wasm")
+	require.Nil(t, err)
+	inputsBytes, err := ioutil.ReadFile("test_files/smtverifier10-input.json")
+	require.Nil(t, err)
+	inputs, err := ParseInputs(inputsBytes)
+	require.Nil(t, err)
+	expected, err := CalculateWitnessBinWASM(wasmBytes, inputs)
+	require.Nil(t, err)
+
+	// Too small stack without retries
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes,
+		WithStackSize(1024), WithMaxStackSize(1024))
+	require.Nil(t, err)
+	_, err = witnessCalculator.CalculateWitness(inputs, false)
+	require.Error(t, err)
+	assert.True(t, isStackOverflow(err))
+	witnessCalculator.Close()
+
+	witnessCalculator, err = LoadWitnessCalculator(wasmBytes, WithStackSize(1024))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	w, err := witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+	assert.Equal(t, expected, w)
+	assert.Greater(t, witnessCalculator.stackSize, uint(1024))
+}
+
+func TestWitnessCalculatorMemoryPregrow(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/smtverifier10.wasm")
+	require.Nil(t, err)
+	inputsBytes, err := ioutil.ReadFile("test_files/smtverifier10-input.json")
+	require.Nil(t, err)
+	inputs, err := ParseInputs(inputsBytes)
+	require.Nil(t, err)
+	expected, err := CalculateWitnessBinWASM(wasmBytes, inputs)
+	require.Nil(t, err)
+
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithMemoryPregrow())
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	estimate := witnessCalculator.EstimateMemory()
+	assert.Equal(t, 0, estimate%wasmPageSize)
+	assert.GreaterOrEqual(t, witnessCalculator.runtime.GetAllocatedMemoryLength(), estimate)
+
+	w, err := witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+	assert.Equal(t, expected, w)
+}
+
+func TestNewRuntimeImportStubs(t *testing.T) {
+	module := newImportsModule(false)
+	_, err := newRuntime(module, defaultStackSize, defaultOptions())
+	require.EqualError(t, err, "missing WASM imports: runtime.newThing")
+
+	o := defaultOptions()
+	o.importMode = ImportsPermissive
+	runtime, err := newRuntime(module, defaultStackSize, o)
+	require.Nil(t, err)
+	defer runtime.Destroy()
+	f, err := runtime.FindFunction("f")
+	require.Nil(t, err)
+	res, err := f(int32(7))
+	require.Nil(t, err)
+	assert.Equal(t, int32(0), res)
+
+	imports, err := parseWASMImports(module)
+	require.Nil(t, err)
+	assert.Equal(t, "i(i)", wasm3Signature(imports[0]))
+}
+
+func TestNewRuntimeReleaseStubs(t *testing.T) {
+	module := newRuntimeImportModule("printErrorMessage", false)
+	_, err := newRuntime(module, defaultStackSize, defaultOptions())
+	require.EqualError(t, err, "missing WASM imports: runtime.printErrorMessage")
+
+	o := defaultOptions()
+	o.releaseMode = true
+	runtime, err := newRuntime(module, defaultStackSize, o)
+	require.Nil(t, err)
+	defer runtime.Destroy()
+	f, err := runtime.FindFunction("f")
+	require.Nil(t, err)
+	// The result overwrites the argument on the stack.
+	res, err := f(int32(7))
+	require.Nil(t, err)
+	assert.Equal(t, int32(0), res)
+}
+
+func TestNewWitnessCalculatorFromReaderFS(t *testing.T) {
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+
+	f, err := os.Open("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	defer f.Close()
+	witnessCalculator, err := NewWitnessCalculatorFromReader(f)
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	w, err := witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, "33", w.At(1).String())
+
+	witnessCalculator2, err := NewWitnessCalculatorFromFS(os.DirFS("test_files"), "mycircuit.wasm")
+	require.Nil(t, err)
+	defer witnessCalculator2.Close()
+	w2, err := witnessCalculator2.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, w, w2)
+
+	_, err = NewWitnessCalculatorFromFS(os.DirFS("test_files"), "missing.wasm")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestLoadWitnessCalculatorCompressed(t *testing.T) {
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	compressed := gzipBytes(t, wasmBytes)
+
+	witnessCalculator, err := LoadWitnessCalculator(compressed)
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	w, err := witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, "33", w.At(1).String())
+	h, ok := witnessCalculator.CircuitHash()
+	require.True(t, ok)
+	assert.Equal(t, NewCircuitHash(wasmBytes), h)
+	require.Nil(t, witnessCalculator.ReloadModule(compressed))
+
+	witnessCalculator2, err := NewWitnessCalculatorFromFS(fstest.MapFS{
+		"mycircuit.wasm.gz": &fstest.MapFile{Data: compressed},
+	}, "mycircuit.wasm.gz")
+	require.Nil(t, err)
+	defer witnessCalculator2.Close()
+	w2, err := witnessCalculator2.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, w, w2)
+
+	info, err := ReadModuleInfo(compressed)
+	require.Nil(t, err)
+	assert.Equal(t, 1, info.Circom)
+}
+
+func TestWitnessCalculatorBatchMontgomery(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/smtverifier10.wasm")
+	require.Nil(t, err)
+	inputsBytes, err := ioutil.ReadFile("test_files/smtverifier10-input.json")
+	require.Nil(t, err)
+	inputs, err := ParseInputs(inputsBytes)
+	require.Nil(t, err)
+	expected, err := CalculateWitnessBinWASM(wasmBytes, inputs)
+	require.Nil(t, err)
+
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithBatchMontgomery())
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	for i := 0; i < 2; i++ {
+		w, err := witnessCalculator.CalculateWitness(inputs, false)
+		require.Nil(t, err)
+		expectedJSON, err := expected.ToJSON()
+		require.Nil(t, err)
+		wJSON, err := w.ToJSON()
+		require.Nil(t, err)
+		assert.Equal(t, string(expectedJSON), string(wJSON))
+	}
+}
+
+func TestWitnessCalculatorLayout(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+
+	var m LayoutManifest
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithLayoutRecord(&m))
+	require.Nil(t, err)
+	_, err = witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+	witnessCalculator.Close()
+	assert.Equal(t, int32(4), m.WitnessLen)
+	assert.Len(t, m.SignalOffsets, 2)
+	assert.NotZero(t, m.MemFreePos)
+
+	var buff bytes.Buffer
+	_, err = m.WriteTo(&buff)
+	require.Nil(t, err)
+	read, err := ReadLayoutManifest(&buff)
+	require.Nil(t, err)
+	assert.Equal(t, &m, read)
+
+	witnessCalculator, err = LoadWitnessCalculator(wasmBytes, WithLayoutCheck(read))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	_, err = witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+
+	read.SignalOffsets["a"]++
+	_, err = witnessCalculator.CalculateWitness(inputs, false)
+	var layoutErr *LayoutError
+	require.True(t, errors.As(err, &layoutErr))
+	assert.Equal(t, "offset of signal a", layoutErr.Item)
+
+	read.WitnessLen = 5
+	_, err = witnessCalculator.CalculateWitness(inputs, false)
+	require.True(t, errors.As(err, &layoutErr))
+	assert.Equal(t, &LayoutError{Item: "witness length", Expected: 5, Got: 4}, layoutErr)
+}
+
+func TestReadModuleInfo(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	info, err := ReadModuleInfo(wasmBytes)
+	require.Nil(t, err)
+	assert.Equal(t, 1, info.Circom)
+	assert.Equal(t, int32(0), info.Version)
+	assert.Equal(t, CurveBN254, info.Curve)
+	assert.Equal(t, int32(4), info.NVars)
+	assert.Equal(t, 4, info.N64)
+	assert.Contains(t, info.Exports, "getNVars")
+	assert.Contains(t, info.Imports, "runtime.error")
+
+	_, err = ReadModuleInfo([]byte("invalid"))
+	assert.Error(t, err)
+}
+
+func TestWitnessCalculatorCircuitHash(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithCircuitHashInWTNS())
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	h, ok := witnessCalculator.CircuitHash()
+	require.True(t, ok)
+	assert.Equal(t, CircuitHash(sha256.Sum256(wasmBytes)), h)
+
+	wtnsBytes, err := witnessCalculator.CalculateWTNSBin(inputs, false)
+	require.Nil(t, err)
+	header, err := VerifyWTNS(bytes.NewReader(wtnsBytes))
+	require.Nil(t, err)
+	require.NotNil(t, header.CircuitHash)
+	assert.Equal(t, h, *header.CircuitHash)
+	assert.Equal(t, uint32(4), header.NWitness)
+}
+
+func TestWitnessCalculatorAbort(t *testing.T) {
+	runtime, err := newRuntime(newAbortModule(), defaultStackSize, defaultOptions())
+	require.Nil(t, err)
+	defer runtime.Destroy()
+	var wc WitnessCalculator
+	wc.attachAbort(runtime)
+	f, err := runtime.FindFunction("f")
+	require.Nil(t, err)
+	_, err = f()
+	require.NotNil(t, err)
+
+	var abortErr *AbortError
+	require.True(t, errors.As(wc.takeRuntimeError(err), &abortErr))
+	assert.Equal(t, &AbortError{Msg: "abc", File: "f.ts", Line: 7, Column: 3}, abortErr)
+	assert.Nil(t, wc.abortErr)
+}
+
+func TestWitnessCalculatorReleaseMode(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/smtverifier10.wasm")
+	require.Nil(t, err)
+	inputsBytes, err := ioutil.ReadFile("test_files/smtverifier10-input.json")
+	require.Nil(t, err)
+	inputs, err := ParseInputs(inputsBytes)
+	require.Nil(t, err)
+	expected, err := CalculateWitnessBinWASM(wasmBytes, inputs)
+	require.Nil(t, err)
+
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithReleaseMode(), WithComponentTree())
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	w, err := witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, expected, w)
+
+	// Go stubs on the runtimes of the caller
+	runtime, err := newRuntime(wasmBytes, defaultStackSize, defaultOptions())
+	require.Nil(t, err)
+	defer runtime.Destroy()
+	witnessCalculator2, err := NewWitnessCalculator(runtime, WithReleaseMode())
+	require.Nil(t, err)
+	w, err = witnessCalculator2.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, expected, w)
+}
+
+// BenchmarkWitnessCalculatorReleaseMode measures the overhead of the debug
+// imports of smtverifier10, called about 90,000 times per witness, against
+// the stubs of WithReleaseMode.
+func BenchmarkWitnessCalculatorReleaseMode(b *testing.B) {
+	wasmBytes, err := ioutil.ReadFile("test_files/smtverifier10.wasm")
+	require.Nil(b, err)
+	inputsBytes, err := ioutil.ReadFile("test_files/smtverifier10-input.json")
+	require.Nil(b, err)
+	inputs, err := ParseInputs(inputsBytes)
+	require.Nil(b, err)
+
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"debug", nil},
+		{"release", []Option{WithReleaseMode()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			witnessCalculator, err := LoadWitnessCalculator(wasmBytes, bc.opts...)
+			require.Nil(b, err)
+			defer witnessCalculator.Close()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := witnessCalculator.CalculateWitness(inputs, true); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSanityCheck measures the cost of the sanity checks of the circom 1
+// modules, off by default with WithDefaultSanityCheck.
+func BenchmarkSanityCheck(b *testing.B) {
+	for _, circuit := range []struct {
+		name   string
+		wasm   string
+		inputs string
+	}{
+		{"mycircuit", "test_files/mycircuit.wasm", "test_files/mycircuit-input1.json"},
+		{"smtverifier10", "test_files/smtverifier10.wasm", "test_files/smtverifier10-input.json"},
+	} {
+		wasmBytes, err := ioutil.ReadFile(circuit.wasm)
+		require.Nil(b, err)
+		inputsBytes, err := ioutil.ReadFile(circuit.inputs)
+		require.Nil(b, err)
+		inputs, err := ParseInputs(inputsBytes)
+		require.Nil(b, err)
+		witnessCalculator, err := LoadWitnessCalculator(wasmBytes)
+		require.Nil(b, err)
+		for _, sanityCheck := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/sanityCheck=%v", circuit.name, sanityCheck), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := witnessCalculator.CalculateWitness(inputs, sanityCheck); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+		witnessCalculator.Close()
+	}
+}
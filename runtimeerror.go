@@ -0,0 +1,64 @@
+package witnesscalc
+
+import "fmt"
+
+// Error codes passed by circom 1 WitnessCalc WASM modules to the runtime.error
+// import.
+const (
+	ErrCodeStackOutOfMemory        = 1
+	ErrCodeStackTooSmall           = 2
+	ErrCodeHashNotFound            = 3
+	ErrCodeInvalidType             = 4
+	ErrCodeAccessingNotAssignedSig = 5
+	ErrCodeSignalAssignedTwice     = 6
+	ErrCodeConstraintDoesNotMatch  = 7
+	ErrCodeMapIsInputDoesNotMatch  = 8
+)
+
+// runtimeErrorMessages are the descriptions of the error codes, as embedded in
+// the WASM modules.
+var runtimeErrorMessages = map[int]string{
+	ErrCodeStackOutOfMemory:        "Stack out of memory",
+	ErrCodeStackTooSmall:           "Stack too small",
+	ErrCodeHashNotFound:            "Hash not found",
+	ErrCodeInvalidType:             "Invalid type",
+	ErrCodeAccessingNotAssignedSig: "Accessing a not assigned signal",
+	ErrCodeSignalAssignedTwice:     "Signal assigned twice",
+	ErrCodeConstraintDoesNotMatch:  "Constraint doesn't match",
+	ErrCodeMapIsInputDoesNotMatch:  "MapIsInput don't match",
+}
+
+// RuntimeError is an error reported by a circom 1 WitnessCalc WASM module
+// through the runtime.error import, which aborts the calculation.
+type RuntimeError struct {
+	Code int
+	Msg  string
+	// Args are the a, b, c and d arguments of the import, whose meaning
+	// depends on the code, e.g. the hash of the signal not found.
+	Args [4]int32
+	// Signal is the name of the signal the error refers to, if known.
+	Signal string
+}
+
+// Error returns the decoded message of the error.
+func (e *RuntimeError) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		var ok bool
+		if msg, ok = runtimeErrorMessages[e.Code]; !ok {
+			msg = "Unknown error"
+		}
+	}
+	if e.Signal != "" {
+		msg = fmt.Sprintf("signal %s: %s", e.Signal, msg)
+	}
+	switch e.Code {
+	case ErrCodeHashNotFound:
+		msg += " (the signal is not an input of the circuit)"
+	case ErrCodeSignalAssignedTwice:
+		msg += " (the input has more values than the signal, or sets a signal calculated by the circuit)"
+	case ErrCodeStackOutOfMemory, ErrCodeStackTooSmall:
+		msg += " (increase the runtime memory)"
+	}
+	return fmt.Sprintf("WASM error %d: %s", e.Code, msg)
+}
@@ -0,0 +1,375 @@
+package witnesscalc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrLossyInput is the error of the input values an InputSchema can't
+// convert without changing them, like 1.5 for an integer, 256 for a uint8 or
+// a float64 above 2^53.
+var ErrLossyInput = errors.New("lossy input conversion")
+
+// InputKind is the type of the values of an input signal in an InputSchema.
+type InputKind int
+
+// The kinds of the input values.
+const (
+	// InputField values are field elements given as integers: JSON numbers,
+	// base-10, "0x" prefixed or scientific notation strings, *big.Int or Go
+	// integers.  Negative values are reduced modulo the prime, and rejected
+	// without one.
+	InputField InputKind = iota
+	// InputBool values are booleans, true and false or their "true" and
+	// "false" strings, and the integers 0 and 1.
+	InputBool
+	// InputUint values are the integers in [0, 2^Bits).
+	InputUint
+	// InputBytes32 values are 32 byte values, big-endian: "0x" prefixed
+	// strings of 64 hexadecimal digits, [32]byte arrays, 32 byte slices, or
+	// integers in [0, 2^256).
+	InputBytes32
+	// InputAddress values are Ethereum addresses: "0x" prefixed strings of 40
+	// hexadecimal digits, [20]byte arrays, 20 byte slices, or integers in
+	// [0, 2^160).
+	InputAddress
+)
+
+// InputType declares the type of an input signal in an InputSchema.
+type InputType struct {
+	Kind InputKind
+	// Bits is the size of the InputUint values.
+	Bits int
+	// Shape is the shape of the array signals, nil for single values.
+	Shape []int
+}
+
+// ParseInputType parses the notation of String, the kind, "field", "bool",
+// "uint<bits>", "bytes32" or "address", followed by the dimensions of the
+// array signals, e.g. "uint8[2][3]".
+func ParseInputType(s string) (InputType, error) {
+	var t InputType
+	kind := s
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		kind = s[:i]
+		for dims := s[i:]; dims != ""; {
+			end := strings.IndexByte(dims, ']')
+			if dims[0] != '[' || end < 0 {
+				return InputType{}, fmt.Errorf("input type %q: invalid dimensions", s)
+			}
+			n, err := strconv.Atoi(dims[1:end])
+			if err != nil || n <= 0 {
+				return InputType{}, fmt.Errorf("input type %q: invalid dimension %q", s, dims[1:end])
+			}
+			t.Shape = append(t.Shape, n)
+			dims = dims[end+1:]
+		}
+	}
+	switch {
+	case kind == "field":
+		t.Kind = InputField
+	case kind == "bool":
+		t.Kind = InputBool
+	case kind == "bytes32":
+		t.Kind = InputBytes32
+	case kind == "address":
+		t.Kind = InputAddress
+	case strings.HasPrefix(kind, "uint"):
+		bits, err := strconv.Atoi(kind[len("uint"):])
+		if err != nil || bits <= 0 || bits > 256 {
+			return InputType{}, fmt.Errorf("input type %q: invalid uint size", s)
+		}
+		t.Kind = InputUint
+		t.Bits = bits
+	default:
+		return InputType{}, fmt.Errorf("input type %q: unknown kind %q", s, kind)
+	}
+	return t, nil
+}
+
+// String returns the notation of the type parsed by ParseInputType.
+func (t InputType) String() string {
+	var b strings.Builder
+	switch t.Kind {
+	case InputField:
+		b.WriteString("field")
+	case InputBool:
+		b.WriteString("bool")
+	case InputUint:
+		fmt.Fprintf(&b, "uint%d", t.Bits)
+	case InputBytes32:
+		b.WriteString("bytes32")
+	case InputAddress:
+		b.WriteString("address")
+	default:
+		fmt.Fprintf(&b, "kind %d", int(t.Kind))
+	}
+	for _, n := range t.Shape {
+		fmt.Fprintf(&b, "[%d]", n)
+	}
+	return b.String()
+}
+
+// InputSchema declares the types of the input signals, to coerce loosely
+// typed inputs, like the ones decoded from the JSON of a request, into field
+// elements with Coerce or WithInputSchema.  In JSON it is an object of the
+// types in the notation of ParseInputType:
+//
+//	{"nullifier": "field", "isOld": "bool", "amounts": "uint64[4]", "owner": "address"}
+type InputSchema map[string]InputType
+
+// ParseInputSchema parses an InputSchema in JSON.
+func ParseInputSchema(b []byte) (InputSchema, error) {
+	var s InputSchema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// MarshalJSON encodes the schema as an object of the types in the notation
+// of ParseInputType.
+func (s InputSchema) MarshalJSON() ([]byte, error) {
+	types := make(map[string]string, len(s))
+	for name, t := range s {
+		types[name] = t.String()
+	}
+	return json.Marshal(types)
+}
+
+// UnmarshalJSON decodes a schema encoded by MarshalJSON.
+func (s *InputSchema) UnmarshalJSON(b []byte) error {
+	var types map[string]string
+	if err := json.Unmarshal(b, &types); err != nil {
+		return err
+	}
+	schema := make(InputSchema, len(types))
+	for name, typ := range types {
+		t, err := ParseInputType(typ)
+		if err != nil {
+			return fmt.Errorf("input %s: %w", name, err)
+		}
+		schema[name] = t
+	}
+	*s = schema
+	return nil
+}
+
+// Coerce converts the values of the inputs to the field elements of their
+// types, in the format of ParseInputs: *big.Int values and []interface{}
+// arrays of the shape of the signals.  The values can be loosely typed, e.g.
+// the float64, bool and string values decoded by encoding/json; the ones that
+// can't be converted exactly return an error wrapping ErrLossyInput, and the
+// values of other types, the arrays of other shapes and the inputs missing in
+// the schema return an error too.  The values must be lower than prime, if it
+// isn't nil.  The inputs missing in the inputs are left for the calculators
+// to report.
+func (s InputSchema) Coerce(inputs map[string]interface{}, prime *big.Int) (map[string]interface{}, error) {
+	// Sorted, for the error to report the same input on every call.
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	coerced := make(map[string]interface{}, len(inputs))
+	for _, name := range names {
+		path := fmt.Sprintf("inputs[%s]", name)
+		t, ok := s[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: input not in the schema", path)
+		}
+		v, err := t.coerce(path, inputs[name], t.Shape, prime)
+		if err != nil {
+			return nil, err
+		}
+		coerced[name] = v
+	}
+	return coerced, nil
+}
+
+// coerce converts the value v at path, an array of shape, to the type t.
+func (t InputType) coerce(path string, v interface{}, shape []int, prime *big.Int) (interface{}, error) {
+	if len(shape) == 0 {
+		return t.coerceValue(path, v, prime)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s: %T value, expected an array of %d", path, v, shape[0])
+	}
+	if rv.Len() != shape[0] {
+		return nil, fmt.Errorf("%s: %d values, expected %d", path, rv.Len(), shape[0])
+	}
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		var err error
+		values[i], err = t.coerce(fmt.Sprintf("%s[%d]", path, i), rv.Index(i).Interface(), shape[1:], prime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// coerceValue converts the single value v at path to the type t.
+func (t InputType) coerceValue(path string, v interface{}, prime *big.Int) (*big.Int, error) {
+	var n *big.Int
+	var err error
+	switch t.Kind {
+	case InputField:
+		n, err = coerceInteger(v)
+		if err == nil && n.Sign() < 0 {
+			if prime == nil {
+				err = fmt.Errorf("negative value %v without the prime to reduce it", n)
+			} else {
+				n.Mod(n, prime)
+			}
+		}
+	case InputBool:
+		n, err = coerceBool(v)
+	case InputUint:
+		n, err = coerceUint(v, t.Bits)
+	case InputBytes32:
+		n, err = coerceBytes(v, 32)
+	case InputAddress:
+		n, err = coerceBytes(v, 20)
+	default:
+		err = fmt.Errorf("unknown input kind %d", int(t.Kind))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", path, t, err)
+	}
+	if prime != nil && n.Cmp(prime) >= 0 {
+		return nil, fmt.Errorf("%s: %s: %v is not lower than the prime: %w", path, t, n, ErrLossyInput)
+	}
+	return n, nil
+}
+
+// coerceInteger converts the integer v, a number in any of the forms of
+// InputField, to a new *big.Int.
+func coerceInteger(v interface{}) (*big.Int, error) {
+	switch a := v.(type) {
+	case nil:
+		return nil, fmt.Errorf("null value")
+	case bool:
+		return nil, fmt.Errorf("boolean %v is not a number", a)
+	case float32:
+		return coerceFloat(float64(a))
+	case float64:
+		return coerceFloat(a)
+	case json.Number:
+		n, err := parseInputNumber(a)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, ErrLossyInput)
+		}
+		return n, nil
+	case string:
+		return parseInputString(a)
+	case BigIntValuer:
+		x, err := valuerBigInt(a)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).Set(x), nil
+	case SignalValue:
+		if a == nil || reflect.ValueOf(a).Kind() == reflect.Ptr && reflect.ValueOf(a).IsNil() {
+			return nil, fmt.Errorf("nil %T", a)
+		}
+		return new(big.Int).Set(bigValue(a)), nil
+	}
+	if n, ok := goInteger(v); ok {
+		return n, nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+// coerceFloat converts the float f, as decoded by encoding/json, to a
+// *big.Int if it is an integer represented exactly.
+func coerceFloat(f float64) (*big.Int, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) || f != math.Trunc(f) {
+		return nil, fmt.Errorf("%v is not an integer: %w", f, ErrLossyInput)
+	}
+	// Above 2^53 the integers may have been rounded when decoded.
+	if math.Abs(f) > 1<<53 {
+		return nil, fmt.Errorf("%v exceeds the float64 precision: %w", f, ErrLossyInput)
+	}
+	return big.NewInt(int64(f)), nil
+}
+
+// coerceBool converts the boolean v to 0 or 1.
+func coerceBool(v interface{}) (*big.Int, error) {
+	switch a := v.(type) {
+	case bool:
+		if a {
+			return big.NewInt(1), nil
+		}
+		return big.NewInt(0), nil
+	case string:
+		switch a {
+		case "true":
+			return big.NewInt(1), nil
+		case "false":
+			return big.NewInt(0), nil
+		}
+	}
+	n, err := coerceInteger(v)
+	if err != nil {
+		return nil, err
+	}
+	if n.Sign() < 0 || n.Cmp(big.NewInt(1)) > 0 {
+		return nil, fmt.Errorf("%v is not a boolean: %w", n, ErrLossyInput)
+	}
+	return n, nil
+}
+
+// coerceUint converts the unsigned integer v of the given bits.
+func coerceUint(v interface{}, bits int) (*big.Int, error) {
+	n, err := coerceInteger(v)
+	if err != nil {
+		return nil, err
+	}
+	if n.Sign() < 0 || n.BitLen() > bits {
+		return nil, fmt.Errorf("%v overflows uint%d: %w", n, bits, ErrLossyInput)
+	}
+	return n, nil
+}
+
+// coerceBytes converts the big-endian value v of size bytes: a "0x"
+// prefixed hexadecimal string of 2*size digits, a byte array or slice of
+// size bytes, or an integer of size bytes.
+func coerceBytes(v interface{}, size int) (*big.Int, error) {
+	if s, ok := v.(string); ok && strings.HasPrefix(s, "0x") {
+		if len(s) != 2+2*size {
+			return nil, fmt.Errorf("%q has %d hexadecimal digits, expected %d", s, len(s)-2, 2*size)
+		}
+		b, err := hex.DecodeString(s[2:])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", s, err)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Type().Elem().Kind() == reflect.Uint8 {
+		if rv.Len() != size {
+			return nil, fmt.Errorf("%d bytes, expected %d", rv.Len(), size)
+		}
+		b := make([]byte, size)
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return new(big.Int).SetBytes(b), nil
+	}
+	n, err := coerceInteger(v)
+	if err != nil {
+		return nil, err
+	}
+	if n.Sign() < 0 || n.BitLen() > size*8 {
+		return nil, fmt.Errorf("%v doesn't fit in %d bytes: %w", n, size, ErrLossyInput)
+	}
+	return n, nil
+}
@@ -0,0 +1,133 @@
+package witnesscalc
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInputType(t *testing.T) {
+	for s, want := range map[string]InputType{
+		"field":         {Kind: InputField},
+		"bool[3]":       {Kind: InputBool, Shape: []int{3}},
+		"uint64":        {Kind: InputUint, Bits: 64},
+		"bytes32[2][4]": {Kind: InputBytes32, Shape: []int{2, 4}},
+		"address":       {Kind: InputAddress},
+		"uint256[1][1]": {Kind: InputUint, Bits: 256, Shape: []int{1, 1}},
+	} {
+		got, err := ParseInputType(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+		assert.Equal(t, s, got.String())
+	}
+
+	for _, s := range []string{"", "int8", "uint", "uint0", "uint257", "field[", "field[0]", "field[2", "field]2["} {
+		_, err := ParseInputType(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestInputSchemaJSON(t *testing.T) {
+	s, err := ParseInputSchema([]byte(`{"a": "field", "b": "uint8[2]"}`))
+	require.NoError(t, err)
+	assert.Equal(t, InputSchema{
+		"a": {Kind: InputField},
+		"b": {Kind: InputUint, Bits: 8, Shape: []int{2}},
+	}, s)
+	b, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a": "field", "b": "uint8[2]"}`, string(b))
+
+	_, err = ParseInputSchema([]byte(`{"a": "felt"}`))
+	assert.EqualError(t, err, `input a: input type "felt": unknown kind "felt"`)
+}
+
+func TestInputSchemaCoerce(t *testing.T) {
+	schema, err := ParseInputSchema([]byte(`{
+		"f": "field",
+		"flags": "bool[3]",
+		"n": "uint8[2][2]",
+		"h": "bytes32",
+		"owner": "address"
+	}`))
+	require.NoError(t, err)
+	var inputs map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"f": -1,
+		"flags": [true, 0, "false"],
+		"n": [[0, "255"], [1e2, 7]],
+		"h": "0x00000000000000000000000000000000000000000000000000000000000000ff",
+		"owner": "0x000000000000000000000000000000000000dEaD"
+	}`), &inputs))
+	prime := big.NewInt(65537)
+	coerced, err := schema.Coerce(inputs, prime)
+	require.NoError(t, err)
+	assert.Equal(t, "65536", coerced["f"].(*big.Int).String())
+
+	// negative field values of any size are reduced
+	reduced, err := InputSchema{"f": {Kind: InputField, Shape: []int{3}}}.
+		Coerce(map[string]interface{}{"f": []interface{}{-65537, int64(-65538), "-131073"}}, prime)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0", "65536", "1"}, coercedStrings(reduced["f"].([]interface{})))
+	assert.Equal(t, []string{"1", "0", "0"}, coercedStrings(coerced["flags"].([]interface{})))
+	n := coerced["n"].([]interface{})
+	assert.Equal(t, []string{"0", "255"}, coercedStrings(n[0].([]interface{})))
+	assert.Equal(t, []string{"100", "7"}, coercedStrings(n[1].([]interface{})))
+	assert.Equal(t, "255", coerced["h"].(*big.Int).String())
+	assert.Equal(t, "57005", coerced["owner"].(*big.Int).String())
+
+	// Go values
+	var owner [20]byte
+	owner[19] = 1
+	coerced, err = InputSchema{"owner": {Kind: InputAddress}, "n": {Kind: InputUint, Bits: 16}}.
+		Coerce(map[string]interface{}{"owner": owner, "n": uint16(65535)}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1", coerced["owner"].(*big.Int).String())
+	assert.Equal(t, "65535", coerced["n"].(*big.Int).String())
+
+	for _, tc := range []struct {
+		typ   string
+		value interface{}
+		err   string
+		lossy bool
+	}{
+		{"field", 1.5, "inputs[a]: field: 1.5 is not an integer: lossy input conversion", true},
+		{"field", 1e20, "inputs[a]: field: 1e+20 exceeds the float64 precision: lossy input conversion", true},
+		{"field", json.Number("2.5"), "inputs[a]: field: Error parsing input 2.5: not an integer: lossy input conversion", true},
+		{"field", "70000", "inputs[a]: field: 70000 is not lower than the prime: lossy input conversion", true},
+		{"field", true, "inputs[a]: field: boolean true is not a number", false},
+		{"field", nil, "inputs[a]: field: null value", false},
+		{"bool", 2.0, "inputs[a]: bool: 2 is not a boolean: lossy input conversion", true},
+		{"uint8", 256.0, "inputs[a]: uint8: 256 overflows uint8: lossy input conversion", true},
+		{"uint8", -1.0, "inputs[a]: uint8: -1 overflows uint8: lossy input conversion", true},
+		{"address", "0xdead", `inputs[a]: address: "0xdead" has 4 hexadecimal digits, expected 40`, false},
+		{"address", []byte{1}, "inputs[a]: address: 1 bytes, expected 20", false},
+		{"bool[2]", []interface{}{true}, "inputs[a]: 1 values, expected 2", false},
+		{"bool[2]", true, "inputs[a]: bool value, expected an array of 2", false},
+		{"uint8[1][2]", []interface{}{[]interface{}{1.0, 300.0}}, "inputs[a][0][1]: uint8[1][2]: 300 overflows uint8: lossy input conversion", true},
+	} {
+		typ, err := ParseInputType(tc.typ)
+		require.NoError(t, err)
+		_, err = InputSchema{"a": typ}.Coerce(map[string]interface{}{"a": tc.value}, prime)
+		assert.EqualError(t, err, tc.err)
+		assert.Equal(t, tc.lossy, errors.Is(err, ErrLossyInput), tc.err)
+	}
+
+	_, err = InputSchema{"a": {Kind: InputField}}.Coerce(map[string]interface{}{"a": -1}, nil)
+	assert.EqualError(t, err, "inputs[a]: field: negative value -1 without the prime to reduce it")
+	_, err = InputSchema{}.Coerce(map[string]interface{}{"a": 1.0}, nil)
+	assert.EqualError(t, err, "inputs[a]: input not in the schema")
+}
+
+// coercedStrings returns the base 10 strings of the *big.Int values coerced.
+func coercedStrings(values []interface{}) []string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = v.(*big.Int).String()
+	}
+	return s
+}
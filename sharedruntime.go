@@ -0,0 +1,212 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	wasm3 "github.com/iden3/go-wasm3"
+)
+
+// SharedRuntime is a wasm3 runtime hosting the WitnessCalc WASM modules of
+// several circom 1 circuits, for services with many small circuits, which
+// otherwise pay for a runtime, its environment and its stack per circuit.
+//
+// wasm3 gives the modules of a runtime a single linear memory and resolves
+// the exported functions by name across them.  The exports of every module
+// are resolved when it is loaded, while it is the first one in the lookups,
+// and its calculator only calls those.  The memory holds the one of the
+// module last called: the others are kept aside and swapped in when their
+// calculator calls them, which copies the memory, so the calculations of a
+// circuit are best grouped.
+//
+// The calculators of a SharedRuntime are not safe for concurrent use, even
+// distinct ones: they all run on the same runtime.
+type SharedRuntime struct {
+	runtime *wasm3.Runtime
+	// active is the module whose memory is in the runtime, nil if none is.
+	active *sharedModule
+	closed bool
+}
+
+// NewSharedRuntime creates a SharedRuntime whose stack is sized by the
+// WithStackSize option.  Close must be called to release it.
+func NewSharedRuntime(opts ...Option) (*SharedRuntime, error) {
+	o := newOptions(opts)
+	runtime := wasm3.NewRuntime(&wasm3.Config{
+		Environment: wasm3.NewEnvironment(),
+		StackSize:   o.stackSize,
+	})
+	// An empty memory, that the modules resize when loaded, so that it can
+	// be cleared before loading any of them.
+	if err := runtime.ResizeMemory(0); err != nil {
+		runtime.Destroy()
+		return nil, err
+	}
+	return &SharedRuntime{runtime: runtime}, nil
+}
+
+// LoadWitnessCalculator loads the WitnessCalc WASM module into the shared
+// runtime and creates its WitnessCalculator.  The stack size options don't
+// apply: calculations that overflow the stack of the shared runtime are not
+// retried, and ReloadModule is not supported.  wasm3 can't unload modules, so
+// the modules of the calculators that failed to be created, like the ones of
+// calculators no longer used, stay in the runtime until it is closed.
+func (s *SharedRuntime) LoadWitnessCalculator(wasmBytes []byte, opts ...Option) (_ *WitnessCalculator, err error) {
+	if s.closed {
+		return nil, errors.New("the SharedRuntime is closed")
+	}
+	o := newOptions(opts)
+	start := time.Now()
+	defer func() { traceSpan(o.tracer, context.Background(), SpanLoad, start, time.Now(), err) }()
+	wasmBytes, err = DecompressWASM(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	exports, err := parseWASMExports(wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	m := &sharedModule{shared: s, exports: make(map[string]bool), funcs: make(map[string]wasm3.FunctionWrapper)}
+	for _, exp := range exports {
+		if exp.Kind == wasmExternFunction {
+			m.exports[exp.Name] = true
+		}
+	}
+
+	// The module starts from a zeroed memory, with its data segments only.
+	s.deactivate()
+	mem := s.runtime.Memory()
+	for i := range mem {
+		mem[i] = 0
+	}
+	if _, err := loadModule(s.runtime, wasmBytes, o); err != nil {
+		return nil, err
+	}
+	s.active = m
+	m.loading = true
+	wc, err := newWitnessCalculator(m, wasmBytes, opts)
+	m.loading = false
+	if err != nil {
+		s.active = nil
+		return nil, err
+	}
+	return wc, nil
+}
+
+// Close releases the runtime and the modules loaded into it, after which
+// their calculators must no longer be used.
+func (s *SharedRuntime) Close() {
+	if !s.closed {
+		s.runtime.Destroy()
+		s.active = nil
+		s.closed = true
+	}
+}
+
+// deactivate keeps aside the memory of the active module.
+func (s *SharedRuntime) deactivate() {
+	if s.active == nil {
+		return
+	}
+	mem := s.runtime.Memory()
+	s.active.memory = append(make([]byte, 0, len(mem)), mem...)
+	s.active = nil
+}
+
+// activate puts the memory of the module m in the runtime.
+func (s *SharedRuntime) activate(m *sharedModule) error {
+	if s.closed {
+		return errors.New("the SharedRuntime is closed")
+	}
+	if s.active == m {
+		return nil
+	}
+	s.deactivate()
+	if len(m.memory) != s.runtime.GetAllocatedMemoryLength() {
+		if err := s.runtime.ResizeMemory(int32(len(m.memory) / wasmPageSize)); err != nil {
+			return fmt.Errorf("restoring the module memory: %w", err)
+		}
+	}
+	copy(s.runtime.Memory(), m.memory)
+	m.memory = nil
+	s.active = m
+	return nil
+}
+
+// sharedModule is the Runtime of the calculator of a module loaded into a
+// SharedRuntime, which resolves the functions of the module only and swaps
+// its memory in when used.
+type sharedModule struct {
+	shared *SharedRuntime
+	// exports are the functions exported by the module.
+	exports map[string]bool
+	// funcs are the exports resolved while the module was loaded.
+	funcs map[string]wasm3.FunctionWrapper
+	// loading is set while the module is the last one loaded, when its
+	// functions can be resolved and attached.
+	loading bool
+	// memory is the memory of the module while another one is active.
+	memory []byte
+}
+
+var _ memoryResizer = (*sharedModule)(nil)
+
+// AttachFunction attaches a function to the imports of the module.  It does
+// nothing once the module has been loaded.
+func (m *sharedModule) AttachFunction(moduleName string, functionName string, signature string, callback wasm3.CallbackFunction) {
+	if m.loading {
+		m.shared.runtime.AttachFunction(moduleName, functionName, signature, callback)
+	}
+}
+
+// FindFunction returns the function exported by the module as funcName.
+// Only the functions resolved while the module was loaded are found
+// afterwards.
+func (m *sharedModule) FindFunction(funcName string) (wasm3.FunctionWrapper, error) {
+	f, ok := m.funcs[funcName]
+	if !ok {
+		if !m.exports[funcName] || !m.loading {
+			return nil, fmt.Errorf("function %s not found", funcName)
+		}
+		var err error
+		if f, err = m.shared.runtime.FindFunction(funcName); err != nil {
+			return nil, err
+		}
+		m.funcs[funcName] = f
+	}
+	return func(args ...interface{}) (interface{}, error) {
+		if err := m.shared.activate(m); err != nil {
+			return nil, err
+		}
+		return f(args...)
+	}, nil
+}
+
+// Memory returns the memory of the module, nil if it can't be restored.
+func (m *sharedModule) Memory() []byte {
+	if err := m.shared.activate(m); err != nil {
+		return nil
+	}
+	return m.shared.runtime.Memory()
+}
+
+// GetAllocatedMemoryLength returns the size of the memory of the module.
+func (m *sharedModule) GetAllocatedMemoryLength() int {
+	if m.shared.active != m {
+		return len(m.memory)
+	}
+	return m.shared.runtime.GetAllocatedMemoryLength()
+}
+
+// ResizeMemory resizes the memory of the module to numPages pages.
+func (m *sharedModule) ResizeMemory(numPages int32) error {
+	if err := m.shared.activate(m); err != nil {
+		return err
+	}
+	return m.shared.runtime.ResizeMemory(numPages)
+}
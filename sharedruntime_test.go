@@ -0,0 +1,70 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedRuntime(t *testing.T) {
+	type circuit struct {
+		wasm     []byte
+		inputs   map[string]interface{}
+		expected *Witness
+	}
+	var circuits []circuit
+	for _, name := range []string{"mycircuit", "smtverifier10"} {
+		wasmBytes, err := ioutil.ReadFile("test_files/" + name + ".wasm")
+		require.Nil(t, err)
+		inputsFile := "test_files/" + name + "-input.json"
+		if name == "mycircuit" {
+			inputsFile = "test_files/mycircuit-input1.json"
+		}
+		inputsBytes, err := ioutil.ReadFile(inputsFile)
+		require.Nil(t, err)
+		inputs, err := ParseInputs(inputsBytes)
+		require.Nil(t, err)
+		expected, err := CalculateWitnessBinWASM(wasmBytes, inputs)
+		require.Nil(t, err)
+		circuits = append(circuits, circuit{wasmBytes, inputs, expected})
+	}
+
+	shared, err := NewSharedRuntime()
+	require.Nil(t, err)
+	defer shared.Close()
+
+	// Two calculators of each circuit, loaded into the same runtime.
+	var calcs []*WitnessCalculator
+	for i := 0; i < 4; i++ {
+		wc, err := shared.LoadWitnessCalculator(circuits[i%2].wasm)
+		require.Nil(t, err)
+		calcs = append(calcs, wc)
+	}
+	_, err = shared.LoadWitnessCalculator([]byte("not wasm"))
+	require.Error(t, err)
+
+	// Interleaved calculations, each module running with its own functions
+	// and memory.
+	for round := 0; round < 2; round++ {
+		for i, wc := range calcs {
+			w, err := wc.CalculateWitness(circuits[i%2].inputs, true)
+			require.Nil(t, err)
+			assert.Equal(t, circuits[i%2].expected, w, "calculator %d", i)
+		}
+	}
+
+	// A calculator failing leaves the others working.
+	_, err = calcs[0].CalculateWitness(map[string]interface{}{"unknown": 1}, true)
+	require.Error(t, err)
+	w, err := calcs[1].CalculateWitness(circuits[1].inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, circuits[1].expected, w)
+	w, err = calcs[0].CalculateWitness(circuits[0].inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, circuits[0].expected, w)
+}
@@ -0,0 +1,254 @@
+package witnesscalc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SignalID identifies an input signal by the 64 bit FNV-1a hash of its name,
+// split into the two 32 bit halves the WASM module looks signals up with.
+type SignalID struct {
+	MSB int32
+	LSB int32
+}
+
+// NewSignalID returns the SignalID of the input signal name.
+func NewSignalID(name string) SignalID {
+	msb, lsb := SignalHash(name)
+	return SignalID{MSB: msb, LSB: lsb}
+}
+
+// String returns the hash in hexadecimal.
+func (id SignalID) String() string {
+	return fmt.Sprintf("%08x%08x", uint32(id.MSB), uint32(id.LSB))
+}
+
+// HashedInput is an input signal identified by its precomputed SignalID, with
+// its values flattened in row-major order.
+type HashedInput struct {
+	ID     SignalID
+	Values []*big.Int
+}
+
+// ErrUnknownInput is the error returned for inputs that are not input
+// signals of the circuit, detected before writing their values.
+type ErrUnknownInput struct {
+	Name string
+	// Err is the error reported by the module, if any.
+	Err error
+}
+
+// Error returns the name of the input and the error of the module.
+func (e ErrUnknownInput) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("unknown input %s: %v", e.Name, e.Err)
+	}
+	return fmt.Sprintf("unknown input %s", e.Name)
+}
+
+// Unwrap returns the error reported by the module.
+func (e ErrUnknownInput) Unwrap() error {
+	return e.Err
+}
+
+// ErrTooManyValues is the error, tested with errors.Is, of the calculations
+// given more values for an input signal than its size, which would be written
+// over the signals that follow it.  The sizes are given by the circom 2
+// modules that export getInputSignalSize, and otherwise by the symbols of
+// WithSymbols; the calculations without either can't detect the overflow.
+var ErrTooManyValues = errors.New("too many values for input signal")
+
+// inputSizeError is the error for an input signal given with a number of
+// values different from its size.
+type inputSizeError struct {
+	name   string
+	values int
+	size   int
+}
+
+func (e inputSizeError) Error() string {
+	if e.values < e.size {
+		return fmt.Sprintf("not enough values for input signal %s", e.name)
+	}
+	return fmt.Sprintf("too many values for input signal %s", e.name)
+}
+
+// Is reports whether target is ErrTooManyValues for the signals given too
+// many values.
+func (e inputSizeError) Is(target error) bool {
+	return target == ErrTooManyValues && e.values > e.size
+}
+
+// symSignalSizes returns the sizes of the signals of the main component,
+// their number of elements in syms, by SignalID.
+func symSignalSizes(syms []Symbol) map[SignalID]int {
+	sizes := make(map[SignalID]int)
+	for _, sym := range syms {
+		if name, ok := mainSignalName(sym.Name); ok {
+			sizes[NewSignalID(name)]++
+		}
+	}
+	return sizes
+}
+
+// ErrMissingInputs is the error, tested with errors.Is, of the calculations
+// that didn't set all the input signals of the circuit (see
+// WithMissingInputs).
+var ErrMissingInputs = errors.New("missing inputs")
+
+// ErrNoInputs is the error of the calculations without inputs with
+// WithRequireInputs.
+var ErrNoInputs = errors.New("no inputs")
+
+// missingInputsError is the error for calculations that didn't set all the
+// input signals.
+type missingInputsError struct {
+	set  int
+	size int
+	// names are the missing input signals, if the inputs of the circuit are
+	// known.
+	names []string
+}
+
+func (e missingInputsError) Error() string {
+	if e.names != nil {
+		return fmt.Sprintf("missing inputs: %s", strings.Join(e.names, ", "))
+	}
+	return fmt.Sprintf("not all inputs have been set: only %d out of %d", e.set, e.size)
+}
+
+// Is reports whether target is ErrMissingInputs.
+func (e missingInputsError) Is(target error) bool {
+	return target == ErrMissingInputs
+}
+
+// signalInput is an input signal ready to be set in the WASM module.
+type signalInput struct {
+	name    string // used in errors
+	id      SignalID
+	values  []SignalValue
+	ndarray *NDArray // set if the input was given as an NDArray
+	encoded [][]byte // the values encoded for the module, for StaticInputs
+}
+
+// checkSize returns an ErrTooManyValues error if the signal has more values
+// than its size in sizes, which has the sizes of the signals by SignalID.
+// The signals missing from sizes aren't checked.
+func (s signalInput) checkSize(sizes map[SignalID]int) error {
+	if size, ok := sizes[s.id]; ok && len(s.values) > size {
+		return inputSizeError{name: s.name, values: len(s.values), size: size}
+	}
+	return nil
+}
+
+// newSignalInputs hashes the input names and flattens their values.
+func newSignalInputs(inputs map[string]interface{}) ([]signalInput, error) {
+	signals := make([]signalInput, 0, len(inputs))
+	for inputName, inputValue := range inputs {
+		fSlice, err := flatSignalValues(inputValue)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", inputName, err)
+		}
+		ndarray, _ := inputValue.(*NDArray)
+		signals = append(signals, signalInput{
+			name:    inputName,
+			id:      NewSignalID(inputName),
+			values:  fSlice,
+			ndarray: ndarray,
+		})
+	}
+	return signals, nil
+}
+
+// newHashedSignalInputs converts the pre-hashed inputs, checking the values.
+func newHashedSignalInputs(inputs []HashedInput) ([]signalInput, error) {
+	signals := make([]signalInput, len(inputs))
+	for i, input := range inputs {
+		name := "signal " + input.ID.String()
+		values := make([]SignalValue, len(input.Values))
+		for j, v := range input.Values {
+			if v == nil {
+				return nil, fmt.Errorf("input %s[%d]: nil value", name, j)
+			}
+			values[j] = v
+		}
+		signals[i] = signalInput{name: name, id: input.ID, values: values}
+	}
+	return signals, nil
+}
+
+// StaticInputs are input signals whose values don't change across
+// calculations, e.g. a Merkle root or the parameters of a circuit.  Their
+// names are hashed and their values flattened once, and encoded once for each
+// field, so that the calculations with CalculateWitnessStatic only process
+// the dynamic inputs.  The static inputs are not linted.  StaticInputs are
+// safe for concurrent use and can be shared by the calculators of different
+// circuits.
+type StaticInputs struct {
+	signals []signalInput
+	ids     map[SignalID]bool
+	mu      sync.Mutex
+	// encoded holds the signals with their encoded values by field.
+	encoded map[string][]signalInput
+}
+
+// NewStaticInputs prepares the static inputs.
+func NewStaticInputs(inputs map[string]interface{}) (*StaticInputs, error) {
+	signals, err := newSignalInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(signals, func(i, j int) bool { return signals[i].name < signals[j].name })
+	ids := make(map[SignalID]bool, len(signals))
+	for _, signal := range signals {
+		ids[signal.id] = true
+	}
+	return &StaticInputs{signals: signals, ids: ids, encoded: make(map[string][]signalInput)}, nil
+}
+
+// encode returns the static signals with their values encoded with encode,
+// which is called only the first time for the field key.
+func (s *StaticInputs) encode(key string, encode func(v SignalValue) ([]byte, error)) ([]signalInput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if signals, ok := s.encoded[key]; ok {
+		return signals, nil
+	}
+	signals := make([]signalInput, len(s.signals))
+	for i, signal := range s.signals {
+		signal.encoded = make([][]byte, len(signal.values))
+		for j, v := range signal.values {
+			b, err := encode(v)
+			if err != nil {
+				return nil, fmt.Errorf("static input %s[%d] = %v: %w", signal.name, j, v, err)
+			}
+			signal.encoded[j] = b
+		}
+		signals[i] = signal
+	}
+	s.encoded[key] = signals
+	return signals, nil
+}
+
+// withInputs returns the static signals, encoded with encode for the field
+// key, followed by the dynamic inputs, which must not set static signals.
+func (s *StaticInputs) withInputs(key string, encode func(v SignalValue) ([]byte, error), inputs map[string]interface{}) ([]signalInput, error) {
+	static, err := s.encode(key, encode)
+	if err != nil {
+		return nil, err
+	}
+	dynamic, err := newSignalInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	for _, signal := range dynamic {
+		if s.ids[signal.id] {
+			return nil, fmt.Errorf("input %s is static", signal.name)
+		}
+	}
+	return append(static[:len(static):len(static)], dynamic...), nil
+}
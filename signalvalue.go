@@ -0,0 +1,253 @@
+package witnesscalc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strings"
+)
+
+// SignalValue is the value of an input signal, in whatever encoding the
+// caller has it.  The inputs of the calculators take SignalValues wherever
+// they take a *big.Int, which implements it, and write them into the WASM
+// memory without converting them to a *big.Int when possible.  The method set
+// is the one of *big.Int.
+type SignalValue interface {
+	// Sign returns -1, 0 or +1 for negative, zero and positive values.
+	Sign() int
+	// BitLen returns the length of the absolute value in bits.
+	BitLen() int
+	// FillBytes sets buf to the absolute value as a zero-extended big-endian
+	// byte slice and returns buf.  It panics if the value doesn't fit in buf.
+	FillBytes(buf []byte) []byte
+}
+
+var (
+	_ SignalValue = (*big.Int)(nil)
+	_ SignalValue = BigInt{}
+	_ SignalValue = Uint64(0)
+	_ SignalValue = HexString("")
+	_ SignalValue = BytesLE(nil)
+	_ SignalValue = BitArray(nil)
+)
+
+// bigValue returns the value of v as a *big.Int, v itself if it is one.
+func bigValue(v SignalValue) *big.Int {
+	switch a := v.(type) {
+	case *big.Int:
+		return a
+	case BigInt:
+		return a.Int
+	}
+	res := new(big.Int).SetBytes(v.FillBytes(make([]byte, (v.BitLen()+7)/8)))
+	if v.Sign() < 0 {
+		res.Neg(res)
+	}
+	return res
+}
+
+// fillLE sets buf to the little-endian bytes of the non-negative value v,
+// returning an error if it doesn't fit.
+func fillLE(buf []byte, v SignalValue) error {
+	if v.Sign() < 0 {
+		return fmt.Errorf("negative value")
+	}
+	if v.BitLen() > len(buf)*8 {
+		return fmt.Errorf("value doesn't fit in %d bits", len(buf)*8)
+	}
+	v.FillBytes(buf)
+	ReverseBytes(buf, buf)
+	return nil
+}
+
+// BigInt is a *big.Int SignalValue, for callers that build []SignalValue.
+type BigInt struct {
+	*big.Int
+}
+
+// Uint64 is a SignalValue of an unsigned integer.
+type Uint64 uint64
+
+// Sign returns 0 or +1.
+func (v Uint64) Sign() int {
+	if v == 0 {
+		return 0
+	}
+	return 1
+}
+
+// BitLen returns the length of v in bits.
+func (v Uint64) BitLen() int {
+	return bits.Len64(uint64(v))
+}
+
+// FillBytes sets buf to the big-endian bytes of v.
+func (v Uint64) FillBytes(buf []byte) []byte {
+	if v.BitLen() > len(buf)*8 {
+		panic("witnesscalc: value doesn't fit in the buffer")
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	if len(buf) >= 8 {
+		copy(buf[len(buf)-8:], b[:])
+	} else {
+		copy(buf, b[8-len(buf):])
+	}
+	return buf
+}
+
+// HexString is a SignalValue of an unsigned integer in hexadecimal, with or
+// without the 0x prefix.  Invalid strings are rejected by the calculators;
+// the methods treat their invalid digits as zeros.
+type HexString string
+
+// digits returns the hexadecimal digits of s without the prefix and the
+// leading zeros.
+func (s HexString) digits() string {
+	d := strings.TrimPrefix(strings.TrimPrefix(string(s), "0x"), "0X")
+	return strings.TrimLeft(d, "0")
+}
+
+// validate checks that s is a hexadecimal integer.
+func (s HexString) validate() error {
+	d := strings.TrimPrefix(strings.TrimPrefix(string(s), "0x"), "0X")
+	if d == "" {
+		return fmt.Errorf("invalid hexadecimal value %q", string(s))
+	}
+	for i := 0; i < len(d); i++ {
+		if hexDigit(d[i]) < 0 {
+			return fmt.Errorf("invalid hexadecimal value %q", string(s))
+		}
+	}
+	return nil
+}
+
+// hexDigit returns the value of the hexadecimal digit c, or -1.
+func hexDigit(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+// Sign returns 0 or +1.
+func (s HexString) Sign() int {
+	if s.BitLen() == 0 {
+		return 0
+	}
+	return 1
+}
+
+// BitLen returns the length of the value in bits.
+func (s HexString) BitLen() int {
+	d := s.digits()
+	for len(d) > 0 && hexDigit(d[0]) <= 0 {
+		d = d[1:]
+	}
+	if d == "" {
+		return 0
+	}
+	return 4*(len(d)-1) + bits.Len(uint(hexDigit(d[0])))
+}
+
+// FillBytes sets buf to the big-endian bytes of the value.
+func (s HexString) FillBytes(buf []byte) []byte {
+	if s.BitLen() > len(buf)*8 {
+		panic("witnesscalc: value doesn't fit in the buffer")
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+	d := s.digits()
+	for i := 0; i < len(d) && i < 2*len(buf); i++ {
+		digit := hexDigit(d[len(d)-1-i])
+		if digit < 0 {
+			continue
+		}
+		buf[len(buf)-1-i/2] |= byte(digit) << (4 * uint(i%2))
+	}
+	return buf
+}
+
+// BytesLE is a SignalValue of an unsigned integer in little-endian bytes.
+type BytesLE []byte
+
+// Sign returns 0 or +1.
+func (b BytesLE) Sign() int {
+	if b.BitLen() == 0 {
+		return 0
+	}
+	return 1
+}
+
+// BitLen returns the length of the value in bits.
+func (b BytesLE) BitLen() int {
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] != 0 {
+			return 8*i + bits.Len8(b[i])
+		}
+	}
+	return 0
+}
+
+// FillBytes sets buf to the big-endian bytes of the value.
+func (b BytesLE) FillBytes(buf []byte) []byte {
+	if b.BitLen() > len(buf)*8 {
+		panic("witnesscalc: value doesn't fit in the buffer")
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+	for i := 0; i < len(b) && i < len(buf); i++ {
+		buf[len(buf)-1-i] = b[i]
+	}
+	return buf
+}
+
+// BitArray is a SignalValue of an unsigned integer given by its bits in
+// little-endian order.
+type BitArray []bool
+
+// Sign returns 0 or +1.
+func (a BitArray) Sign() int {
+	if a.BitLen() == 0 {
+		return 0
+	}
+	return 1
+}
+
+// BitLen returns the length of the value in bits.
+func (a BitArray) BitLen() int {
+	for i := len(a) - 1; i >= 0; i-- {
+		if a[i] {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// FillBytes sets buf to the big-endian bytes of the value.
+func (a BitArray) FillBytes(buf []byte) []byte {
+	n := a.BitLen()
+	if n > len(buf)*8 {
+		panic("witnesscalc: value doesn't fit in the buffer")
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+	for i := 0; i < n; i++ {
+		if a[i] {
+			buf[len(buf)-1-i/8] |= 1 << uint(i%8)
+		}
+	}
+	return buf
+}
@@ -0,0 +1,46 @@
+package witnesscalc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignalValues(t *testing.T) {
+	v, ok := new(big.Int).SetString("1234567890abcdef1234567890abcdef", 16)
+	require.True(t, ok)
+	le := v.FillBytes(make([]byte, 16))
+	ReverseBytes(le, le)
+	bits := make(BitArray, 130)
+	for i := range bits {
+		bits[i] = v.Bit(i) == 1
+	}
+	for _, tt := range []struct {
+		value    SignalValue
+		expected *big.Int
+	}{
+		{BigInt{v}, v},
+		{HexString("0x1234567890abcdef1234567890abcdef"), v},
+		{HexString("001234567890ABCDEF1234567890ABCDEF"), v},
+		{BytesLE(append(le, 0, 0)), v},
+		{bits, v},
+		{Uint64(0xfedcba9876543210), new(big.Int).SetUint64(0xfedcba9876543210)},
+		{Uint64(0), new(big.Int)},
+		{HexString("0x0"), new(big.Int)},
+		{BytesLE{}, new(big.Int)},
+		{BitArray{false}, new(big.Int)},
+		{big.NewInt(-5), big.NewInt(-5)},
+	} {
+		assert.Equal(t, tt.expected.Sign(), tt.value.Sign(), "%v", tt.value)
+		assert.Equal(t, tt.expected.BitLen(), tt.value.BitLen(), "%v", tt.value)
+		assert.Equal(t, tt.expected.FillBytes(make([]byte, 20)), tt.value.FillBytes(make([]byte, 20)), "%v", tt.value)
+		assert.Equal(t, 0, tt.expected.Cmp(bigValue(tt.value)), "%v", tt.value)
+	}
+
+	assert.Panics(t, func() { Uint64(0x100).FillBytes(make([]byte, 1)) })
+	assert.Panics(t, func() { HexString("0x100").FillBytes(make([]byte, 1)) })
+	assert.Error(t, HexString("0x").validate())
+	assert.Error(t, HexString("12z").validate())
+}
@@ -0,0 +1,117 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrSnapshotUnsupported is the error of Snapshot with the runtimes that can't
+// serialize compiled modules, like the WebAssembly API of JavaScript hosts.
+var ErrSnapshotUnsupported = errors.New("the WASM runtime doesn't support snapshots")
+
+// snapshotMagic starts the snapshots, followed by their format version.
+const (
+	snapshotMagic   = "wcsnap"
+	snapshotVersion = 1
+)
+
+// moduleSnapshot is the post-init state of a WitnessCalc WASM module: the
+// module compiled by the runtime and the memory of an instance once loaded.
+type moduleSnapshot struct {
+	wasm     []byte // the module, for its imports and its CircuitHash
+	compiled []byte // the module compiled and serialized by the runtime
+	memory   []byte // the memory of a loaded instance
+}
+
+// Snapshot returns the post-init state of the module of the calculator: the
+// module compiled by the runtime and the memory of a freshly loaded instance,
+// for NewCircom2WitnessCalculatorFromSnapshot to create calculators of the
+// circuit without compiling its module, which takes seconds for big circuits.
+// Snapshots are only valid for the runtime version and the machine
+// architecture that created them.  It returns ErrSnapshotUnsupported if the
+// runtime can't serialize compiled modules.
+func (wc *Circom2WitnessCalculator) Snapshot() ([]byte, error) {
+	if wc.snapshot == nil {
+		return nil, ErrSnapshotUnsupported
+	}
+	s, err := wc.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return s.encode(), nil
+}
+
+// NewCircom2WitnessCalculatorFromSnapshot creates a Circom2WitnessCalculator
+// from a snapshot returned by Snapshot, instantiating the compiled module and
+// restoring its memory instead of compiling and initializing it.  Corrupted
+// snapshots are rejected, and the snapshots of other runtime versions or
+// machine architectures fail to load.
+func NewCircom2WitnessCalculatorFromSnapshot(snapshot []byte, opts ...Option) (*Circom2WitnessCalculator, error) {
+	s, err := decodeModuleSnapshot(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkModuleABI(s.wasm, true); err != nil {
+		return nil, err
+	}
+	wc := newCircom2WitnessCalculator(opts)
+	m, err := wc.loadSnapshot(s)
+	if err != nil {
+		return nil, err
+	}
+	m.circuitHash = NewCircuitHash(s.wasm)
+	wc.swapModule(m)
+	return wc, nil
+}
+
+// encode serializes the snapshot: the magic and the version, the module, the
+// compiled module and the memory, each prefixed by its little-endian uint64
+// length, and the SHA-256 hash of all the above.
+func (s *moduleSnapshot) encode() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(snapshotVersion))
+	for _, b := range [][]byte{s.wasm, s.compiled, s.memory} {
+		_ = binary.Write(&buf, binary.LittleEndian, uint64(len(b)))
+		buf.Write(b)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes()
+}
+
+// decodeModuleSnapshot parses a snapshot serialized by encode, checking its
+// hash.  The sections of the returned snapshot alias b.
+func decodeModuleSnapshot(b []byte) (*moduleSnapshot, error) {
+	if len(b) < len(snapshotMagic)+4+sha256.Size || string(b[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.New("invalid snapshot")
+	}
+	body, sum := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	if h := sha256.Sum256(body); !bytes.Equal(h[:], sum) {
+		return nil, errors.New("corrupted snapshot")
+	}
+	body = body[len(snapshotMagic):]
+	if v := binary.LittleEndian.Uint32(body); v != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", v)
+	}
+	body = body[4:]
+	sections := make([][]byte, 3)
+	for i := range sections {
+		if len(body) < 8 {
+			return nil, errors.New("truncated snapshot")
+		}
+		n := binary.LittleEndian.Uint64(body)
+		body = body[8:]
+		if n > uint64(len(body)) {
+			return nil, errors.New("truncated snapshot")
+		}
+		sections[i], body = body[:n], body[n:]
+	}
+	if len(body) != 0 {
+		return nil, errors.New("invalid data after the snapshot")
+	}
+	return &moduleSnapshot{wasm: sections[0], compiled: sections[1], memory: sections[2]}, nil
+}
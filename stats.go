@@ -0,0 +1,193 @@
+package witnesscalc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+)
+
+// Stats is the timing breakdown of a witness calculation, to tell whether the
+// time is spent executing the circuit or converting values on the Go side.
+type Stats struct {
+	// Init is the time spent initializing the module for the calculation.
+	Init time.Duration
+	// SetInputs is the time spent assigning the inputs, which includes the
+	// execution of the circuit triggered by the assignments.
+	SetInputs time.Duration
+	// Extract is the time spent reading the witness from the module.
+	Extract time.Duration
+	// Total is the duration of the whole calculation, including the
+	// conversion of the inputs.
+	Total time.Duration
+	// WASMCalls is the number of calls to functions exported by the module.
+	WASMCalls int
+	// InputsBytes and WitnessBytes are the sizes of the input values and of
+	// the witness encoded as field elements.
+	InputsBytes  int
+	WitnessBytes int
+	// MemPeak is the size in bytes of the WASM linear memory after the
+	// calculation, its peak as it never shrinks.
+	MemPeak int
+}
+
+// StatsSink records the Stats of the witness calculations, e.g. to plan the
+// capacity of proving clusters.  Record must be safe for concurrent use when
+// the sink is shared by several calculators.
+type StatsSink interface {
+	Record(circuit string, s Stats) error
+}
+
+// statsRecord is a line of a JSONLStatsSink.
+type statsRecord struct {
+	Time         time.Time `json:"time"`
+	Circuit      string    `json:"circuit"`
+	Duration     int64     `json:"duration_ns"`
+	InputsBytes  int       `json:"inputs_bytes"`
+	WitnessBytes int       `json:"witness_bytes"`
+	MemPeak      int       `json:"mem_peak"`
+	WASMCalls    int       `json:"wasm_calls"`
+}
+
+// JSONLStatsSink is a StatsSink that writes every record as a line of JSON,
+// e.g. to a file opened in append mode.
+type JSONLStatsSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLStatsSink creates a JSONLStatsSink writing to w.
+func NewJSONLStatsSink(w io.Writer) *JSONLStatsSink {
+	return &JSONLStatsSink{enc: json.NewEncoder(w)}
+}
+
+// Record writes the Stats of a calculation of the circuit as a line of JSON.
+func (s *JSONLStatsSink) Record(circuit string, st Stats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(statsRecord{
+		Time:         time.Now().UTC(),
+		Circuit:      circuit,
+		Duration:     int64(st.Total),
+		InputsBytes:  st.InputsBytes,
+		WitnessBytes: st.WitnessBytes,
+		MemPeak:      st.MemPeak,
+		WASMCalls:    st.WASMCalls,
+	})
+}
+
+// statsFunc returns the function the Stats of the calculations are passed to
+// with the options o, or nil if they are not measured.
+func statsFunc(o options) func(Stats) {
+	if o.statsSink == nil {
+		return o.stats
+	}
+	return func(s Stats) {
+		if o.stats != nil {
+			o.stats(s)
+		}
+		if err := o.statsSink.Record(o.circuitName, s); err != nil {
+			log.Warn("Error recording the stats", "circuit", o.circuitName, "err", err)
+		}
+	}
+}
+
+// statsPhase is a phase of a calculation measured in the Stats.
+type statsPhase int
+
+const (
+	phaseNone statsPhase = iota
+	phaseInit
+	phaseSetInputs
+	phaseExtract
+)
+
+// statsTimer measures the Stats of a calculation and passes them to f, and
+// records its spans with tracer.  A nil *statsTimer measures nothing.
+type statsTimer struct {
+	f     func(Stats)
+	stats Stats
+	start time.Time
+	last  time.Time
+	// tracer records the spans of the calculation, children of span, which
+	// is nil once ended, and of its context ctx.
+	tracer Tracer
+	ctx    context.Context
+	span   Span
+}
+
+// newStatsTimer starts measuring a calculation whose Stats are passed to f,
+// and tracing it with tracer in the context ctx, or returns nil if f and
+// tracer are nil.
+func newStatsTimer(f func(Stats), tracer Tracer, ctx context.Context) *statsTimer {
+	if f == nil && tracer == nil {
+		return nil
+	}
+	now := time.Now()
+	t := &statsTimer{f: f, start: now, last: now}
+	if tracer != nil {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		t.tracer = tracer
+		t.ctx, t.span = tracer.Start(ctx, SpanCalculate, now)
+	}
+	return t
+}
+
+// lap adds the time since the previous lap to the phase, and records its
+// span.
+func (t *statsTimer) lap(phase statsPhase) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	d := now.Sub(t.last)
+	if name := phase.spanName(); name != "" {
+		traceSpan(t.tracer, t.ctx, name, t.last, now, nil)
+	}
+	t.last = now
+	switch phase {
+	case phaseInit:
+		t.stats.Init += d
+	case phaseSetInputs:
+		t.stats.SetInputs += d
+	case phaseExtract:
+		t.stats.Extract += d
+	}
+}
+
+// inputs adds n bytes of input values.
+func (t *statsTimer) inputs(n int) {
+	if t == nil {
+		return
+	}
+	t.stats.InputsBytes += n
+}
+
+// report passes the Stats of the finished calculation to f.
+func (t *statsTimer) report(wasmCalls, witnessBytes, memPeak int) {
+	if t == nil {
+		return
+	}
+	t.stats.Total = time.Since(t.start)
+	t.stats.WASMCalls = wasmCalls
+	t.stats.WitnessBytes = witnessBytes
+	t.stats.MemPeak = memPeak
+	if t.f != nil {
+		t.f(t.stats)
+	}
+	t.end(nil)
+}
+
+// end ends the span of the calculation with its error, if it isn't ended.
+func (t *statsTimer) end(err error) {
+	if t == nil || t.span == nil {
+		return
+	}
+	t.span.End(time.Now(), err)
+	t.span = nil
+}
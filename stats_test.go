@@ -0,0 +1,61 @@
+package witnesscalc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLStatsSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLStatsSink(&buf)
+	require.NoError(t, sink.Record("auth", Stats{Total: 3 * time.Millisecond,
+		InputsBytes: 64, WitnessBytes: 128, MemPeak: 65536, WASMCalls: 7}))
+	require.NoError(t, sink.Record("vote", Stats{Total: time.Second}))
+
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var r map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	require.Len(t, records, 2)
+	assert.Equal(t, "auth", records[0]["circuit"])
+	assert.Equal(t, float64(3*time.Millisecond), records[0]["duration_ns"])
+	assert.Equal(t, float64(64), records[0]["inputs_bytes"])
+	assert.Equal(t, float64(128), records[0]["witness_bytes"])
+	assert.Equal(t, float64(65536), records[0]["mem_peak"])
+	assert.Equal(t, float64(7), records[0]["wasm_calls"])
+	assert.NotEmpty(t, records[0]["time"])
+	assert.Equal(t, "vote", records[1]["circuit"])
+}
+
+type statsSinkFunc func(circuit string, s Stats) error
+
+func (f statsSinkFunc) Record(circuit string, s Stats) error {
+	return f(circuit, s)
+}
+
+func TestStatsFunc(t *testing.T) {
+	require.Nil(t, statsFunc(options{}))
+
+	var circuits []string
+	var stats []Stats
+	o := options{circuitName: "auth", stats: func(s Stats) {
+		stats = append(stats, s)
+	}}
+	o.statsSink = statsSinkFunc(func(circuit string, s Stats) error {
+		circuits = append(circuits, circuit)
+		return errors.New("disk full")
+	})
+	statsFunc(o)(Stats{WASMCalls: 1})
+	assert.Equal(t, []string{"auth"}, circuits)
+	assert.Equal(t, []Stats{{WASMCalls: 1}}, stats)
+}
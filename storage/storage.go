@@ -0,0 +1,134 @@
+// Package storage saves and loads witnesses in the formats used by the circom
+// toolchain, detecting the format of the loaded files, so that pipelines can
+// switch formats without code changes.
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// Format is a witness file format.
+type Format int
+
+const (
+	// FormatJSON is the snarkjs JSON array of base 10 strings.
+	FormatJSON Format = iota + 1
+	// FormatWTNS is the snarkjs wtns binary format, version 2.
+	FormatWTNS
+	// FormatBinLE is the raw binary witness of CalculateBinWitness: the
+	// values as little-endian integers of the field element size, without
+	// header.
+	FormatBinLE
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatWTNS:
+		return "wtns"
+	case FormatBinLE:
+		return "binle"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// bn254 is the prime of the scalar field of the BN254 curve, the default
+// circom field.
+var bn254, _ = new(big.Int).SetString(
+	"21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+
+// Option configures SaveWitness and LoadWitness.
+type Option func(*options)
+
+type options struct {
+	prime *big.Int
+}
+
+// WithPrime sets the prime of the field of the witness, which defaults to the
+// BN254 scalar field.  It is written in wtns files and gives the field element
+// size of FormatBinLE files.
+func WithPrime(prime *big.Int) Option {
+	return func(o *options) {
+		o.prime = prime
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{prime: bn254}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// SaveWitness writes the witness w to the file at path in the given format.
+func SaveWitness(path string, w []*big.Int, format Format, opts ...Option) error {
+	o := newOptions(opts)
+	var buff bytes.Buffer
+	switch format {
+	case FormatJSON:
+		wJSON, err := witnesscalc.MarshalWitnessJSON(w)
+		if err != nil {
+			return err
+		}
+		buff.Write(wJSON)
+	case FormatWTNS:
+		if err := witnesscalc.WriteWTNS(&buff, w, o.prime); err != nil {
+			return err
+		}
+	case FormatBinLE:
+		bin, err := witnesscalc.NewWitness(w, o.prime).ToBinLE()
+		if err != nil {
+			return err
+		}
+		buff.Write(bin)
+	default:
+		return fmt.Errorf("unknown witness format %v", format)
+	}
+	return ioutil.WriteFile(path, buff.Bytes(), 0644)
+}
+
+// DetectFormat returns the format of a witness file from its first bytes:
+// FormatWTNS for the "wtns" magic, FormatJSON for a JSON array and FormatBinLE
+// otherwise.
+func DetectFormat(b []byte) Format {
+	if bytes.HasPrefix(b, []byte("wtns")) {
+		return FormatWTNS
+	}
+	if trimmed := bytes.TrimLeft(b, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+		return FormatJSON
+	}
+	return FormatBinLE
+}
+
+// LoadWitness reads the witness in the file at path, detecting its format
+// with DetectFormat, and returns it along with the format.
+func LoadWitness(path string, opts ...Option) ([]*big.Int, Format, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	o := newOptions(opts)
+	format := DetectFormat(b)
+	var w []*big.Int
+	switch format {
+	case FormatJSON:
+		w, err = witnesscalc.ParseWitnessJSON(b)
+	case FormatWTNS:
+		_, w, err = witnesscalc.ParseWTNS(bytes.NewReader(b))
+	default:
+		w, err = witnesscalc.ParseWitnessBinLE(b, o.prime)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s witness %s: %w", format, path, err)
+	}
+	return w, format, nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveLoadWitness(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+	for _, format := range []Format{FormatJSON, FormatWTNS, FormatBinLE} {
+		path := filepath.Join(dir, "witness."+format.String())
+		require.Nil(t, SaveWitness(path, w, format), format)
+		loaded, detected, err := LoadWitness(path)
+		require.Nil(t, err, format)
+		assert.Equal(t, format, detected)
+		assert.Equal(t, w, loaded, format)
+	}
+
+	// Files written by snarkjs and the calculators
+	for path, format := range map[string]Format{
+		"../test_files/mycircuit-witness.json": FormatJSON,
+		"../test_files/mycircuit-witness.wtns": FormatWTNS,
+	} {
+		loaded, detected, err := LoadWitness(path)
+		require.Nil(t, err, path)
+		assert.Equal(t, format, detected)
+		assert.Equal(t, w, loaded, path)
+	}
+
+	goldilocks := new(big.Int).SetUint64(0xffffffff00000001)
+	path := filepath.Join(dir, "goldilocks.bin")
+	require.Nil(t, SaveWitness(path, w, FormatBinLE, WithPrime(goldilocks)))
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Len(t, b, 4*8)
+	loaded, _, err := LoadWitness(path, WithPrime(goldilocks))
+	require.Nil(t, err)
+	assert.Equal(t, w, loaded)
+	require.Nil(t, ioutil.WriteFile(path, b[:31], 0644))
+	_, _, err = LoadWitness(path, WithPrime(goldilocks))
+	assert.Error(t, err)
+
+	assert.Error(t, SaveWitness(path, []*big.Int{bn254}, FormatBinLE))
+	assert.Error(t, SaveWitness(path, w, Format(0)))
+}
@@ -0,0 +1,187 @@
+package witnesscalc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Symbol is an entry of a circom .sym file, mapping a signal name to its
+// position in the witness.
+type Symbol struct {
+	LabelIdx     int
+	VarIdx       int // witness index, -1 if the signal was optimized away
+	ComponentIdx int
+	Name         string
+}
+
+// ParseSym parses a circom .sym file, with one
+// `labelIdx,varIdx,componentIdx,name` entry per line.
+func ParseSym(r io.Reader) ([]Symbol, error) {
+	var syms []Symbol
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.SplitN(text, ",", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("sym line %d: expected 4 fields, got %d", line, len(fields))
+		}
+		var idxs [3]int
+		for i := range idxs {
+			idx, err := strconv.Atoi(fields[i])
+			if err != nil {
+				return nil, fmt.Errorf("sym line %d: %w", line, err)
+			}
+			idxs[i] = idx
+		}
+		syms = append(syms, Symbol{
+			LabelIdx:     idxs[0],
+			VarIdx:       idxs[1],
+			ComponentIdx: idxs[2],
+			Name:         fields[3],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return syms, nil
+}
+
+// inComponent returns true if the signal name belongs to the component or
+// any of its subcomponents.
+func inComponent(name, component string) bool {
+	if !strings.HasPrefix(name, component) || len(name) == len(component) {
+		return false
+	}
+	sep := name[len(component)]
+	return sep == '.' || sep == '['
+}
+
+// mainSignalName returns the name of a signal of the main component without
+// its array indexes (e.g. "in" for "main.in[2]"), or false if the signal
+// belongs to a subcomponent.
+func mainSignalName(name string) (string, bool) {
+	if !strings.HasPrefix(name, "main.") {
+		return "", false
+	}
+	name = name[len("main."):]
+	if strings.ContainsRune(name, '.') {
+		return "", false
+	}
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	return name, name != ""
+}
+
+// NormalizeInputs returns the inputs with the fully-qualified names of the
+// signals of the main component, as written in sym files and by some tools
+// (e.g. "main.in" or "main.in[0]"), converted to the bare names taken by the
+// calculators ("in").  The values of the indexed names of a signal, which
+// must be single field elements, are gathered in an array in the order of
+// the signal elements in syms.  syms are only required for indexed names.
+// The other names are kept, and inputs is returned as is if it has no
+// fully-qualified names.
+func NormalizeInputs(inputs map[string]interface{}, syms []Symbol) (map[string]interface{}, error) {
+	qualified := false
+	for name := range inputs {
+		if strings.HasPrefix(name, "main.") {
+			qualified = true
+			break
+		}
+	}
+	if !qualified {
+		return inputs, nil
+	}
+
+	normalized := make(map[string]interface{}, len(inputs))
+	// elems holds the values of the indexed names by bare name
+	elems := make(map[string]map[string]interface{})
+	for name, v := range inputs {
+		bare, ok := mainSignalName(name)
+		switch {
+		case !ok:
+			bare = name
+		case len(name) != len("main.")+len(bare):
+			if elems[bare] == nil {
+				elems[bare] = make(map[string]interface{})
+			}
+			elems[bare][name] = v
+			continue
+		}
+		if _, ok := normalized[bare]; ok {
+			return nil, fmt.Errorf("input %s is given with several names", bare)
+		}
+		normalized[bare] = v
+	}
+	if len(elems) == 0 {
+		return normalized, nil
+	}
+	if syms == nil {
+		return nil, fmt.Errorf("the symbols of the circuit are required for indexed input names (see WithSymbols)")
+	}
+
+	arrays := make(map[string][]*big.Int, len(elems))
+	for _, sym := range syms {
+		bare, ok := mainSignalName(sym.Name)
+		if !ok || elems[bare] == nil || sym.Name == "main."+bare {
+			continue
+		}
+		v, ok := elems[bare][sym.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %s", sym.Name)
+		}
+		delete(elems[bare], sym.Name)
+		values, err := FlattenSignal(v)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", sym.Name, err)
+		}
+		if len(values) != 1 {
+			return nil, fmt.Errorf("input %s: expected a single value, got %d", sym.Name, len(values))
+		}
+		arrays[bare] = append(arrays[bare], values[0])
+	}
+	for bare, names := range elems {
+		for name := range names {
+			return nil, ErrUnknownInput{Name: name}
+		}
+		if _, ok := normalized[bare]; ok {
+			return nil, fmt.Errorf("input %s is given with several names", bare)
+		}
+		normalized[bare] = arrays[bare]
+	}
+	return normalized, nil
+}
+
+// ComponentSignals returns the values in the witness w of the signals
+// belonging to the named component (e.g. "main.hasher") and its
+// subcomponents, indexed by full signal name.  Signals optimized away by the
+// compiler are omitted.
+func ComponentSignals(w []*big.Int, syms []Symbol, component string) (map[string]*big.Int, error) {
+	signals := make(map[string]*big.Int)
+	found := false
+	for _, sym := range syms {
+		if !inComponent(sym.Name, component) {
+			continue
+		}
+		found = true
+		if sym.VarIdx < 0 {
+			continue
+		}
+		if sym.VarIdx >= len(w) {
+			return nil, fmt.Errorf("signal %s: witness index %d out of range (%d)",
+				sym.Name, sym.VarIdx, len(w))
+		}
+		signals[sym.Name] = w[sym.VarIdx]
+	}
+	if !found {
+		return nil, fmt.Errorf("component %s not found", component)
+	}
+	return signals, nil
+}
@@ -0,0 +1,168 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package witnesscalc
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSym(t *testing.T) {
+	syms, err := ParseSym(strings.NewReader("1,2,0,main.a\n2,-1,1,main.h[0].x\n"))
+	require.Nil(t, err)
+	assert.Equal(t, []Symbol{
+		{LabelIdx: 1, VarIdx: 2, ComponentIdx: 0, Name: "main.a"},
+		{LabelIdx: 2, VarIdx: -1, ComponentIdx: 1, Name: "main.h[0].x"},
+	}, syms)
+
+	_, err = ParseSym(strings.NewReader("1,2,main.a\n"))
+	require.Error(t, err)
+	_, err = ParseSym(strings.NewReader("1,x,0,main.a\n"))
+	require.Error(t, err)
+}
+
+func TestComponentSignals(t *testing.T) {
+	f, err := os.Open("test_files/mycircuit.sym")
+	require.Nil(t, err)
+	defer f.Close()
+	syms, err := ParseSym(f)
+	require.Nil(t, err)
+
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	w, err := witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+
+	signals, err := ComponentSignals(w.Values(), syms, "main")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]*big.Int{
+		"main.a": big.NewInt(3),
+		"main.b": big.NewInt(11),
+		"main.c": big.NewInt(33),
+	}, signals)
+
+	_, err = ComponentSignals(w.Values(), syms, "main.hasher")
+	require.Error(t, err)
+	_, err = ComponentSignals(w.Values()[:2], syms, "main")
+	require.Error(t, err)
+}
+
+func TestMainSignalName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"main.in":        "in",
+		"main.in[2]":     "in",
+		"main.in[2][0]":  "in",
+		"main.sub.in":    "",
+		"main.sub[1].in": "",
+		"one":            "",
+	} {
+		got, ok := mainSignalName(name)
+		assert.Equal(t, expected != "", ok, name)
+		assert.Equal(t, expected, got, name)
+	}
+}
+
+func TestNormalizeInputs(t *testing.T) {
+	syms, err := ParseSym(strings.NewReader(
+		"1,1,0,main.out\n2,2,0,main.in[0][0]\n3,3,0,main.in[0][1]\n4,4,0,main.in[1][0]\n5,5,0,main.in[1][1]\n6,6,0,main.k\n7,7,1,main.h.in[0]\n"))
+	require.Nil(t, err)
+
+	inputs := map[string]interface{}{"in": []*big.Int{big.NewInt(1)}, "k": big.NewInt(2)}
+	normalized, err := NormalizeInputs(inputs, nil)
+	require.Nil(t, err)
+	assert.Equal(t, inputs, normalized)
+
+	normalized, err = NormalizeInputs(map[string]interface{}{
+		"main.in[0][0]": big.NewInt(1),
+		"main.in[1][1]": []*big.Int{big.NewInt(4)},
+		"main.in[0][1]": big.NewInt(2),
+		"main.in[1][0]": big.NewInt(3),
+		"main.k":        big.NewInt(5),
+		"x":             big.NewInt(6),
+	}, syms)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"in": []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3), big.NewInt(4)},
+		"k":  big.NewInt(5),
+		"x":  big.NewInt(6),
+	}, normalized)
+
+	// Unindexed names don't need the symbols.
+	normalized, err = NormalizeInputs(map[string]interface{}{"main.k": big.NewInt(5)}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"k": big.NewInt(5)}, normalized)
+
+	for _, tt := range []struct {
+		inputs map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"main.k": big.NewInt(1), "k": big.NewInt(1)},
+			"input k is given with several names"},
+		{map[string]interface{}{"main.in[0][0]": big.NewInt(1), "in": big.NewInt(1)},
+			"missing input main.in[0][1]"},
+		{map[string]interface{}{"main.in[0][0]": big.NewInt(1), "main.in[0][1]": big.NewInt(1),
+			"main.in[1][0]": big.NewInt(1), "main.in[1][1]": big.NewInt(1), "in": big.NewInt(1)},
+			"input in is given with several names"},
+		{map[string]interface{}{"main.in[0][0]": []*big.Int{big.NewInt(1), big.NewInt(2)}},
+			"input main.in[0][0]: expected a single value, got 2"},
+		{map[string]interface{}{"main.k[0]": big.NewInt(1)},
+			"unknown input main.k[0]"},
+	} {
+		_, err := NormalizeInputs(tt.inputs, syms)
+		assert.EqualError(t, err, tt.err)
+	}
+	_, err = NormalizeInputs(map[string]interface{}{"main.in[0][0]": big.NewInt(1)}, nil)
+	assert.Error(t, err)
+
+	// Calculations with the symbols
+	f, err := os.Open("test_files/mycircuit.sym")
+	require.Nil(t, err)
+	defer f.Close()
+	mySyms, err := ParseSym(f)
+	require.Nil(t, err)
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithSymbols(mySyms))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	w, err := witnessCalculator.CalculateWitness(map[string]interface{}{"main.a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	assert.Equal(t, "33", w.At(1).String())
+}
+
+func TestSymSignalSizes(t *testing.T) {
+	sizes := symSignalSizes([]Symbol{
+		{Name: "main.a"},
+		{Name: "main.in[0][0]"},
+		{Name: "main.in[0][1]"},
+		{Name: "main.in[1][0]"},
+		{Name: "main.in[1][1]"},
+		{Name: "main.hasher.in[0]"},
+		{Name: "one"},
+	})
+	assert.Equal(t, map[SignalID]int{
+		NewSignalID("a"):  1,
+		NewSignalID("in"): 4,
+	}, sizes)
+
+	s := signalInput{name: "in", id: NewSignalID("in"), values: make([]SignalValue, 5)}
+	err := s.checkSize(sizes)
+	assert.True(t, errors.Is(err, ErrTooManyValues))
+	assert.EqualError(t, err, "too many values for input signal in")
+	s.values = s.values[:4]
+	assert.NoError(t, s.checkSize(sizes))
+	s.id = NewSignalID("other")
+	s.values = make([]SignalValue, 10)
+	assert.NoError(t, s.checkSize(sizes))
+	// Not enough values aren't ErrTooManyValues.
+	assert.False(t, errors.Is(inputSizeError{name: "in", values: 3, size: 4}, ErrTooManyValues))
+}
@@ -0,0 +1,90 @@
+//go:build conformance && cgo && !js
+// +build conformance,cgo,!js
+
+package testvectors
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// calculateWTNS calculates the wtns file of a vector with this module.
+func calculateWTNS(v *Vector) ([]byte, error) {
+	if v.CircomVersion == 1 {
+		calc, err := witnesscalc.LoadWitnessCalculator(v.WASM)
+		if err != nil {
+			return nil, err
+		}
+		defer calc.Close()
+		return calc.CalculateWTNSBin(v.Inputs, true)
+	}
+	calc, err := witnesscalc.NewCircom2WitnessCalculator(v.WASM)
+	if err != nil {
+		return nil, err
+	}
+	return calc.CalculateWTNSBin(v.Inputs, true)
+}
+
+// TestConformance compares bit for bit the wtns files of the test vectors
+// calculated by this module with the ones calculated by snarkjs, the
+// reference implementation.  It runs with `go test -tags=conformance` and is
+// skipped when node or the snarkjs package (e.g. installed in testdata with
+// `npm install snarkjs`) are not available.
+func TestConformance(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+	check := exec.Command(node, "-e", `require("snarkjs")`)
+	check.Dir = "testdata"
+	if err := check.Run(); err != nil {
+		t.Skip("snarkjs not found: install it in testdata or set NODE_PATH")
+	}
+	script, err := filepath.Abs("testdata/snarkjs_wtns.js")
+	require.NoError(t, err)
+
+	vectors, err := Vectors()
+	require.NoError(t, err)
+	for i := range vectors {
+		v := &vectors[i]
+		t.Run(v.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			wasmPath := filepath.Join(dir, "circuit.wasm")
+			inputsPath := filepath.Join(dir, "input.json")
+			wtnsPath := filepath.Join(dir, "witness.wtns")
+			require.NoError(t, ioutil.WriteFile(wasmPath, v.WASM, 0644))
+			inputsJSON, err := witnesscalc.CanonicalizeInputs(v.Inputs)
+			require.NoError(t, err)
+			require.NoError(t, ioutil.WriteFile(inputsPath, inputsJSON, 0644))
+
+			cmd := exec.Command(node, script, wasmPath, inputsPath, wtnsPath)
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+			expected, err := ioutil.ReadFile(wtnsPath)
+			require.NoError(t, err)
+
+			wtns, err := calculateWTNS(v)
+			require.NoError(t, err)
+			if bytes.Equal(expected, wtns) {
+				return
+			}
+			// Report the first diverging signal, if the files are valid.
+			expectedPrime, expectedW, err := witnesscalc.ParseWTNS(bytes.NewReader(expected))
+			require.NoError(t, err)
+			prime, w, err := witnesscalc.ParseWTNS(bytes.NewReader(wtns))
+			require.NoError(t, err)
+			require.Equal(t, expectedPrime, prime, "prime")
+			require.Len(t, w, len(expectedW))
+			for j := range w {
+				require.Equal(t, expectedW[j].String(), w[j].String(), "signal %d", j)
+			}
+			t.Fatal("the wtns files differ in their encoding")
+		})
+	}
+}
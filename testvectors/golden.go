@@ -0,0 +1,60 @@
+package testvectors
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// errCircom1Unsupported is returned by Calculate for circom 1 vectors on
+// platforms without the wasm3 runtime.
+var errCircom1Unsupported = errors.New("circom 1 witness calculation requires the wasm3 runtime (cgo)")
+
+// Calculate calculates the witness of the vector with the calculator matching
+// its circom version.
+func (v *Vector) Calculate() ([]*big.Int, error) {
+	if v.CircomVersion == 2 {
+		calc, err := witnesscalc.NewCircom2WitnessCalculator(v.WASM)
+		if err != nil {
+			return nil, err
+		}
+		w, err := calc.CalculateWitness(v.Inputs, true)
+		if err != nil {
+			return nil, err
+		}
+		return w.Values(), nil
+	}
+	return calculateCircom1(v)
+}
+
+// RunGolden calculates the witness of every embedded vector as a subtest and
+// checks it matches the known-good witness.  Projects embedding this module
+// can call it from their tests to validate their build and platform.
+func RunGolden(t *testing.T) {
+	vectors, err := Vectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range vectors {
+		v := &vectors[i]
+		t.Run(v.Name, func(t *testing.T) {
+			w, err := v.Calculate()
+			if err == errCircom1Unsupported {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(w) != len(v.Witness) {
+				t.Fatalf("witness length %d, expected %d", len(w), len(v.Witness))
+			}
+			for i := range w {
+				if w[i].Cmp(v.Witness[i]) != 0 {
+					t.Fatalf("witness[%d] = %v, expected %v", i, w[i], v.Witness[i])
+				}
+			}
+		})
+	}
+}
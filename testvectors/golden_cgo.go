@@ -0,0 +1,19 @@
+//go:build cgo && !js
+// +build cgo,!js
+
+package testvectors
+
+import (
+	"math/big"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// calculateCircom1 calculates the witness of a circom 1 vector.
+func calculateCircom1(v *Vector) ([]*big.Int, error) {
+	w, err := witnesscalc.CalculateWitnessBinWASM(v.WASM, v.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	return w.Values(), nil
+}
@@ -0,0 +1,11 @@
+//go:build !cgo && !js
+// +build !cgo,!js
+
+package testvectors
+
+import "math/big"
+
+// calculateCircom1 calculates the witness of a circom 1 vector.
+func calculateCircom1(v *Vector) ([]*big.Int, error) {
+	return nil, errCircom1Unsupported
+}
@@ -0,0 +1,22 @@
+#!/usr/bin/env node
+
+// Calculates the wtns file of a circuit with the snarkjs witness calculator,
+// the reference implementation used by the conformance test.
+//
+// Usage: snarkjs_wtns.js circuit.wasm input.json witness.wtns
+
+const fs = require("fs");
+const snarkjs = require("snarkjs");
+
+async function run() {
+    const [wasmName, inputName, wtnsName] = process.argv.slice(2);
+    const input = JSON.parse(await fs.promises.readFile(inputName, "utf8"));
+    await snarkjs.wtns.calculate(input, wasmName, wtnsName);
+}
+
+run().then(() => {
+    process.exit(0);
+}, (err) => {
+    console.error(err);
+    process.exit(1);
+});
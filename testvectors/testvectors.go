@@ -0,0 +1,100 @@
+// Package testvectors provides known-good circuit, inputs and witness triples
+// for circom 1 and circom 2, embedded in the package, together with RunGolden,
+// a test helper that validates the witness calculation of this module on the
+// running platform against them.
+package testvectors
+
+import (
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path"
+	"strings"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+//go:embed data
+var data embed.FS
+
+// Vector is a known-good witness calculation.
+type Vector struct {
+	Name string
+	// CircomVersion is the major version of the circom compiler that
+	// generated WASM: 1 or 2.
+	CircomVersion int
+	WASM          []byte
+	Inputs        map[string]interface{}
+	Witness       []*big.Int
+}
+
+// vectorFiles lists the files of each vector in the data directory.  Files
+// ending in .gz are gzip compressed.
+var vectorFiles = []struct {
+	name          string
+	circomVersion int
+	wasm          string
+	inputs        string
+	witness       string
+}{
+	{"mycircuit-1", 1, "circom1/mycircuit.wasm", "circom1/mycircuit-input1.json", "circom1/mycircuit-witness1.json"},
+	{"mycircuit-2", 1, "circom1/mycircuit.wasm", "circom1/mycircuit-input2.json", "circom1/mycircuit-witness2.json"},
+	{"mycircuit-3", 1, "circom1/mycircuit.wasm", "circom1/mycircuit-input3.json", "circom1/mycircuit-witness3.json"},
+	{"smtverifier10", 1, "circom1/smtverifier10.wasm.gz", "circom1/smtverifier10-input.json", "circom1/smtverifier10-witness.json.gz"},
+	{"circom2-circuit", 2, "circom2/circuit.wasm.gz", "circom2/input.json", "circom2/witness.json.gz"},
+}
+
+// readFile reads a file from the embedded data directory.
+func readFile(name string) ([]byte, error) {
+	b, err := data.ReadFile(path.Join("data", name))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return b, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Vectors returns all the embedded test vectors.
+func Vectors() ([]Vector, error) {
+	vectors := make([]Vector, len(vectorFiles))
+	for i, f := range vectorFiles {
+		wasm, err := readFile(f.wasm)
+		if err != nil {
+			return nil, err
+		}
+		inputsJSON, err := readFile(f.inputs)
+		if err != nil {
+			return nil, err
+		}
+		inputs, err := witnesscalc.ParseInputs(inputsJSON)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		witnessJSON, err := readFile(f.witness)
+		if err != nil {
+			return nil, err
+		}
+		witness, err := witnesscalc.ParseWitnessJSON(witnessJSON)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		vectors[i] = Vector{
+			Name:          f.name,
+			CircomVersion: f.circomVersion,
+			WASM:          wasm,
+			Inputs:        inputs,
+			Witness:       witness,
+		}
+	}
+	return vectors, nil
+}
@@ -0,0 +1,22 @@
+package testvectors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectors(t *testing.T) {
+	vectors, err := Vectors()
+	require.NoError(t, err)
+	require.Len(t, vectors, len(vectorFiles))
+	for _, v := range vectors {
+		require.NotEmpty(t, v.WASM, v.Name)
+		require.NotEmpty(t, v.Inputs, v.Name)
+		require.Equal(t, "1", v.Witness[0].String(), v.Name)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	RunGolden(t)
+}
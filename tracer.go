@@ -0,0 +1,67 @@
+package witnesscalc
+
+import (
+	"context"
+	"time"
+)
+
+// The names of the spans of the calculators, see WithTracer.
+const (
+	// SpanLoad is the loading of a module: its parsing, instantiation and the
+	// reading of the circuit parameters.
+	SpanLoad = "witnesscalc.Load"
+	// SpanCalculate is a witness calculation, the parent of the spans of its
+	// phases.
+	SpanCalculate = "witnesscalc.Calculate"
+	// SpanInit is the initialization of the module for a calculation.
+	SpanInit = "witnesscalc.Init"
+	// SpanSetInputs is the assignment of the inputs, which includes the
+	// execution of the circuit triggered by the assignments.
+	SpanSetInputs = "witnesscalc.SetInputs"
+	// SpanExtract is the reading of the witness from the module.
+	SpanExtract = "witnesscalc.Extract"
+)
+
+// Tracer creates the spans of the calculators, see WithTracer.  It is the
+// part of an OpenTelemetry trace.Tracer the calculators use, so that the
+// package doesn't depend on OpenTelemetry: the spans are recorded once their
+// operation is done, with its start time.  Start must be safe for concurrent
+// use when the Tracer is shared by several calculators.
+type Tracer interface {
+	// Start starts the span name at start, a child of the span of ctx, and
+	// returns the context of the new span.
+	Start(ctx context.Context, name string, start time.Time) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span at end, with the error of its operation, nil if it
+	// succeeded.
+	End(end time.Time, err error)
+}
+
+// traceSpan records the span name of an operation of the context ctx that
+// ran from start to end with err.  It does nothing if t is nil.
+func traceSpan(t Tracer, ctx context.Context, name string, start, end time.Time, err error) {
+	if t == nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := t.Start(ctx, name, start)
+	span.End(end, err)
+}
+
+// spanName returns the name of the span of the phase, or "" for phaseNone.
+func (p statsPhase) spanName() string {
+	switch p {
+	case phaseInit:
+		return SpanInit
+	case phaseSetInputs:
+		return SpanSetInputs
+	case phaseExtract:
+		return SpanExtract
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package witnesscalc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tracedSpan is a span recorded by a testTracer.
+type tracedSpan struct {
+	name, parent string
+	start, end   time.Time
+	err          error
+}
+
+type tracedSpanKey struct{}
+
+// testTracer records the ended spans, with the name of their parent.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []tracedSpan
+}
+
+type testSpan struct {
+	t    *testTracer
+	span tracedSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, start time.Time) (context.Context, Span) {
+	parent, _ := ctx.Value(tracedSpanKey{}).(string)
+	return context.WithValue(ctx, tracedSpanKey{}, name),
+		&testSpan{t: t, span: tracedSpan{name: name, parent: parent, start: start}}
+}
+
+func (s *testSpan) End(end time.Time, err error) {
+	s.span.end, s.span.err = end, err
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.t.spans = append(s.t.spans, s.span)
+}
+
+// names returns the names of the ended spans, as "parent/name" for the
+// children.
+func (t *testTracer) names() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var names []string
+	for _, s := range t.spans {
+		if s.parent != "" {
+			names = append(names, s.parent+"/"+s.name)
+		} else {
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
+
+func TestStatsTimerTrace(t *testing.T) {
+	require.Nil(t, newStatsTimer(nil, nil, nil))
+
+	var tracer testTracer
+	timer := newStatsTimer(nil, &tracer, nil)
+	timer.lap(phaseNone)
+	timer.lap(phaseInit)
+	timer.lap(phaseSetInputs)
+	timer.lap(phaseExtract)
+	timer.report(1, 2, 3)
+	timer.end(errors.New("ignored"))
+	assert.Equal(t, []string{
+		SpanCalculate + "/" + SpanInit,
+		SpanCalculate + "/" + SpanSetInputs,
+		SpanCalculate + "/" + SpanExtract,
+		SpanCalculate,
+	}, tracer.names())
+	for _, s := range tracer.spans {
+		assert.Nil(t, s.err)
+		assert.False(t, s.end.Before(s.start))
+	}
+
+	tracer = testTracer{}
+	errFailed := errors.New("failed")
+	timer = newStatsTimer(nil, &tracer, context.Background())
+	timer.lap(phaseInit)
+	timer.end(errFailed)
+	assert.Equal(t, []string{SpanCalculate + "/" + SpanInit, SpanCalculate}, tracer.names())
+	assert.Equal(t, errFailed, tracer.spans[1].err)
+}
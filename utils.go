@@ -1,93 +1,479 @@
 package witnesscalc
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"io/fs"
 	"math/big"
+	"os"
 	"reflect"
+	"regexp"
+	"strconv"
 )
 
 // swap the order of the bytes in a slice.  This allows flipping the endianness.
 func swap(b []byte) []byte {
 	bs := make([]byte, len(b))
-	for i := 0; i < len(b); i++ {
-		bs[len(b)-1-i] = b[i]
-	}
+	ReverseBytes(bs, b)
 	return bs
 }
 
+// maxFileRefDepth limits the nesting of $file references, which also stops
+// reference cycles.
+const maxFileRefDepth = 8
+
+// parseFileRef parses the inputs file referenced by a {"$file": path} object.
+func parseFileRef(v map[string]interface{}, fsys fs.FS, depth int) (interface{}, error) {
+	path, ok := v["$file"].(string)
+	if !ok || len(v) != 1 {
+		return nil, fmt.Errorf("Unexpected object for input %v", v)
+	}
+	if fsys == nil {
+		return nil, fmt.Errorf("Input file reference %q requires ParseInputsFS", path)
+	}
+	if depth >= maxFileRefDepth {
+		return nil, fmt.Errorf("Input file reference %q nested too deep", path)
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var raw interface{}
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("Error parsing input file %s: %w", path, err)
+	}
+	res, err := parseInput(raw, fsys, depth+1)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing input file %s: %w", path, err)
+	}
+	return res, nil
+}
+
+// scientificRegexp matches numbers in scientific notation, e.g. "1e18" or
+// "-2.5E3".
+var scientificRegexp = regexp.MustCompile(`^([+-]?)([0-9]+)(?:\.([0-9]+))?[eE]([+-]?[0-9]+)$`)
+
+// maxInputExponent is the largest exponent accepted in scientific notation,
+// bigger than the one of any supported field.
+const maxInputExponent = 128
+
+// parseScientific parses an integer in scientific notation, rejecting values
+// with a fractional part.  ok is false if s is not in scientific notation.
+func parseScientific(s string) (n *big.Int, ok bool, err error) {
+	m := scientificRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return nil, false, nil
+	}
+	sign, intPart, fracPart := m[1], m[2], m[3]
+	exp, err := strconv.Atoi(m[4])
+	if err != nil || exp > maxInputExponent || exp < -maxInputExponent {
+		return nil, true, fmt.Errorf("Error parsing input %s: exponent out of range", s)
+	}
+	// digits * 10^(exp - len(fracPart))
+	digits, _ := new(big.Int).SetString(intPart+fracPart, 10)
+	exp -= len(fracPart)
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil)
+	if exp >= 0 {
+		digits.Mul(digits, pow)
+	} else {
+		var rem big.Int
+		digits.QuoRem(digits, pow, &rem)
+		if rem.Sign() != 0 {
+			return nil, true, fmt.Errorf("Error parsing input %s: not an integer", s)
+		}
+	}
+	if sign == "-" {
+		digits.Neg(digits)
+	}
+	return digits, true, nil
+}
+
+// abs returns the absolute value of x.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// parseInputString parses a number given as a string: a base-10 number, a
+// "0x" prefixed hexadecimal number or a number in scientific notation.
+func parseInputString(s string) (*big.Int, error) {
+	if n, ok := new(big.Int).SetString(s, 0); ok {
+		return n, nil
+	}
+	n, ok, err := parseScientific(s)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("Error parsing input %v", s)
+	}
+	return n, nil
+}
+
+// parseInputNumber parses a JSON number without the float64 of
+// encoding/json, which rounds the big integers, rejecting the numbers with a
+// fractional part, like 1.5 or 1.0.
+func parseInputNumber(n json.Number) (*big.Int, error) {
+	s := n.String()
+	if v, ok := new(big.Int).SetString(s, 10); ok {
+		return v, nil
+	}
+	v, ok, err := parseScientific(s)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("Error parsing input %s: not an integer", s)
+	}
+	return v, nil
+}
+
 // parseInput is a recurisve helper function for ParseInputs
-func parseInput(v interface{}) (interface{}, error) {
+func parseInput(v interface{}, fsys fs.FS, depth int) (interface{}, error) {
+	if n, ok := v.(json.Number); ok {
+		return parseInputNumber(n)
+	}
 	rv := reflect.ValueOf(v)
 	switch rv.Kind() {
 	case reflect.String:
-		n, ok := new(big.Int).SetString(v.(string), 0)
-		if !ok {
-			return nil, fmt.Errorf("Error parsing input %v", v)
-		}
-		return n, nil
-	case reflect.Float64:
-		return new(big.Int).SetInt64(int64(v.(float64))), nil
+		return parseInputString(v.(string))
 	case reflect.Slice:
 		res := make([]interface{}, rv.Len())
 		for i := 0; i < rv.Len(); i++ {
 			var err error
-			res[i], err = parseInput(rv.Index(i).Interface())
+			res[i], err = parseInput(rv.Index(i).Interface(), fsys, depth)
 			if err != nil {
 				return nil, fmt.Errorf("Error parsing input %v: %w", v, err)
 			}
 		}
 		return res, nil
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Unexpected type for input %v: %T", v, v)
+		}
+		return parseFileRef(m, fsys, depth)
 	default:
 		return nil, fmt.Errorf("Unexpected type for input %v: %T", v, v)
 	}
 }
 
 // ParseInputs parses WitnessCalc inputs from JSON that consist of a map of
-// types which contain a recursive combination of: numbers, base-10 encoded
-// numbers in string format, arrays.
+// types which contain a recursive combination of: numbers, numbers in string
+// format (base-10, "0x" prefixed hexadecimal, or integers in scientific
+// notation like "1e18"), arrays.  The numbers are parsed without loss of
+// precision, and the ones with a fractional part, like 1.5, are rejected
+// with an error naming their input.
 func ParseInputs(inputsJSON []byte) (map[string]interface{}, error) {
+	return ParseInputsFS(inputsJSON, nil)
+}
+
+// ParseInputsFS parses WitnessCalc inputs like ParseInputs, also resolving
+// {"$file": "path"} objects against fsys: the object is replaced by the
+// inputs value parsed from the JSON file at path, so that giant arrays can be
+// kept in separate files, e.g.
+//
+//	{"root": "1", "leaves": {"$file": "leaves.json"}}
+//
+// Referenced files can reference other files, up to a nesting depth of 8.
+func ParseInputsFS(inputsJSON []byte, fsys fs.FS) (map[string]interface{}, error) {
 	inputsRAW := make(map[string]interface{})
-	if err := json.Unmarshal(inputsJSON, &inputsRAW); err != nil {
+	dec := json.NewDecoder(bytes.NewReader(inputsJSON))
+	dec.UseNumber()
+	if err := dec.Decode(&inputsRAW); err != nil {
 		return nil, err
 	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid data after top-level value")
+	}
 	inputs := make(map[string]interface{})
 	for inputName, inputValue := range inputsRAW {
-		v, err := parseInput(inputValue)
+		v, err := parseInput(inputValue, fsys, 0)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("input %s: %w", inputName, err)
 		}
 		inputs[inputName] = v
 	}
 	return inputs, nil
 }
 
-// _flatSlice is a recursive helper function for flatSlice.
-func _flatSlice(acc *[]*big.Int, v interface{}) {
+// canonicalInput returns the canonical form of an input value: its values,
+// flattened like the calculators set them (see FlattenSignal), as base 10
+// strings nested back into arrays of the shape of the value.
+func canonicalInput(v interface{}) (interface{}, error) {
+	var values []SignalValue
+	shape, err := _flatSlice(&values, v)
+	if err != nil {
+		return nil, err
+	}
+	strs := make([]string, len(values))
+	for i, value := range values {
+		strs[i] = bigValue(value).String()
+	}
+	return nestValues(strs, shape), nil
+}
+
+// nestValues nests the values, in row-major order, into arrays of the shape.
+func nestValues(values []string, shape []int) interface{} {
+	if len(shape) == 0 {
+		return values[0]
+	}
+	res := make([]interface{}, shape[0])
+	if shape[0] == 0 {
+		return res
+	}
+	size := len(values) / shape[0]
+	for i := range res {
+		res[i] = nestValues(values[i*size:(i+1)*size], shape[1:])
+	}
+	return res
+}
+
+// CanonicalizeInputs returns a deterministic JSON serialization of the inputs,
+// of any of the types accepted by the calculators (see FlattenSignal): keys
+// are sorted, values are base-10 encoded numbers in string format and arrays,
+// including NDArrays, keep their shape.  Two inputs maps holding the same
+// values always produce the same bytes, whatever their Go types.
+func CanonicalizeInputs(inputs map[string]interface{}) ([]byte, error) {
+	canonical := make(map[string]interface{}, len(inputs))
+	for inputName, inputValue := range inputs {
+		v, err := canonicalInput(inputValue)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", inputName, err)
+		}
+		canonical[inputName] = v
+	}
+	// encoding/json sorts map keys
+	return json.Marshal(canonical)
+}
+
+// HashInputs returns the SHA-256 hash of the canonical serialization of the
+// inputs (see CanonicalizeInputs).  It can be used as deduplication or
+// idempotency key for witness calculation requests.
+func HashInputs(inputs map[string]interface{}) ([sha256.Size]byte, error) {
+	canonical, err := CanonicalizeInputs(inputs)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(canonical), nil
+}
+
+// _flatSlice is a recursive helper function for FlattenSignal.  It returns
+// the shape of v.
+func _flatSlice(acc *[]SignalValue, v interface{}) ([]int, error) {
+	switch a := v.(type) {
+	case *NDArray:
+		if err := a.validate(); err != nil {
+			return nil, err
+		}
+		for _, value := range a.Values {
+			*acc = append(*acc, value)
+		}
+		return a.Shape, nil
+	case NDArray:
+		return _flatSlice(acc, &a)
+	case *big.Int:
+		if a == nil {
+			return nil, fmt.Errorf("Unexpected nil *big.Int")
+		}
+		*acc = append(*acc, a)
+		return []int{}, nil
+	case BigInt:
+		if a.Int == nil {
+			return nil, fmt.Errorf("Unexpected nil *big.Int")
+		}
+		*acc = append(*acc, a)
+		return []int{}, nil
+	case HexString:
+		if err := a.validate(); err != nil {
+			return nil, err
+		}
+		*acc = append(*acc, a)
+		return []int{}, nil
+	case SignalValue:
+		*acc = append(*acc, a)
+		return []int{}, nil
+	case BigIntValuer:
+		x, err := valuerBigInt(a)
+		if err != nil {
+			return nil, err
+		}
+		*acc = append(*acc, x)
+		return []int{}, nil
+	}
+	if x, ok, err := goInputValue(v); err != nil {
+		return nil, err
+	} else if ok {
+		*acc = append(*acc, x)
+		return []int{}, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("Unexpected type for input %v: %T", v, v)
+	}
+	var elemShape []int
+	for i := 0; i < rv.Len(); i++ {
+		shape, err := _flatSlice(acc, rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			elemShape = shape
+		} else if !equalShapes(elemShape, shape) {
+			return nil, fmt.Errorf("ragged array: element %d has shape %v, expected %v",
+				i, shape, elemShape)
+		}
+	}
+	return append([]int{rv.Len()}, elemShape...), nil
+}
+
+// goInteger converts the Go integers, signed or not, to *big.Int, returning
+// false for other types.
+func goInteger(v interface{}) (*big.Int, bool) {
 	rv := reflect.ValueOf(v)
 	switch rv.Kind() {
-	case reflect.Slice:
-		for i := 0; i < rv.Len(); i++ {
-			_flatSlice(acc, rv.Index(i).Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(rv.Uint()), true
+	}
+	return nil, false
+}
+
+// goInputValue converts the Go values accepted as single input values, the
+// non-negative Go integers, the decimal strings and the byte arrays ([N]byte,
+// big-endian like big.Int.SetBytes), to *big.Int, returning false for other
+// types.  Negative values are rejected: they aren't field elements, and
+// reducing them needs the prime of the circuit.
+func goInputValue(v interface{}) (*big.Int, bool, error) {
+	if n, ok := goInteger(v); ok {
+		if n.Sign() < 0 {
+			return nil, true, fmt.Errorf("negative value %v", n)
 		}
-	default:
-		*acc = append(*acc, v.(*big.Int))
+		return n, true, nil
 	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		n, ok := new(big.Int).SetString(rv.String(), 10)
+		if !ok {
+			return nil, true, fmt.Errorf("non-decimal string %q", rv.String())
+		}
+		if n.Sign() < 0 {
+			return nil, true, fmt.Errorf("negative value %q", rv.String())
+		}
+		return n, true, nil
+	case reflect.Array:
+		if rv.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, false, nil
+		}
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return new(big.Int).SetBytes(b), true, nil
+	}
+	return nil, false, nil
 }
 
-// flatSlice takes a structure that contains a recursive combination of slices
-// and *big.Int and flattens it into a single slice.
-func flatSlice(v interface{}) []*big.Int {
-	res := make([]*big.Int, 0)
-	_flatSlice(&res, v)
-	return res
+// equalShapes returns true if both shapes have the same dimensions.
+func equalShapes(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// FlattenSignal flattens the value of an input signal, a recursive
+// combination of slices, NDArrays, *big.Int and other SignalValues, into a
+// single slice of *big.Int in row-major order, the order in which the
+// calculators set the signal.  It is the flattening the calculators apply to
+// their inputs, for tooling that needs to count or enumerate the values of a
+// signal the same way:
+//
+//   - a single value is flattened into a slice of one value;
+//   - empty slices, at any depth, contribute no values, so []interface{}{}
+//     is flattened into an empty slice without error;
+//   - slices may mix the value types, e.g. []interface{}{big.NewInt(1),
+//     Uint64(2)}, but nested slices must be rectangular: an error is returned
+//     for ragged arrays and for values mixed with slices at the same depth;
+//   - BigIntValuers, like the merkle tree hashes of go-iden3-crypto, are
+//     single values, while structs, like babyjub.Point, are rejected: points
+//     are set with InputsBuilder.SetPoint;
+//   - non-negative Go integers, like int, int64 or uint64, decimal strings
+//     and byte arrays ([N]byte, big-endian) are single values, converted to
+//     *big.Int, while byte slices are arrays of bytes and other Go arrays are
+//     arrays of their elements;
+//   - nil, nil *big.Int values, invalid HexStrings, non-decimal strings,
+//     negative Go integers and decimal strings, and other types, like float64
+//     or bool, return an error.
+func FlattenSignal(v interface{}) ([]*big.Int, error) {
+	values, err := flatSignalValues(v)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*big.Int, len(values))
+	for i, value := range values {
+		res[i] = bigValue(value)
+	}
+	return res, nil
+}
+
+// flatSignalValues is FlattenSignal without converting the values to *big.Int.
+func flatSignalValues(v interface{}) ([]SignalValue, error) {
+	res := make([]SignalValue, 0)
+	if _, err := _flatSlice(&res, v); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
-// fnvHash returns the 64 bit FNV-1a hash split into two 32 bit values: (MSB, LSB)
-func fnvHash(s string) (int32, int32) {
+// SignalHash returns the 64 bit FNV-1a hash of the signal name split into its
+// two 32 bit halves (MSB, LSB), which the WASM modules look input signals up
+// with, like the fnvHash of witness_calculator.js (see also NewSignalID).
+// The name is hashed as is, e.g. "main.in" and "in" hash differently, and
+// the empty name has the hash of the FNV-1a offset basis.
+func SignalHash(s string) (int32, int32) {
 	hash := fnv.New64a()
 	hash.Write([]byte(s))
 	h := hash.Sum64()
 	return int32(h >> 32), int32(h & 0xffffffff)
 }
+
+// fileBufferSize is the size of the write buffer of writeFile.
+const fileBufferSize = 1 << 20
+
+// writeFile creates the file at path and writes it with write through a
+// buffer, removing the file if it fails.
+func writeFile(path string, write func(w io.Writer) error) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	bw := bufio.NewWriterSize(f, fileBufferSize)
+	if err := write(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
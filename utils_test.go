@@ -1,34 +1,121 @@
 package witnesscalc
 
 import (
+	"fmt"
 	"math/big"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func TestFlatSlice(t *testing.T) {
+func TestFlattenSignal(t *testing.T) {
 	one := new(big.Int).SetInt64(1)
 	two := new(big.Int).SetInt64(2)
 	three := new(big.Int).SetInt64(3)
 	four := new(big.Int).SetInt64(4)
 
 	a := one
-	fa := flatSlice(a)
+	fa, err := FlattenSignal(a)
+	require.Nil(t, err)
 	assert.Equal(t, []*big.Int{one}, fa)
 
 	b := []*big.Int{one, two}
-	fb := flatSlice(b)
+	fb, err := FlattenSignal(b)
+	require.Nil(t, err)
 	assert.Equal(t, []*big.Int{one, two}, fb)
 
 	c := []interface{}{one, []*big.Int{two, three}}
-	fc := flatSlice(c)
-	assert.Equal(t, []*big.Int{one, two, three}, fc)
+	_, err = FlattenSignal(c)
+	require.Error(t, err)
 
 	d := []interface{}{[]*big.Int{one, two}, []*big.Int{three, four}}
-	fd := flatSlice(d)
+	fd, err := FlattenSignal(d)
+	require.Nil(t, err)
 	assert.Equal(t, []*big.Int{one, two, three, four}, fd)
+
+	e := []interface{}{[]*big.Int{one, two}, []*big.Int{three}}
+	_, err = FlattenSignal(e)
+	require.Error(t, err)
+
+	f, err := NewNDArray([]int{2, 1, 2}, []*big.Int{one, two, three, four})
+	require.Nil(t, err)
+	ff, err := FlattenSignal([]interface{}{f, f})
+	require.Nil(t, err)
+	assert.Equal(t, []*big.Int{one, two, three, four, one, two, three, four}, ff)
+
+	_, err = NewNDArray([]int{2, 2}, []*big.Int{one, two, three})
+	require.Error(t, err)
+
+	_, err = FlattenSignal(1.5)
+	require.Error(t, err)
+
+	// Edge cases
+	_, err = FlattenSignal(nil)
+	require.Error(t, err)
+	_, err = FlattenSignal((*big.Int)(nil))
+	require.Error(t, err)
+	_, err = FlattenSignal([]interface{}{one, nil})
+	require.Error(t, err)
+	_, err = FlattenSignal("0x1")
+	require.Error(t, err)
+	_, err = FlattenSignal(true)
+	require.Error(t, err)
+	_, err = FlattenSignal(HexString("0xz"))
+	require.Error(t, err)
+	empty, err := FlattenSignal([]interface{}{})
+	require.Nil(t, err)
+	assert.Empty(t, empty)
+	empty, err = FlattenSignal([]interface{}{[]*big.Int{}, []*big.Int{}})
+	require.Nil(t, err)
+	assert.Empty(t, empty)
+	_, err = FlattenSignal([]interface{}{[]*big.Int{}, []*big.Int{one}})
+	require.Error(t, err)
+	mixed, err := FlattenSignal([]interface{}{one, Uint64(2), HexString("0x3"), BytesLE{4}})
+	require.Nil(t, err)
+	assert.Equal(t, []*big.Int{one, two, three, four}, mixed)
+
+	// Go values
+	goValues, err := FlattenSignal([]interface{}{1, int64(2), uint64(1 << 63), "123", [2]byte{1, 0}})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"1", "2", "9223372036854775808", "123", "256"}, bigStrings(goValues))
+	_, err = FlattenSignal([]interface{}{1, int64(-2)})
+	assert.EqualError(t, err, "negative value -2")
+	_, err = FlattenSignal("-5")
+	assert.EqualError(t, err, `negative value "-5"`)
+	goValues, err = FlattenSignal([][2]uint8{{1, 2}, {3, 4}})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"258", "772"}, bigStrings(goValues))
+	goValues, err = FlattenSignal([2][]int{{1, 2}, {3, 4}})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, bigStrings(goValues))
+	goValues, err = FlattenSignal([]byte{1, 2})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"1", "2"}, bigStrings(goValues))
+}
+
+// bigStrings returns the base 10 strings of vs.
+func bigStrings(vs []*big.Int) []string {
+	s := make([]string, len(vs))
+	for i, v := range vs {
+		s[i] = v.String()
+	}
+	return s
+}
+
+func TestSignalHash(t *testing.T) {
+	// FNV-1a 64 offset basis and hash of "a"
+	msb, lsb := SignalHash("")
+	assert.Equal(t, uint32(0xcbf29ce4), uint32(msb))
+	assert.Equal(t, uint32(0x84222325), uint32(lsb))
+	msb, lsb = SignalHash("a")
+	assert.Equal(t, uint32(0xaf63dc4c), uint32(msb))
+	assert.Equal(t, uint32(0x8601ec8c), uint32(lsb))
+	assert.Equal(t, SignalID{MSB: msb, LSB: lsb}, NewSignalID("a"))
+
+	msb2, lsb2 := SignalHash("main.a")
+	assert.False(t, msb == msb2 && lsb == lsb2)
 }
 
 func TestParseInputs(t *testing.T) {
@@ -49,3 +136,115 @@ func TestParseInputs(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, map[string]interface{}{"a": one, "b": []interface{}{[]interface{}{one, two}, []interface{}{three, four}}}, c)
 }
+
+func TestParseInputsNotation(t *testing.T) {
+	inputs, err := ParseInputs([]byte(`{"a": "1e18", "b": ["0x10", "0XfF", "2.5E3", "-1e2", "120e-1"]}`))
+	require.Nil(t, err)
+	canonical, err := CanonicalizeInputs(inputs)
+	require.Nil(t, err)
+	assert.Equal(t, `{"a":"1000000000000000000","b":["16","255","2500","-100","12"]}`, string(canonical))
+
+	for _, v := range []string{"1.5", "25e-1", "1e-1", "1e1000", "1/2", "0x1p4", "e5", "1e"} {
+		_, err := ParseInputs([]byte(fmt.Sprintf(`{"a": %q}`, v)))
+		require.Error(t, err, v)
+	}
+
+	// JSON numbers with a fractional part are rejected, not truncated.
+	inputs, err = ParseInputs([]byte(`{"a": 1e3, "b": -2.5e1}`))
+	require.Nil(t, err)
+	canonical, err = CanonicalizeInputs(inputs)
+	require.Nil(t, err)
+	assert.Equal(t, `{"a":"1000","b":"-25"}`, string(canonical))
+	_, err = ParseInputs([]byte(`{"a": 1.5}`))
+	assert.EqualError(t, err, "input a: Error parsing input 1.5: not an integer")
+}
+
+func TestParseInputsFractional(t *testing.T) {
+	inputs, err := ParseInputs([]byte(`{"a": 12345678901234567890123, "b": [1e3, -2.5e1]}`))
+	require.Nil(t, err)
+	canonical, err := CanonicalizeInputs(inputs)
+	require.Nil(t, err)
+	assert.Equal(t, `{"a":"12345678901234567890123","b":["1000","-25"]}`, string(canonical))
+
+	_, err = ParseInputs([]byte(`{"a": 1, "b": [2, 1.5]}`))
+	assert.EqualError(t, err, "input b: Error parsing input [2 1.5]: Error parsing input 1.5: not an integer")
+	_, err = ParseInputs([]byte(`{"a": 1.0}`))
+	assert.EqualError(t, err, "input a: Error parsing input 1.0: not an integer")
+	_, err = ParseInputs([]byte(`{"a": 25e-2}`))
+	assert.EqualError(t, err, "input a: Error parsing input 25e-2: not an integer")
+	_, err = ParseInputs([]byte(`{"a": 1} {}`))
+	require.Error(t, err)
+}
+
+func TestParseInputsFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"leaves.json":      {Data: []byte(`[[1, "2"], {"$file": "more/leaves.json"}]`)},
+		"more/leaves.json": {Data: []byte(`[3, 4]`)},
+		"loop.json":        {Data: []byte(`{"$file": "loop.json"}`)},
+	}
+	inputs, err := ParseInputsFS([]byte(`{"a": {"$file": "leaves.json"}}`), fsys)
+	require.Nil(t, err)
+	canonical, err := CanonicalizeInputs(inputs)
+	require.Nil(t, err)
+	assert.Equal(t, `{"a":[["1","2"],["3","4"]]}`, string(canonical))
+
+	_, err = ParseInputs([]byte(`{"a": {"$file": "leaves.json"}}`))
+	require.Error(t, err)
+	_, err = ParseInputsFS([]byte(`{"a": {"$file": "missing.json"}}`), fsys)
+	require.Error(t, err)
+	_, err = ParseInputsFS([]byte(`{"a": {"$file": "loop.json"}}`), fsys)
+	require.Error(t, err)
+	_, err = ParseInputsFS([]byte(`{"a": {"file": "leaves.json"}}`), fsys)
+	require.Error(t, err)
+}
+
+func TestCanonicalizeInputs(t *testing.T) {
+	a, err := ParseInputs([]byte(`{"b": [["0x10", 2], [3, 4]], "a": 1}`))
+	require.Nil(t, err)
+	b, err := ParseInputs([]byte(`{"a": "1", "b": [[16, "2"], ["3", "4"]]}`))
+	require.Nil(t, err)
+
+	ca, err := CanonicalizeInputs(a)
+	require.Nil(t, err)
+	assert.Equal(t, `{"a":"1","b":[["16","2"],["3","4"]]}`, string(ca))
+	cb, err := CanonicalizeInputs(b)
+	require.Nil(t, err)
+	assert.Equal(t, ca, cb)
+
+	ha, err := HashInputs(a)
+	require.Nil(t, err)
+	hb, err := HashInputs(b)
+	require.Nil(t, err)
+	assert.Equal(t, ha, hb)
+
+	_, err = CanonicalizeInputs(map[string]interface{}{"a": 1.5})
+	require.Error(t, err)
+
+	// Every value type accepted by the calculators, with its shape
+	nd, err := NewNDArray([]int{2, 2}, []*big.Int{big.NewInt(16), big.NewInt(2), big.NewInt(3), big.NewInt(4)})
+	require.Nil(t, err)
+	var bytes32 [32]byte
+	bytes32[31] = 1
+	c := map[string]interface{}{
+		"a": []interface{}{uint8(1)},
+		"b": nd,
+	}
+	for _, v := range []interface{}{
+		big.NewInt(1), BigInt{big.NewInt(1)}, Uint64(1), HexString("0x01"),
+		&testHash{0, 0, 0, 1}, 1, int64(1), uint64(1), "1", bytes32,
+	} {
+		c["a"] = []interface{}{v}
+		cc, err := CanonicalizeInputs(c)
+		require.Nil(t, err, "%T", v)
+		assert.Equal(t, `{"a":["1"],"b":[["16","2"],["3","4"]]}`, string(cc), "%T", v)
+	}
+	c["a"] = [][]int{{}, {}}
+	cc, err := CanonicalizeInputs(c)
+	require.Nil(t, err)
+	assert.Equal(t, `{"a":[[],[]],"b":[["16","2"],["3","4"]]}`, string(cc))
+
+	for _, v := range []interface{}{nil, -1, "0x1", [][]int{{1}, {}}, testPoint{}} {
+		_, err = CanonicalizeInputs(map[string]interface{}{"a": v})
+		assert.Error(t, err, "%v", v)
+	}
+}
@@ -0,0 +1,31 @@
+package witnesscalc
+
+import "fmt"
+
+// maxFieldLen32 is the largest field element size, in 32 bit words, accepted
+// from a WitnessCalc WASM module.
+const maxFieldLen32 = 32
+
+// memRange returns the n bytes of the WASM memory mem at position p, or an
+// error if they are out of its bounds, so that corrupted or malicious pointers
+// given by a module don't make the calculators panic.  Built with the
+// witnesscalc_memdebug tag, it logs every access with its call site.
+func memRange(mem []byte, p, n int64) ([]byte, error) {
+	if p < 0 || n < 0 || p > int64(len(mem))-n {
+		err := fmt.Errorf("memory access [%d, %d) out of bounds (%d bytes)", p, p+n, len(mem))
+		traceMemAccess(mem, p, n, err)
+		return nil, err
+	}
+	traceMemAccess(mem, p, n, nil)
+	return mem[p : p+n], nil
+}
+
+// int32Result returns the result of the call to the exported function name,
+// which must be an i32.
+func int32Result(name string, res interface{}) (int32, error) {
+	v, ok := res.(int32)
+	if !ok {
+		return 0, fmt.Errorf("%s returned %T, expected i32", name, res)
+	}
+	return v, nil
+}
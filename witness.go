@@ -0,0 +1,146 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Witness is a calculated witness: the values of the signals of a circuit in
+// witness order, starting with the constant 1, and the prime of their field.
+type Witness struct {
+	values      []*big.Int
+	prime       *big.Int
+	circuitHash *CircuitHash
+}
+
+// NewWitness creates the Witness with the values of the field of the prime.
+// The Witness shares the memory of values.
+func NewWitness(values []*big.Int, prime *big.Int) *Witness {
+	return &Witness{values: values, prime: prime}
+}
+
+// CircuitHash returns the hash of the module that calculated the witness,
+// embedded in its wtns encoding.  It is only known for the witnesses of the
+// calculators created with WithCircuitHashInWTNS.
+func (w *Witness) CircuitHash() (CircuitHash, bool) {
+	if w.circuitHash == nil {
+		return CircuitHash{}, false
+	}
+	return *w.circuitHash, true
+}
+
+// Len returns the number of values of the witness.
+func (w *Witness) Len() int {
+	return len(w.values)
+}
+
+// At returns the value at the witness index i.
+func (w *Witness) At(i int) *big.Int {
+	return w.values[i]
+}
+
+// Values returns the values of the witness, sharing its memory.
+func (w *Witness) Values() []*big.Int {
+	return w.values
+}
+
+// Public returns the n public signals, the outputs followed by the public
+// inputs, that follow the constant 1 (see CircuitHeader.NPublic).
+func (w *Witness) Public(n int) []*big.Int {
+	return w.values[1 : 1+n : 1+n]
+}
+
+// Prime returns the prime of the field of the witness.
+func (w *Witness) Prime() *big.Int {
+	return w.prime
+}
+
+// n8 returns the size in bytes of the field elements of the binary encodings,
+// the size of the prime rounded up to 64 bits.
+func (w *Witness) n8() int {
+	return primeN8(w.prime)
+}
+
+// ToJSON encodes the witness in the snarkjs JSON format (see
+// MarshalWitnessJSON).
+func (w *Witness) ToJSON() ([]byte, error) {
+	return MarshalWitnessJSON(w.values)
+}
+
+// ToWTNS encodes the witness in the snarkjs wtns format (see WriteWTNS), with
+// its CircuitHash if known.
+func (w *Witness) ToWTNS() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeWTNS(&buf, w.values, w.prime, w.circuitHash); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ToBinLE encodes the witness like CalculateBinWitness: the values as
+// little-endian integers of the size of the prime rounded up to 64 bits.  Like
+// ToWTNS, it fails if a value isn't an element of the field.
+func (w *Witness) ToBinLE() ([]byte, error) {
+	if err := checkFieldElems(w.values, w.prime); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(w.values) * w.n8())
+	if err := writeElems(&buf, w.values, w.n8()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalWitnessJSON marshals the witness in the snarkjs JSON format, where
+// each value is encoded in base 10 as a string in an array.
+func MarshalWitnessJSON(w []*big.Int) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	for i, bi := range w {
+		buffer.WriteString(`"` + bi.String() + `"`)
+		if i != len(w)-1 {
+			buffer.WriteString(",")
+		}
+	}
+	buffer.WriteString("]")
+	return buffer.Bytes(), nil
+}
+
+// ParseWitnessJSON parses a witness in the snarkjs JSON format, as written by
+// MarshalWitnessJSON and by snarkjs `wtns export json`.
+func ParseWitnessJSON(witnessJSON []byte) ([]*big.Int, error) {
+	var values []string
+	if err := json.Unmarshal(witnessJSON, &values); err != nil {
+		return nil, err
+	}
+	w := make([]*big.Int, len(values))
+	for i, v := range values {
+		var ok bool
+		w[i], ok = new(big.Int).SetString(v, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid witness value %d: %q", i, v)
+		}
+	}
+	return w, nil
+}
+
+// ParseWitnessBinLE parses a witness encoded like Witness.ToBinLE in the field
+// of the prime, checking that every value is a field element.
+func ParseWitnessBinLE(b []byte, prime *big.Int) ([]*big.Int, error) {
+	n8 := primeN8(prime)
+	if len(b)%n8 != 0 {
+		return nil, fmt.Errorf("size %d is not a multiple of the field element size %d", len(b), n8)
+	}
+	h := WTNSHeader{N8: uint32(n8), Prime: prime, NWitness: uint32(len(b) / n8)}
+	w := make([]*big.Int, 0, h.NWitness)
+	err := readWTNSWitness(bytes.NewReader(b), &h, func(v *big.Int) {
+		w = append(w, v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
@@ -0,0 +1,52 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWitness(t *testing.T) {
+	values := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+	w := NewWitness(values, bn254)
+	assert.Equal(t, 4, w.Len())
+	assert.Equal(t, big.NewInt(33), w.At(1))
+	assert.Equal(t, values, w.Values())
+	assert.Equal(t, bn254, w.Prime())
+	assert.Equal(t, []*big.Int{big.NewInt(33)}, w.Public(1))
+
+	wJSON, err := w.ToJSON()
+	require.NoError(t, err)
+	assert.Equal(t, `["1","33","3","11"]`, string(wJSON))
+
+	bin, err := w.ToBinLE()
+	require.NoError(t, err)
+	require.Len(t, bin, 4*32)
+	assert.Equal(t, byte(33), bin[32])
+
+	wtns, err := w.ToWTNS()
+	require.NoError(t, err)
+	prime, wtnsValues, err := ParseWTNS(bytes.NewReader(wtns))
+	require.NoError(t, err)
+	assert.Equal(t, bn254, prime)
+	assert.Equal(t, values, wtnsValues)
+	assert.Equal(t, bin, wtns[len(wtns)-len(bin):])
+
+	parsed, err := ParseWitnessBinLE(bin, bn254)
+	require.NoError(t, err)
+	assert.Equal(t, values, parsed)
+	_, err = ParseWitnessBinLE(bin[:len(bin)-1], bn254)
+	require.Error(t, err)
+
+	_, err = NewWitness([]*big.Int{bn254}, bn254).ToBinLE()
+	require.EqualError(t, err, "witness[0] = "+bn254.String()+" is not a field element")
+	_, err = ParseWitnessBinLE(bin[32:40], big.NewInt(7))
+	require.EqualError(t, err, "witness[0] = 33 is not a field element")
+	_, err = NewWitness([]*big.Int{big.NewInt(-1)}, bn254).ToBinLE()
+	require.Error(t, err)
+	_, err = NewWitness([]*big.Int{bn254}, bn254).ToWTNS()
+	require.Error(t, err)
+}
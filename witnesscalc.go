@@ -1,17 +1,28 @@
+//go:build cgo && !js
+// +build cgo,!js
+
 package witnesscalc
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"math"
 	"math/big"
 	"reflect"
+	"strings"
 	"unsafe"
 
-	log "github.com/sirupsen/logrus"
-
 	wasm3 "github.com/iden3/go-wasm3"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/internal/log"
+	"github.com/iden3/go-circom-witnesscalc/v2/lowlevel"
 )
 
 // witnessCalcFns are wrapper functions to the WitnessCalc WASM module
@@ -36,7 +47,7 @@ func getStack(sp unsafe.Pointer, length int) []uint64 {
 	return *(*[]uint64)(unsafe.Pointer(&header))
 }
 
-func getMem(r *wasm3.Runtime, _mem unsafe.Pointer) []byte {
+func getMem(r Runtime, _mem unsafe.Pointer) []byte {
 	var data = (*uint8)(_mem)
 	length := r.GetAllocatedMemoryLength()
 	var header reflect.SliceHeader
@@ -47,17 +58,115 @@ func getMem(r *wasm3.Runtime, _mem unsafe.Pointer) []byte {
 	return *(*[]byte)(unsafe.Pointer(&header))
 }
 
-func getStr(mem []byte, p uint64) string {
-	var buf bytes.Buffer
-	for ; mem[p] != 0; p++ {
-		buf.WriteByte(mem[p])
+// getStr returns the NUL terminated string at position p of mem, truncated to
+// maxStrLen bytes and with invalid UTF-8 sequences replaced.
+func getStr(mem []byte, p uint64) (string, error) {
+	if p >= uint64(len(mem)) {
+		return "", fmt.Errorf("string at %d out of bounds (%d bytes)", p, len(mem))
+	}
+	b := mem[p:]
+	truncated := false
+	if len(b) > maxStrLen {
+		b = b[:maxStrLen]
+		truncated = true
+	}
+	n := bytes.IndexByte(b, 0)
+	if n >= 0 {
+		b = b[:n]
+	} else if !truncated {
+		return "", fmt.Errorf("string at %d is not terminated", p)
+	}
+	s := strings.ToValidUTF8(string(b), "\uFFFD")
+	if n < 0 {
+		s += "..."
+	}
+	return s, nil
+}
+
+// decodeRuntimeError decodes the arguments of the runtime.error import.
+func (wc *WitnessCalculator) decodeRuntimeError(mem []byte, code, pstr, a, b, c, d uint64) *RuntimeError {
+	// The arguments come from the module: invalid pointers are reported in
+	// the message instead of failing.
+	str := func(p uint64) string {
+		s, err := getStr(mem, p)
+		if err != nil {
+			return fmt.Sprintf("<%v>", err)
+		}
+		return s
+	}
+	fr := func(p uint64) string {
+		v, err := wc.loadFr(int32(p))
+		if err != nil {
+			return fmt.Sprintf("<%v>", err)
+		}
+		return v.String()
+	}
+	e := &RuntimeError{
+		Code: int(code),
+		Args: [4]int32{int32(a), int32(b), int32(c), int32(d)},
+	}
+	if pstr != 0 {
+		e.Msg = str(pstr)
+	}
+	// The message is the one of witness_calculator.js, without the arguments
+	// when they are all zero.
+	switch {
+	case code == ErrCodeConstraintDoesNotMatch:
+		// (cIdx, pA, pB, pStr)
+		e.Msg = fmt.Sprintf("%s %s != %s", e.Msg, fr(b), fr(c))
+		if d != 0 {
+			e.Msg += " " + str(d)
+		}
+	case e.Args != [4]int32{}:
+		msg := e.Msg
+		if msg == "" {
+			msg = runtimeErrorMessages[int(code)]
+		}
+		e.Msg = fmt.Sprintf("%s %d %d %d %d", msg, e.Args[0], e.Args[1], e.Args[2], e.Args[3])
+	}
+	return e
+}
+
+// takeRuntimeError returns the RuntimeError reported by the module during the
+// call that failed with err, or err if there is none.
+func (wc *WitnessCalculator) takeRuntimeError(err error) error {
+	if wc.abortErr != nil {
+		e := wc.abortErr
+		wc.abortErr = nil
+		return e
+	}
+	if wc.runtimeErr == nil {
+		return err
+	}
+	e := wc.runtimeErr
+	wc.runtimeErr = nil
+	return e
+}
+
+// attachAbort attaches the env.abort import of the modules built with other
+// toolchains, which aborts the calculation with an AbortError.  Only the
+// signature of the module, if any, is linked.
+func (wc *WitnessCalculator) attachAbort(r Runtime) {
+	for _, sig := range []string{"v()", "v(i)", "v(iiii)"} {
+		nArgs := len(sig) - 3
+		r.AttachFunction("env", "abort", sig, wasm3.CallbackFunction(
+			func(runtime wasm3.RuntimeT, sp unsafe.Pointer, _mem unsafe.Pointer) int {
+				args := make([]uint32, nArgs)
+				for i, v := range getStack(sp, nArgs) {
+					args[i] = uint32(v)
+				}
+				wc.abortErr = decodeAbort(sliceMemReader(getMem(r, _mem)), args)
+				return 1
+			},
+		))
 	}
-	return buf.String()
 }
 
 // newWitnessCalcFns builds the witnessCalcFns from the loaded WitnessCalc WASM
 // module in the runtime.  Imported functions (logging) are binded to dummy functions.
-func newWitnessCalcFns(r *wasm3.Runtime, m *wasm3.Module, wc *WitnessCalculator) (*witnessCalcFns, error) {
+// releaseLinked is set if the debug imports are already linked to the stubs
+// of WithReleaseMode, by newRuntime.
+func newWitnessCalcFns(r Runtime, wc *WitnessCalculator, releaseLinked bool) (*witnessCalcFns, error) {
 	r.AttachFunction("runtime", "error", "v(iiiiii)", wasm3.CallbackFunction(
 		func(runtime wasm3.RuntimeT, sp unsafe.Pointer, _mem unsafe.Pointer) int {
 			// func(code, pstr, a, b, c, d)
@@ -72,132 +181,172 @@ func newWitnessCalcFns(r *wasm3.Runtime, m *wasm3.Module, wc *WitnessCalculator)
 			c := stack[4]
 			d := stack[5]
 
-			var errStr string
-			if code == 7 {
-				errStr = fmt.Sprintf("%s %v != %v %s",
-					getStr(mem, pstr),
-					wc.loadFr(int32(b)), wc.loadFr(int32(c)), getStr(mem, d))
-			} else {
-				errStr = fmt.Sprintf("%s %v %v %v %v",
-					getStr(mem, pstr), a, b, c, getStr(mem, d))
-			}
-			log.Errorf("WitnessCalculator WASM Error (%v): %v", code, errStr)
-			return 0
+			wc.runtimeErr = wc.decodeRuntimeError(mem, code, pstr, a, b, c, d)
+			// Abort the calculation, like the JavaScript runtime throwing.
+			return 1
 		},
 	))
-	r.AttachFunction("runtime", "logSetSignal", "v(ii)", wasm3.CallbackFunction(
+	wc.attachAbort(r)
+	// attachDebug attaches the debug import name, or a no-op with
+	// WithReleaseMode if newRuntime didn't link it to a native one, which
+	// attaching would replace.
+	attachDebug := func(name, sig string, f wasm3.CallbackFunction) {
+		switch {
+		case releaseLinked:
+		case wc.opts.releaseMode:
+			r.AttachFunction("runtime", name, sig, wasm3.CallbackFunction(
+				func(runtime wasm3.RuntimeT, sp unsafe.Pointer, mem unsafe.Pointer) int {
+					return 0
+				},
+			))
+		default:
+			r.AttachFunction("runtime", name, sig, f)
+		}
+	}
+	attachDebug("logSetSignal", "v(ii)", wasm3.CallbackFunction(
 		func(runtime wasm3.RuntimeT, sp unsafe.Pointer, mem unsafe.Pointer) int {
 			return 0
 		},
 	))
-	r.AttachFunction("runtime", "logGetSignal", "v(ii)", wasm3.CallbackFunction(
+	attachDebug("logGetSignal", "v(ii)", wasm3.CallbackFunction(
 		func(runtime wasm3.RuntimeT, sp unsafe.Pointer, mem unsafe.Pointer) int {
 			return 0
 		},
 	))
-	r.AttachFunction("runtime", "logFinishComponent", "v(i)", wasm3.CallbackFunction(
+	attachDebug("logFinishComponent", "v(i)", wasm3.CallbackFunction(
 		func(runtime wasm3.RuntimeT, sp unsafe.Pointer, mem unsafe.Pointer) int {
+			if wc.profile != nil {
+				wc.profile.finish(int32(getStack(sp, 1)[0]))
+			}
 			return 0
 		},
 	))
-	r.AttachFunction("runtime", "logStartComponent", "v(i)", wasm3.CallbackFunction(
+	attachDebug("logStartComponent", "v(i)", wasm3.CallbackFunction(
 		func(runtime wasm3.RuntimeT, sp unsafe.Pointer, mem unsafe.Pointer) int {
+			if wc.profile != nil {
+				wc.profile.start(int32(getStack(sp, 1)[0]))
+			}
 			return 0
 		},
 	))
-	r.AttachFunction("runtime", "log", "v(i)", wasm3.CallbackFunction(
+	attachDebug("log", "v(i)", wasm3.CallbackFunction(
 		func(runtime wasm3.RuntimeT, sp unsafe.Pointer, mem unsafe.Pointer) int {
+			wc.logFr(int32(getStack(sp, 1)[0]))
 			return 0
 		},
 	))
 
-	_getFrLen, err := r.FindFunction("getFrLen")
+	// find looks up an exported function, counting its calls.
+	find := func(name string) (wasm3.FunctionWrapper, error) {
+		f, err := r.FindFunction(name)
+		if err != nil {
+			return nil, err
+		}
+		return func(args ...interface{}) (interface{}, error) {
+			wc.wasmCalls++
+			return f(args...)
+		}, nil
+	}
+
+	_getFrLen, err := find("getFrLen")
 	if err != nil {
+		// circom 2 modules export getVersion instead
+		if _, err2 := r.FindFunction("getVersion"); err2 == nil {
+			return nil, newABIError(true)
+		}
 		return nil, err
 	}
 	getFrLen := func() (int32, error) {
 		res, err := _getFrLen()
 		if err != nil {
+			err = wc.takeRuntimeError(err)
 			return 0, err
 		}
-		return res.(int32), nil
+		return int32Result("getFrLen", res)
 	}
-	_getPRawPrime, err := r.FindFunction("getPRawPrime")
+	_getPRawPrime, err := find("getPRawPrime")
 	if err != nil {
 		return nil, err
 	}
 	getPRawPrime := func() (int32, error) {
 		res, err := _getPRawPrime()
 		if err != nil {
+			err = wc.takeRuntimeError(err)
 			return 0, err
 		}
-		return res.(int32), nil
+		return int32Result("getPRawPrime", res)
 	}
-	_getNVars, err := r.FindFunction("getNVars")
+	_getNVars, err := find("getNVars")
 	if err != nil {
 		return nil, err
 	}
 	getNVars := func() (int32, error) {
 		res, err := _getNVars()
 		if err != nil {
+			err = wc.takeRuntimeError(err)
 			return 0, err
 		}
-		return res.(int32), nil
+		return int32Result("getNVars", res)
 	}
-	_init, err := r.FindFunction("init")
+	_init, err := find("init")
 	if err != nil {
 		return nil, err
 	}
 	init := func(sanityCheck int32) error {
 		_, err := _init(sanityCheck)
 		if err != nil {
+			err = wc.takeRuntimeError(err)
 			return err
 		}
 		return nil
 	}
-	_getSignalOffset32, err := r.FindFunction("getSignalOffset32")
+	_getSignalOffset32, err := find("getSignalOffset32")
 	if err != nil {
 		return nil, err
 	}
 	getSignalOffset32 := func(pR, component, hashMSB, hashLSB int32) error {
 		_, err := _getSignalOffset32(pR, component, hashMSB, hashLSB)
 		if err != nil {
+			err = wc.takeRuntimeError(err)
 			return err
 		}
 		return nil
 	}
-	_setSignal, err := r.FindFunction("setSignal")
+	_setSignal, err := find("setSignal")
 	if err != nil {
 		return nil, err
 	}
 	setSignal := func(cIdx, component, signal, pVal int32) error {
 		_, err := _setSignal(cIdx, component, signal, pVal)
 		if err != nil {
+			err = wc.takeRuntimeError(err)
 			return err
 		}
 		return nil
 	}
-	_getPWitness, err := r.FindFunction("getPWitness")
+	_getPWitness, err := find("getPWitness")
 	if err != nil {
 		return nil, err
 	}
 	getPWitness := func(w int32) (int32, error) {
 		res, err := _getPWitness(w)
 		if err != nil {
+			err = wc.takeRuntimeError(err)
 			return 0, err
 		}
-		return res.(int32), nil
+		return int32Result("getPWitness", res)
 	}
-	_getWitnessBuffer, err := r.FindFunction("getWitnessBuffer")
+	_getWitnessBuffer, err := find("getWitnessBuffer")
 	if err != nil {
 		return nil, err
 	}
 	getWitnessBuffer := func() (int32, error) {
 		res, err := _getWitnessBuffer()
 		if err != nil {
+			err = wc.takeRuntimeError(err)
 			return 0, err
 		}
-		return res.(int32), nil
+		return int32Result("getWitnessBuffer", res)
 	}
 
 	return &witnessCalcFns{
@@ -212,36 +361,42 @@ func newWitnessCalcFns(r *wasm3.Runtime, m *wasm3.Module, wc *WitnessCalculator)
 	}, nil
 }
 
-// WitnessJSON is a wrapper type to Marshal the Witness in JSON format
-type WitnessJSON []*big.Int
-
-// MarshalJSON marshals the WitnessJSON where each value is encoded in base 10
-// as a string in an array.
-func (w WitnessJSON) MarshalJSON() ([]byte, error) {
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
-	for i, bi := range w {
-		buffer.WriteString(`"` + bi.String() + `"`)
-		if i != len(w)-1 {
-			buffer.WriteString(",")
-		}
-	}
-	buffer.WriteString("]")
-	return buffer.Bytes(), nil
+// Runtime is the WASM runtime a WitnessCalculator executes the WitnessCalc
+// module in.  It is implemented by *wasm3.Runtime after the module has been
+// loaded.  Every *wasm3.Runtime needs its own wasm3.Environment, which its
+// Destroy method frees: runtimes sharing one crash when the second is
+// destroyed.
+type Runtime interface {
+	AttachFunction(moduleName string, functionName string, signature string, callback wasm3.CallbackFunction)
+	FindFunction(funcName string) (wasm3.FunctionWrapper, error)
+	Memory() []byte
+	GetAllocatedMemoryLength() int
 }
 
 // loadBigInt loads a *big.Int from the runtime memory at position p.
-func loadBigInt(runtime *wasm3.Runtime, p int32, n int32) *big.Int {
-	bigIntBytes := make([]byte, n)
-	copy(bigIntBytes, runtime.Memory()[p:p+n])
-	return new(big.Int).SetBytes(swap(bigIntBytes))
+func loadBigInt(runtime Runtime, p int32, n int32) (*big.Int, error) {
+	b, err := memRange(runtime.Memory(), int64(p), int64(n))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(swap(b)), nil
 }
 
+// ShortLimit bounds the Field elements that the circom 1 runtime stores in the
+// short form, a 32 bit signed integer: the ones in [0, ShortLimit) and in
+// [prime - ShortLimit, prime), the latter standing for the negative values.
+// It is the one of lowlevel, whose Fr encodes the field elements like the
+// WitnessCalculator.
+const ShortLimit = lowlevel.ShortLimit
+
 // WitnessCalculator is the object that allows performing witness calculation
-// from signal inputs using the WitnessCalc WASM module.
+// from signal inputs using the WitnessCalc WASM module.  It is not safe for
+// concurrent use: concurrent calculations need a calculator each, e.g. from a
+// CalculatorPool.
 type WitnessCalculator struct {
 	n32    int32
 	prime  *big.Int
+	curve  Curve
 	mask32 *big.Int
 	nVars  int32
 	n64    uint
@@ -251,37 +406,134 @@ type WitnessCalculator struct {
 	shortMax *big.Int
 	shortMin *big.Int
 
-	runtime *wasm3.Runtime
+	runtime Runtime
 	fns     *witnessCalcFns
+	opts    options
+	// codec converts the field elements of the runtime memory.
+	codec LimbCodec
+	// reducer converts the witness out of Montgomery form, with
+	// WithBatchMontgomery.
+	reducer *montgomeryReducer
+	// alloc is the allocation convention of the module and scratchPos the
+	// next free position of the scratch memory, for allocScratch.
+	alloc      allocConvention
+	scratchPos int32
+
+	// runtimeErr is the error reported by the module during the last call,
+	// and abortErr the one reported through env.abort.
+	runtimeErr *RuntimeError
+	abortErr   *AbortError
+	// signalNames maps signal indexes to names, from WithSymbols.
+	signalNames map[int32]string
+	// profile records the components of the running calculation and
+	// componentTree is built from it, with WithComponentTree.
+	profile       *componentProfile
+	componentTree *ComponentTree
+	// logger emits the values logged by the circuit.
+	logger circuitLogger
+	// timer measures the running calculation, with WithStats, and wasmCalls
+	// counts the calls to the module.
+	timer     *statsTimer
+	wasmCalls int
+	// ctx is the context of the running CalculateWitnessAsync calculation.
+	ctx context.Context
+	// calculated is set when the module holds the witness of the last
+	// calculation, for SampleWitness.
+	calculated bool
+	// circuitHash is the hash of the module, nil if the WitnessCalculator
+	// was created from a runtime.
+	circuitHash *CircuitHash
+	// witnessOrder maps the witness indexes to the indexes of the witness
+	// buffer, for WithParallelExtraction, found on the first extraction.  It
+	// is empty if the buffer doesn't hold the witness values.
+	witnessOrder []int32
+
+	// wasm, ownRuntime and stackSize are only set when the runtime is owned
+	// by the WitnessCalculator (see LoadWitnessCalculator).
+	wasm       []byte
+	ownRuntime *wasm3.Runtime
+	stackSize  uint
 }
 
+var _ Calculator = (*WitnessCalculator)(nil)
+
 // NewWitnessCalculator creates a new WitnessCalculator from the WitnessCalc
 // loaded WASM module in the runtime.
-func NewWitnessCalculator(runtime *wasm3.Runtime, module *wasm3.Module) (*WitnessCalculator, error) {
+func NewWitnessCalculator(runtime Runtime, opts ...Option) (*WitnessCalculator, error) {
+	return newWitnessCalculator(runtime, nil, opts)
+}
+
+// newWitnessCalculator creates a WitnessCalculator from the WASM module
+// wasmBytes, or nil if unknown, loaded in the runtime.
+func newWitnessCalculator(runtime Runtime, wasmBytes []byte, opts []Option) (*WitnessCalculator, error) {
 	var wc WitnessCalculator
-	fns, err := newWitnessCalcFns(runtime, module, &wc)
-	if err != nil {
+	wc.opts = newOptions(opts)
+	wc.logger = circuitLogger{circuit: wc.opts.circuitName, collect: wc.opts.circuitLogs}
+	if err := wc.setRuntime(runtime, wasmBytes); err != nil {
 		return nil, err
 	}
+	return &wc, nil
+}
+
+// setRuntime binds the WitnessCalculator to the WitnessCalc WASM module
+// loaded in the runtime.  wasmBytes, the module, is used if not nil to detect
+// its allocation convention.
+func (wc *WitnessCalculator) setRuntime(runtime Runtime, wasmBytes []byte) error {
+	fns, err := newWitnessCalcFns(runtime, wc, wc.opts.releaseMode && wasmBytes != nil)
+	if err != nil {
+		return err
+	}
 
 	n32, err := fns.getFrLen()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	// n32 = (n32 >> 2) - 2
 	n32 = n32 - 8
 
 	pRawPrime, err := fns.getPRawPrime()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	prime := loadBigInt(runtime, pRawPrime, n32)
+	if n32 <= 0 || n32 > maxFieldLen32*4 || n32%8 != 0 {
+		return fmt.Errorf("invalid field element size %d", n32)
+	}
+	prime, err := loadBigInt(runtime, pRawPrime, n32)
+	if err != nil {
+		return fmt.Errorf("prime: %w", err)
+	}
+	if prime.Cmp(big.NewInt(1)) <= 0 {
+		return fmt.Errorf("invalid prime %v", prime)
+	}
+	if wc.prime != nil && prime.Cmp(wc.prime) != 0 {
+		return fmt.Errorf("the prime of the module %v doesn't match the prime %v", prime, wc.prime)
+	}
+	curve, err := checkCurve(prime, wc.opts)
+	if err != nil {
+		return err
+	}
 
-	mask32 := new(big.Int).SetUint64(0xFFFFFFFF)
+	mask32 := new(big.Int).SetUint64(lowlevel.Mask32)
 	nVars, err := fns.getNVars()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if nVars < 0 {
+		return fmt.Errorf("invalid number of witness variables %d", nVars)
+	}
+	if len(runtime.Memory()) < 8 {
+		return fmt.Errorf("module memory too small")
+	}
+	alloc, err := detectAllocConvention(runtime, wasmBytes)
+	if err != nil {
+		return err
+	}
+	var scratchPos int32
+	if alloc == allocScratch {
+		if scratchPos, err = reserveScratch(runtime); err != nil {
+			return err
+		}
 	}
 
 	n64 := uint(((prime.BitLen() - 1) / 64) + 1)
@@ -289,15 +541,12 @@ func NewWitnessCalculator(runtime *wasm3.Runtime, module *wasm3.Module) (*Witnes
 	r.Lsh(r, n64*64)
 	rInv := new(big.Int).ModInverse(r, prime)
 
-	shortMax, ok := new(big.Int).SetString("0x80000000", 0)
-	if !ok {
-		return nil, fmt.Errorf("unable to set shortMax from string")
-	}
-	shortMin := new(big.Int).Set(prime)
-	shortMin.Sub(shortMin, shortMax)
+	shortMax := big.NewInt(ShortLimit)
+	shortMin := new(big.Int).Sub(prime, shortMax)
 
 	wc.n32 = n32
 	wc.prime = prime
+	wc.curve = curve
 	wc.mask32 = mask32
 	wc.nVars = nVars
 	wc.n64 = n64
@@ -307,30 +556,58 @@ func NewWitnessCalculator(runtime *wasm3.Runtime, module *wasm3.Module) (*Witnes
 	wc.shortMax = shortMax
 	wc.runtime = runtime
 	wc.fns = fns
-	return &wc, nil
+	wc.alloc = alloc
+	wc.scratchPos = scratchPos
+	wc.calculated = false
+	wc.witnessOrder = nil
+	if wasmBytes != nil {
+		h := NewCircuitHash(wasmBytes)
+		wc.circuitHash = &h
+	}
+	if wc.opts.symbols != nil {
+		wc.signalNames = make(map[int32]string, len(wc.opts.symbols))
+		for _, sym := range wc.opts.symbols {
+			wc.signalNames[int32(sym.LabelIdx)] = sym.Name
+		}
+	}
+	if wc.opts.preGrowMemory {
+		return wc.preGrowMemory()
+	}
+	return nil
 }
 
 // loadBigInt loads a *big.Int from the runtime memory at position p.
-func (wc *WitnessCalculator) loadBigInt(p int32, n int32) *big.Int {
-	return loadBigInt(wc.runtime, p, n)
+func (wc *WitnessCalculator) loadBigInt(p int32, n int32) (*big.Int, error) {
+	b, err := memRange(wc.runtime.Memory(), int64(p), int64(n))
+	if err != nil {
+		return nil, err
+	}
+	return wc.codec.Decode(b), nil
 }
 
-var zero32 [32]byte
-
 // storeBigInt stores a *big.Int into the runtime memory at position p.
-func (wc *WitnessCalculator) storeBigInt(p int32, v *big.Int) {
-	bigIntBytes := swap(v.Bytes())
-	copy(wc.runtime.Memory()[p:p+32], zero32[:])
-	copy(wc.runtime.Memory()[p:p+int32(len(bigIntBytes))], bigIntBytes)
+func (wc *WitnessCalculator) storeBigInt(p int32, v *big.Int) error {
+	b, err := memRange(wc.runtime.Memory(), int64(p), int64(wc.n32))
+	if err != nil {
+		return err
+	}
+	return wc.codec.Encode(b, v)
 }
 
 // memFreePos gives the next free runtime memory position.
 func (wc *WitnessCalculator) memFreePos() int32 {
+	if wc.alloc == allocScratch {
+		return wc.scratchPos
+	}
 	return int32(binary.LittleEndian.Uint32(wc.runtime.Memory()[:4]))
 }
 
 // setMemFreePos sets the next free runtime memory position.
 func (wc *WitnessCalculator) setMemFreePos(p int32) {
+	if wc.alloc == allocScratch {
+		wc.scratchPos = p
+		return
+	}
 	binary.LittleEndian.PutUint32(wc.runtime.Memory()[:4], uint32(p))
 }
 
@@ -349,53 +626,122 @@ func (wc *WitnessCalculator) allocFr() int32 {
 }
 
 // getInt loads an int32 from the runtime memory at position p.
-func (wc *WitnessCalculator) getInt(p int32) int32 {
-	return int32(binary.LittleEndian.Uint32(wc.runtime.Memory()[p : p+4]))
+func (wc *WitnessCalculator) getInt(p int32) (int32, error) {
+	b, err := memRange(wc.runtime.Memory(), int64(p), 4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(b)), nil
 }
 
 // setInt stores an int32 in the runtime memory at position p.
-func (wc *WitnessCalculator) setInt(p, v int32) {
-	binary.LittleEndian.PutUint32(wc.runtime.Memory()[p:p+4], uint32(v))
+func (wc *WitnessCalculator) setInt(p, v int32) error {
+	b, err := memRange(wc.runtime.Memory(), int64(p), 4)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b, uint32(v))
+	return nil
 }
 
 // setShortPositive stores a small positive Field element in the runtime memory at position p.
-func (wc *WitnessCalculator) setShortPositive(p int32, v *big.Int) {
-	if !v.IsInt64() || v.Int64() >= 0x80000000 {
-		panic(fmt.Errorf("v should be < 0x80000000"))
+func (wc *WitnessCalculator) setShortPositive(p int32, v *big.Int) error {
+	if !v.IsInt64() || v.Int64() < -0x80000000 || v.Int64() >= 0x80000000 {
+		return fmt.Errorf("v should be in [-0x80000000, 0x80000000)")
+	}
+	if err := wc.setInt(p, int32(v.Int64())); err != nil {
+		return err
 	}
-	wc.setInt(p, int32(v.Int64()))
-	wc.setInt(p+4, 0)
+	return wc.setInt(p+4, 0)
 }
 
 // setShortPositive stores a small negative *big.Int in the runtime memory at position p.
-func (wc *WitnessCalculator) setShortNegative(p int32, v *big.Int) {
+func (wc *WitnessCalculator) setShortNegative(p int32, v *big.Int) error {
 	vNeg := new(big.Int).Set(wc.prime) // prime
 	vNeg.Sub(vNeg, wc.shortMax)        // prime - max
 	vNeg.Sub(v, vNeg)                  // v - (prime - max)
 	vNeg.Add(wc.shortMax, vNeg)        // max + (v - (prime - max))
 	if !vNeg.IsInt64() || vNeg.Int64() < 0x80000000 || vNeg.Int64() >= 0x80000000*2 {
-		panic(fmt.Errorf("v should be < 0x80000000"))
+		return fmt.Errorf("v should be in [prime - 0x80000000, prime + 0x80000000)")
+	}
+	if err := wc.setInt(p, int32(vNeg.Int64())); err != nil {
+		return err
 	}
-	wc.setInt(p, int32(vNeg.Int64()))
-	wc.setInt(p+4, 0)
+	return wc.setInt(p+4, 0)
 }
 
 // setShortPositive stores a normal Field element in the runtime memory at position p.
-func (wc *WitnessCalculator) setLongNormal(p int32, v *big.Int) {
-	wc.setInt(p, 0)
-	wc.setInt(p+4, math.MinInt32) // math.MinInt32 = 0x80000000
-	wc.storeBigInt(p+8, v)
+func (wc *WitnessCalculator) setLongNormal(p int32, v *big.Int) error {
+	if err := wc.setInt(p, 0); err != nil {
+		return err
+	}
+	if err := wc.setInt(p+4, math.MinInt32); err != nil { // math.MinInt32 = 0x80000000
+		return err
+	}
+	return wc.storeBigInt(p+8, v)
 }
 
 // storeFr stores a Field element in the runtime memory at position p.
-func (wc *WitnessCalculator) storeFr(p int32, v *big.Int) {
+// SignalValues other than *big.Int that are short or clearly below the prime
+// are stored without converting them to *big.Int.
+func (wc *WitnessCalculator) storeFr(p int32, value SignalValue) error {
+	v, ok := value.(*big.Int)
+	if !ok {
+		switch {
+		case value.Sign() >= 0 && value.BitLen() < 32:
+			var b [4]byte
+			value.FillBytes(b[:])
+			if err := wc.setInt(p, int32(binary.BigEndian.Uint32(b[:]))); err != nil {
+				return err
+			}
+			return wc.setInt(p+4, 0)
+		case value.Sign() > 0 && value.BitLen() < wc.prime.BitLen():
+			if err := wc.setInt(p, 0); err != nil {
+				return err
+			}
+			if err := wc.setInt(p+4, math.MinInt32); err != nil {
+				return err
+			}
+			m, err := memRange(wc.runtime.Memory(), int64(p+8), int64(wc.n32))
+			if err != nil {
+				return err
+			}
+			return fillLE(m, value)
+		}
+		v = bigValue(value)
+	}
 	if v.Cmp(wc.shortMax) == -1 {
-		wc.setShortPositive(p, v)
+		return wc.setShortPositive(p, v)
 	} else if v.Cmp(wc.shortMin) >= 0 {
-		wc.setShortNegative(p, v)
-	} else {
-		wc.setLongNormal(p, v)
+		return wc.setShortNegative(p, v)
 	}
+	return wc.setLongNormal(p, v)
+}
+
+// encodeFr returns the runtime memory representation of the Field element v
+// written by storeFr.
+func (wc *WitnessCalculator) encodeFr(v SignalValue) ([]byte, error) {
+	p := wc.allocFr()
+	defer wc.setMemFreePos(p)
+	if err := wc.storeFr(p, v); err != nil {
+		return nil, err
+	}
+	b, err := memRange(wc.runtime.Memory(), int64(p), int64(wc.n32+8))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// storeEncodedFr stores a Field element encoded by encodeFr in the runtime
+// memory at position p.
+func (wc *WitnessCalculator) storeEncodedFr(p int32, b []byte) error {
+	m, err := memRange(wc.runtime.Memory(), int64(p), int64(len(b)))
+	if err != nil {
+		return err
+	}
+	copy(m, b)
+	return nil
 }
 
 // fromMontgomery transforms a Field element from Montgomery form to regular form.
@@ -407,89 +753,728 @@ func (wc *WitnessCalculator) fromMontgomery(v *big.Int) *big.Int {
 }
 
 // loadFr loads a Field element from the runtime memory at position p.
-func (wc *WitnessCalculator) loadFr(p int32) *big.Int {
-	m := wc.runtime.Memory()
-	if (m[p+4+3] & 0x80) != 0 {
-		res := wc.loadBigInt(p+8, wc.n32)
-		if (m[p+4+3] & 0x40) != 0 {
-			return wc.fromMontgomery(res)
+func (wc *WitnessCalculator) loadFr(p int32) (*big.Int, error) {
+	m, err := memRange(wc.runtime.Memory(), int64(p), 8)
+	if err != nil {
+		return nil, err
+	}
+	if (m[4+3] & 0x80) != 0 {
+		res, err := wc.loadBigInt(p+8, wc.n32)
+		if err != nil {
+			return nil, err
+		}
+		if (m[4+3] & 0x40) != 0 {
+			return wc.fromMontgomery(res), nil
 		} else {
-			return res
+			return res, nil
 		}
 	} else {
-		if (m[p+3] & 0x40) != 0 {
-			res := wc.loadBigInt(p, 4) // res
-			res.Sub(res, wc.shortMax)  // res - max
-			res.Add(wc.prime, res)     // res - max + prime
-			res.Sub(res, wc.shortMax)  // res - max + (prime - max)
-			return res
+		// the short form is a 32 bit signed integer, negative for [prime - max, prime)
+		if (m[3] & 0x80) != 0 {
+			res, err := wc.loadBigInt(p, 4) // res
+			if err != nil {
+				return nil, err
+			}
+			res.Sub(res, wc.shortMax) // res - max
+			res.Add(wc.prime, res)    // res - max + prime
+			res.Sub(res, wc.shortMax) // res - max + (prime - max)
+			return res, nil
 		} else {
 			return wc.loadBigInt(p, 4)
 		}
 	}
 }
 
+// logFr logs the Field element at position p, logged by the circuit.
+func (wc *WitnessCalculator) logFr(p int32) {
+	wc.logger.log(wc.loadFr(p))
+}
+
 // doCalculateWitness is an internal function that calculates the witness.
 func (wc *WitnessCalculator) doCalculateWitness(inputs map[string]interface{}, sanityCheck bool) error {
+	inputs, err := wc.opts.normalizeInputs(inputs, wc.prime)
+	if err != nil {
+		return err
+	}
+	if wc.opts.lintInputs {
+		if err := logLintWarnings(inputs, wc.prime, wc.opts.binaryInputs); err != nil {
+			return err
+		}
+	}
+	signals, err := newSignalInputs(inputs)
+	if err != nil {
+		return err
+	}
+	return wc.doCalculateWitnessSignals(signals, sanityCheck)
+}
+
+// doCalculateWitnessSignals is an internal function that calculates the
+// witness of the hashed input signals.
+func (wc *WitnessCalculator) doCalculateWitnessSignals(signals []signalInput, sanityCheck bool) error {
+	signals, err := wc.opts.fillMissingInputs(signals, wc.opts.inputSignals)
+	if err != nil {
+		return err
+	}
 	sanityCheckVal := int32(0)
 	if sanityCheck {
 		sanityCheckVal = 1
 	}
+	if wc.opts.componentTree {
+		wc.profile = newComponentProfile()
+		defer func() { wc.profile = nil }()
+	}
+	wc.calculated = false
+	wc.logger.reset()
+	wc.timer.lap(phaseNone)
 	if err := wc.fns.init(sanityCheckVal); err != nil {
 		return err
 	}
+	wc.timer.lap(phaseInit)
+	if err := wc.checkLayoutStart(wc.memFreePos()); err != nil {
+		return err
+	}
 	pSigOffset := wc.allocInt()
 	pFr := wc.allocFr()
 
-	for inputName, inputValue := range inputs {
-		hMSB, hLSB := fnvHash(inputName)
-		wc.fns.getSignalOffset32(pSigOffset, 0, hMSB, hLSB)
-		sigOffset := wc.getInt(pSigOffset)
-		fSlice := flatSlice(inputValue)
-		for i, value := range fSlice {
-			wc.storeFr(pFr, value)
-			wc.fns.setSignal(0, 0, sigOffset+int32(i), pFr)
+	var rec *recording
+	if wc.opts.recorder != nil {
+		rec = wc.newRecording(sanityCheck)
+	}
+	for _, signal := range signals {
+		hMSB, hLSB := signal.id.MSB, signal.id.LSB
+		if err := wc.setInt(pSigOffset, 0); err != nil {
+			return err
+		}
+		if err := wc.fns.getSignalOffset32(pSigOffset, 0, hMSB, hLSB); err != nil {
+			var e *RuntimeError
+			if errors.As(err, &e) && e.Code == ErrCodeHashNotFound {
+				return ErrUnknownInput{Name: signal.name, Err: err}
+			}
+			return fmt.Errorf("input %s: %w", signal.name, err)
+		}
+		sigOffset, err := wc.getInt(pSigOffset)
+		if err != nil {
+			return fmt.Errorf("input %s: %w", signal.name, err)
+		}
+		// The offset 0, left by modules that don't report unknown hashes,
+		// is the signal one, which is never an input.
+		if sigOffset <= 0 {
+			return ErrUnknownInput{Name: signal.name}
+		}
+		if err := wc.checkLayoutSignal(signal.name, sigOffset); err != nil {
+			return err
+		}
+		if err := signal.checkSize(wc.opts.signalSizes); err != nil {
+			return err
+		}
+		wc.timer.inputs(len(signal.values) * int(wc.n64*8))
+		for i, value := range signal.values {
+			var err error
+			if signal.encoded != nil {
+				err = wc.storeEncodedFr(pFr, signal.encoded[i])
+			} else {
+				err = wc.storeFr(pFr, value)
+			}
+			if err != nil {
+				return fmt.Errorf("input %s[%d] = %v: %w", signal.name, i, value, err)
+			}
+			if err := canceled(wc.ctx); err != nil {
+				return err
+			}
+			if rec != nil {
+				if err := rec.add(hMSB, hLSB, sigOffset+int32(i), pFr); err != nil {
+					return err
+				}
+			}
+			if err := wc.fns.setSignal(0, 0, sigOffset+int32(i), pFr); err != nil {
+				e, ok := err.(*RuntimeError)
+				if ok {
+					e.Signal = wc.signalNames[sigOffset+int32(i)]
+				}
+				err = fmt.Errorf("input %s[%d] = %v: %w", signal.name, i, value, err)
+				if ok && sanityCheck && wc.opts.partialWitness {
+					err = newPartialWitnessError(err, wc.loadWitness)
+				}
+				return err
+			}
 		}
 	}
 
+	wc.calculated = true
+	wc.timer.lap(phaseSetInputs)
+	if wc.profile != nil {
+		wc.componentTree = newComponentTree(wc.opts.symbols, wc.profile)
+	}
+	if rec != nil {
+		return rec.writeTo(wc.opts.recorder)
+	}
 	return nil
 }
 
+// checkLayoutStart records and checks the layout of a calculation starting
+// with the free memory position freePos (see WithLayoutRecord and
+// WithLayoutCheck).
+func (wc *WitnessCalculator) checkLayoutStart(freePos int32) error {
+	if m := wc.opts.layoutRecord; m != nil {
+		m.recordStart(freePos, wc.nVars)
+	}
+	if m := wc.opts.layoutCheck; m != nil {
+		return m.checkStart(freePos, wc.nVars)
+	}
+	return nil
+}
+
+// checkLayoutSignal records and checks the offset of the input signal name.
+func (wc *WitnessCalculator) checkLayoutSignal(name string, offset int32) error {
+	if m := wc.opts.layoutRecord; m != nil {
+		m.recordSignal(name, offset)
+	}
+	if m := wc.opts.layoutCheck; m != nil {
+		return m.checkSignal(name, offset)
+	}
+	return nil
+}
+
+// Calculate calculates the witness given the inputs, with the sanity checks
+// of WithDefaultSanityCheck.
+func (wc *WitnessCalculator) Calculate(inputs map[string]interface{}) (*Witness, error) {
+	return wc.CalculateWitness(inputs, wc.opts.sanityCheck)
+}
+
+// CalculateWitnessAsync calculates the witness given the inputs, like
+// Calculate, in a goroutine, and sends the result to the returned channel,
+// which is closed afterwards.  Canceling ctx stops the calculation before the
+// next input value with the error of ctx.  The calculator must not be used
+// until the result is received.
+func (wc *WitnessCalculator) CalculateWitnessAsync(ctx context.Context, inputs map[string]interface{}) (<-chan Result, error) {
+	return calculateAsync(ctx, func(ctx context.Context) { wc.ctx = ctx }, func() (*Witness, error) {
+		return wc.Calculate(inputs)
+	})
+}
+
+// CalculateBin calculates the witness in binary given the inputs, with the
+// sanity checks of WithDefaultSanityCheck.
+func (wc *WitnessCalculator) CalculateBin(inputs map[string]interface{}) ([]byte, error) {
+	return wc.CalculateBinWitness(inputs, wc.opts.sanityCheck)
+}
+
+// CalculateWTNS calculates the witness in the wtns format given the inputs,
+// with the sanity checks of WithDefaultSanityCheck.
+func (wc *WitnessCalculator) CalculateWTNS(inputs map[string]interface{}) ([]byte, error) {
+	return wc.CalculateWTNSBin(inputs, wc.opts.sanityCheck)
+}
+
 // CalculateWitness calculates the witness given the inputs.
-func (wc *WitnessCalculator) CalculateWitness(inputs map[string]interface{}, sanityCheck bool) ([]*big.Int, error) {
+func (wc *WitnessCalculator) CalculateWitness(inputs map[string]interface{}, sanityCheck bool) (*Witness, error) {
+	var w []*big.Int
+	err := wc.retryOnStackOverflow(func() error {
+		var err error
+		w, err = wc.calculateWitness(inputs, func() error {
+			return wc.doCalculateWitness(inputs, sanityCheck)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wc.newWitness(w), nil
+}
+
+// CircuitHash returns the SHA-256 hash of the WitnessCalc WASM module, to
+// check that the witnesses and the zkey of a prover come from the same
+// circuit build.  It is unknown, and the bool false, for the
+// WitnessCalculators created from a runtime with NewWitnessCalculator.
+func (wc *WitnessCalculator) CircuitHash() (CircuitHash, bool) {
+	if wc.circuitHash == nil {
+		return CircuitHash{}, false
+	}
+	return *wc.circuitHash, true
+}
+
+// Field returns the field of the circuit.
+func (wc *WitnessCalculator) Field() *Field {
+	return NewField(wc.prime)
+}
+
+// moduleInfo returns the ModuleInfo of the module of the calculator, without
+// its exports and imports.
+func (wc *WitnessCalculator) moduleInfo() ModuleInfo {
+	return ModuleInfo{
+		Circom: 1,
+		Prime:  new(big.Int).Set(wc.prime),
+		Curve:  wc.curve,
+		NVars:  wc.nVars,
+		N64:    int(wc.n64),
+	}
+}
+
+// ExportDescriptor returns the CircuitDescriptor of the calculator in JSON.
+func (wc *WitnessCalculator) ExportDescriptor() ([]byte, error) {
+	return json.Marshal(&CircuitDescriptor{
+		ModuleInfo:  wc.moduleInfo(),
+		N32:         wc.n32 / 4, // wc.n32 is in bytes
+		ShortMax:    new(big.Int).Set(wc.shortMax),
+		ShortMin:    new(big.Int).Set(wc.shortMin),
+		CircuitHash: wc.circuitHash,
+	})
+}
+
+// newWitness creates the Witness of the values calculated by the module,
+// with its CircuitHash if WithCircuitHashInWTNS is set.
+func (wc *WitnessCalculator) newWitness(values []*big.Int) *Witness {
+	w := NewWitness(values, wc.prime)
+	if wc.opts.wtnsCircuitHash {
+		w.circuitHash = wc.circuitHash
+	}
+	return w
+}
+
+// CalculateWitnessHashed calculates the witness given the inputs identified by
+// their precomputed SignalID, skipping the hashing of the signal names.
+// Callers calculating many witnesses of the same circuit can compute the IDs
+// once with NewSignalID.  The inputs are not linted.
+func (wc *WitnessCalculator) CalculateWitnessHashed(inputs []HashedInput, sanityCheck bool) (*Witness, error) {
+	signals, err := newHashedSignalInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	var w []*big.Int
+	err = wc.retryOnStackOverflow(func() error {
+		var err error
+		w, err = wc.calculateWitness(inputs, func() error {
+			return wc.doCalculateWitnessSignals(signals, sanityCheck)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wc.newWitness(w), nil
+}
+
+// CalculateWitnessStatic calculates the witness given the static inputs,
+// prepared once with NewStaticInputs, and the dynamic inputs, which must not
+// set static signals.
+func (wc *WitnessCalculator) CalculateWitnessStatic(static *StaticInputs, inputs map[string]interface{}, sanityCheck bool) (*Witness, error) {
+	inputs, err := wc.opts.normalizeInputs(inputs, wc.prime)
+	if err != nil {
+		return nil, err
+	}
+	if wc.opts.lintInputs {
+		if err := logLintWarnings(inputs, wc.prime, wc.opts.binaryInputs); err != nil {
+			return nil, err
+		}
+	}
+	signals, err := static.withInputs("circom1 "+wc.prime.String(), wc.encodeFr, inputs)
+	if err != nil {
+		return nil, err
+	}
+	var w []*big.Int
+	err = wc.retryOnStackOverflow(func() error {
+		var err error
+		w, err = wc.calculateWitness(inputs, func() error {
+			return wc.doCalculateWitnessSignals(signals, sanityCheck)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wc.newWitness(w), nil
+}
+
+// calculateWitness is an internal function that runs the calculation
+// setting the inputs and loads the witness.  inputs are only used for crash
+// dumps.
+func (wc *WitnessCalculator) calculateWitness(inputs interface{}, calculate func() error) (_ []*big.Int, err error) {
 	oldMemFreePos := wc.memFreePos()
+	defer wc.setMemFreePos(oldMemFreePos)
+
+	wc.startStats()
+	defer func() { wc.timer.end(err) }()
+	if err := calculate(); err != nil {
+		wc.crashDump(inputs, err)
+		return nil, err
+	}
 
-	if err := wc.doCalculateWitness(inputs, sanityCheck); err != nil {
+	w, err := wc.loadWitness()
+	if err != nil {
 		return nil, err
 	}
+	wc.timer.lap(phaseExtract)
+	wc.reportStats()
+	if wc.opts.checksum != nil {
+		c, err := WitnessChecksum(w, int(wc.n64*8))
+		if err != nil {
+			return nil, err
+		}
+		wc.opts.checksum(c)
+	}
+	return w, nil
+}
+
+// ShortMax returns the smallest positive Field element that is not stored in
+// the short form, ShortLimit.
+func (wc *WitnessCalculator) ShortMax() *big.Int {
+	return new(big.Int).Set(wc.shortMax)
+}
+
+// ShortMin returns the smallest Field element stored in the short form as a
+// negative value, prime - ShortLimit.
+func (wc *WitnessCalculator) ShortMin() *big.Int {
+	return new(big.Int).Set(wc.shortMin)
+}
+
+// IsShort returns whether the Field element v, in [0, prime), is stored in
+// the short form.
+func (wc *WitnessCalculator) IsShort(v *big.Int) bool {
+	if v.Sign() < 0 || v.Cmp(wc.prime) >= 0 {
+		return false
+	}
+	return v.Cmp(wc.shortMax) < 0 || v.Cmp(wc.shortMin) >= 0
+}
+
+// Curve returns the curve of the field of the circuit.
+func (wc *WitnessCalculator) Curve() Curve {
+	return wc.curve
+}
+
+// startStats starts measuring a calculation, with WithStats.
+func (wc *WitnessCalculator) startStats() {
+	wc.timer = newStatsTimer(statsFunc(wc.opts), wc.opts.tracer, wc.ctx)
+	wc.wasmCalls = 0
+}
+
+// reportStats reports the Stats of the finished calculation.
+func (wc *WitnessCalculator) reportStats() {
+	wc.timer.report(wc.wasmCalls, int(uint(wc.nVars)*wc.n64*8), wc.runtime.GetAllocatedMemoryLength())
+}
+
+// ComponentTree returns the ComponentTree of the last successful calculation,
+// or nil if the WitnessCalculator wasn't created WithComponentTree.
+func (wc *WitnessCalculator) ComponentTree() *ComponentTree {
+	return wc.componentTree
+}
+
+// CircuitLogs returns the values logged by the circuit during the last
+// calculation, collected with WithCircuitLogs.
+func (wc *WitnessCalculator) CircuitLogs() []CircuitLog {
+	return wc.logger.logs
+}
+
+// loadWitness loads the calculated witness from the runtime memory.
+func (wc *WitnessCalculator) loadWitness() ([]*big.Int, error) {
+	if wc.opts.extractWorkers > 0 {
+		return wc.loadWitnessParallel()
+	}
+	return wc.loadWitnessValues()
+}
+
+// loadWitnessValues loads the calculated witness reading the values one at
+// a time.
+func (wc *WitnessCalculator) loadWitnessValues() ([]*big.Int, error) {
+	if wc.opts.batchMontgomery {
+		return wc.loadWitnessBatch()
+	}
+	w := make([]*big.Int, wc.nVars)
+	for i := int32(0); i < wc.nVars; i++ {
+		pWitness, err := wc.fns.getPWitness(i)
+		if err != nil {
+			return nil, err
+		}
+		w[i], err = wc.loadFr(pWitness)
+		if err != nil {
+			return nil, fmt.Errorf("witness %d: %w", i, err)
+		}
+		if err := wc.postprocess(int(i), w[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// postprocess calls the WithPostprocess hook, if any, with the witness value
+// v at index i.
+func (wc *WitnessCalculator) postprocess(i int, v *big.Int) error {
+	if wc.opts.postprocess == nil {
+		return nil
+	}
+	if err := wc.opts.postprocess(i, v); err != nil {
+		return fmt.Errorf("witness %d: %w", i, err)
+	}
+	return nil
+}
+
+// SampleWitness returns the values at the indices of the witness of the last
+// calculation, reading only them from the module memory, e.g. to spot check a
+// few signals without loading the whole witness.  It returns ErrNoWitness if
+// the last calculation failed or no calculation has been made, or after
+// CalculateBinWitness, as the module builds the witness buffer over its
+// signals.
+func (wc *WitnessCalculator) SampleWitness(indices []int) ([]*big.Int, error) {
+	if !wc.calculated {
+		return nil, ErrNoWitness
+	}
+	values := make([]*big.Int, len(indices))
+	for j, i := range indices {
+		if i < 0 || i >= int(wc.nVars) {
+			return nil, fmt.Errorf("witness index %d out of range [0, %d)", i, wc.nVars)
+		}
+		pWitness, err := wc.fns.getPWitness(int32(i))
+		if err != nil {
+			return nil, err
+		}
+		if values[j], err = wc.loadFr(pWitness); err != nil {
+			return nil, fmt.Errorf("witness %d: %w", i, err)
+		}
+	}
+	return values, nil
+}
+
+// WitnessIter returns an iterator over the witness of the last calculation,
+// with the WithPostprocess hook applied to its values like CalculateWitness.
+func (wc *WitnessCalculator) WitnessIter() *WitnessIter {
+	return newWitnessIter(int(wc.nVars), wc.calculated, func(i int) (*big.Int, error) {
+		if !wc.calculated {
+			return nil, ErrNoWitness
+		}
+		pWitness, err := wc.fns.getPWitness(int32(i))
+		if err != nil {
+			return nil, err
+		}
+		v, err := wc.loadFr(pWitness)
+		if err != nil {
+			return nil, fmt.Errorf("witness %d: %w", i, err)
+		}
+		return v, nil
+	}, wc.opts.postprocess)
+}
 
+// loadWitnessBatch loads the witness like loadWitness, converting the values
+// in Montgomery form with the montgomeryReducer and allocating them at once.
+func (wc *WitnessCalculator) loadWitnessBatch() ([]*big.Int, error) {
+	if wc.reducer == nil {
+		wc.reducer = newMontgomeryReducer(wc.prime, int(wc.n64))
+	}
 	w := make([]*big.Int, wc.nVars)
+	values := make([]big.Int, wc.nVars)
 	for i := int32(0); i < wc.nVars; i++ {
 		pWitness, err := wc.fns.getPWitness(i)
 		if err != nil {
 			return nil, err
 		}
-		w[i] = wc.loadFr(pWitness)
+		m, err := memRange(wc.runtime.Memory(), int64(pWitness), 8+int64(wc.n32))
+		if err != nil {
+			return nil, fmt.Errorf("witness %d: %w", i, err)
+		}
+		// long form in Montgomery
+		if m[4+3]&0xc0 == 0xc0 {
+			w[i] = wc.reducer.reduce(&values[i], m[8:])
+		} else if w[i], err = wc.loadFr(pWitness); err != nil {
+			return nil, fmt.Errorf("witness %d: %w", i, err)
+		}
+		if err := wc.postprocess(int(i), w[i]); err != nil {
+			return nil, err
+		}
 	}
+	return w, nil
+}
 
-	wc.setMemFreePos(oldMemFreePos)
+// loadWitnessParallel loads the witness like loadWitness, from a copy of the
+// witness buffer of the module converted with WithParallelExtraction.  The
+// buffer holds the values in the order of the signals of the module, mapped
+// to the witness order with witnessOrder, which the first extraction finds
+// reading the values one at a time.
+func (wc *WitnessCalculator) loadWitnessParallel() ([]*big.Int, error) {
+	if wc.witnessOrder == nil {
+		w, err := wc.loadWitnessValues()
+		if err != nil {
+			return nil, err
+		}
+		if wc.witnessOrder, err = wc.findWitnessOrder(w); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+	if len(wc.witnessOrder) != int(wc.nVars) {
+		return wc.loadWitnessValues()
+	}
+	values, err := wc.loadWitnessBuffer()
+	if err != nil {
+		return nil, err
+	}
+	w := make([]*big.Int, len(values))
+	for i, j := range wc.witnessOrder {
+		w[i] = values[j]
+		if err := wc.postprocess(i, w[i]); err != nil {
+			return nil, err
+		}
+	}
 	return w, nil
 }
 
+// loadWitnessBuffer returns the values of the witness buffer of the module,
+// copied out of the runtime memory and converted on up to extractWorkers
+// goroutines.  The module builds the buffer over its signals, so the witness
+// can't be sampled afterwards.
+func (wc *WitnessCalculator) loadWitnessBuffer() ([]*big.Int, error) {
+	pWitnessBuff, err := wc.fns.getWitnessBuffer()
+	if err != nil {
+		return nil, err
+	}
+	wc.calculated = false
+	n8 := int(wc.n64 * 8)
+	witnessLen := int(wc.nVars) * n8
+	m, err := memRange(wc.runtime.Memory(), int64(pWitnessBuff), int64(witnessLen))
+	if err != nil {
+		return nil, fmt.Errorf("witness buffer of %d bytes at %d: %w", witnessLen, pWitnessBuff, err)
+	}
+	// The goroutines don't read the runtime memory, which the module may
+	// grow and move.
+	buf := make([]byte, witnessLen)
+	copy(buf, m)
+	return decodeWitnessBuffer(buf, n8, wc.opts.extractWorkers), nil
+}
+
+// findWitnessOrder returns the index in the witness buffer of every value of
+// the calculated witness w, from the positions of the signals in the module
+// memory, checked against the values of the buffer.  It returns an empty
+// slice if the buffer doesn't hold the values in the order of the signals.
+func (wc *WitnessCalculator) findWitnessOrder(w []*big.Int) ([]int32, error) {
+	order := make([]int32, wc.nVars)
+	seen := make([]bool, wc.nVars)
+	stride := wc.n32 + 8
+	var base int32
+	for i := int32(0); i < wc.nVars; i++ {
+		pWitness, err := wc.fns.getPWitness(i)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			base = pWitness
+		}
+		j := (pWitness - base) / stride
+		if (pWitness-base)%stride != 0 || j < 0 || j >= wc.nVars || seen[j] {
+			log.Warn("Witness signals layout not supported, extracting the values one at a time", "witness", i)
+			return []int32{}, nil
+		}
+		seen[j] = true
+		order[i] = j
+	}
+	values, err := wc.loadWitnessBuffer()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := range order {
+		if values[j].Cmp(w[i]) != 0 {
+			log.Warn("Witness buffer layout not supported, extracting the values one at a time", "witness", i)
+			return []int32{}, nil
+		}
+	}
+	return order, nil
+}
+
 // CalculateWitness calculates the witness in binary given the inputs.
 func (wc *WitnessCalculator) CalculateBinWitness(inputs map[string]interface{}, sanityCheck bool) ([]byte, error) {
+	var buff bytes.Buffer
+	buff.Grow(int(uint(wc.nVars) * wc.n64 * 8))
+	if err := wc.CalculateBinWitnessTo(&buff, inputs, sanityCheck); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// CalculateBinWitnessTo calculates the witness in binary given the inputs and
+// writes it to w straight from the runtime memory, so that big witnesses can
+// be streamed without holding a copy in Go memory.
+func (wc *WitnessCalculator) CalculateBinWitnessTo(w io.Writer, inputs map[string]interface{}, sanityCheck bool) error {
+	_, err := wc.calculateBinWitnessTo(w, inputs, sanityCheck, wc.opts.checksum != nil)
+	return err
+}
+
+// CalculateBinWitnessChecksum calculates the witness in binary given the
+// inputs, like CalculateBinWitness, and returns it with its Checksum,
+// computed while copying it out of the runtime memory.
+func (wc *WitnessCalculator) CalculateBinWitnessChecksum(inputs map[string]interface{}, sanityCheck bool) ([]byte, Checksum, error) {
+	var buff bytes.Buffer
+	buff.Grow(int(uint(wc.nVars) * wc.n64 * 8))
+	c, err := wc.calculateBinWitnessTo(&buff, inputs, sanityCheck, true)
+	if err != nil {
+		return nil, Checksum{}, err
+	}
+	return buff.Bytes(), c, nil
+}
+
+// calculateBinWitnessTo is CalculateBinWitnessTo, returning the Checksum of
+// the witness if checksum is set.
+func (wc *WitnessCalculator) calculateBinWitnessTo(w io.Writer, inputs map[string]interface{}, sanityCheck bool, checksum bool) (c Checksum, err error) {
 	oldMemFreePos := wc.memFreePos()
+	defer func() { wc.setMemFreePos(oldMemFreePos) }()
+	// ends the span of the last attempt
+	defer func() { wc.timer.end(err) }()
 
-	if err := wc.doCalculateWitness(inputs, sanityCheck); err != nil {
-		return nil, err
+	err = wc.retryOnStackOverflow(func() error {
+		oldMemFreePos = wc.memFreePos()
+		wc.startStats()
+		err := wc.doCalculateWitness(inputs, sanityCheck)
+		if err != nil {
+			wc.crashDump(inputs, err)
+			wc.timer.end(err)
+		}
+		return err
+	})
+	if err != nil {
+		return c, err
 	}
 	pWitnessBuff, err := wc.fns.getWitnessBuffer()
 	if err != nil {
-		return nil, err
+		return c, err
 	}
-	witnessBuff := make([]byte, uint(wc.nVars)*wc.n64*8)
-	copy(witnessBuff, wc.runtime.Memory()[pWitnessBuff:int(pWitnessBuff)+len(witnessBuff)])
+	// the buffer is built over the signals
+	wc.calculated = false
+	// the whole buffer must be in the memory: a witness is never truncated
+	witnessLen := int(uint(wc.nVars) * wc.n64 * 8)
+	binWitness, err := memRange(wc.runtime.Memory(), int64(pWitnessBuff), int64(witnessLen))
+	if err != nil {
+		return c, fmt.Errorf("witness buffer of %d bytes at %d: %w", witnessLen, pWitnessBuff, err)
+	}
+	var h hash.Hash
+	if checksum {
+		h = sha256.New()
+		w = io.MultiWriter(w, h)
+	}
+	if _, err := w.Write(binWitness); err != nil {
+		return c, err
+	}
+	if h != nil {
+		copy(c[:], h.Sum(nil))
+		if wc.opts.checksum != nil {
+			wc.opts.checksum(c)
+		}
+	}
+	wc.timer.lap(phaseExtract)
+	wc.reportStats()
+	return c, nil
+}
 
-	wc.setMemFreePos(oldMemFreePos)
-	return witnessBuff, nil
+// CalculateBinWitnessFile calculates the witness in binary given the inputs
+// and writes it to the file at path, straight from the runtime memory through
+// a write buffer, for witnesses too big to hold in Go memory.  The file is
+// removed on errors.
+func (wc *WitnessCalculator) CalculateBinWitnessFile(path string, inputs map[string]interface{}, sanityCheck bool) error {
+	return writeFile(path, func(w io.Writer) error {
+		return wc.CalculateBinWitnessTo(w, inputs, sanityCheck)
+	})
+}
+
+// CalculateWTNSBin calculates the witness given the inputs in the snarkjs wtns
+// version 2 format, with field elements of n64*8 bytes.  Unlike the buffer of
+// CalculateBinWitness, the wtns witness is in witness order.
+func (wc *WitnessCalculator) CalculateWTNSBin(inputs map[string]interface{}, sanityCheck bool) ([]byte, error) {
+	w, err := wc.CalculateWitness(inputs, sanityCheck)
+	if err != nil {
+		return nil, err
+	}
+	return w.ToWTNS()
 }
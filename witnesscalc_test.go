@@ -1,8 +1,14 @@
+//go:build cgo && !js
+// +build cgo,!js
+
 package witnesscalc
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -11,13 +17,17 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	wasm3 "github.com/iden3/go-wasm3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/iden3/go-circom-witnesscalc/v2/lowlevel"
 )
 
 type TestParams struct {
@@ -125,9 +135,9 @@ func TestWitnessCalcNConstraints(t *testing.T) {
 		require.Nil(t, err)
 		module, err := runtime.ParseModule(wasmBytes)
 		require.Nil(t, err)
-		module, err = runtime.LoadModule(module)
+		_, err = runtime.LoadModule(module)
 		require.Nil(t, err)
-		witnessCalculator, err := NewWitnessCalculator(runtime, module)
+		witnessCalculator, err := NewWitnessCalculator(runtime)
 		require.Nil(t, err)
 		p := witnessCalculator.prime
 		start = time.Now()
@@ -145,7 +155,7 @@ func TestWitnessCalcNConstraints(t *testing.T) {
 			out.Mod(out, p)
 		}
 
-		assert.Equal(t, out, w[1])
+		assert.Equal(t, out, w.At(1))
 
 		err = os.Remove("nconstraints.circom.tmp")
 		require.Nil(t, err)
@@ -175,7 +185,7 @@ func testWitnessCalc(t *testing.T, p TestParams, logWitness bool) {
 
 	module, err := runtime.ParseModule(wasmBytes)
 	require.Nil(t, err)
-	module, err = runtime.LoadModule(module)
+	_, err = runtime.LoadModule(module)
 	require.Nil(t, err)
 	log.Print("Loaded module")
 
@@ -191,7 +201,7 @@ func testWitnessCalc(t *testing.T, p TestParams, logWitness bool) {
 	require.Nil(t, err)
 	log.Print("Inputs: ", inputs)
 
-	witnessCalculator, err := NewWitnessCalculator(runtime, module)
+	witnessCalculator, err := NewWitnessCalculator(runtime)
 	require.Nil(t, err)
 	log.Print("n32: ", witnessCalculator.n32)
 	log.Print("prime: ", witnessCalculator.prime)
@@ -214,7 +224,7 @@ func testWitnessCalc(t *testing.T, p TestParams, logWitness bool) {
 	if logWitness {
 		log.Print("Witness: ", w)
 	}
-	wJSON, err := json.Marshal(WitnessJSON(w))
+	wJSON, err := w.ToJSON()
 	require.Nil(t, err)
 	if logWitness {
 		log.Print("Witness JSON: ", string(wJSON))
@@ -240,3 +250,1243 @@ func testWitnessCalc(t *testing.T, p TestParams, logWitness bool) {
 		log.Print("WitnessBin: ", hex.EncodeToString(wb))
 	}
 }
+
+func newTestWitnessCalculator(t *testing.T, wasmFilename string) (*WitnessCalculator, func()) {
+	runtime := wasm3.NewRuntime(&wasm3.Config{
+		Environment: wasm3.NewEnvironment(),
+		StackSize:   64 * 1024,
+	})
+	wasmBytes, err := ioutil.ReadFile(wasmFilename)
+	require.Nil(t, err)
+	module, err := runtime.ParseModule(wasmBytes)
+	require.Nil(t, err)
+	_, err = runtime.LoadModule(module)
+	require.Nil(t, err)
+	witnessCalculator, err := NewWitnessCalculator(runtime)
+	require.Nil(t, err)
+	return witnessCalculator, runtime.Destroy
+}
+
+func TestWitnessCalcInvalidInput(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	tooBig := new(big.Int).Add(witnessCalculator.prime, witnessCalculator.shortMax)
+	inputs := map[string]interface{}{
+		"a": new(big.Int).SetInt64(3),
+		"b": tooBig,
+	}
+	_, err := witnessCalculator.CalculateWitness(inputs, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "input b[0] = "+tooBig.String())
+
+	tooSmall := new(big.Int).SetInt64(-0x80000001)
+	inputs["b"] = tooSmall
+	_, err = witnessCalculator.CalculateBinWitness(inputs, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "input b[0] = -2147483649")
+
+	// The calculator is still usable after a failed calculation
+	inputs["b"] = new(big.Int).SetInt64(11)
+	w, err := witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+	assert.Equal(t, "33", w.At(1).String())
+}
+
+// fakeRuntime is a Runtime whose exports return fixed results, simulating a
+// malformed WitnessCalc module.
+type fakeRuntime struct {
+	mem     []byte
+	results map[string]interface{}
+}
+
+func (r *fakeRuntime) AttachFunction(string, string, string, wasm3.CallbackFunction) {}
+
+func (r *fakeRuntime) FindFunction(name string) (wasm3.FunctionWrapper, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		return r.results[name], nil
+	}, nil
+}
+
+func (r *fakeRuntime) Memory() []byte { return r.mem }
+
+func (r *fakeRuntime) GetAllocatedMemoryLength() int { return len(r.mem) }
+
+func newFakeRuntime() *fakeRuntime {
+	r := &fakeRuntime{
+		mem: make([]byte, 1024),
+		results: map[string]interface{}{
+			"getFrLen":         int32(40),
+			"getPRawPrime":     int32(16),
+			"getNVars":         int32(2),
+			"getPWitness":      int32(64),
+			"getWitnessBuffer": int32(64),
+		},
+	}
+	r.mem[0] = 128 // free memory position
+	copy(r.mem[16:], swap(bn254.Bytes()))
+	return r
+}
+
+func TestWitnessCalcMalformedModule(t *testing.T) {
+	_, err := NewWitnessCalculator(newFakeRuntime())
+	require.Nil(t, err)
+
+	for name, tc := range map[string]struct {
+		export string
+		result interface{}
+		errMsg string
+	}{
+		"result type":      {"getFrLen", int64(40), "getFrLen returned int64, expected i32"},
+		"field size":       {"getFrLen", int32(8 + 4096), "invalid field element size 4096"},
+		"prime pointer":    {"getPRawPrime", int32(1000), "prime: memory access [1000, 1032) out of bounds"},
+		"number of vars":   {"getNVars", int32(-1), "invalid number of witness variables -1"},
+		"missing function": {"getNVars", nil, "getNVars returned <nil>, expected i32"},
+	} {
+		r := newFakeRuntime()
+		r.results[tc.export] = tc.result
+		_, err := NewWitnessCalculator(r)
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), tc.errMsg, name)
+	}
+
+	r := newFakeRuntime()
+	r.results["getPWitness"] = int32(1020)
+	r.results["getWitnessBuffer"] = int32(1000)
+	witnessCalculator, err := NewWitnessCalculator(r)
+	require.Nil(t, err)
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{}, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "witness 0: memory access [1020, 1028) out of bounds")
+	_, err = witnessCalculator.CalculateBinWitness(map[string]interface{}{}, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "witness buffer of 64 bytes at 1000: memory access [1000, 1064) out of bounds")
+	_, _, err = witnessCalculator.CalculateBinWitnessChecksum(map[string]interface{}{}, false)
+	require.Error(t, err)
+	r.results["getWitnessBuffer"] = int32(-8)
+	_, err = witnessCalculator.CalculateBinWitness(map[string]interface{}{}, false)
+	assert.Contains(t, err.Error(), "witness buffer of 64 bytes at -8: memory access [-8, 56) out of bounds")
+}
+
+func TestWitnessCalcBinWitnessChecksum(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+
+	expected, err := witnessCalculator.CalculateBinWitness(inputs, true)
+	require.Nil(t, err)
+	bin, c, err := witnessCalculator.CalculateBinWitnessChecksum(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, expected, bin)
+	assert.Equal(t, BinWitnessChecksum(expected), c)
+}
+
+func TestGetStr(t *testing.T) {
+	mem := []byte("error\x00msg")
+	s, err := getStr(mem, 0)
+	require.Nil(t, err)
+	assert.Equal(t, "error", s)
+	_, err = getStr(mem, 6)
+	assert.EqualError(t, err, "string at 6 is not terminated")
+	_, err = getStr(mem, 100)
+	assert.EqualError(t, err, "string at 100 out of bounds (9 bytes)")
+
+	s, err = getStr([]byte("a\xffb\x00"), 0)
+	require.Nil(t, err)
+	assert.Equal(t, "a\uFFFDb", s)
+
+	long := bytes.Repeat([]byte{'x'}, 2*maxStrLen)
+	s, err = getStr(long, 0)
+	require.Nil(t, err)
+	assert.Equal(t, strings.Repeat("x", maxStrLen)+"...", s)
+}
+
+func TestWitnessCalcBinWitnessTo(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	inputs := map[string]interface{}{
+		"a": new(big.Int).SetInt64(3),
+		"b": new(big.Int).SetInt64(11),
+	}
+	wb, err := witnessCalculator.CalculateBinWitness(inputs, false)
+	require.Nil(t, err)
+	assert.Equal(t, int(witnessCalculator.nVars)*int(witnessCalculator.n64)*8, len(wb))
+
+	var buff bytes.Buffer
+	err = witnessCalculator.CalculateBinWitnessTo(&buff, inputs, false)
+	require.Nil(t, err)
+	assert.Equal(t, wb, buff.Bytes())
+}
+
+func TestWitnessCalcBinWitnessFile(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+	dir, err := ioutil.TempDir("", "witnesscalc")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	inputs := map[string]interface{}{
+		"a": new(big.Int).SetInt64(3),
+		"b": new(big.Int).SetInt64(11),
+	}
+	wb, err := witnessCalculator.CalculateBinWitness(inputs, false)
+	require.Nil(t, err)
+	path := filepath.Join(dir, "witness.bin")
+	require.Nil(t, witnessCalculator.CalculateBinWitnessFile(path, inputs, false))
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, wb, b)
+
+	// The file is removed on errors.
+	path = filepath.Join(dir, "failed.bin")
+	err = witnessCalculator.CalculateBinWitnessFile(path, map[string]interface{}{"x": big.NewInt(1)}, true)
+	require.Error(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestParseWitnessJSON(t *testing.T) {
+	witnessJSON, err := ioutil.ReadFile("test_files/smtverifier10-witness.json")
+	require.Nil(t, err)
+	w, err := ParseWitnessJSON(witnessJSON)
+	require.Nil(t, err)
+	require.Len(t, w, 4794)
+	assert.Equal(t, big.NewInt(1), w[0])
+
+	wJSON, err := MarshalWitnessJSON(w)
+	require.Nil(t, err)
+	w2, err := ParseWitnessJSON(wJSON)
+	require.Nil(t, err)
+	assert.Equal(t, w, w2)
+
+	_, err = ParseWitnessJSON([]byte(`["1","0x2"]`))
+	require.Error(t, err)
+	_, err = ParseWitnessJSON([]byte(`[1]`))
+	require.Error(t, err)
+}
+
+func TestWitnessCalcHashed(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	inputs := []HashedInput{
+		{ID: NewSignalID("a"), Values: []*big.Int{big.NewInt(3)}},
+		{ID: NewSignalID("b"), Values: []*big.Int{big.NewInt(11)}},
+	}
+	w, err := witnessCalculator.CalculateWitnessHashed(inputs, true)
+	require.Nil(t, err)
+	wJSON, err := w.ToJSON()
+	require.Nil(t, err)
+	assert.Equal(t, `["1","33","3","11"]`, string(wJSON))
+
+	inputs[1].Values = []*big.Int{nil}
+	_, err = witnessCalculator.CalculateWitnessHashed(inputs, true)
+	require.Error(t, err)
+}
+
+func TestWitnessCalcStatic(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	static, err := NewStaticInputs(map[string]interface{}{"a": big.NewInt(3)})
+	require.Nil(t, err)
+	for _, tt := range []struct {
+		b        *big.Int
+		expected string
+	}{
+		{big.NewInt(11), `["1","33","3","11"]`},
+		{big.NewInt(5), `["1","15","3","5"]`},
+		// long form
+		{new(big.Int).Lsh(big.NewInt(1), 40), `["1","3298534883328","3","1099511627776"]`},
+	} {
+		freePos := witnessCalculator.memFreePos()
+		w, err := witnessCalculator.CalculateWitnessStatic(static, map[string]interface{}{"b": tt.b}, true)
+		require.Nil(t, err)
+		wJSON, err := w.ToJSON()
+		require.Nil(t, err)
+		assert.Equal(t, tt.expected, string(wJSON))
+		assert.Equal(t, freePos, witnessCalculator.memFreePos())
+	}
+
+	_, err = witnessCalculator.CalculateWitnessStatic(static, map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.EqualError(t, err, "input a is static")
+
+	// long form and negative static values
+	static, err = NewStaticInputs(map[string]interface{}{"b": new(big.Int).Lsh(big.NewInt(1), 40)})
+	require.Nil(t, err)
+	w, err := witnessCalculator.CalculateWitnessStatic(static, map[string]interface{}{"a": big.NewInt(3)}, true)
+	require.Nil(t, err)
+	assert.Equal(t, "3298534883328", w.At(1).String())
+	static, err = NewStaticInputs(map[string]interface{}{"b": new(big.Int).Sub(bn254, big.NewInt(1))})
+	require.Nil(t, err)
+	w, err = witnessCalculator.CalculateWitnessStatic(static, map[string]interface{}{"a": big.NewInt(3)}, true)
+	require.Nil(t, err)
+	assert.Equal(t, new(big.Int).Sub(bn254, big.NewInt(3)), w.At(1))
+}
+
+func TestWitnessCalcChecksum(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	var checksums []Checksum
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithChecksum(func(c Checksum) {
+		checksums = append(checksums, c)
+	}))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	w, err := witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	binWitness, err := witnessCalculator.CalculateBinWitness(inputs, true)
+	require.Nil(t, err)
+
+	expected, err := WitnessChecksum(w.Values(), 32)
+	require.Nil(t, err)
+	assert.Equal(t, []Checksum{expected, BinWitnessChecksum(binWitness)}, checksums)
+}
+
+func TestWitnessCalcRuntimeError(t *testing.T) {
+	f, err := os.Open("test_files/mycircuit.sym")
+	require.Nil(t, err)
+	defer f.Close()
+	syms, err := ParseSym(f)
+	require.Nil(t, err)
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithSymbols(syms))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{"z": big.NewInt(3)}, true)
+	var runtimeErr *RuntimeError
+	require.ErrorAs(t, err, &runtimeErr)
+	assert.Equal(t, ErrCodeHashNotFound, runtimeErr.Code)
+	assert.Contains(t, err.Error(), "input z: WASM error 3: Hash not found")
+	var unknownErr ErrUnknownInput
+	require.ErrorAs(t, err, &unknownErr)
+	assert.Equal(t, "z", unknownErr.Name)
+
+	inputs := map[string]interface{}{"a": []*big.Int{big.NewInt(3), big.NewInt(11), big.NewInt(1)}}
+	_, err = witnessCalculator.CalculateWitness(inputs, true)
+	assert.True(t, errors.Is(err, ErrTooManyValues))
+	assert.EqualError(t, err, "too many values for input signal a")
+
+	// Without the symbol of a, its size is unknown and the values overflow
+	// into the next signals.
+	overflowCalculator, err := LoadWitnessCalculator(wasmBytes, WithSymbols(syms[1:]))
+	require.Nil(t, err)
+	defer overflowCalculator.Close()
+	_, err = overflowCalculator.CalculateWitness(inputs, true)
+	require.ErrorAs(t, err, &runtimeErr)
+	assert.Equal(t, ErrCodeSignalAssignedTwice, runtimeErr.Code)
+	assert.Equal(t, "main.c", runtimeErr.Signal)
+
+	// The calculator is still usable after an error.
+	w, err := witnessCalculator.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	assert.Equal(t, big.NewInt(33), w.At(1))
+}
+
+func TestWitnessCalcDecodeRuntimeError(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	mem := witnessCalculator.runtime.Memory()
+	pStr := witnessCalculator.allocFr()
+	copy(mem[pStr:], "Assert doesn't match\x00")
+	pA := witnessCalculator.allocFr()
+	require.Nil(t, witnessCalculator.storeFr(pA, big.NewInt(3)))
+	pB := witnessCalculator.allocFr()
+	require.Nil(t, witnessCalculator.storeFr(pB, big.NewInt(4)))
+
+	e := witnessCalculator.decodeRuntimeError(mem, ErrCodeConstraintDoesNotMatch, uint64(pStr), 1, uint64(pA), uint64(pB), 0)
+	assert.Equal(t, "Assert doesn't match 3 != 4", e.Msg)
+	assert.Equal(t, [4]int32{1, pA, pB, 0}, e.Args)
+
+	// the other codes keep their arguments, like witness_calculator.js
+	e = witnessCalculator.decodeRuntimeError(mem, 9, uint64(pStr), 1, 2, 3, 0xFFFFFFFF)
+	assert.Equal(t, "Assert doesn't match 1 2 3 -1", e.Msg)
+	assert.Equal(t, [4]int32{1, 2, 3, -1}, e.Args)
+	e = witnessCalculator.decodeRuntimeError(mem, ErrCodeHashNotFound, 0, 0x1234, 0x5678, 0, 0)
+	assert.Equal(t, "WASM error 3: Hash not found 4660 22136 0 0 (the signal is not an input of the circuit)", e.Error())
+	e = witnessCalculator.decodeRuntimeError(mem, ErrCodeHashNotFound, 0, 0, 0, 0, 0)
+	assert.Equal(t, "WASM error 3: Hash not found (the signal is not an input of the circuit)", e.Error())
+}
+
+func TestWitnessCalcPartialWitness(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithPartialWitness())
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	// main.c is calculated once a and b are set, so the third value fails.
+	inputs := map[string]interface{}{"a": []*big.Int{big.NewInt(3), big.NewInt(11), big.NewInt(1)}}
+	_, err = witnessCalculator.CalculateWitness(inputs, true)
+	var partialErr *PartialWitnessError
+	require.ErrorAs(t, err, &partialErr)
+	var runtimeErr *RuntimeError
+	require.ErrorAs(t, err, &runtimeErr)
+	assert.Equal(t, ErrCodeSignalAssignedTwice, runtimeErr.Code)
+	assert.Equal(t, []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)},
+		partialErr.Witness)
+
+	// Only the calculations with sanityCheck return the partial witness.
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{"z": big.NewInt(3)}, false)
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &partialErr))
+}
+
+func TestWitnessCalcReloadModule(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes)
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	// Another circuit on the same field.
+	smtBytes, err := ioutil.ReadFile("test_files/smtverifier10.wasm")
+	require.Nil(t, err)
+	require.Nil(t, witnessCalculator.ReloadModule(smtBytes))
+	assert.NotEqual(t, int32(4), witnessCalculator.nVars)
+	require.Nil(t, witnessCalculator.ReloadModule(wasmBytes))
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	w, err := witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, big.NewInt(33), w.At(1))
+
+	// The calculator keeps the previous module on errors.
+	require.Error(t, witnessCalculator.ReloadModule([]byte("invalid")))
+	w, err = witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, big.NewInt(33), w.At(1))
+
+	// The runtime of calculators created with NewWitnessCalculator is owned
+	// by the caller.
+	calc, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+	require.Error(t, calc.ReloadModule(wasmBytes))
+}
+
+func TestWitnessCalcWTNSBin(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+	inputsBytes, err := ioutil.ReadFile("test_files/mycircuit-input1.json")
+	require.Nil(t, err)
+	inputs, err := ParseInputs(inputsBytes)
+	require.Nil(t, err)
+
+	wtnsBytes, err := witnessCalculator.CalculateWTNSBin(inputs, false)
+	require.Nil(t, err)
+	expected, err := ioutil.ReadFile("test_files/mycircuit-witness.wtns")
+	require.Nil(t, err)
+	assert.Equal(t, expected, wtnsBytes)
+}
+
+func TestWitnessCalcCurve(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithCurve(CurveBN254))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	assert.Equal(t, CurveBN254, witnessCalculator.Curve())
+
+	_, err = LoadWitnessCalculator(wasmBytes, WithCurve(CurveBLS12381))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not the bls12381 prime")
+}
+
+func TestWitnessCalcCircuitLogs(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes,
+		WithCircuitName("mycircuit"), WithCircuitLogs())
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	// The module calls runtime.log with a pointer to the logged value.
+	p := witnessCalculator.allocFr()
+	require.Nil(t, witnessCalculator.storeFr(p, big.NewInt(-1)))
+	witnessCalculator.logFr(p)
+	witnessCalculator.logFr(-1)
+	require.Nil(t, witnessCalculator.storeFr(p, big.NewInt(42)))
+	witnessCalculator.logFr(p)
+	assert.Equal(t, []CircuitLog{
+		{Circuit: "mycircuit", Seq: 0, Value: new(big.Int).Sub(witnessCalculator.prime, big.NewInt(1))},
+		{Circuit: "mycircuit", Seq: 2, Value: big.NewInt(42)},
+	}, witnessCalculator.CircuitLogs())
+
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	_, err = witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Empty(t, witnessCalculator.CircuitLogs())
+}
+
+func TestWitnessCalcDefaultSanityCheck(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	expected, err := CalculateWitnessBinWASM(wasmBytes, inputs)
+	require.Nil(t, err)
+
+	// The module only reports the components with the sanity check.
+	for _, sanityCheck := range []bool{false, true} {
+		witnessCalculator, err := LoadWitnessCalculator(wasmBytes,
+			WithComponentTree(), WithDefaultSanityCheck(sanityCheck))
+		require.Nil(t, err)
+		w, err := witnessCalculator.Calculate(inputs)
+		require.Nil(t, err)
+		assert.Equal(t, "33", w.At(1).String())
+		assert.Equal(t, sanityCheck, len(witnessCalculator.ComponentTree().Order) > 0)
+
+		wtns, err := witnessCalculator.CalculateWTNS(inputs)
+		require.Nil(t, err)
+		_, wtnsWitness, err := ParseWTNS(bytes.NewReader(wtns))
+		require.Nil(t, err)
+		assert.Equal(t, expected.Values(), wtnsWitness)
+		_, err = witnessCalculator.CalculateBin(inputs)
+		require.Nil(t, err)
+		assert.Equal(t, sanityCheck, len(witnessCalculator.ComponentTree().Order) > 0)
+		witnessCalculator.Close()
+	}
+}
+
+func TestWitnessCalcIsShort(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	prime := witnessCalculator.prime
+	assert.Equal(t, big.NewInt(0x80000000), witnessCalculator.ShortMax())
+	assert.Equal(t, new(big.Int).Sub(prime, big.NewInt(0x80000000)), witnessCalculator.ShortMin())
+
+	tests := []struct {
+		v     *big.Int
+		short bool
+	}{
+		{big.NewInt(0), true},
+		{big.NewInt(0x7fffffff), true},
+		{big.NewInt(0x80000000), false},
+		{new(big.Int).Sub(prime, big.NewInt(0x80000001)), false},
+		{new(big.Int).Sub(prime, big.NewInt(0x80000000)), true},
+		{new(big.Int).Sub(prime, big.NewInt(1)), true},
+		{prime, false},
+		{big.NewInt(-1), false},
+	}
+	p := witnessCalculator.allocFr()
+	for _, tt := range tests {
+		assert.Equal(t, tt.short, witnessCalculator.IsShort(tt.v), tt.v.String())
+		if tt.v.Sign() < 0 || tt.v.Cmp(prime) >= 0 {
+			continue
+		}
+		// the value round-trips through the runtime memory in either form
+		require.Nil(t, witnessCalculator.storeFr(p, tt.v))
+		m := witnessCalculator.runtime.Memory()
+		assert.Equal(t, !tt.short, m[p+7]&0x80 != 0, tt.v.String())
+		v, err := witnessCalculator.loadFr(p)
+		require.Nil(t, err)
+		assert.Equal(t, tt.v.String(), v.String())
+	}
+}
+
+func TestWitnessCalcStats(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	var stats []Stats
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithStats(func(s Stats) {
+		stats = append(stats, s)
+	}))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	_, err = witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+	_, err = witnessCalculator.CalculateBinWitness(inputs, false)
+	require.Nil(t, err)
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{"z": big.NewInt(3)}, false)
+	require.Error(t, err)
+
+	require.Len(t, stats, 2)
+	// init, 2 × (getSignalOffset32, setSignal), 4 × getPWitness
+	assert.Equal(t, 9, stats[0].WASMCalls)
+	// init, 2 × (getSignalOffset32, setSignal), getWitnessBuffer
+	assert.Equal(t, 6, stats[1].WASMCalls)
+	for _, s := range stats {
+		assert.True(t, s.Total >= s.Init+s.SetInputs+s.Extract)
+		// a and b
+		assert.Equal(t, 2*32, s.InputsBytes)
+		assert.Equal(t, 4*32, s.WitnessBytes)
+		assert.Greater(t, s.MemPeak, 0)
+	}
+}
+
+func TestWitnessCalcStatsSink(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	var buf bytes.Buffer
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes,
+		WithCircuitName("mycircuit"), WithStatsSink(NewJSONLStatsSink(&buf)))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	_, err = witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+	_, err = witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"circuit":"mycircuit"`)
+	assert.Contains(t, lines[0], `"witness_bytes":128`)
+}
+
+func TestWitnessCalcTracer(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	var tracer testTracer
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithTracer(&tracer))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	assert.Equal(t, []string{SpanLoad}, tracer.names())
+
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	for _, calculate := range []func() error{
+		func() error {
+			_, err := witnessCalculator.CalculateWitness(inputs, false)
+			return err
+		},
+		func() error {
+			_, err := witnessCalculator.CalculateBinWitness(inputs, false)
+			return err
+		},
+	} {
+		tracer = testTracer{}
+		require.Nil(t, calculate())
+		assert.Equal(t, []string{
+			SpanCalculate + "/" + SpanInit,
+			SpanCalculate + "/" + SpanSetInputs,
+			SpanCalculate + "/" + SpanExtract,
+			SpanCalculate,
+		}, tracer.names())
+	}
+
+	tracer = testTracer{}
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{"z": big.NewInt(3)}, false)
+	require.Error(t, err)
+	require.Len(t, tracer.spans, 2)
+	assert.Equal(t, SpanCalculate, tracer.names()[1])
+	assert.Error(t, tracer.spans[1].err)
+}
+
+func TestWitnessCalcComponentTree(t *testing.T) {
+	f, err := os.Open("test_files/mycircuit.sym")
+	require.Nil(t, err)
+	defer f.Close()
+	syms, err := ParseSym(f)
+	require.Nil(t, err)
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithSymbols(syms), WithComponentTree())
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	assert.Nil(t, witnessCalculator.ComponentTree())
+
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	_, err = witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	tree := witnessCalculator.ComponentTree()
+	require.NotNil(t, tree)
+	require.Len(t, tree.Roots, 1)
+	main := tree.Roots[0]
+	assert.Equal(t, "main", main.Name)
+	assert.Equal(t, 1, main.FirstSignal)
+	assert.Equal(t, 3, main.LastSignal)
+	assert.Equal(t, 0, main.Order)
+	assert.Equal(t, []*ComponentNode{main}, tree.Order)
+
+	// The module only reports the components with the sanity check.
+	_, err = witnessCalculator.CalculateWitness(inputs, false)
+	require.Nil(t, err)
+	assert.Empty(t, witnessCalculator.ComponentTree().Order)
+}
+
+func TestWitnessCalcCrashDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crashdump")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithCrashDump(dir))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	_, err = witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	dumps, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, dumps, 0)
+
+	inputs["z"] = big.NewInt(1)
+	_, err = witnessCalculator.CalculateWitness(inputs, true)
+	require.Error(t, err)
+	dumps, err = ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, dumps, 1)
+
+	dumpDir := path.Join(dir, dumps[0].Name())
+	inputsJSON, err := ioutil.ReadFile(path.Join(dumpDir, "inputs.json"))
+	require.Nil(t, err)
+	assert.Equal(t, `{"a":"3","b":"11","z":"1"}`, string(inputsJSON))
+	info, err := ioutil.ReadFile(path.Join(dumpDir, "info.json"))
+	require.Nil(t, err)
+	assert.Contains(t, string(info), "Hash not found")
+	mem, err := ioutil.ReadFile(path.Join(dumpDir, "memory.bin"))
+	require.Nil(t, err)
+	assert.Equal(t, witnessCalculator.runtime.GetAllocatedMemoryLength(), len(mem))
+}
+
+func TestWitnessCalcSignalValues(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	for _, tt := range []struct {
+		a, b     interface{}
+		expected string
+	}{
+		{Uint64(3), HexString("0xb"), `["1","33","3","11"]`},
+		{BytesLE{3}, BitArray{true, true, false, true}, `["1","33","3","11"]`},
+		{BigInt{big.NewInt(3)}, []SignalValue{Uint64(11)}, `["1","33","3","11"]`},
+		// long form
+		{Uint64(3), Uint64(1 << 40), `["1","3298534883328","3","1099511627776"]`},
+		{Uint64(3), BytesLE{0, 0, 0, 0, 0, 1}, `["1","3298534883328","3","1099511627776"]`},
+		// values out of the fast paths
+		{HexString("30644e72e131a029b85045b68181585d2833e84879b9709143e1f593f0000000"), Uint64(1),
+			`["1","21888242871839275222246405745257275088548364400416034343698204186575808495616","21888242871839275222246405745257275088548364400416034343698204186575808495616","1"]`},
+	} {
+		w, err := witnessCalculator.CalculateWitness(map[string]interface{}{"a": tt.a, "b": tt.b}, true)
+		require.Nil(t, err)
+		wJSON, err := w.ToJSON()
+		require.Nil(t, err)
+		assert.Equal(t, tt.expected, string(wJSON))
+	}
+
+	_, err := witnessCalculator.CalculateWitness(map[string]interface{}{"a": HexString("0xg"), "b": Uint64(1)}, true)
+	assert.EqualError(t, err, `input a: invalid hexadecimal value "0xg"`)
+}
+
+// countdownCtx is a context canceled after n calls to Err.
+type countdownCtx struct {
+	context.Context
+	n int
+}
+
+func (ctx *countdownCtx) Err() error {
+	if ctx.n--; ctx.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestWitnessCalcAsync(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+
+	res, err := witnessCalculator.CalculateWitnessAsync(context.Background(), inputs)
+	require.Nil(t, err)
+	r := <-res
+	require.Nil(t, r.Err)
+	wJSON, err := r.Witness.ToJSON()
+	require.Nil(t, err)
+	assert.Equal(t, `["1","33","3","11"]`, string(wJSON))
+	_, ok := <-res
+	assert.False(t, ok)
+
+	// canceled after the first input value
+	res, err = witnessCalculator.CalculateWitnessAsync(&countdownCtx{context.Background(), 2}, inputs)
+	require.Nil(t, err)
+	r = <-res
+	assert.Nil(t, r.Witness)
+	assert.True(t, errors.Is(r.Err, context.Canceled))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = witnessCalculator.CalculateWitnessAsync(ctx, inputs)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	w, err := witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	wJSON, err = w.ToJSON()
+	require.Nil(t, err)
+	assert.Equal(t, `["1","33","3","11"]`, string(wJSON))
+}
+
+func TestWitnessCalcSampleWitness(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	_, err := witnessCalculator.SampleWitness([]int{1})
+	assert.Equal(t, ErrNoWitness, err)
+
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	values, err := witnessCalculator.SampleWitness([]int{3, 1})
+	require.Nil(t, err)
+	assert.Equal(t, "11", values[0].String())
+	assert.Equal(t, "33", values[1].String())
+
+	_, err = witnessCalculator.SampleWitness([]int{4})
+	assert.EqualError(t, err, "witness index 4 out of range [0, 4)")
+
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{"x": big.NewInt(3)}, true)
+	require.Error(t, err)
+	_, err = witnessCalculator.SampleWitness([]int{1})
+	assert.Equal(t, ErrNoWitness, err)
+
+	// the binary witness is built over the signals
+	_, err = witnessCalculator.CalculateBinWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	_, err = witnessCalculator.SampleWitness([]int{1})
+	assert.Equal(t, ErrNoWitness, err)
+}
+
+func TestWitnessCalcWitnessIter(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	it := witnessCalculator.WitnessIter()
+	_, ok := it.Next()
+	assert.False(t, ok)
+	assert.Equal(t, ErrNoWitness, it.Err())
+
+	w, err := witnessCalculator.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	it = witnessCalculator.WitnessIter()
+	var values []*big.Int
+	for v, ok := it.Next(); ok; v, ok = it.Next() {
+		values = append(values, v)
+	}
+	require.Nil(t, it.Err())
+	assert.Equal(t, w.Values(), values)
+
+	// the buffer of CalculateBinWitness is built over the signals
+	_, err = witnessCalculator.CalculateBinWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	it = witnessCalculator.WitnessIter()
+	_, ok = it.Next()
+	assert.False(t, ok)
+	assert.Equal(t, ErrNoWitness, it.Err())
+}
+
+func TestWitnessCalcPostprocess(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	errTooBig := errors.New("too big")
+	for _, opts := range [][]Option{nil, {WithBatchMontgomery()}} {
+		var values []string
+		max := big.NewInt(100)
+		witnessCalculator, err := LoadWitnessCalculator(wasmBytes, append(opts, WithPostprocess(func(i int, v *big.Int) error {
+			if v.Cmp(max) > 0 {
+				return errTooBig
+			}
+			values = append(values, fmt.Sprintf("%d=%v", i, v))
+			return nil
+		}))...)
+		require.Nil(t, err)
+
+		_, err = witnessCalculator.CalculateWitness(inputs, true)
+		require.Nil(t, err)
+		assert.Equal(t, []string{"0=1", "1=33", "2=3", "3=11"}, values)
+
+		max.SetInt64(20)
+		_, err = witnessCalculator.CalculateWitness(inputs, true)
+		assert.True(t, errors.Is(err, errTooBig))
+		assert.EqualError(t, err, "witness 1: too big")
+		witnessCalculator.Close()
+	}
+}
+
+func TestWitnessCalcStrictInputs(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithStrictInputs())
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	w, err := witnessCalculator.CalculateWitness(map[string]interface{}{"a": 3, "b": uint64(11)}, true)
+	require.Nil(t, err)
+	assert.Equal(t, []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}, w.Values())
+
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{"a": 3, "b": 11.0}, true)
+	assert.EqualError(t, err, "inputs[b]: unsupported type float64")
+}
+
+func TestWitnessCalcInputSchema(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	schema := InputSchema{"a": {Kind: InputBool}, "b": {Kind: InputUint, Bits: 8}}
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithInputSchema(schema), WithStrictInputs())
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	var inputs map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(`{"a": true, "b": 11}`), &inputs))
+	w, err := witnessCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, []*big.Int{big.NewInt(1), big.NewInt(11), big.NewInt(1), big.NewInt(11)}, w.Values())
+
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{"a": false, "b": 256.0}, true)
+	assert.EqualError(t, err, "inputs[b]: uint8: 256 overflows uint8: lossy input conversion")
+	assert.True(t, errors.Is(err, ErrLossyInput))
+}
+
+func TestWitnessCalcExportDescriptor(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes)
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	b, err := witnessCalculator.ExportDescriptor()
+	require.Nil(t, err)
+	d, err := ImportDescriptor(b)
+	require.Nil(t, err)
+	hash := NewCircuitHash(wasmBytes)
+	assert.Equal(t, &CircuitDescriptor{
+		ModuleInfo: ModuleInfo{
+			Circom: 1,
+			Prime:  witnessCalculator.prime,
+			Curve:  CurveBN254,
+			NVars:  4,
+			N64:    4,
+		},
+		N32:         8,
+		ShortMax:    big.NewInt(ShortLimit),
+		ShortMin:    new(big.Int).Sub(witnessCalculator.prime, big.NewInt(ShortLimit)),
+		CircuitHash: &hash,
+	}, d)
+
+	w, err := witnessCalculator.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	assert.Nil(t, d.CheckWitness(w))
+}
+
+func TestWitnessCalcField(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes)
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	f := witnessCalculator.Field()
+	assert.Equal(t, CurveBN254.Prime(), f.Prime())
+	// c = a * b, with the inputs derived in the field of the circuit.
+	a := f.Sub(big.NewInt(0), big.NewInt(3))
+	b := big.NewInt(11)
+	w, err := witnessCalculator.CalculateWitness(map[string]interface{}{"a": a, "b": b}, true)
+	require.Nil(t, err)
+	assert.Equal(t, f.Mul(a, b), w.At(1))
+}
+
+func TestWitnessCalcParallelExtraction(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	var indices []int
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, WithParallelExtraction(4),
+		WithPostprocess(func(i int, v *big.Int) error {
+			indices = append(indices, i)
+			return nil
+		}))
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	for _, b := range []int64{11, -1} {
+		indices = nil
+		w, err := witnessCalculator.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(b)}, true)
+		require.Nil(t, err)
+		f := witnessCalculator.Field()
+		assert.Equal(t, []*big.Int{big.NewInt(1), f.Mod(big.NewInt(3 * b)), big.NewInt(3), f.Mod(big.NewInt(b))}, w.Values())
+		assert.Equal(t, []int{0, 1, 2, 3}, indices)
+	}
+	assert.Equal(t, []int32{0, 3, 1, 2}, witnessCalculator.witnessOrder)
+	// The module builds the witness buffer over its signals.
+	_, err = witnessCalculator.SampleWitness([]int{1})
+	assert.Equal(t, ErrNoWitness, err)
+
+	smtBytes, err := ioutil.ReadFile("test_files/smtverifier10.wasm")
+	require.Nil(t, err)
+	inputsBytes, err := ioutil.ReadFile("test_files/smtverifier10-input.json")
+	require.Nil(t, err)
+	inputs, err := ParseInputs(inputsBytes)
+	require.Nil(t, err)
+	smtCalculator, err := LoadWitnessCalculator(smtBytes, WithParallelExtraction(0))
+	require.Nil(t, err)
+	defer smtCalculator.Close()
+	expected, err := smtCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	// The witness of the optimized circuit isn't the first signals of the
+	// module, so it falls back to reading the values one at a time.
+	assert.Equal(t, []int32{}, smtCalculator.witnessOrder)
+	w, err := smtCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, expected.Values(), w.Values())
+}
+
+func TestWitnessCalcMissingInputs(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	inputSignals := WithInputSignals(map[string]int{"a": 1, "b": 1})
+	inputs := map[string]interface{}{"a": big.NewInt(3)}
+
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes, inputSignals)
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	_, err = witnessCalculator.CalculateWitness(inputs, true)
+	assert.True(t, errors.Is(err, ErrMissingInputs))
+	assert.EqualError(t, err, "missing inputs: b")
+
+	zeroCalculator, err := LoadWitnessCalculator(wasmBytes, inputSignals, WithMissingInputs(MissingInputsZero))
+	require.Nil(t, err)
+	defer zeroCalculator.Close()
+	w, err := zeroCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, 0, w.At(1).Sign())
+	assert.Equal(t, 0, w.At(3).Sign())
+
+	var missing []string
+	funcCalculator, err := LoadWitnessCalculator(wasmBytes, inputSignals,
+		WithMissingInputFunc(func(name string, size int) (interface{}, error) {
+			missing = append(missing, name)
+			return big.NewInt(11), nil
+		}))
+	require.Nil(t, err)
+	defer funcCalculator.Close()
+	w, err = funcCalculator.CalculateWitness(inputs, true)
+	require.Nil(t, err)
+	assert.Equal(t, []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}, w.Values())
+	assert.Equal(t, []string{"b"}, missing)
+
+	// The given inputs are not replaced.
+	missing = nil
+	_, err = funcCalculator.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestNewAutoWitnessCalculator(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	calc, err := NewAutoWitnessCalculator(wasmBytes, WithDefaultSanityCheck(true))
+	require.Nil(t, err)
+	wc, ok := calc.(*WitnessCalculator)
+	require.True(t, ok)
+	defer wc.Close()
+	assert.True(t, wc.opts.sanityCheck)
+	w, err := calc.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	assert.Equal(t, []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}, w.Values())
+
+	_, err = NewAutoWitnessCalculator([]byte("invalid"))
+	require.Error(t, err)
+}
+
+func TestWitnessCalcDebugDescribeFr(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes)
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+
+	_, err = witnessCalculator.DebugDescribeWitness(1)
+	assert.Equal(t, ErrNoWitness, err)
+	_, err = witnessCalculator.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+	d, err := witnessCalculator.DebugDescribeWitness(1)
+	require.Nil(t, err)
+	assert.Equal(t, big.NewInt(33), d.Value)
+
+	f := witnessCalculator.Field()
+	minusOne := f.Sub(big.NewInt(0), big.NewInt(1))
+	large := new(big.Int).Lsh(big.NewInt(1), 100)
+	p := witnessCalculator.allocFr()
+	require.Nil(t, witnessCalculator.setShortPositive(p, big.NewInt(5)))
+	d, err = witnessCalculator.DebugDescribeFr(p)
+	require.Nil(t, err)
+	assert.Equal(t, FrShortPositive, d.Encoding)
+	assert.Equal(t, int32(5), d.Short)
+	assert.Len(t, d.Raw, 8)
+	assert.Equal(t, big.NewInt(5), d.Value)
+	assert.Equal(t, fmt.Sprintf("short positive 5 at %d: 5", p), d.String())
+
+	require.Nil(t, witnessCalculator.setShortNegative(p, minusOne))
+	d, err = witnessCalculator.DebugDescribeFr(p)
+	require.Nil(t, err)
+	assert.Equal(t, FrShortNegative, d.Encoding)
+	assert.Equal(t, minusOne, d.Value)
+
+	require.Nil(t, witnessCalculator.setLongNormal(p, large))
+	d, err = witnessCalculator.DebugDescribeFr(p)
+	require.Nil(t, err)
+	assert.Equal(t, FrLongNormal, d.Encoding)
+	assert.Equal(t, uint32(0x80000000), d.Type)
+	assert.Len(t, d.Raw, 8+int(witnessCalculator.n32))
+	assert.Equal(t, large, d.Value)
+
+	r := new(big.Int).Lsh(big.NewInt(1), uint(8*witnessCalculator.n32))
+	require.Nil(t, witnessCalculator.setLongNormal(p, f.Mul(large, r)))
+	require.Nil(t, witnessCalculator.setInt(p+4, int32(-0x40000000)))
+	d, err = witnessCalculator.DebugDescribeFr(p)
+	require.Nil(t, err)
+	assert.Equal(t, FrLongMontgomery, d.Encoding)
+	assert.Equal(t, large, d.Value)
+}
+
+// TestWitnessCalcLowlevelFr pins the field element encoding of the
+// WitnessCalculator to the one of the lowlevel package.
+func TestWitnessCalcLowlevelFr(t *testing.T) {
+	witnessCalculator, destroy := newTestWitnessCalculator(t, "test_files/mycircuit.wasm")
+	defer destroy()
+
+	prime := witnessCalculator.prime
+	fr := lowlevel.NewFr(prime)
+	require.Equal(t, witnessCalculator.n32, fr.N8())
+	runtime := witnessCalculator.runtime
+	p := witnessCalculator.allocFr()
+	q := witnessCalculator.allocFr()
+	for _, v := range []*big.Int{
+		big.NewInt(0),
+		big.NewInt(5),
+		big.NewInt(ShortLimit - 1),
+		big.NewInt(ShortLimit),
+		new(big.Int).Sub(prime, big.NewInt(ShortLimit+1)),
+		new(big.Int).Sub(prime, big.NewInt(ShortLimit)),
+		new(big.Int).Sub(prime, big.NewInt(1)),
+		new(big.Int).Lsh(big.NewInt(1), 100),
+	} {
+		require.Nil(t, witnessCalculator.storeFr(p, v))
+		require.Nil(t, fr.Store(runtime, q, v))
+		assert.Equal(t, runtime.Memory()[p:p+fr.Size()], runtime.Memory()[q:q+fr.Size()], "%v", v)
+
+		got, err := fr.Load(runtime, p)
+		require.Nil(t, err)
+		assert.Equal(t, 0, v.Cmp(got), "%v", v)
+		got, err = witnessCalculator.loadFr(q)
+		require.Nil(t, err)
+		assert.Equal(t, 0, v.Cmp(got), "%v", v)
+	}
+
+	// long Montgomery form
+	v := new(big.Int).Lsh(big.NewInt(1), 100)
+	r := new(big.Int).Lsh(big.NewInt(1), uint(8*fr.N8()))
+	require.Nil(t, witnessCalculator.setLongNormal(p, witnessCalculator.Field().Mul(v, r)))
+	require.Nil(t, witnessCalculator.setInt(p+4, -(lowlevel.TypeLong-lowlevel.TypeMontgomery)))
+	got, err := fr.Load(runtime, p)
+	require.Nil(t, err)
+	assert.Equal(t, 0, v.Cmp(got))
+	got, err = witnessCalculator.loadFr(p)
+	require.Nil(t, err)
+	assert.Equal(t, 0, v.Cmp(got))
+}
+
+func TestConvertInputsDirToWTNS(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+	fsys := fstest.MapFS{
+		"mycircuit.wasm":   {Data: wasmBytes},
+		"inputs/1.json":    {Data: []byte(`{"a": "3", "b": "11"}`)},
+		"inputs/2.json":    {Data: []byte(`{"a": "2", "b": {"$file": "inputs/b.data"}}`)},
+		"inputs/b.data":    {Data: []byte(`"5"`)},
+		"inputs/notes.txt": {Data: []byte(`not inputs`)},
+	}
+	outDir := filepath.Join(t.TempDir(), "out")
+	paths, err := ConvertInputsDirToWTNS(fsys, "mycircuit.wasm", "inputs/*.json", outDir)
+	require.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(outDir, "1.wtns"), filepath.Join(outDir, "2.wtns")}, paths)
+	for i, expected := range [][]*big.Int{
+		{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)},
+		{big.NewInt(1), big.NewInt(10), big.NewInt(2), big.NewInt(5)},
+	} {
+		f, err := os.Open(paths[i])
+		require.Nil(t, err)
+		_, w, err := ParseWTNS(f)
+		f.Close()
+		require.Nil(t, err)
+		assert.Equal(t, expected, w)
+	}
+	// No temporary file is left behind.
+	entries, err := ioutil.ReadDir(outDir)
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, os.FileMode(0644), entries[0].Mode().Perm())
+
+	fsys["inputs/3.json"] = &fstest.MapFile{Data: []byte(`{"a": "3"`)}
+	paths, err = ConvertInputsDirToWTNS(fsys, "mycircuit.wasm", "inputs/*.json", outDir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "inputs inputs/3.json")
+	assert.Len(t, paths, 2)
+
+	// Nothing is loaded when no inputs match, not even a missing module.
+	emptyDir := filepath.Join(t.TempDir(), "empty")
+	paths, err = ConvertInputsDirToWTNS(fsys, "missing.wasm", "none/*.json", emptyDir)
+	require.Nil(t, err)
+	assert.Empty(t, paths)
+	_, err = os.Stat(emptyDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWitnessCalcABINotSupported(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/circom2/circuit.wasm")
+	require.Nil(t, err)
+	_, err = LoadWitnessCalculator(wasmBytes)
+	assert.True(t, errors.Is(err, ErrABINotSupported))
+	var abiErr *ABIError
+	require.True(t, errors.As(err, &abiErr))
+	assert.Equal(t, &ABIError{Circom: 2, Constructor: "NewCircom2WitnessCalculator"}, abiErr)
+	assert.Contains(t, err.Error(), "circom 2")
+
+	runtime := wasm3.NewRuntime(&wasm3.Config{
+		Environment: wasm3.NewEnvironment(),
+		StackSize:   64 * 1024,
+	})
+	defer runtime.Destroy()
+	module, err := runtime.ParseModule(wasmBytes)
+	require.Nil(t, err)
+	_, err = runtime.LoadModule(module)
+	require.Nil(t, err)
+	_, err = NewWitnessCalculator(runtime)
+	assert.True(t, errors.Is(err, ErrABINotSupported))
+}
+
+func TestWitnessCalcEmptyInputs(t *testing.T) {
+	wasmBytes, err := ioutil.ReadFile("test_files/mycircuit.wasm")
+	require.Nil(t, err)
+
+	witnessCalculator, err := LoadWitnessCalculator(wasmBytes)
+	require.Nil(t, err)
+	defer witnessCalculator.Close()
+	w, err := witnessCalculator.CalculateWitness(nil, true)
+	require.Nil(t, err)
+	assert.Equal(t, 0, w.At(1).Sign())
+
+	requireCalculator, err := LoadWitnessCalculator(wasmBytes, WithRequireInputs())
+	require.Nil(t, err)
+	defer requireCalculator.Close()
+	for _, inputs := range []map[string]interface{}{nil, {}} {
+		_, err = requireCalculator.CalculateWitness(inputs, true)
+		assert.Equal(t, ErrNoInputs, err)
+	}
+	_, err = requireCalculator.CalculateWitness(map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}, true)
+	require.Nil(t, err)
+
+	declaredCalculator, err := LoadWitnessCalculator(wasmBytes, WithRequireInputs(),
+		WithInputSignals(map[string]int{"a": 1, "b": 1}))
+	require.Nil(t, err)
+	defer declaredCalculator.Close()
+	_, err = declaredCalculator.CalculateWitness(map[string]interface{}{}, true)
+	assert.EqualError(t, err, "missing inputs: a, b")
+}
@@ -0,0 +1,133 @@
+// Package witnesscalctest provides a fake witnesscalc.Calculator returning
+// canned witnesses, so that applications can unit test their proving flow
+// without WASM fixtures.
+package witnesscalctest
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	witnesscalc "github.com/iden3/go-circom-witnesscalc/v2"
+)
+
+// bn254 is the prime of the scalar field of the BN254 curve, the default
+// circom field.
+var bn254, _ = new(big.Int).SetString(
+	"21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+
+// ErrNoWitness is returned by FakeCalculator for inputs without a canned
+// witness when there is no default one.
+var ErrNoWitness = errors.New("no canned witness for the inputs")
+
+// FakeCalculator is a witnesscalc.Calculator that returns the witness
+// registered for the inputs with SetWitness, or the Default one.  It records
+// the inputs of every call.  It is safe for concurrent use.
+type FakeCalculator struct {
+	// Default is returned for inputs without a canned witness, if not nil.
+	Default []*big.Int
+	// Err, if not nil, is returned by every calculation.
+	Err error
+	// N8 is the size in bytes of the field elements of binary witnesses.
+	// Defaults to 32.
+	N8 int
+	// Prime is the prime of the field of the witnesses.  Defaults to the
+	// BN254 scalar field.
+	Prime *big.Int
+
+	mu        sync.Mutex
+	witnesses map[[sha256.Size]byte][]*big.Int
+	calls     []map[string]interface{}
+}
+
+var _ witnesscalc.Calculator = (*FakeCalculator)(nil)
+
+// NewFakeCalculator creates a FakeCalculator without canned witnesses.
+func NewFakeCalculator() *FakeCalculator {
+	return &FakeCalculator{witnesses: make(map[[sha256.Size]byte][]*big.Int)}
+}
+
+// SetWitness registers the witness w to return for the inputs.  Inputs are
+// matched by value (see witnesscalc.HashInputs).
+func (f *FakeCalculator) SetWitness(inputs map[string]interface{}, w []*big.Int) error {
+	key, err := witnesscalc.HashInputs(inputs)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.witnesses[key] = w
+	return nil
+}
+
+// Calls returns the inputs of the calculations, in call order.
+func (f *FakeCalculator) Calls() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}(nil), f.calls...)
+}
+
+// CalculateWitness returns the canned witness of the inputs.
+func (f *FakeCalculator) CalculateWitness(inputs map[string]interface{}, sanityCheck bool) (*witnesscalc.Witness, error) {
+	w, err := f.calculate(inputs)
+	if err != nil {
+		return nil, err
+	}
+	prime := f.Prime
+	if prime == nil {
+		prime = bn254
+	}
+	return witnesscalc.NewWitness(w, prime), nil
+}
+
+// calculate returns a copy of the canned witness values of the inputs.
+func (f *FakeCalculator) calculate(inputs map[string]interface{}) ([]*big.Int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, inputs)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	key, err := witnesscalc.HashInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	w, ok := f.witnesses[key]
+	if !ok {
+		w = f.Default
+	}
+	if w == nil {
+		return nil, ErrNoWitness
+	}
+	res := make([]*big.Int, len(w))
+	for i, v := range w {
+		res[i] = new(big.Int).Set(v)
+	}
+	return res, nil
+}
+
+// CalculateBinWitness returns the canned witness of the inputs encoded as N8
+// bytes little-endian field elements.
+func (f *FakeCalculator) CalculateBinWitness(inputs map[string]interface{}, sanityCheck bool) ([]byte, error) {
+	w, err := f.calculate(inputs)
+	if err != nil {
+		return nil, err
+	}
+	n8 := f.N8
+	if n8 == 0 {
+		n8 = 32
+	}
+	bin := make([]byte, len(w)*n8)
+	for i, v := range w {
+		b := v.Bytes()
+		if v.Sign() < 0 || len(b) > n8 {
+			return nil, fmt.Errorf("witness value %d: %v doesn't fit in %d bytes", i, v, n8)
+		}
+		for j := range b {
+			bin[i*n8+j] = b[len(b)-1-j]
+		}
+	}
+	return bin, nil
+}
@@ -0,0 +1,39 @@
+package witnesscalctest
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeCalculator(t *testing.T) {
+	calc := NewFakeCalculator()
+	inputs := map[string]interface{}{"a": big.NewInt(3), "b": big.NewInt(11)}
+	w := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+	require.NoError(t, calc.SetWitness(inputs, w))
+
+	res, err := calc.CalculateWitness(map[string]interface{}{"b": big.NewInt(11), "a": big.NewInt(3)}, true)
+	require.NoError(t, err)
+	assert.Equal(t, w, res.Values())
+	assert.Equal(t, "21888242871839275222246405745257275088548364400416034343698204186575808495617", res.Prime().String())
+
+	bin, err := calc.CalculateBinWitness(inputs, true)
+	require.NoError(t, err)
+	require.Len(t, bin, 4*32)
+	assert.Equal(t, byte(33), bin[32])
+
+	_, err = calc.CalculateWitness(map[string]interface{}{"a": big.NewInt(1)}, true)
+	assert.Equal(t, ErrNoWitness, err)
+	calc.Default = w[:1]
+	res, err = calc.CalculateWitness(map[string]interface{}{"a": big.NewInt(1)}, true)
+	require.NoError(t, err)
+	assert.Equal(t, w[:1], res.Values())
+
+	calc.Err = errors.New("boom")
+	_, err = calc.CalculateWitness(inputs, true)
+	assert.EqualError(t, err, "boom")
+	assert.Len(t, calc.Calls(), 5)
+}
@@ -0,0 +1,96 @@
+package witnesscalc
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// WitnessIter iterates over the witness of the last calculation of a
+// calculator, reading every value from the module memory when Next returns
+// it, so that aggregates like a hash of the public outputs are computed
+// without holding the whole witness in Go memory.  The iterator reads the
+// module of its calculator, which must not run other calculations until the
+// iteration is done:
+//
+//	it := wc.WitnessIter()
+//	for v, ok := it.Next(); ok; v, ok = it.Next() {
+//		h.Write(v.Bytes())
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type WitnessIter struct {
+	n    int
+	next int
+	read func(i int) (*big.Int, error)
+	err  error
+}
+
+// newWitnessIter creates a WitnessIter over the n values returned by read,
+// calling postprocess on every value, or an iterator failing with
+// ErrNoWitness if calculated is false.
+func newWitnessIter(n int, calculated bool, read func(i int) (*big.Int, error), postprocess func(i int, v *big.Int) error) *WitnessIter {
+	it := &WitnessIter{n: n}
+	if !calculated {
+		it.err = ErrNoWitness
+		return it
+	}
+	it.read = func(i int) (*big.Int, error) {
+		v, err := read(i)
+		if err != nil {
+			return nil, err
+		}
+		if postprocess != nil {
+			if err := postprocess(i, v); err != nil {
+				return nil, fmt.Errorf("witness %d: %w", i, err)
+			}
+		}
+		return v, nil
+	}
+	return it
+}
+
+// Next returns the next value of the witness, or false when the witness is
+// exhausted or reading it failed, see Err.
+func (it *WitnessIter) Next() (*big.Int, bool) {
+	if it.err != nil || it.next >= it.n {
+		return nil, false
+	}
+	v, err := it.read(it.next)
+	if err != nil {
+		it.err = err
+		return nil, false
+	}
+	it.next++
+	return v, true
+}
+
+// Index returns the index in the witness of the next value.
+func (it *WitnessIter) Index() int {
+	return it.next
+}
+
+// Len returns the number of values of the witness.
+func (it *WitnessIter) Len() int {
+	return it.n
+}
+
+// Err returns the error that stopped the iteration, ErrNoWitness if the
+// calculator doesn't hold the witness of a successful calculation, or nil.
+func (it *WitnessIter) Err() error {
+	return it.err
+}
+
+// WitnessIter returns an iterator over the witness of the last calculation,
+// with the WithPostprocess hook applied to its values like CalculateWitness.
+func (wc *Circom2WitnessCalculator) WitnessIter() *WitnessIter {
+	return newWitnessIter(int(wc.witnessSize), wc.calculated, func(i int) (*big.Int, error) {
+		if !wc.calculated {
+			return nil, ErrNoWitness
+		}
+		if _, err := wc.getWitness(i); err != nil {
+			return nil, err
+		}
+		return wc.readSharedRWMemoryFr()
+	}, wc.opts.postprocess)
+}
@@ -0,0 +1,56 @@
+package witnesscalc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWitnessIter(t *testing.T) {
+	read := func(i int) (*big.Int, error) {
+		if i == 3 {
+			return nil, errors.New("out of memory")
+		}
+		return big.NewInt(int64(i * 10)), nil
+	}
+
+	it := newWitnessIter(3, true, read, nil)
+	assert.Equal(t, 3, it.Len())
+	var values []string
+	for v, ok := it.Next(); ok; v, ok = it.Next() {
+		values = append(values, v.String())
+	}
+	require.Nil(t, it.Err())
+	assert.Equal(t, []string{"0", "10", "20"}, values)
+	assert.Equal(t, 3, it.Index())
+	_, ok := it.Next()
+	assert.False(t, ok)
+
+	it = newWitnessIter(5, true, read, nil)
+	n := 0
+	for _, ok := it.Next(); ok; _, ok = it.Next() {
+		n++
+	}
+	assert.Equal(t, 3, n)
+	assert.EqualError(t, it.Err(), "out of memory")
+
+	it = newWitnessIter(3, true, read, func(i int, v *big.Int) error {
+		if i == 1 {
+			return errors.New("not a bit")
+		}
+		return nil
+	})
+	it.Next()
+	_, ok = it.Next()
+	assert.False(t, ok)
+	assert.EqualError(t, it.Err(), "witness 1: not a bit")
+	assert.Equal(t, 1, it.Index())
+
+	it = newWitnessIter(3, false, read, nil)
+	_, ok = it.Next()
+	assert.False(t, ok)
+	assert.Equal(t, ErrNoWitness, it.Err())
+}
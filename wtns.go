@@ -0,0 +1,295 @@
+package witnesscalc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+)
+
+// wtns section types
+const (
+	wtnsSectionHeader  = 1
+	wtnsSectionWitness = 2
+	// wtnsSectionCircuitHash holds the CircuitHash of the module that
+	// calculated the witness, written with WithCircuitHashInWTNS.  snarkjs
+	// skips the sections it doesn't know.
+	wtnsSectionCircuitHash = 100
+)
+
+// wtnsVersion is the version of the wtns files written by the calculators.
+const wtnsVersion = 2
+
+// WTNSHeader is the header of a snarkjs wtns file.
+type WTNSHeader struct {
+	// N8 is the size in bytes of a field element.
+	N8       uint32
+	Prime    *big.Int
+	NWitness uint32
+	// CircuitHash is the hash of the module that calculated the witness, nil
+	// if the file doesn't have it.
+	CircuitHash *CircuitHash
+}
+
+// writeWTNSHeader writes the start of a version 2 wtns file holding nWitness
+// field elements of n8 bytes: the file header, the header section and the
+// header of the witness section, whose elements the caller writes next.  The
+// circuit hash section is written before the witness section when circuitHash
+// isn't nil.
+func writeWTNSHeader(w io.Writer, prime *big.Int, n8, nWitness int, circuitHash *CircuitHash) error {
+	primeBytes := prime.Bytes()
+	if len(primeBytes) > n8 {
+		return fmt.Errorf("prime doesn't fit in %d bytes", n8)
+	}
+	primeLE := make([]byte, n8)
+	copy(primeLE, swap(primeBytes))
+
+	nSections := uint32(2)
+	if circuitHash != nil {
+		nSections++
+	}
+	fields := []interface{}{
+		uint32(wtnsVersion),
+		nSections,
+		uint32(wtnsSectionHeader), uint64(4 + n8 + 4),
+		uint32(n8), primeLE, uint32(nWitness),
+	}
+	if circuitHash != nil {
+		fields = append(fields,
+			uint32(wtnsSectionCircuitHash), uint64(len(circuitHash)),
+			circuitHash[:])
+	}
+	fields = append(fields, uint32(wtnsSectionWitness), uint64(n8*nWitness))
+
+	var buff bytes.Buffer
+	buff.WriteString("wtns")
+	for _, v := range fields {
+		_ = binary.Write(&buff, binary.LittleEndian, v)
+	}
+	_, err := w.Write(buff.Bytes())
+	return err
+}
+
+// readWTNSHeader reads the content of the wtns header section of the given
+// size.
+func readWTNSHeader(r io.Reader, size uint64) (*WTNSHeader, error) {
+	var h WTNSHeader
+	if err := binary.Read(r, binary.LittleEndian, &h.N8); err != nil {
+		return nil, err
+	}
+	if h.N8 == 0 || h.N8%8 != 0 {
+		return nil, fmt.Errorf("invalid field size %d", h.N8)
+	}
+	if size != uint64(4+h.N8+4) {
+		return nil, fmt.Errorf("wtns header section has %d bytes, expected %d", size, 4+h.N8+4)
+	}
+	primeBytes := make([]byte, h.N8)
+	if _, err := io.ReadFull(r, primeBytes); err != nil {
+		return nil, err
+	}
+	h.Prime = new(big.Int).SetBytes(swap(primeBytes))
+	if err := binary.Read(r, binary.LittleEndian, &h.NWitness); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// readWTNSWitness reads the witness section described by h, checking that
+// every value is a field element, and passes the values to f.
+func readWTNSWitness(r io.Reader, h *WTNSHeader, f func(v *big.Int)) error {
+	elem := make([]byte, h.N8)
+	for i := uint32(0); i < h.NWitness; i++ {
+		if _, err := io.ReadFull(r, elem); err != nil {
+			return fmt.Errorf("witness[%d]: %w", i, err)
+		}
+		v := new(big.Int).SetBytes(swap(elem))
+		if v.Cmp(h.Prime) >= 0 {
+			return fmt.Errorf("witness[%d] = %v is not a field element", i, v)
+		}
+		f(v)
+	}
+	return nil
+}
+
+// readWTNS reads a version 2 wtns file from r, checking its layout, and
+// passes the witness values to f.
+func readWTNS(r io.Reader, f func(v *big.Int)) (*WTNSHeader, error) {
+	nSections, err := readBinFileHeader(r, "wtns", wtnsVersion)
+	if err != nil {
+		return nil, err
+	}
+	var h *WTNSHeader
+	var circuitHash *CircuitHash
+	witnessFound := false
+	for i := uint32(0); i < nSections; i++ {
+		sectionType, size, err := readSectionHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		switch sectionType {
+		case wtnsSectionHeader:
+			if h != nil {
+				return nil, fmt.Errorf("duplicated wtns header section")
+			}
+			if h, err = readWTNSHeader(r, size); err != nil {
+				return nil, err
+			}
+		case wtnsSectionWitness:
+			if h == nil {
+				return nil, fmt.Errorf("wtns witness section before the header section")
+			}
+			if witnessFound {
+				return nil, fmt.Errorf("duplicated wtns witness section")
+			}
+			if expected := uint64(h.N8) * uint64(h.NWitness); size != expected {
+				return nil, fmt.Errorf("wtns witness section has %d bytes, expected %d", size, expected)
+			}
+			if err := readWTNSWitness(r, h, f); err != nil {
+				return nil, err
+			}
+			witnessFound = true
+		case wtnsSectionCircuitHash:
+			if circuitHash != nil {
+				return nil, fmt.Errorf("duplicated wtns circuit hash section")
+			}
+			circuitHash = new(CircuitHash)
+			if size != uint64(len(circuitHash)) {
+				return nil, fmt.Errorf("wtns circuit hash section has %d bytes, expected %d", size, len(circuitHash))
+			}
+			if _, err := io.ReadFull(r, circuitHash[:]); err != nil {
+				return nil, err
+			}
+		default:
+			if _, err := io.CopyN(ioutil.Discard, r, int64(size)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if h == nil {
+		return nil, fmt.Errorf("wtns header section not found")
+	}
+	if !witnessFound {
+		return nil, fmt.Errorf("wtns witness section not found")
+	}
+	h.CircuitHash = circuitHash
+	return h, nil
+}
+
+// VerifyWTNS reads a version 2 wtns file from r and checks its layout: the
+// header and witness sections are present, have the sizes given by the field
+// element size and the number of witness values, and every witness value is
+// lower than the prime.  It returns the header of the file.
+func VerifyWTNS(r io.Reader) (*WTNSHeader, error) {
+	return readWTNS(r, func(*big.Int) {})
+}
+
+// ParseWTNS reads a version 2 wtns file from r, checking its layout like
+// VerifyWTNS, and returns the prime of the field and the witness.
+func ParseWTNS(r io.Reader) (*big.Int, []*big.Int, error) {
+	var w []*big.Int
+	h, err := readWTNS(r, func(v *big.Int) {
+		w = append(w, v)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.Prime, w, nil
+}
+
+// WTNSDiff is a witness value that differs between two wtns files, see
+// CompareWTNS.
+type WTNSDiff struct {
+	Index int
+	// A and B are the values of the files, nil for the file whose witness
+	// doesn't have Index.
+	A, B *big.Int
+}
+
+// String returns the index and the values, e.g. "witness[3]: 11 != 12".
+func (d WTNSDiff) String() string {
+	value := func(v *big.Int) string {
+		if v == nil {
+			return "missing"
+		}
+		return v.String()
+	}
+	return fmt.Sprintf("witness[%d]: %s != %s", d.Index, value(d.A), value(d.B))
+}
+
+// CompareWTNS parses the wtns files a and b like ParseWTNS and returns the
+// witness values that differ, in index order, with the values past the end
+// of the shorter witness reported as missing.  Files of different fields
+// return an error.  It validates the witnesses of the calculators against the
+// ones of snarkjs, or of another build of the circuit, file by file.
+func CompareWTNS(a, b io.Reader) ([]WTNSDiff, error) {
+	primeA, wA, err := ParseWTNS(a)
+	if err != nil {
+		return nil, fmt.Errorf("first wtns: %w", err)
+	}
+	primeB, wB, err := ParseWTNS(b)
+	if err != nil {
+		return nil, fmt.Errorf("second wtns: %w", err)
+	}
+	if primeA.Cmp(primeB) != 0 {
+		return nil, fmt.Errorf("wtns of different fields: %v and %v", primeA, primeB)
+	}
+	var diffs []WTNSDiff
+	for i := 0; i < len(wA) || i < len(wB); i++ {
+		var d WTNSDiff
+		if i < len(wA) {
+			d.A = wA[i]
+		}
+		if i < len(wB) {
+			d.B = wB[i]
+		}
+		if d.A == nil || d.B == nil || d.A.Cmp(d.B) != 0 {
+			d.Index = i
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, nil
+}
+
+// WriteWTNS writes the witness w of the field of the given prime to out as a
+// version 2 wtns file, with field elements of the size of the prime rounded up
+// to 64 bits.
+func WriteWTNS(out io.Writer, w []*big.Int, prime *big.Int) error {
+	return writeWTNS(out, w, prime, nil)
+}
+
+// writeWTNS is WriteWTNS with the circuit hash section when circuitHash isn't
+// nil.
+func writeWTNS(out io.Writer, w []*big.Int, prime *big.Int, circuitHash *CircuitHash) error {
+	n8 := primeN8(prime)
+	bw := bufio.NewWriter(out)
+	if err := writeWTNSHeader(bw, prime, n8, len(w), circuitHash); err != nil {
+		return err
+	}
+	if err := checkFieldElems(w, prime); err != nil {
+		return err
+	}
+	if err := writeElems(bw, w, n8); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// primeN8 returns the size in bytes of the field elements of the prime in the
+// binary encodings, the size of the prime rounded up to 64 bits.
+func primeN8(prime *big.Int) int {
+	return ((prime.BitLen()-1)/64 + 1) * 8
+}
+
+// checkFieldElems checks that every value of the witness w is an element of
+// the field of the prime.
+func checkFieldElems(w []*big.Int, prime *big.Int) error {
+	for i, v := range w {
+		if v == nil || v.Sign() < 0 || v.Cmp(prime) >= 0 {
+			return fmt.Errorf("witness[%d] = %v is not a field element", i, v)
+		}
+	}
+	return nil
+}
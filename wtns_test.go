@@ -0,0 +1,111 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bn254 is the prime of the scalar field of the BN254 curve.
+var bn254, _ = new(big.Int).SetString(
+	"21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+
+func TestVerifyWTNS(t *testing.T) {
+	// mycircuit-witness.wtns holds the witness of mycircuit-input1.json in the
+	// layout written by snarkjs.
+	wtnsBytes, err := ioutil.ReadFile("test_files/mycircuit-witness.wtns")
+	require.Nil(t, err)
+	h, err := VerifyWTNS(bytes.NewReader(wtnsBytes))
+	require.Nil(t, err)
+	assert.Equal(t, &WTNSHeader{N8: 32, Prime: bn254, NWitness: 4}, h)
+
+	var buff bytes.Buffer
+	require.Nil(t, writeWTNSHeader(&buff, bn254, 32, 4, nil))
+	for _, v := range []int64{1, 33, 3, 11} {
+		elem := make([]byte, 32)
+		binary.LittleEndian.PutUint64(elem, uint64(v))
+		buff.Write(elem)
+	}
+	assert.Equal(t, wtnsBytes, buff.Bytes())
+
+	prime, w, err := ParseWTNS(bytes.NewReader(wtnsBytes))
+	require.Nil(t, err)
+	assert.Equal(t, bn254, prime)
+	expected := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+	assert.Equal(t, expected, w)
+	buff.Reset()
+	require.Nil(t, WriteWTNS(&buff, w, prime))
+	assert.Equal(t, wtnsBytes, buff.Bytes())
+	assert.Error(t, WriteWTNS(&buff, []*big.Int{bn254}, bn254))
+
+	corrupt := func(offset int, b ...byte) []byte {
+		c := append([]byte{}, wtnsBytes...)
+		copy(c[offset:], b)
+		return c
+	}
+	for name, b := range map[string][]byte{
+		"magic":           corrupt(0, 'r'),
+		"version":         corrupt(4, 1),
+		"field size":      corrupt(24, 31),
+		"header size":     corrupt(16, 41),
+		"witness size":    corrupt(68, 0x7f),
+		"truncated":       wtnsBytes[:len(wtnsBytes)-1],
+		"field element":   corrupt(len(wtnsBytes)-32, swap(bn254.Bytes())...),
+		"missing witness": corrupt(8, 1),
+	} {
+		_, err := VerifyWTNS(bytes.NewReader(b))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestWTNSCircuitHash(t *testing.T) {
+	w := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}
+	h := NewCircuitHash([]byte("circuit"))
+	var buff bytes.Buffer
+	require.Nil(t, writeWTNS(&buff, w, bn254, &h))
+	wtnsBytes := buff.Bytes()
+
+	header, err := VerifyWTNS(bytes.NewReader(wtnsBytes))
+	require.Nil(t, err)
+	assert.Equal(t, &WTNSHeader{N8: 32, Prime: bn254, NWitness: 4, CircuitHash: &h}, header)
+	prime, parsed, err := ParseWTNS(bytes.NewReader(wtnsBytes))
+	require.Nil(t, err)
+	assert.Equal(t, bn254, prime)
+	assert.Equal(t, w, parsed)
+
+	// The size of the circuit hash section follows the file header, the
+	// header section and its type.
+	badSize := append([]byte{}, wtnsBytes...)
+	badSize[68] = 31
+	_, err = VerifyWTNS(bytes.NewReader(badSize))
+	assert.Error(t, err)
+}
+
+func TestCompareWTNS(t *testing.T) {
+	wtnsBytes, err := ioutil.ReadFile("test_files/mycircuit-witness.wtns")
+	require.Nil(t, err)
+	diffs, err := CompareWTNS(bytes.NewReader(wtnsBytes), bytes.NewReader(wtnsBytes))
+	require.Nil(t, err)
+	assert.Empty(t, diffs)
+
+	var buff bytes.Buffer
+	w := []*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(4), big.NewInt(11), big.NewInt(0)}
+	require.Nil(t, WriteWTNS(&buff, w, bn254))
+	diffs, err = CompareWTNS(bytes.NewReader(wtnsBytes), bytes.NewReader(buff.Bytes()))
+	require.Nil(t, err)
+	require.Len(t, diffs, 2)
+	assert.Equal(t, "witness[2]: 3 != 4", diffs[0].String())
+	assert.Equal(t, "witness[4]: missing != 0", diffs[1].String())
+
+	buff.Reset()
+	require.Nil(t, WriteWTNS(&buff, w[:1], big.NewInt(7)))
+	_, err = CompareWTNS(bytes.NewReader(wtnsBytes), bytes.NewReader(buff.Bytes()))
+	assert.Error(t, err)
+	_, err = CompareWTNS(bytes.NewReader(wtnsBytes), bytes.NewReader(wtnsBytes[:10]))
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// zkey section types
+const (
+	zkeySectionHeader         = 1
+	zkeySectionProtocolHeader = 2
+)
+
+// ZKeyProtocol is the proving system of a snarkjs zkey file.
+type ZKeyProtocol uint32
+
+// The protocols of the snarkjs zkey files.
+const (
+	ZKeyGroth16 ZKeyProtocol = 1
+	ZKeyPlonk   ZKeyProtocol = 2
+	ZKeyFflonk  ZKeyProtocol = 10
+)
+
+// String returns the name of the protocol used by snarkjs.
+func (p ZKeyProtocol) String() string {
+	switch p {
+	case ZKeyGroth16:
+		return "groth16"
+	case ZKeyPlonk:
+		return "plonk"
+	case ZKeyFflonk:
+		return "fflonk"
+	}
+	return fmt.Sprintf("protocol %d", uint32(p))
+}
+
+// ZKeyHeader is the header of a snarkjs zkey file, describing the witness its
+// prover expects.
+type ZKeyHeader struct {
+	Protocol ZKeyProtocol
+	// N8q and Q are the size in bytes and the prime of the base field.
+	N8q uint32
+	Q   *big.Int
+	// N8r and R are the size in bytes and the prime of the scalar field, the
+	// field of the witness.
+	N8r uint32
+	R   *big.Int
+	// NVars is the number of variables, which for PLONK and fflonk includes
+	// the NAdditions variables the prover computes from the witness.
+	NVars      uint32
+	NPublic    uint32
+	DomainSize uint32
+	// NAdditions and NConstraints are only set for PLONK and fflonk.
+	NAdditions   uint32
+	NConstraints uint32
+}
+
+// NWitness returns the number of values of the witnesses of the zkey.
+func (h *ZKeyHeader) NWitness() int {
+	return int(h.NVars) - int(h.NAdditions)
+}
+
+// CheckWitness checks that w is a witness of the zkey, like the snarkjs
+// provers: it must be of the field of the zkey and have NWitness values.
+func (h *ZKeyHeader) CheckWitness(w *Witness) error {
+	if w.Prime() == nil || w.Prime().Cmp(h.R) != 0 {
+		return fmt.Errorf("witness field %v doesn't match the %s zkey field %v", w.Prime(), h.Protocol, h.R)
+	}
+	if w.Len() != h.NWitness() {
+		return fmt.Errorf("witness has %d values, the %s zkey expects %d", w.Len(), h.Protocol, h.NWitness())
+	}
+	if w.Len() < 1+int(h.NPublic) {
+		return fmt.Errorf("witness has %d values, the zkey has %d public signals", w.Len(), h.NPublic)
+	}
+	return nil
+}
+
+// ReadZKeyHeader reads the header of a snarkjs zkey file of any protocol.
+// Sections preceding the headers are skipped; r is not read past them.
+func ReadZKeyHeader(r io.Reader) (*ZKeyHeader, error) {
+	nSections, err := readBinFileHeader(r, "zkey", 1)
+	if err != nil {
+		return nil, err
+	}
+	var h *ZKeyHeader
+	for i := uint32(0); i < nSections; i++ {
+		sectionType, size, err := readSectionHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case sectionType == zkeySectionHeader:
+			var protocol uint32
+			if size != 4 {
+				return nil, fmt.Errorf("zkey header section has %d bytes, expected 4", size)
+			}
+			if err := binary.Read(r, binary.LittleEndian, &protocol); err != nil {
+				return nil, err
+			}
+			h = &ZKeyHeader{Protocol: ZKeyProtocol(protocol)}
+		case sectionType == zkeySectionProtocolHeader && h != nil:
+			section, err := readSection(r, size)
+			if err != nil {
+				return nil, err
+			}
+			if err := parseZKeyProtocolHeader(h, section); err != nil {
+				return nil, fmt.Errorf("zkey %s header: %w", h.Protocol, err)
+			}
+			return h, nil
+		case sectionType == zkeySectionProtocolHeader:
+			return nil, fmt.Errorf("zkey protocol header section found before the header section")
+		default:
+			if err := skipSection(r, size); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("zkey header section not found")
+}
+
+// parseZKeyProtocolHeader parses the fields of the protocol header section
+// common to the protocols into h.
+func parseZKeyProtocolHeader(h *ZKeyHeader, section []byte) error {
+	switch h.Protocol {
+	case ZKeyGroth16, ZKeyPlonk, ZKeyFflonk:
+	default:
+		return fmt.Errorf("unsupported protocol")
+	}
+	r := bytes.NewReader(section)
+	readPrime := func(n8 *uint32) (*big.Int, error) {
+		if err := binary.Read(r, binary.LittleEndian, n8); err != nil {
+			return nil, err
+		}
+		if *n8 == 0 || *n8%8 != 0 {
+			return nil, fmt.Errorf("invalid field size %d", *n8)
+		}
+		if int64(*n8) > int64(r.Len()) {
+			return nil, fmt.Errorf("field size %d exceeds the section", *n8)
+		}
+		b := make([]byte, *n8)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(swap(b)), nil
+	}
+	var err error
+	if h.Q, err = readPrime(&h.N8q); err != nil {
+		return err
+	}
+	if h.R, err = readPrime(&h.N8r); err != nil {
+		return err
+	}
+	fields := []*uint32{&h.NVars, &h.NPublic, &h.DomainSize}
+	if h.Protocol != ZKeyGroth16 {
+		fields = append(fields, &h.NAdditions, &h.NConstraints)
+	}
+	for _, v := range fields {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	if h.NAdditions > h.NVars {
+		return fmt.Errorf("%d additions for %d variables", h.NAdditions, h.NVars)
+	}
+	return nil
+}
+
+// ToZKeyWTNS encodes the witness in the wtns format like ToWTNS, checking
+// first that it is a witness of the zkey (see ZKeyHeader.CheckWitness), so
+// that PLONK and fflonk witnesses are validated against the number of
+// variables of the zkey without the additions, which snarkjs only reports
+// when proving.  It also returns the public signals of the proof, the
+// NPublic values that follow the constant 1.
+func (w *Witness) ToZKeyWTNS(h *ZKeyHeader) (wtns []byte, publicSignals []*big.Int, err error) {
+	if err := h.CheckWitness(w); err != nil {
+		return nil, nil, err
+	}
+	wtns, err = w.ToWTNS()
+	if err != nil {
+		return nil, nil, err
+	}
+	return wtns, w.Public(int(h.NPublic)), nil
+}
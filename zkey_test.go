@@ -0,0 +1,101 @@
+package witnesscalc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testZKey returns a zkey file with the headers of a circuit of the BN254
+// scalar field, preceded by an unrelated section.
+func testZKey(protocol ZKeyProtocol, nVars, nPublic, nAdditions uint32) []byte {
+	var section bytes.Buffer
+	for _, p := range []*big.Int{bn254, bn254} {
+		_ = binary.Write(&section, binary.LittleEndian, uint32(32))
+		section.Write(swap(p.FillBytes(make([]byte, 32))))
+	}
+	fields := []uint32{nVars, nPublic, 8}
+	if protocol != ZKeyGroth16 {
+		fields = append(fields, nAdditions, 5)
+	}
+	_ = binary.Write(&section, binary.LittleEndian, fields)
+	// The points that follow the common fields.
+	section.Write(make([]byte, 64))
+
+	var buf bytes.Buffer
+	buf.WriteString("zkey")
+	_ = binary.Write(&buf, binary.LittleEndian, []uint32{1, 3})
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(10))
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(3))
+	buf.Write([]byte{1, 2, 3})
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(zkeySectionHeader))
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(4))
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(protocol))
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(zkeySectionProtocolHeader))
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(section.Len()))
+	buf.Write(section.Bytes())
+	return buf.Bytes()
+}
+
+func TestReadZKeyHeader(t *testing.T) {
+	h, err := ReadZKeyHeader(bytes.NewReader(testZKey(ZKeyPlonk, 6, 1, 2)))
+	require.Nil(t, err)
+	assert.Equal(t, &ZKeyHeader{Protocol: ZKeyPlonk, N8q: 32, Q: bn254, N8r: 32, R: bn254,
+		NVars: 6, NPublic: 1, DomainSize: 8, NAdditions: 2, NConstraints: 5}, h)
+	assert.Equal(t, 4, h.NWitness())
+
+	h, err = ReadZKeyHeader(bytes.NewReader(testZKey(ZKeyGroth16, 4, 1, 0)))
+	require.Nil(t, err)
+	assert.Equal(t, ZKeyGroth16, h.Protocol)
+	assert.Equal(t, 4, h.NWitness())
+
+	_, err = ReadZKeyHeader(bytes.NewReader(testZKey(3, 4, 1, 0)))
+	assert.EqualError(t, err, "zkey protocol 3 header: unsupported protocol")
+	_, err = ReadZKeyHeader(bytes.NewReader(testZKey(ZKeyFflonk, 4, 1, 5)))
+	assert.EqualError(t, err, "zkey fflonk header: 5 additions for 4 variables")
+	// A corrupted section size fails without allocating it.
+	zkey := testZKey(ZKeyPlonk, 6, 1, 2)
+	// the file header, the unrelated section, the header section and the
+	// protocol header type
+	binary.LittleEndian.PutUint64(zkey[12+15+16+4:], 1<<40)
+	_, err = ReadZKeyHeader(bytes.NewReader(zkey))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	// So do the sizes of the skipped sections and of the field elements.
+	zkey = testZKey(ZKeyPlonk, 6, 1, 2)
+	binary.LittleEndian.PutUint64(zkey[12+4:], math.MaxUint64)
+	_, err = ReadZKeyHeader(bytes.NewReader(zkey))
+	assert.EqualError(t, err, "invalid section size 18446744073709551615")
+	zkey = testZKey(ZKeyPlonk, 6, 1, 2)
+	binary.LittleEndian.PutUint32(zkey[12+15+16+12:], 0xfffffff8)
+	_, err = ReadZKeyHeader(bytes.NewReader(zkey))
+	assert.EqualError(t, err, "zkey plonk header: field size 4294967288 exceeds the section")
+	_, err = ReadZKeyHeader(bytes.NewReader([]byte("wtns")))
+	assert.Error(t, err)
+}
+
+func TestWitnessToZKeyWTNS(t *testing.T) {
+	w := NewWitness([]*big.Int{big.NewInt(1), big.NewInt(33), big.NewInt(3), big.NewInt(11)}, bn254)
+	h, err := ReadZKeyHeader(bytes.NewReader(testZKey(ZKeyPlonk, 6, 1, 2)))
+	require.Nil(t, err)
+	wtns, public, err := w.ToZKeyWTNS(h)
+	require.Nil(t, err)
+	expected, err := w.ToWTNS()
+	require.Nil(t, err)
+	assert.Equal(t, expected, wtns)
+	assert.Equal(t, []*big.Int{big.NewInt(33)}, public)
+
+	// Without the additions, the witness is too short for the zkey.
+	h.NAdditions = 0
+	_, _, err = w.ToZKeyWTNS(h)
+	assert.EqualError(t, err, "witness has 4 values, the plonk zkey expects 6")
+
+	h.NAdditions, h.R = 2, big.NewInt(101)
+	_, _, err = w.ToZKeyWTNS(h)
+	assert.Error(t, err)
+}